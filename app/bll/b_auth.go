@@ -0,0 +1,294 @@
+package bll
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"moddns/app/logger"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/ldap"
+	"moddns/app/util"
+
+	"github.com/spf13/viper"
+)
+
+// 认证方式
+const (
+	AuthProviderLocal = "local" // 本地用户
+	AuthProviderLDAP  = "ldap"  // LDAP
+)
+
+type (
+	// AuthOption 认证链的配置项
+	AuthOption func(*authOptions)
+
+	authOptions struct {
+		providers     []string            // 认证方式(按顺序尝试)
+		ldap          *ldap.Authenticator // LDAP认证
+		autoProvision bool                // LDAP用户首次登录时是否自动创建本地用户
+		defaultRole   string              // 自动创建的用户未匹配到角色时分配的角色名称
+		groupRoles    map[string][]string // LDAP组(小写)与角色名称的映射
+	}
+)
+
+// SetAuthProviders 设置认证方式(按顺序尝试，用户不存在时尝试下一个)
+func SetAuthProviders(providers ...string) AuthOption {
+	return func(o *authOptions) {
+		o.providers = providers
+	}
+}
+
+// SetLDAP 设置LDAP认证
+func SetLDAP(auth *ldap.Authenticator) AuthOption {
+	return func(o *authOptions) {
+		o.ldap = auth
+	}
+}
+
+// SetLDAPProvision 设置LDAP用户首次登录时是否自动创建本地用户及默认角色
+func SetLDAPProvision(autoProvision bool, defaultRole string) AuthOption {
+	return func(o *authOptions) {
+		o.autoProvision = autoProvision
+		o.defaultRole = defaultRole
+	}
+}
+
+// SetLDAPGroupRole 添加LDAP组(DN或名称)与角色名称的映射，配置后每次登录时同步用户的角色
+func SetLDAPGroupRole(group, role string) AuthOption {
+	return func(o *authOptions) {
+		if o.groupRoles == nil {
+			o.groupRoles = make(map[string][]string)
+		}
+		group = strings.ToLower(group)
+		o.groupRoles[group] = append(o.groupRoles[group], role)
+	}
+}
+
+// NewAuth 创建认证链
+func NewAuth(opts ...AuthOption) *Auth {
+	o := &authOptions{
+		providers: []string{AuthProviderLocal},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Auth{opts: o}
+}
+
+// Auth 认证链：按配置的认证方式依次认证用户(不包含超级用户)，
+// 未配置时(如未注入)仅使用本地用户认证
+type Auth struct {
+	UserModel models.IUser `inject:"IUser"`
+	RoleModel models.IRole `inject:"IRole"`
+	UserBll   *User        `inject:""`
+	opts      *authOptions
+}
+
+// Authenticate 认证用户，plain表示密码为明文(否则为md5值，LDAP认证需要明文密码)；
+// 用户在当前认证方式中不存在时尝试下一个，全部不存在时返回ErrInvalidUserName
+func (a *Auth) Authenticate(ctx context.Context, userName, password string, plain bool) (*schema.User, error) {
+	providers := []string{AuthProviderLocal}
+	if a.opts != nil {
+		providers = a.opts.providers
+	}
+
+	for _, provider := range providers {
+		var (
+			user *schema.User
+			err  error
+		)
+		switch provider {
+		case AuthProviderLocal:
+			user, err = a.authLocal(ctx, userName, password, plain)
+		case AuthProviderLDAP:
+			user, err = a.authLDAP(ctx, userName, password, plain)
+		default:
+			continue
+		}
+
+		if err == ErrInvalidUserName {
+			continue
+		}
+		return user, err
+	}
+	return nil, ErrInvalidUserName
+}
+
+// authLocal 本地用户认证(LDAP用户不使用本地密码)
+func (a *Auth) authLocal(ctx context.Context, userName, password string, plain bool) (*schema.User, error) {
+	if plain {
+		password = util.MD5HashString(password)
+	}
+
+	user, err := a.UserModel.GetByUserName(ctx, userName, false)
+	if err != nil {
+		return nil, err
+	} else if user == nil || user.Source != schema.UserSourceLocal {
+		return nil, ErrInvalidUserName
+	} else if user.Status != 1 {
+		return nil, ErrUserDisable
+	} else if user.Password != util.SHA1HashString(password) {
+		return nil, ErrInvalidPassword
+	}
+
+	return user, nil
+}
+
+// authLDAP LDAP认证，通过后获取(或创建)对应的本地用户并同步角色
+func (a *Auth) authLDAP(ctx context.Context, userName, password string, plain bool) (*schema.User, error) {
+	if a.opts.ldap == nil || !plain {
+		return nil, ErrInvalidUserName
+	}
+	if rootUser := viper.GetStringSlice("system_root_user"); len(rootUser) == 2 && rootUser[0] == userName {
+		// 超级用户的密码错误时不尝试LDAP认证，也不创建同名的本地用户
+		logger.LoginWithContext(ctx).Warnf("LDAP用户[%s]与超级用户重名", userName)
+		return nil, ErrInvalidUserName
+	}
+
+	info, err := a.opts.ldap.Authenticate(ctx, userName, password)
+	switch err {
+	case nil:
+	case ldap.ErrUserNotFound:
+		return nil, ErrInvalidUserName
+	case ldap.ErrInvalidCredentials:
+		return nil, ErrInvalidPassword
+	default:
+		return nil, err
+	}
+
+	user, err := a.UserModel.GetByUserName(ctx, userName, true)
+	if err != nil {
+		return nil, err
+	} else if user == nil {
+		if !a.opts.autoProvision {
+			logger.LoginWithContext(ctx).Warnf("LDAP用户[%s]未开通本地用户", userName)
+			return nil, ErrInvalidUserName
+		}
+		return a.provision(ctx, info)
+	} else if user.Source != schema.UserSourceLDAP {
+		// 不允许LDAP用户登录同名的本地用户
+		logger.LoginWithContext(ctx).Warnf("LDAP用户[%s]与本地用户重名", userName)
+		return nil, ErrInvalidUserName
+	} else if user.Status != 1 {
+		return nil, ErrUserDisable
+	}
+
+	if err := a.syncRoles(ctx, user, info); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// realName 获取LDAP用户的真实姓名(为空时使用用户名)
+func realName(info *ldap.UserInfo) string {
+	if info.RealName != "" {
+		return info.RealName
+	}
+	return info.UserName
+}
+
+// provision 为首次登录的LDAP用户创建本地用户
+func (a *Auth) provision(ctx context.Context, info *ldap.UserInfo) (*schema.User, error) {
+	roleIDs, err := a.mapRoles(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &schema.User{
+		UserName: info.UserName,
+		RealName: realName(info),
+		Source:   schema.UserSourceLDAP,
+		Status:   1,
+		RoleIDs:  roleIDs,
+	}
+	if err := a.UserBll.Create(ctx, item); err != nil {
+		return nil, err
+	}
+	logger.LoginWithContext(ctx).Infof("已为LDAP用户[%s]创建本地用户", info.UserName)
+
+	return item, nil
+}
+
+// syncRoles 按LDAP组同步用户的角色及真实姓名(未配置组与角色的映射时不同步)
+func (a *Auth) syncRoles(ctx context.Context, user *schema.User, info *ldap.UserInfo) error {
+	if len(a.opts.groupRoles) == 0 {
+		return nil
+	}
+
+	roleIDs, err := a.mapRoles(ctx, info)
+	if err != nil {
+		return err
+	}
+	return syncUser(ctx, a.UserBll, user, realName(info), roleIDs)
+}
+
+// mapRoles 根据LDAP组映射启用的角色，未匹配到角色时使用默认角色
+func (a *Auth) mapRoles(ctx context.Context, info *ldap.UserInfo) ([]string, error) {
+	names := make(map[string]bool)
+	for _, group := range info.Groups {
+		for _, name := range a.opts.groupRoles[strings.ToLower(group)] {
+			names[name] = true
+		}
+	}
+	if len(names) == 0 && a.opts.defaultRole != "" {
+		names[a.opts.defaultRole] = true
+	}
+	return resolveRoles(ctx, a.RoleModel, names, "LDAP组")
+}
+
+// resolveRoles 将映射的角色名称转换为启用的角色ID(排序)，from为映射来源(用于日志)
+func resolveRoles(ctx context.Context, roleModel models.IRole, names map[string]bool, from string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{}, nil
+	}
+
+	roles, err := roleModel.QuerySelect(ctx, schema.RoleSelectQueryParam{Status: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDs := []string{}
+	for _, role := range roles {
+		if names[role.Name] {
+			roleIDs = append(roleIDs, role.RecordID)
+			delete(names, role.Name)
+		}
+	}
+	for name := range names {
+		logger.LoginWithContext(ctx).Warnf("%s映射的角色[%s]不存在或已停用", from, name)
+	}
+
+	sort.Strings(roleIDs)
+	return roleIDs, nil
+}
+
+// syncUser 同步外部认证用户的真实姓名及角色(未变化时不更新)
+func syncUser(ctx context.Context, userBll *User, user *schema.User, name string, roleIDs []string) error {
+	if name == user.RealName && equalStrings(roleIDs, user.RoleIDs) {
+		return nil
+	}
+
+	item := *user
+	item.Password = ""
+	item.RealName = name
+	item.RoleIDs = roleIDs
+	if err := userBll.Update(ctx, user.RecordID, &item); err != nil {
+		return err
+	}
+
+	user.RealName = name
+	user.RoleIDs = roleIDs
+	return nil
+}
+
+// equalStrings 检查两个列表的元素是否相同(忽略顺序)
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	added, removed := util.DiffStrings(a, b)
+	return len(added) == 0 && len(removed) == 0
+}
@@ -0,0 +1,168 @@
+package bll
+
+import (
+	"context"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/app/service/ldap"
+	"moddns/app/service/ldap/ldaptest"
+	"moddns/app/service/sessionstore"
+	"moddns/app/util"
+	"reflect"
+	"testing"
+
+	"github.com/casbin/casbin"
+	"github.com/spf13/viper"
+)
+
+// newTestAuth 创建使用进程内LDAP服务的认证链(LDAP用户alice属于admins组，bob及root属于users组)
+func newTestAuth(t *testing.T, users *modeltest.User, roles *modeltest.Role, opts ...AuthOption) (*Auth, func()) {
+	srv, err := ldaptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, group := range map[string]string{"alice": "admins", "bob": "users", "root": "users"} {
+		srv.AddEntry("uid="+name+",ou=people,dc=example,dc=com", map[string][]string{
+			"objectClass":  {"person"},
+			"uid":          {name},
+			"cn":           {name + " (LDAP)"},
+			"memberOf":     {"cn=" + group + ",ou=groups,dc=example,dc=com"},
+			"userPassword": {name + "pw"},
+		})
+	}
+	srv.SetAllowAnonymous(true)
+
+	auth := ldap.NewAuthenticator(
+		ldap.SetURL(srv.URL()),
+		ldap.SetBaseDN("ou=people,dc=example,dc=com"),
+		ldap.SetUserFilter("(&(objectClass=person)(uid=%s))"),
+		ldap.SetMemberOfAttribute("memberOf"),
+	)
+
+	a := NewAuth(append([]AuthOption{SetLDAP(auth)}, opts...)...)
+	a.UserModel = users
+	a.RoleModel = roles
+	a.UserBll = &User{
+		UserModel:  users,
+		RoleModel:  roles,
+		TransModel: new(modeltest.Trans),
+		Enforcer:   casbin.NewEnforcer("../../config/model.conf", false),
+		Sessions:   sessionstore.NewRegistry(nil, sessionstore.NewMemoryIndex(0)),
+	}
+	return a, func() { srv.Close() }
+}
+
+// TestAuthProviders 按配置的顺序尝试认证方式，用户不存在时尝试下一个，LDAP用户不能登录同名的本地用户
+func TestAuthProviders(t *testing.T) {
+	users := &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "dave", Password: util.SHA1HashString(util.MD5HashString("davepw")), Source: schema.UserSourceLocal, Status: 1},
+		{RecordID: "u2", UserName: "bob", Password: util.SHA1HashString(util.MD5HashString("localpw")), Source: schema.UserSourceLocal, Status: 1},
+	}}
+	ctx := context.Background()
+
+	a, closeFn := newTestAuth(t, users, new(modeltest.Role), SetAuthProviders(AuthProviderLDAP, AuthProviderLocal))
+	defer closeFn()
+
+	if user, err := a.Authenticate(ctx, "dave", "davepw", true); err != nil || user.RecordID != "u1" {
+		t.Fatalf("LDAP中不存在的用户应使用本地用户认证：%v,%v", user, err)
+	} else if _, err := a.Authenticate(ctx, "dave", "wrong", true); err != ErrInvalidPassword {
+		t.Fatalf("本地用户的密码错误时应认证失败：%v", err)
+	}
+
+	// LDAP认证通过但存在同名的本地用户时视为用户不存在，尝试本地用户认证(LDAP密码不是本地密码)；
+	// 用户存在于LDAP但密码错误时不再尝试之后的认证方式
+	if _, err := a.Authenticate(ctx, "bob", "bobpw", true); err != ErrInvalidPassword {
+		t.Fatalf("LDAP用户不应登录同名的本地用户：%v", err)
+	} else if _, err := a.Authenticate(ctx, "bob", "localpw", true); err != ErrInvalidPassword {
+		t.Fatalf("LDAP密码错误时不应尝试本地用户认证：%v", err)
+	}
+
+	localFirst, closeLocalFirst := newTestAuth(t, users, new(modeltest.Role), SetAuthProviders(AuthProviderLocal, AuthProviderLDAP))
+	defer closeLocalFirst()
+	if user, err := localFirst.Authenticate(ctx, "bob", "localpw", true); err != nil || user.RecordID != "u2" {
+		t.Fatalf("本地用户优先时应使用本地密码认证：%v,%v", user, err)
+	} else if _, err := localFirst.Authenticate(ctx, "bob", "bobpw", true); err != ErrInvalidPassword {
+		t.Fatalf("本地用户的密码错误时不应尝试LDAP认证：%v", err)
+	}
+
+	// LDAP认证需要明文密码
+	if _, err := a.Authenticate(ctx, "alice", util.MD5HashString("alicepw"), false); err != ErrInvalidUserName {
+		t.Fatalf("密码为md5值时不应尝试LDAP认证：%v", err)
+	}
+
+	local, closeLocal := newTestAuth(t, users, new(modeltest.Role))
+	defer closeLocal()
+	if _, err := local.Authenticate(ctx, "alice", "alicepw", true); err != ErrInvalidUserName {
+		t.Fatalf("未配置LDAP认证方式时不应尝试LDAP认证：%v", err)
+	}
+}
+
+// TestAuthLDAPProvision LDAP用户首次登录时按配置自动创建本地用户，每次登录时按LDAP组同步角色
+func TestAuthLDAPProvision(t *testing.T) {
+	viper.Set("system_root_user", []string{"root", "123"})
+	defer viper.Set("system_root_user", nil)
+
+	users := new(modeltest.User)
+	roles := &modeltest.Role{Items: []*schema.Role{
+		{RecordID: "r1", Name: "admin", Status: 1},
+		{RecordID: "r2", Name: "viewer", Status: 1},
+		{RecordID: "r3", Name: "auditor", Status: 2},
+	}}
+	ctx := context.Background()
+
+	manual, closeManual := newTestAuth(t, users, roles, SetAuthProviders(AuthProviderLDAP))
+	defer closeManual()
+	if _, err := manual.Authenticate(ctx, "alice", "alicepw", true); err != ErrInvalidUserName || len(users.Items) != 0 {
+		t.Fatalf("未开启自动创建时不应创建本地用户：%v", err)
+	}
+
+	a, closeFn := newTestAuth(t, users, roles,
+		SetAuthProviders(AuthProviderLDAP),
+		SetLDAPProvision(true, "viewer"),
+		SetLDAPGroupRole("cn=admins,ou=groups,dc=example,dc=com", "admin"),
+		SetLDAPGroupRole("admins", "auditor"))
+	defer closeFn()
+
+	if _, err := a.Authenticate(ctx, "alice", "wrong", true); err != ErrInvalidPassword {
+		t.Fatalf("LDAP密码错误时应认证失败：%v", err)
+	}
+
+	user, err := a.Authenticate(ctx, "alice", "alicepw", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := users.FindByUserName("alice")
+	if item == nil || item.RecordID != user.RecordID || item.Source != schema.UserSourceLDAP || item.RealName != "alice (LDAP)" {
+		t.Fatalf("自动创建的用户错误：%+v", item)
+	} else if !reflect.DeepEqual(item.RoleIDs, []string{"r1"}) {
+		t.Fatalf("应按LDAP组分配启用的角色：%v", item.RoleIDs)
+	}
+
+	// 未匹配到角色时使用默认角色
+	if _, err := a.Authenticate(ctx, "bob", "bobpw", true); err != nil {
+		t.Fatal(err)
+	} else if item := users.FindByUserName("bob"); !reflect.DeepEqual(item.RoleIDs, []string{"r2"}) {
+		t.Fatalf("未匹配到角色时应分配默认角色：%v", item.RoleIDs)
+	}
+
+	// 再次登录时同步角色
+	item.RoleIDs = []string{"r2"}
+	if user, err := a.Authenticate(ctx, "alice", "alicepw", true); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(user.RoleIDs, []string{"r1"}) || !reflect.DeepEqual(users.FindByUserName("alice").RoleIDs, []string{"r1"}) {
+		t.Fatalf("登录时应按LDAP组同步角色：%v", users.FindByUserName("alice").RoleIDs)
+	}
+
+	item.Status = 2
+	if _, err := a.Authenticate(ctx, "alice", "alicepw", true); err != ErrUserDisable {
+		t.Fatalf("停用的用户应登录失败：%v", err)
+	}
+
+	// 不创建与超级用户同名的本地用户
+	if _, err := a.Authenticate(ctx, "root", "rootpw", true); err != ErrInvalidUserName {
+		t.Fatalf("与超级用户同名的LDAP用户应登录失败：%v", err)
+	} else if users.FindByUserName("root") != nil {
+		t.Fatal("不应创建与超级用户同名的本地用户")
+	}
+}
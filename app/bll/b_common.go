@@ -0,0 +1,158 @@
+package bll
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"moddns/app/logger"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/cache"
+	"moddns/app/service/exchange"
+	"moddns/app/util"
+)
+
+// invalidateCache 事务提交后使命名空间的查询缓存失效(不存在事务时立即失效)，
+// 失效失败时仅记录日志，缓存将在有效期后过期
+func invalidateCache(ctx context.Context, trans models.ITrans, c *cache.Cache, namespaces ...string) {
+	trans.AfterCommit(ctx, func() {
+		if err := c.Invalidate(ctx, namespaces...); err != nil {
+			logger.SystemWithContext(ctx).Warnf("%s", err.Error())
+		}
+	})
+}
+
+// execBatch 在同一事务中逐条处理数据，任意一条处理失败时停止处理并全部回滚
+// (事务出错后后续语句无法执行)，并返回每条数据的处理结果
+func execBatch(ctx context.Context, trans models.ITrans, recordIDs []string, fn func(context.Context, string) error) ([]*schema.BatchResult, error) {
+	results := make([]*schema.BatchResult, len(recordIDs))
+	for i, recordID := range recordIDs {
+		results[i] = &schema.BatchResult{RecordID: recordID}
+	}
+
+	var done int
+	err := trans.Exec(ctx, func(ctx context.Context) error {
+		for i, recordID := range recordIDs {
+			if err := fn(ctx, recordID); err != nil {
+				results[i].Error = errorMessage(err)
+				done = i + 1
+				return util.ErrBatchFailed
+			}
+			results[i].Success = true
+			done = i + 1
+		}
+		return nil
+	})
+	if err != nil {
+		for i, r := range results {
+			if r.Error != "" {
+				continue
+			} else if i < done {
+				r.Success = false
+				r.Error = "其它数据处理失败，已回滚"
+			} else {
+				r.Error = "其它数据处理失败，未处理"
+			}
+		}
+		return results, err
+	}
+
+	return results, nil
+}
+
+// errorMessage 获取错误的提示信息(去除包装的底层错误)
+func errorMessage(err error) string {
+	ss := strings.Split(err.Error(), ": ")
+	return ss[0]
+}
+
+// exportPageSize 导出数据时每次查询的数据条数
+const exportPageSize = 500
+
+// exportPages 按ID倒序逐页导出数据(导出期间新增或删除数据时，按偏移量分页会遗漏或重复数据)，
+// fn查询ID小于beforeID的一页数据，返回当前页的数据条数及最后一条数据的ID，不足一页时结束
+func exportPages(fn func(beforeID int64) (int, int64, error)) error {
+	beforeID := int64(math.MaxInt64)
+	for {
+		n, lastID, err := fn(beforeID)
+		if err != nil {
+			return err
+		} else if n < exportPageSize {
+			return nil
+		}
+		beforeID = lastID
+	}
+}
+
+// importItem 校验通过的导入数据
+type importItem struct {
+	line   int
+	create func(context.Context) error
+}
+
+// addImportError 添加导入数据的校验错误
+func addImportError(result *schema.ImportResult, row *exchange.Row, field, message string) {
+	result.Errors = append(result.Errors, &schema.ImportError{
+		Line:    row.Line,
+		Field:   field,
+		Value:   row.Get(field),
+		Message: message,
+	})
+}
+
+// execImport 校验全部通过且非仅校验时，在同一事务中逐条创建数据，任意一条失败时全部回滚
+func execImport(ctx context.Context, trans models.ITrans, result *schema.ImportResult, items []*importItem) (*schema.ImportResult, error) {
+	if len(result.Errors) > 0 {
+		return result, util.ErrImportInvalid
+	} else if result.DryRun {
+		return result, nil
+	}
+
+	err := trans.Exec(ctx, func(ctx context.Context) error {
+		for _, item := range items {
+			if err := item.create(ctx); err != nil {
+				result.Errors = append(result.Errors, &schema.ImportError{
+					Line:    item.line,
+					Message: errorMessage(err),
+				})
+				return util.ErrImportInvalid
+			}
+			result.Created++
+		}
+		return nil
+	})
+	if err != nil {
+		result.Created = 0
+		return result, err
+	}
+
+	return result, nil
+}
+
+// parseImportStatus 解析导入数据的状态(为空时默认为启用)
+func parseImportStatus(result *schema.ImportResult, row *exchange.Row, field string) int {
+	switch row.Get(field) {
+	case "", "1":
+		return 1
+	case "2":
+		return 2
+	}
+	addImportError(result, row, field, "状态只能为1(启用)或2(停用)")
+	return 0
+}
+
+// parseImportInt 解析导入数据的整数值(为空时返回0)
+func parseImportInt(result *schema.ImportResult, row *exchange.Row, field string) int {
+	v := row.Get(field)
+	if v == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		addImportError(result, row, field, "必须为整数")
+	}
+	return n
+}
@@ -0,0 +1,103 @@
+package bll
+
+import (
+	"context"
+	"errors"
+	"moddns/app/models/modeltest"
+	"moddns/app/util"
+	"testing"
+)
+
+func TestExecBatch(t *testing.T) {
+	ctx := context.Background()
+
+	var handled []string
+	fn := func(ctx context.Context, recordID string) error {
+		handled = append(handled, recordID)
+		if recordID == "b" {
+			return errors.New("数据不存在: b")
+		}
+		return nil
+	}
+
+	trans := new(modeltest.Trans)
+	results, err := execBatch(ctx, trans, []string{"a", "b", "c"}, fn)
+	if err != util.ErrBatchFailed || !trans.Rollback {
+		t.Fatalf("处理失败时应回滚：%v", err)
+	}
+	// 失败后不再处理后续数据
+	if len(handled) != 2 {
+		t.Fatalf("失败后应停止处理：%v", handled)
+	}
+
+	expected := []struct {
+		recordID string
+		err      string
+	}{
+		{"a", "其它数据处理失败，已回滚"},
+		{"b", "数据不存在"},
+		{"c", "其它数据处理失败，未处理"},
+	}
+	for i, item := range expected {
+		r := results[i]
+		if r.RecordID != item.recordID || r.Success || r.Error != item.err {
+			t.Fatalf("处理结果错误：%+v", r)
+		}
+	}
+
+	handled = nil
+	trans = new(modeltest.Trans)
+	results, err = execBatch(ctx, trans, []string{"a", "c"}, fn)
+	if err != nil || trans.Rollback {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.Success || r.Error != "" {
+			t.Fatalf("处理结果错误：%+v", r)
+		}
+	}
+}
+
+// TestExportPages 导出期间新增或删除数据时，已存在的数据不遗漏也不重复
+func TestExportPages(t *testing.T) {
+	const total = 2*exportPageSize + 100
+	ids := make(map[int64]bool, total)
+	for id := int64(1); id <= total; id++ {
+		ids[id] = true
+	}
+
+	exported := make(map[int64]int)
+	pages := 0
+	err := exportPages(func(beforeID int64) (int, int64, error) {
+		var page []int64
+		for id := int64(total + 10); id > 0 && len(page) < exportPageSize; id-- {
+			if id < beforeID && ids[id] {
+				page = append(page, id)
+			}
+		}
+
+		if pages++; pages == 1 {
+			ids[total+1] = true // 新增的数据
+			delete(ids, 1)      // 删除尚未导出的数据
+		}
+		if len(page) == 0 {
+			return 0, 0, nil
+		}
+		for _, id := range page {
+			exported[id]++
+		}
+		return len(page), page[len(page)-1], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id := int64(2); id <= total; id++ {
+		if exported[id] != 1 {
+			t.Errorf("数据[%d]导出了%d次", id, exported[id])
+		}
+	}
+	if len(exported) != total-1 {
+		t.Errorf("导出的数据条数错误：%d", len(exported))
+	}
+}
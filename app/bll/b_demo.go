@@ -11,7 +11,8 @@ import (
 
 // Demo 示例程序
 type Demo struct {
-	DemoModel models.IDemo `inject:"IDemo"`
+	DemoModel  models.IDemo  `inject:"IDemo"`
+	TransModel models.ITrans `inject:"ITrans"`
 }
 
 // QueryPage 查询分页数据
@@ -37,6 +38,7 @@ func (a *Demo) Create(ctx context.Context, item *schema.Demo) error {
 	item.RecordID = uuid.New().String()
 	item.Created = time.Now().Unix()
 	item.Deleted = 0
+	item.Version = 1
 	return a.DemoModel.Create(ctx, item)
 }
 
@@ -57,7 +59,7 @@ func (a *Demo) Update(ctx context.Context, recordID string, item *schema.Demo) e
 	delete(info, "updated")
 	delete(info, "deleted")
 
-	return a.DemoModel.Update(ctx, recordID, info)
+	return a.DemoModel.Update(ctx, recordID, info, item.Version)
 }
 
 // Delete 删除数据
@@ -71,3 +73,42 @@ func (a *Demo) Delete(ctx context.Context, recordID string) error {
 
 	return a.DemoModel.Delete(ctx, recordID)
 }
+
+// DeleteMany 删除多条数据(全部成功或全部回滚)
+func (a *Demo) DeleteMany(ctx context.Context, recordIDs []string) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, a.Delete)
+}
+
+// QueryDeletedPage 查询已删除的分页数据(回收站)
+func (a *Demo) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	return a.DemoModel.QueryDeletedPage(ctx, pageIndex, pageSize)
+}
+
+// Restore 恢复已删除的数据
+func (a *Demo) Restore(ctx context.Context, recordID string) error {
+	item, err := a.DemoModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	return a.DemoModel.Restore(ctx, recordID, item.Deleted)
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Demo) Purge(ctx context.Context, recordID string) error {
+	item, err := a.DemoModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	return a.DemoModel.Purge(ctx, recordID)
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据
+func (a *Demo) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	return a.DemoModel.PurgeExpired(ctx, before.Unix())
+}
@@ -0,0 +1,184 @@
+package bll
+
+import (
+	"context"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/util"
+)
+
+// Loader 关联数据加载器：按记录内码批量查询列表关联的名称(用户的角色、角色的菜单、创建人)，
+// 查询次数与数据条数无关；上下文中存在请求缓存时，同一请求中已查询的数据不再重复查询
+type Loader struct {
+	UserModel models.IUser `inject:"IUser"`
+	RoleModel models.IRole `inject:"IRole"`
+	MenuModel models.IMenu `inject:"IMenu"`
+	LoginBll  *Login       `inject:""`
+}
+
+// loaderKey 请求缓存中的键
+type loaderKey struct {
+	kind     string
+	recordID string
+}
+
+// loadNames 查询记录内码对应的名称，未缓存的记录内码通过fetch一次性查询
+func (a *Loader) loadNames(ctx context.Context, kind string, recordIDs []string, fetch func(context.Context, []string) (map[string]string, error)) (map[string]string, error) {
+	names := make(map[string]string, len(recordIDs))
+	missing := a.missing(ctx, kind, recordIDs, func(recordID string, v interface{}) {
+		names[recordID] = v.(string)
+	})
+	if len(missing) == 0 {
+		return names, nil
+	}
+
+	result, err := fetch(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := util.FromRequestCacheContext(ctx)
+	for _, recordID := range missing {
+		name := result[recordID]
+		if cache != nil {
+			cache.Store(loaderKey{kind, recordID}, name)
+		}
+		names[recordID] = name
+	}
+	return names, nil
+}
+
+// loadIDs 查询记录内码关联的内码列表，未缓存的记录内码通过fetch一次性查询
+func (a *Loader) loadIDs(ctx context.Context, kind string, recordIDs []string, fetch func(context.Context, []string) (map[string][]string, error)) (map[string][]string, error) {
+	ids := make(map[string][]string, len(recordIDs))
+	missing := a.missing(ctx, kind, recordIDs, func(recordID string, v interface{}) {
+		ids[recordID] = v.([]string)
+	})
+	if len(missing) == 0 {
+		return ids, nil
+	}
+
+	result, err := fetch(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := util.FromRequestCacheContext(ctx)
+	for _, recordID := range missing {
+		items := result[recordID]
+		if cache != nil {
+			cache.Store(loaderKey{kind, recordID}, items)
+		}
+		ids[recordID] = items
+	}
+	return ids, nil
+}
+
+// missing 读取请求缓存中已存在的数据，返回未缓存的记录内码(去重并忽略空值)
+func (a *Loader) missing(ctx context.Context, kind string, recordIDs []string, found func(string, interface{})) []string {
+	cache := util.FromRequestCacheContext(ctx)
+
+	var missing []string
+	seen := make(map[string]bool, len(recordIDs))
+	for _, recordID := range recordIDs {
+		if recordID == "" || seen[recordID] {
+			continue
+		}
+		seen[recordID] = true
+
+		if cache != nil {
+			if v, ok := cache.Load(loaderKey{kind, recordID}); ok {
+				found(recordID, v)
+				continue
+			}
+		}
+		missing = append(missing, recordID)
+	}
+	return missing
+}
+
+// UserNames 批量查询用户名称(包括超级用户)，返回用户内码与名称的对应关系
+func (a *Loader) UserNames(ctx context.Context, userIDs []string) (map[string]string, error) {
+	root := a.LoginBll.getRootUser()
+	return a.loadNames(ctx, "user_name", userIDs, func(ctx context.Context, recordIDs []string) (map[string]string, error) {
+		names, err := a.UserModel.QueryNamesByIDs(ctx, recordIDs)
+		if err != nil {
+			return nil, err
+		} else if names == nil {
+			names = make(map[string]string)
+		}
+
+		if root.RecordID != "" {
+			for _, recordID := range recordIDs {
+				if recordID == root.RecordID {
+					names[recordID] = root.RealName
+				}
+			}
+		}
+		return names, nil
+	})
+}
+
+// RoleNames 批量查询角色名称，返回角色内码与名称的对应关系
+func (a *Loader) RoleNames(ctx context.Context, roleIDs []string) (map[string]string, error) {
+	return a.loadNames(ctx, "role_name", roleIDs, a.RoleModel.QueryNamesByIDs)
+}
+
+// MenuNames 批量查询菜单名称，返回菜单内码与名称的对应关系
+func (a *Loader) MenuNames(ctx context.Context, menuIDs []string) (map[string]string, error) {
+	return a.loadNames(ctx, "menu_name", menuIDs, func(ctx context.Context, recordIDs []string) (map[string]string, error) {
+		menus, err := a.MenuModel.QuerySelect(ctx, schema.MenuSelectQueryParam{RecordIDs: recordIDs})
+		if err != nil {
+			return nil, err
+		}
+
+		names := make(map[string]string, len(menus))
+		for _, m := range menus {
+			names[m.RecordID] = m.Name
+		}
+		return names, nil
+	})
+}
+
+// UserRoleNames 批量查询用户的角色名称，返回用户内码与角色名称列表的对应关系
+func (a *Loader) UserRoleNames(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	roleIDs, err := a.loadIDs(ctx, "user_roles", userIDs, a.UserModel.QueryRoleIDsByUserIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.joinNames(ctx, roleIDs, a.RoleNames)
+}
+
+// RoleMenuNames 批量查询角色的菜单名称，返回角色内码与菜单名称列表的对应关系
+func (a *Loader) RoleMenuNames(ctx context.Context, roleIDs []string) (map[string][]string, error) {
+	menuIDs, err := a.loadIDs(ctx, "role_menus", roleIDs, a.RoleModel.QueryMenuIDsByRoleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.joinNames(ctx, menuIDs, a.MenuNames)
+}
+
+// joinNames 将关联的内码列表转换为名称列表(忽略已不存在的记录)
+func (a *Loader) joinNames(ctx context.Context, ids map[string][]string, load func(context.Context, []string) (map[string]string, error)) (map[string][]string, error) {
+	var all []string
+	for _, items := range ids {
+		all = append(all, items...)
+	}
+
+	names, err := load(ctx, all)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]string, len(ids))
+	for recordID, items := range ids {
+		for _, id := range items {
+			if name := names[id]; name != "" {
+				result[recordID] = append(result[recordID], name)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package bll
+
+import (
+	"context"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/app/util"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// testLoaderUserModel 记录名称查询的用户存储
+type testLoaderUserModel struct {
+	*modeltest.User
+	queries [][]string
+}
+
+func (m *testLoaderUserModel) QueryNamesByIDs(ctx context.Context, recordIDs []string) (map[string]string, error) {
+	ids := append([]string(nil), recordIDs...)
+	sort.Strings(ids)
+	m.queries = append(m.queries, ids)
+	return m.User.QueryNamesByIDs(ctx, recordIDs)
+}
+
+// TestLoaderUserNames 批量查询用户名称：去重并忽略空值，请求缓存中已有的用户不再查询，超级用户不在用户表中
+func TestLoaderUserNames(t *testing.T) {
+	viper.Set("system_root_user", []string{"root", "123"})
+	defer viper.Set("system_root_user", nil)
+
+	model := &testLoaderUserModel{User: &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "zhangsan", RealName: "张三"},
+		{RecordID: "u2", UserName: "lisi", RealName: "李四"},
+	}}}
+	loader := &Loader{UserModel: model, LoginBll: new(Login)}
+	ctx := util.NewRequestCacheContext(context.Background(), new(util.RequestCache))
+
+	cases := []struct {
+		name     string
+		userIDs  []string
+		query    []string
+		expected map[string]string
+	}{
+		{"仅超级用户", []string{"root", "root"}, []string{"root"}, map[string]string{"root": "超级用户"}},
+		{"去重并忽略空值", []string{"u1", "", "u1", "root"}, []string{"u1"}, map[string]string{"u1": "张三", "root": "超级用户"}},
+		{"缓存不存在的用户", []string{"u2", "u3"}, []string{"u2", "u3"}, map[string]string{"u2": "李四", "u3": ""}},
+		{"全部命中缓存", []string{"u3", "u1", "root", "u2"}, nil, map[string]string{"u1": "张三", "u2": "李四", "u3": "", "root": "超级用户"}},
+	}
+
+	for _, c := range cases {
+		model.queries = nil
+		names, err := loader.UserNames(ctx, c.userIDs)
+		if err != nil {
+			t.Fatalf("%s：%s", c.name, err.Error())
+		}
+
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("%s：名称应为%v，实际为%v", c.name, c.expected, names)
+		}
+
+		var query []string
+		if len(model.queries) > 0 {
+			query = model.queries[0]
+		}
+		if len(model.queries) > 1 || !reflect.DeepEqual(query, c.query) {
+			t.Errorf("%s：应查询%v，实际查询%v", c.name, c.query, model.queries)
+		}
+	}
+
+	// 没有请求缓存时每次都查询
+	model.queries = nil
+	for i := 0; i < 2; i++ {
+		if _, err := loader.UserNames(context.Background(), []string{"u1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(model.queries) != 2 {
+		t.Errorf("没有请求缓存时应查询2次，实际查询%d次", len(model.queries))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/spf13/viper"
 	"moddns/app/models"
 	"moddns/app/schema"
+	"moddns/app/service/sessionstore"
 	"moddns/app/util"
 )
 
@@ -19,9 +20,11 @@ var (
 
 // Login 登录管理
 type Login struct {
-	UserModel models.IUser `inject:"IUser"`
-	RoleModel models.IRole `inject:"IRole"`
-	MenuModel models.IMenu `inject:"IMenu"`
+	UserModel models.IUser           `inject:"IUser"`
+	RoleModel models.IRole           `inject:"IRole"`
+	MenuModel models.IMenu           `inject:"IMenu"`
+	Sessions  *sessionstore.Registry `inject:""`
+	Auth      *Auth                  `inject:""`
 }
 
 func (a *Login) getRootUser() schema.User {
@@ -46,14 +49,29 @@ func (a *Login) CheckIsRoot(ctx context.Context, recordID string) bool {
 	return false
 }
 
-// Verify 登录验证
-func (a *Login) Verify(ctx context.Context, userName, password string) (*schema.User, error) {
+// Verify 登录验证，plain表示密码为明文(否则为md5值)
+func (a *Login) Verify(ctx context.Context, userName, password string, plain bool) (*schema.User, error) {
+	hashed := password
+	if plain {
+		hashed = util.MD5HashString(password)
+	}
+
 	rootUser := a.getRootUser()
 	if userName == rootUser.UserName &&
-		util.MD5HashString(rootUser.Password) == password {
+		util.MD5HashString(rootUser.Password) == hashed {
 		return &rootUser, nil
 	}
 
+	return a.Auth.Authenticate(ctx, userName, password, plain)
+}
+
+// VerifyIdentity 根据已验证的身份标识(如客户端证书)获取用户，
+// 超级用户不允许通过身份标识映射(只能使用密码登录)
+func (a *Login) VerifyIdentity(ctx context.Context, userName string) (*schema.User, error) {
+	if rootUser := a.getRootUser(); rootUser.UserName != "" && userName == rootUser.UserName {
+		return nil, ErrInvalidUserName
+	}
+
 	user, err := a.UserModel.GetByUserName(ctx, userName, false)
 	if err != nil {
 		return nil, err
@@ -61,8 +79,6 @@ func (a *Login) Verify(ctx context.Context, userName, password string) (*schema.
 		return nil, ErrInvalidUserName
 	} else if user.Status != 1 {
 		return nil, ErrUserDisable
-	} else if user.Password != util.SHA1HashString(password) {
-		return nil, ErrInvalidPassword
 	}
 
 	return user, nil
@@ -128,3 +144,48 @@ func (a *Login) QueryCurrentUserMenus(ctx context.Context, userID string) ([]map
 	treeData := util.Slice2Tree(util.StructsToMapSlice(items), "record_id", "parent_id")
 	return treeData, nil
 }
+
+// CheckSessionLimit 检查用户同时在线的会话数(拒绝策略下达到上限时返回sessionstore.ErrSessionLimit)，sid为登录前的会话ID
+func (a *Login) CheckSessionLimit(ctx context.Context, userID, sid string) error {
+	return a.Sessions.Allow(ctx, userID, sid)
+}
+
+// AddSession 登记登录后的会话，oldSID为登录前的会话ID
+func (a *Login) AddSession(ctx context.Context, oldSID string, item *sessionstore.Record) error {
+	return a.Sessions.Add(ctx, oldSID, item)
+}
+
+// TouchSession 更新会话的最后活动时间
+func (a *Login) TouchSession(ctx context.Context, item *sessionstore.Record) error {
+	return a.Sessions.Touch(ctx, item)
+}
+
+// RemoveSession 移除登出的会话记录
+func (a *Login) RemoveSession(ctx context.Context, sid string) error {
+	return a.Sessions.Remove(ctx, sid)
+}
+
+// QueryCurrentUserSessions 查询当前用户在线的会话，sid为当前请求的会话ID
+func (a *Login) QueryCurrentUserSessions(ctx context.Context, userID, sid string) ([]*schema.UserSession, error) {
+	items, err := a.Sessions.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return toUserSessions(items, sid), nil
+}
+
+// toUserSessions 转换会话记录(不返回会话ID)
+func toUserSessions(items []*sessionstore.Record, sid string) []*schema.UserSession {
+	list := make([]*schema.UserSession, len(items))
+	for i, item := range items {
+		list[i] = &schema.UserSession{
+			RecordID:   item.RecordID,
+			IP:         item.IP,
+			UserAgent:  item.UserAgent,
+			LoginAt:    item.LoginAt,
+			LastActive: item.LastActive,
+			Current:    sid != "" && item.SessionID == sid,
+		}
+	}
+	return list
+}
@@ -2,25 +2,59 @@ package bll
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
-	"sync"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"moddns/app/models"
 	"moddns/app/schema"
+	"moddns/app/service/cache"
+	"moddns/app/service/exchange"
 	"moddns/app/util"
 )
 
+// MenuColumns 菜单导入导出的列(parent为上级菜单的编号路径)
+var MenuColumns = []string{"code", "name", "type", "sequence", "icon", "path", "method", "parent", "is_hide", "status"}
+
 // Menu 菜单管理
 type Menu struct {
-	MenuModel models.IMenu `inject:"IMenu"`
-	lock      sync.RWMutex
+	MenuModel  models.IMenu  `inject:"IMenu"`
+	TransModel models.ITrans `inject:"ITrans"`
+	Loader     *Loader       `inject:""`
+	Cache      *cache.Cache  `inject:""`
+}
+
+// invalidate 数据提交后使菜单及角色(角色菜单)的查询缓存失效
+func (a *Menu) invalidate(ctx context.Context) {
+	invalidateCache(ctx, a.TransModel, a.Cache, cache.NSMenu, cache.NSRole)
 }
 
 // QueryPage 查询分页数据
 func (a *Menu) QueryPage(ctx context.Context, params schema.MenuQueryParam, pageIndex, pageSize uint) (int64, []*schema.MenuQueryResult, error) {
-	return a.MenuModel.QueryPage(ctx, params, pageIndex, pageSize)
+	total, items, err := a.MenuModel.QueryPage(ctx, params, pageIndex, pageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	creators := make([]string, len(items))
+	for i, item := range items {
+		creators[i] = item.Creator
+	}
+
+	creatorNames, err := a.Loader.UserNames(ctx, creators)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, item := range items {
+		item.CreatorName = creatorNames[item.Creator]
+	}
+
+	return total, items, nil
 }
 
 // QueryTree 查询菜单树
@@ -57,25 +91,30 @@ func (a *Menu) Create(ctx context.Context, item *schema.Menu) error {
 		}
 	}
 
-	a.lock.Lock()
-	defer a.lock.Unlock()
+	return a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		levelCodes, err := a.MenuModel.LockLevelCodesByParentID(ctx, item.ParentID)
+		if err != nil {
+			return err
+		}
 
-	levelCodes, err := a.MenuModel.QueryLevelCodesByParentID(item.ParentID)
-	if err != nil {
-		return err
-	}
+		levelCode, err := nextLevelCode(levelCodes, item.ParentID)
+		if err != nil {
+			return err
+		}
 
-	levelCode := util.GetLevelCode(levelCodes)
-	if len(levelCode) == 0 {
-		return errors.New("无效的分级码")
-	}
+		item.LevelCode = levelCode
+		item.ID = 0
+		item.RecordID = uuid.New().String()
+		item.Created = time.Now().Unix()
+		item.Deleted = 0
+		item.Version = 1
+		if err := a.MenuModel.Create(ctx, item); err != nil {
+			return err
+		}
 
-	item.LevelCode = levelCode
-	item.ID = 0
-	item.RecordID = uuid.New().String()
-	item.Created = time.Now().Unix()
-	item.Deleted = 0
-	return a.MenuModel.Create(ctx, item)
+		a.invalidate(ctx)
+		return nil
+	})
 }
 
 // Update 更新数据
@@ -89,7 +128,7 @@ func (a *Menu) Update(ctx context.Context, recordID string, item *schema.Menu) e
 		return err
 	} else if oldItem == nil {
 		return util.ErrNotFound
-	} else if item.Code != oldItem.Code {
+	} else if item.Code != oldItem.Code || (item.Code != "" && item.ParentID != oldItem.ParentID) {
 		exists, err := a.MenuModel.CheckCode(ctx, item.Code, item.ParentID)
 		if err != nil {
 			return err
@@ -108,23 +147,206 @@ func (a *Menu) Update(ctx context.Context, recordID string, item *schema.Menu) e
 	delete(info, "deleted")
 
 	if item.ParentID != oldItem.ParentID {
-		a.lock.Lock()
-		defer a.lock.Unlock()
+		if err := a.checkParent(ctx, oldItem, item.ParentID); err != nil {
+			return err
+		}
+
+		return a.TransModel.Exec(ctx, func(ctx context.Context) error {
+			levelCodes, err := a.MenuModel.LockLevelCodesByParentID(ctx, item.ParentID)
+			if err != nil {
+				return err
+			}
+
+			levelCode, err := nextLevelCode(levelCodes, item.ParentID)
+			if err != nil {
+				return err
+			}
 
-		levelCodes, err := a.MenuModel.QueryLevelCodesByParentID(item.ParentID)
+			err = a.MenuModel.UpdateWithLevelCode(ctx, recordID, info, oldItem.LevelCode, levelCode, item.Version)
+			if err != nil {
+				return err
+			}
+
+			a.invalidate(ctx)
+			return nil
+		})
+	}
+
+	if err := a.MenuModel.Update(ctx, recordID, info, item.Version); err != nil {
+		return err
+	}
+
+	a.invalidate(ctx)
+	return nil
+}
+
+// checkParent 检查新的上级菜单是否存在且不属于菜单自身的下级
+func (a *Menu) checkParent(ctx context.Context, item *schema.Menu, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+
+	parent, err := a.MenuModel.Get(ctx, parentID)
+	if err != nil {
+		return err
+	} else if parent == nil {
+		return errors.New("上级菜单不存在")
+	} else if strings.HasPrefix(parent.LevelCode, item.LevelCode) {
+		return errors.New("不能使用下级菜单作为菜单上级")
+	}
+	return nil
+}
+
+// Move 移动菜单(含下级菜单)到新的上级菜单的指定位置，重新计算分级码并更新同级菜单的排序值，
+// 角色授权通过菜单内码关联，移动后保持不变(version大于0时校验版本号)
+func (a *Menu) Move(ctx context.Context, recordID string, param schema.MenuMoveParam, version int64) error {
+	return a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		item, err := a.MenuModel.Get(ctx, recordID)
+		if err != nil {
+			return err
+		} else if item == nil {
+			return util.ErrNotFound
+		}
+
+		if param.ParentID != item.ParentID {
+			item.ParentID = param.ParentID
+			if version > 0 {
+				item.Version = version
+			}
+
+			err := a.Update(ctx, recordID, item)
+			if err != nil {
+				return err
+			}
+			version = 0
+		}
+
+		siblings, err := a.MenuModel.QueryChildren(ctx, param.ParentID)
 		if err != nil {
 			return err
 		}
 
-		levelCode := util.GetLevelCode(levelCodes)
-		if len(levelCode) == 0 {
-			return errors.New("无效的分级码")
+		recordIDs := make([]string, 0, len(siblings))
+		for _, s := range siblings {
+			if s.RecordID != recordID {
+				recordIDs = append(recordIDs, s.RecordID)
+			}
+		}
+
+		pos := param.Position
+		if pos < 0 || pos > len(recordIDs) {
+			pos = len(recordIDs)
 		}
+		recordIDs = append(recordIDs[:pos], append([]string{recordID}, recordIDs[pos:]...)...)
 
-		return a.MenuModel.UpdateWithLevelCode(ctx, recordID, info, oldItem.LevelCode, levelCode)
+		return a.updateSequences(ctx, siblings, recordIDs, map[string]int64{recordID: version})
+	})
+}
+
+// Reorder 按指定顺序重新设置同级菜单的排序值，recordIDs必须包含全部同级菜单
+func (a *Menu) Reorder(ctx context.Context, param schema.MenuReorderParam) error {
+	return a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		siblings, err := a.MenuModel.QueryChildren(ctx, param.ParentID)
+		if err != nil {
+			return err
+		}
+
+		exists := make(map[string]bool, len(siblings))
+		for _, s := range siblings {
+			exists[s.RecordID] = true
+		}
+
+		if len(param.IDs) != len(siblings) {
+			return errors.New("排序的菜单必须为全部同级菜单")
+		}
+		for _, recordID := range param.IDs {
+			if !exists[recordID] {
+				return errors.New("排序的菜单必须为全部同级菜单")
+			}
+			delete(exists, recordID)
+		}
+
+		return a.updateSequences(ctx, siblings, param.IDs, nil)
+	})
+}
+
+// updateSequences 按recordIDs的顺序更新同级菜单的排序值(10、20、30...)，仅更新发生变化的菜单，
+// versions为需要校验版本号的菜单
+func (a *Menu) updateSequences(ctx context.Context, siblings []*schema.Menu, recordIDs []string, versions map[string]int64) error {
+	sequences := make(map[string]int, len(siblings))
+	for _, s := range siblings {
+		sequences[s.RecordID] = s.Sequence
+	}
+
+	for i, recordID := range recordIDs {
+		sequence := (i + 1) * 10
+		if sequences[recordID] == sequence && versions[recordID] == 0 {
+			continue
+		}
+
+		err := a.MenuModel.Update(ctx, recordID, map[string]interface{}{"sequence": sequence}, versions[recordID])
+		if err != nil {
+			return err
+		}
+	}
+
+	a.invalidate(ctx)
+	return nil
+}
+
+// Copy 复制菜单及全部下级菜单到同一上级菜单下，下级菜单保留原编号，复制的菜单不包含角色授权
+func (a *Menu) Copy(ctx context.Context, recordID string, param schema.MenuCopyParam, creator string) (*schema.Menu, error) {
+	item, err := a.MenuModel.Get(ctx, recordID)
+	if err != nil {
+		return nil, err
+	} else if item == nil {
+		return nil, util.ErrNotFound
+	}
+
+	newItem := *item
+	newItem.Code = param.Code
+	if newItem.Code == "" {
+		newItem.Code = item.Code + "_copy"
+	}
+	newItem.Name = param.Name
+	if newItem.Name == "" {
+		newItem.Name = item.Name + "(副本)"
 	}
+	newItem.Creator = creator
 
-	return a.MenuModel.Update(ctx, recordID, info)
+	var copyChildren func(ctx context.Context, srcID, parentID string) error
+	copyChildren = func(ctx context.Context, srcID, parentID string) error {
+		children, err := a.MenuModel.QueryChildren(ctx, srcID)
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			srcID := child.RecordID
+			child.ParentID = parentID
+			child.Creator = creator
+			if err := a.Create(ctx, child); err != nil {
+				return err
+			}
+
+			if err := copyChildren(ctx, srcID, child.RecordID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		if err := a.Create(ctx, &newItem); err != nil {
+			return err
+		}
+		return copyChildren(ctx, recordID, newItem.RecordID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &newItem, nil
 }
 
 // Delete 删除数据
@@ -143,11 +365,16 @@ func (a *Menu) Delete(ctx context.Context, recordID string) error {
 		return errors.New("含有子级菜单，不能删除")
 	}
 
-	return a.MenuModel.Delete(ctx, recordID)
+	if err := a.MenuModel.Delete(ctx, recordID); err != nil {
+		return err
+	}
+
+	a.invalidate(ctx)
+	return nil
 }
 
-// UpdateStatus 更新状态
-func (a *Menu) UpdateStatus(ctx context.Context, recordID string, status int) error {
+// UpdateStatus 更新状态(version大于0时校验版本号)
+func (a *Menu) UpdateStatus(ctx context.Context, recordID string, status int, version int64) error {
 	exists, err := a.MenuModel.Check(ctx, recordID)
 	if err != nil {
 		return err
@@ -158,5 +385,343 @@ func (a *Menu) UpdateStatus(ctx context.Context, recordID string, status int) er
 	info := map[string]interface{}{
 		"status": status,
 	}
-	return a.MenuModel.Update(ctx, recordID, info)
+	if err := a.MenuModel.Update(ctx, recordID, info, version); err != nil {
+		return err
+	}
+
+	a.invalidate(ctx)
+	return nil
+}
+
+// DeleteMany 删除多条数据(全部成功或全部回滚)
+func (a *Menu) DeleteMany(ctx context.Context, recordIDs []string) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, a.Delete)
+}
+
+// UpdateStatusMany 更新多条数据的状态(全部成功或全部回滚)
+func (a *Menu) UpdateStatusMany(ctx context.Context, recordIDs []string, status int) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, func(ctx context.Context, recordID string) error {
+		return a.UpdateStatus(ctx, recordID, status, 0)
+	})
+}
+
+// QueryDeletedPage 查询已删除的分页数据(回收站)
+func (a *Menu) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	return a.MenuModel.QueryDeletedPage(ctx, pageIndex, pageSize)
+}
+
+// Restore 恢复已删除的数据(上级菜单必须存在，分级码被占用时重新分配)
+func (a *Menu) Restore(ctx context.Context, recordID string) error {
+	item, err := a.MenuModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	if item.ParentID != "" {
+		exists, err := a.MenuModel.Check(ctx, item.ParentID)
+		if err != nil {
+			return err
+		} else if !exists {
+			return util.NewConflictError("上级菜单不存在，不能恢复")
+		}
+	}
+
+	if item.Code != "" {
+		exists, err := a.MenuModel.CheckCode(ctx, item.Code, item.ParentID)
+		if err != nil {
+			return err
+		} else if exists {
+			return util.NewConflictError("编号已经存在，不能恢复")
+		}
+	}
+
+	return a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		levelCodes, err := a.MenuModel.LockLevelCodesByParentID(ctx, item.ParentID)
+		if err != nil {
+			return err
+		}
+
+		levelCode := item.LevelCode
+		if !checkRestoreLevelCode(levelCodes, item.ParentID, levelCode) {
+			levelCode, err = nextLevelCode(levelCodes, item.ParentID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := a.MenuModel.Restore(ctx, recordID, item.Deleted, levelCode); err != nil {
+			return err
+		}
+
+		a.invalidate(ctx)
+		return nil
+	})
+}
+
+// checkRestoreLevelCode 检查恢复的分级码是否仍属于上级且未被占用
+func checkRestoreLevelCode(levelCodes []string, parentID, levelCode string) bool {
+	prefix, siblings, ok := splitLevelCodes(levelCodes, parentID)
+	if !ok || len(levelCode) != len(prefix)+util.LevelCodeWidth() || !strings.HasPrefix(levelCode, prefix) {
+		return false
+	}
+
+	for _, code := range siblings {
+		if code == levelCode {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLevelCodes 将上级及下级的分级码(按分级码排序)拆分为上级分级码及同级分级码，上级菜单不存在时返回false
+func splitLevelCodes(levelCodes []string, parentID string) (string, []string, bool) {
+	if parentID == "" {
+		return "", levelCodes, true
+	} else if len(levelCodes) == 0 {
+		return "", nil, false
+	}
+	return levelCodes[0], levelCodes[1:], true
+}
+
+// nextLevelCode 获取上级菜单下未被占用的分级码
+func nextLevelCode(levelCodes []string, parentID string) (string, error) {
+	prefix, siblings, ok := splitLevelCodes(levelCodes, parentID)
+	if !ok {
+		return "", errors.New("上级菜单不存在")
+	}
+
+	levelCode := util.GetLevelCode(prefix, siblings)
+	if levelCode == "" {
+		return "", errors.New("同级菜单数量已达到分级码位数的上限")
+	}
+	return levelCode, nil
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Menu) Purge(ctx context.Context, recordID string) error {
+	item, err := a.MenuModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	if err := a.MenuModel.Purge(ctx, recordID); err != nil {
+		return err
+	}
+
+	a.invalidate(ctx)
+	return nil
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据
+func (a *Menu) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	n, err := a.MenuModel.PurgeExpired(ctx, before.Unix())
+	if err == nil && n > 0 {
+		a.invalidate(ctx)
+	}
+	return n, err
+}
+
+// menuCodePaths 获取菜单的编号路径(由顶级至本级的编号以/连接，如admin/system/menu)，返回菜单内码与路径的对应关系
+func menuCodePaths(menus []*schema.MenuSelectQueryResult) map[string]string {
+	items := make(map[string]*schema.MenuSelectQueryResult, len(menus))
+	for _, m := range menus {
+		items[m.RecordID] = m
+	}
+
+	paths := make(map[string]string, len(menus))
+	var pathOf func(m *schema.MenuSelectQueryResult, depth int) string
+	pathOf = func(m *schema.MenuSelectQueryResult, depth int) string {
+		if path, ok := paths[m.RecordID]; ok {
+			return path
+		}
+
+		path := m.Code
+		// 深度超过菜单数量时说明上级关系存在循环
+		if parent, ok := items[m.ParentID]; ok && depth < len(menus) {
+			path = pathOf(parent, depth+1) + "/" + m.Code
+		}
+		paths[m.RecordID] = path
+		return path
+	}
+
+	for _, m := range menus {
+		pathOf(m, 0)
+	}
+	return paths
+}
+
+// Export 导出数据(查询条件与分页查询一致)
+func (a *Menu) Export(ctx context.Context, params schema.MenuQueryParam, w exchange.Writer) error {
+	menus, err := a.MenuModel.QuerySelect(ctx, schema.MenuSelectQueryParam{})
+	if err != nil {
+		return err
+	}
+
+	paths := menuCodePaths(menus)
+	items := make(map[string]*schema.MenuSelectQueryResult, len(menus))
+	for _, m := range menus {
+		items[m.RecordID] = m
+	}
+
+	return exportPages(func(beforeID int64) (int, int64, error) {
+		params.BeforeID = beforeID
+		_, results, err := a.MenuModel.QueryPage(ctx, params, 1, exportPageSize)
+		if err != nil {
+			return 0, 0, err
+		} else if len(results) == 0 {
+			return 0, 0, nil
+		}
+
+		for _, item := range results {
+			var method, parent string
+			if m, ok := items[item.RecordID]; ok {
+				method = m.Method
+				if m.ParentID != "" {
+					parent = paths[m.ParentID]
+				}
+			}
+
+			err := w.Write([]string{
+				item.Code,
+				item.Name,
+				strconv.Itoa(item.Type),
+				strconv.Itoa(item.Sequence),
+				item.Icon,
+				item.Path,
+				method,
+				parent,
+				strconv.Itoa(item.IsHide),
+				strconv.Itoa(item.Status),
+			})
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		return len(results), results[len(results)-1].ID, nil
+	})
+}
+
+// Import 导入数据(上级菜单通过编号路径关联，可以是已存在的菜单或同一文件中的菜单)，
+// dryRun为true时仅校验，校验未通过时返回校验报告
+func (a *Menu) Import(ctx context.Context, rows []*exchange.Row, dryRun bool, creator string) (*schema.ImportResult, error) {
+	menus, err := a.MenuModel.QuerySelect(ctx, schema.MenuSelectQueryParam{})
+	if err != nil {
+		return nil, err
+	}
+
+	// 编号路径与菜单内码的对应关系，导入时加入新创建的菜单
+	menuIDs := make(map[string]string, len(menus))
+	for recordID, path := range menuCodePaths(menus) {
+		menuIDs[path] = recordID
+	}
+
+	result := &schema.ImportResult{DryRun: dryRun, Total: len(rows)}
+
+	// 文件中菜单的编号路径及所在行号
+	linePaths := make(map[string]int)
+	for _, row := range rows {
+		path := row.Get("code")
+		if parent := row.Get("parent"); parent != "" {
+			path = parent + "/" + path
+		}
+		if _, ok := linePaths[path]; !ok {
+			linePaths[path] = row.Line
+		}
+	}
+
+	type menuItem struct {
+		*importItem
+		depth int
+	}
+
+	var items []*menuItem
+	for _, row := range rows {
+		n := len(result.Errors)
+		item := &schema.Menu{
+			Code:    row.Get("code"),
+			Name:    row.Get("name"),
+			Icon:    row.Get("icon"),
+			Path:    row.Get("path"),
+			Method:  strings.ToUpper(row.Get("method")),
+			Creator: creator,
+		}
+		parent := row.Get("parent")
+
+		path := item.Code
+		if parent != "" {
+			path = parent + "/" + path
+		}
+
+		if item.Code == "" {
+			addImportError(result, row, "code", "编号不能为空")
+		} else if strings.Contains(item.Code, "/") {
+			addImportError(result, row, "code", "编号不能包含/")
+		} else if _, ok := menuIDs[path]; ok {
+			addImportError(result, row, "code", "编号已经存在")
+		} else if line := linePaths[path]; line != row.Line {
+			addImportError(result, row, "code", fmt.Sprintf("编号与第%d行重复", line))
+		}
+
+		if item.Name == "" {
+			addImportError(result, row, "name", "菜单名称不能为空")
+		}
+
+		switch item.Type = parseImportInt(result, row, "type"); item.Type {
+		case 10, 20, 30, 40:
+		default:
+			addImportError(result, row, "type", "菜单类型只能为10、20、30或40")
+		}
+		item.Sequence = parseImportInt(result, row, "sequence")
+
+		switch row.Get("is_hide") {
+		case "", "2":
+			item.IsHide = 2
+		case "1":
+			item.IsHide = 1
+		default:
+			addImportError(result, row, "is_hide", "是否隐藏只能为1(是)或2(否)")
+		}
+		item.Status = parseImportStatus(result, row, "status")
+
+		if parent != "" {
+			_, exists := menuIDs[parent]
+			if line, ok := linePaths[parent]; !exists && (!ok || line == row.Line) {
+				addImportError(result, row, "parent", fmt.Sprintf("上级菜单[%s]不存在", parent))
+			}
+		}
+
+		if len(result.Errors) == n {
+			items = append(items, &menuItem{
+				importItem: &importItem{
+					line: row.Line,
+					create: func(ctx context.Context) error {
+						if parent != "" {
+							item.ParentID = menuIDs[parent]
+						}
+						if err := a.Create(ctx, item); err != nil {
+							return err
+						}
+						menuIDs[path] = item.RecordID
+						return nil
+					},
+				},
+				depth: strings.Count(path, "/"),
+			})
+		}
+	}
+
+	// 按层级创建，保证上级菜单先于下级菜单创建
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].depth < items[j].depth
+	})
+
+	importItems := make([]*importItem, len(items))
+	for i, item := range items {
+		importItems[i] = item.importItem
+	}
+	return execImport(ctx, a.TransModel, result, importItems)
 }
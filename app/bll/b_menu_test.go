@@ -0,0 +1,123 @@
+package bll
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+)
+
+// newTestMenus 创建菜单树：a(a1(a11),a2)、b
+func newTestMenus(t *testing.T) (*Menu, *modeltest.Menu) {
+	model := new(modeltest.Menu)
+	a := &Menu{MenuModel: model, TransModel: new(modeltest.Trans)}
+
+	create := func(code, parentCode string, sequence int) {
+		var parentID string
+		if parentCode != "" {
+			parentID = model.FindByPath(parentCode).RecordID
+		}
+		item := &schema.Menu{Code: code, Name: code, Type: 20, Sequence: sequence, ParentID: parentID, IsHide: 2, Status: 1}
+		if err := a.Create(context.Background(), item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create("a", "", 10)
+	create("a1", "a", 10)
+	create("a11", "a/a1", 10)
+	create("a2", "a", 20)
+	create("b", "", 20)
+	return a, model
+}
+
+func TestMenuMove(t *testing.T) {
+	ctx := context.Background()
+	a, model := newTestMenus(t)
+	root, child, grandchild := model.FindByPath("a"), model.FindByPath("a/a1"), model.FindByPath("a/a1/a11")
+
+	// 不能移动到自身或下级菜单
+	for _, parentID := range []string{root.RecordID, child.RecordID, grandchild.RecordID} {
+		if err := a.Move(ctx, root.RecordID, schema.MenuMoveParam{ParentID: parentID}, 0); err == nil {
+			t.Fatal("不能移动到自身或下级菜单")
+		}
+	}
+	if model.FindByPath("a").ParentID != "" || model.FindByPath("a/a1/a11").LevelCode != grandchild.LevelCode {
+		t.Fatal("移动失败时不应修改数据")
+	}
+
+	// 移动到其它上级的第一个位置，下级菜单的分级码随之变更
+	b := model.FindByPath("b")
+	if err := a.Move(ctx, child.RecordID, schema.MenuMoveParam{ParentID: b.RecordID, Position: 0}, child.Version); err != nil {
+		t.Fatal(err)
+	}
+	moved, sub := model.FindByPath("b/a1"), model.FindByPath("b/a1/a11")
+	if moved == nil || sub == nil {
+		t.Fatal("应移动菜单及下级菜单")
+	} else if !strings.HasPrefix(moved.LevelCode, b.LevelCode) || !strings.HasPrefix(sub.LevelCode, moved.LevelCode) {
+		t.Fatalf("分级码错误：%s,%s,%s", b.LevelCode, moved.LevelCode, sub.LevelCode)
+	} else if moved.Sequence != 10 {
+		t.Fatalf("排序值错误：%d", moved.Sequence)
+	}
+
+	// 版本号过期
+	if err := a.Move(ctx, moved.RecordID, schema.MenuMoveParam{ParentID: root.RecordID}, 1); err == nil {
+		t.Fatal("版本号过期时应移动失败")
+	}
+}
+
+func TestMenuReorder(t *testing.T) {
+	ctx := context.Background()
+	a, model := newTestMenus(t)
+	root, a1, a2 := model.FindByPath("a"), model.FindByPath("a/a1"), model.FindByPath("a/a2")
+
+	// 必须包含全部同级菜单
+	for _, ids := range [][]string{{a2.RecordID}, {a2.RecordID, a2.RecordID}, {a2.RecordID, root.RecordID}} {
+		if err := a.Reorder(ctx, schema.MenuReorderParam{ParentID: root.RecordID, IDs: ids}); err == nil {
+			t.Fatalf("排序的菜单不完整时应失败：%v", ids)
+		}
+	}
+
+	err := a.Reorder(ctx, schema.MenuReorderParam{ParentID: root.RecordID, IDs: []string{a2.RecordID, a1.RecordID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, _ := model.QueryChildren(ctx, root.RecordID)
+	if len(children) != 2 || children[0].Code != "a2" || children[0].Sequence != 10 || children[1].Sequence != 20 {
+		t.Fatalf("排序结果错误：%+v,%+v", children[0], children[1])
+	}
+}
+
+func TestMenuCopy(t *testing.T) {
+	ctx := context.Background()
+	a, model := newTestMenus(t)
+	src := model.FindByPath("a")
+
+	item, err := a.Copy(ctx, src.RecordID, schema.MenuCopyParam{}, "u1")
+	if err != nil {
+		t.Fatal(err)
+	} else if item.Code != "a_copy" || item.Name != "a(副本)" || item.Creator != "u1" {
+		t.Fatalf("复制的菜单错误：%+v", item)
+	}
+
+	// 复制全部下级菜单，下级保留原编号并使用新的记录内码及分级码
+	for _, path := range []string{"a_copy/a1", "a_copy/a1/a11", "a_copy/a2"} {
+		copied := model.FindByPath(path)
+		orig := model.FindByPath("a" + strings.TrimPrefix(path, "a_copy"))
+		if copied == nil {
+			t.Fatalf("未复制下级菜单[%s]", path)
+		} else if copied.RecordID == orig.RecordID || copied.LevelCode == orig.LevelCode ||
+			!strings.HasPrefix(copied.LevelCode, item.LevelCode) {
+			t.Fatalf("复制的下级菜单[%s]错误：%+v", path, copied)
+		}
+	}
+	if len(model.Items) != 9 {
+		t.Fatalf("菜单数量错误：%d", len(model.Items))
+	}
+
+	// 编号已存在
+	if _, err := a.Copy(ctx, src.RecordID, schema.MenuCopyParam{Code: "b"}, "u1"); err == nil {
+		t.Fatal("编号已存在时应复制失败")
+	}
+}
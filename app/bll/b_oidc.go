@@ -0,0 +1,265 @@
+package bll
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"moddns/app/logger"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/oidc"
+)
+
+// ErrOIDCDisabled 未启用OIDC登录
+var ErrOIDCDisabled = errors.New("未启用OIDC登录")
+
+type (
+	// OIDCOption OIDC登录的配置项
+	OIDCOption func(*oidcOptions)
+
+	oidcOptions struct {
+		provider      *oidc.Provider      // 身份提供方
+		userClaim     string              // 对应本地用户名的声明
+		nameClaim     string              // 真实姓名的声明
+		autoProvision bool                // 首次登录时是否自动创建本地用户
+		linkExisting  bool                // 首次登录时是否允许关联同名的本地或LDAP用户
+		defaultRole   string              // 自动创建的用户未匹配到角色时分配的角色名称
+		roleClaim     string              // 映射角色的声明(字符串或字符串数组)
+		claimRoles    map[string][]string // 声明值与角色名称的映射
+	}
+)
+
+// SetOIDCProvider 设置身份提供方(未设置时不启用OIDC登录)
+func SetOIDCProvider(provider *oidc.Provider) OIDCOption {
+	return func(o *oidcOptions) {
+		o.provider = provider
+	}
+}
+
+// SetOIDCUserClaim 设置对应本地用户名的声明及真实姓名的声明
+func SetOIDCUserClaim(userClaim, nameClaim string) OIDCOption {
+	return func(o *oidcOptions) {
+		if userClaim != "" {
+			o.userClaim = userClaim
+		}
+		if nameClaim != "" {
+			o.nameClaim = nameClaim
+		}
+	}
+}
+
+// SetOIDCProvision 设置首次登录时是否自动创建本地用户及默认角色
+func SetOIDCProvision(autoProvision bool, defaultRole string) OIDCOption {
+	return func(o *oidcOptions) {
+		o.autoProvision = autoProvision
+		o.defaultRole = defaultRole
+	}
+}
+
+// SetOIDCLinkExisting 设置首次登录时是否允许按用户声明关联同名的本地或LDAP用户
+// (默认仅关联认证来源为OIDC的用户)
+func SetOIDCLinkExisting(linkExisting bool) OIDCOption {
+	return func(o *oidcOptions) {
+		o.linkExisting = linkExisting
+	}
+}
+
+// SetOIDCRoleClaim 设置映射角色的声明(如groups)
+func SetOIDCRoleClaim(claim string) OIDCOption {
+	return func(o *oidcOptions) {
+		o.roleClaim = claim
+	}
+}
+
+// SetOIDCClaimRole 添加声明值与角色名称的映射，配置后OIDC用户每次登录时同步角色
+func SetOIDCClaimRole(value, role string) OIDCOption {
+	return func(o *oidcOptions) {
+		if o.claimRoles == nil {
+			o.claimRoles = make(map[string][]string)
+		}
+		o.claimRoles[value] = append(o.claimRoles[value], role)
+	}
+}
+
+// NewOIDC 创建OIDC登录
+func NewOIDC(opts ...OIDCOption) *OIDC {
+	o := &oidcOptions{
+		userClaim: "preferred_username",
+		nameClaim: "name",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &OIDC{opts: o}
+}
+
+// OIDC OpenID Connect单点登录：校验身份提供方签发的ID令牌，
+// 首次登录时按配置的声明关联(或创建)本地用户并记录签发方及用户标识(sub)，
+// 之后按签发方及用户标识匹配，未配置时(如未注入)不启用
+type OIDC struct {
+	UserModel models.IUser `inject:"IUser"`
+	RoleModel models.IRole `inject:"IRole"`
+	UserBll   *User        `inject:""`
+	opts      *oidcOptions
+}
+
+// Enabled 是否启用OIDC登录
+func (a *OIDC) Enabled() bool {
+	return a.opts != nil && a.opts.provider != nil
+}
+
+// AuthCodeURL 生成身份提供方的授权地址
+func (a *OIDC) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	if !a.Enabled() {
+		return "", ErrOIDCDisabled
+	}
+	return a.opts.provider.AuthCodeURL(ctx, state, nonce, verifier)
+}
+
+// Login 使用授权码换取并校验ID令牌，返回关联的本地用户；
+// 用户不存在且未开启自动创建时返回ErrInvalidUserName
+func (a *OIDC) Login(ctx context.Context, code, verifier, nonce string) (*schema.User, error) {
+	if !a.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	token, err := a.opts.provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := a.opts.provider.VerifyIDToken(ctx, token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, subject := claims.String("iss"), claims.String("sub")
+	if subject == "" {
+		return nil, errors.New("ID令牌缺少用户标识(sub)")
+	}
+
+	// 用户声明可能被修改，已关联的用户按签发方及用户标识匹配
+	user, err := a.UserModel.GetByOIDCSubject(ctx, issuer, subject, true)
+	if err != nil {
+		return nil, err
+	} else if user == nil {
+		var created bool
+		user, created, err = a.link(ctx, issuer, subject, claims)
+		if err != nil || created {
+			return user, err
+		}
+	}
+	if user.Status != 1 {
+		return nil, ErrUserDisable
+	}
+
+	// 仅同步由OIDC创建的用户，关联的本地(或LDAP)用户的角色由管理员维护
+	if user.Source == schema.UserSourceOIDC && a.opts.roleClaim != "" && len(a.opts.claimRoles) > 0 {
+		roleIDs, err := a.mapRoles(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if err := syncUser(ctx, a.UserBll, user, a.realName(user.UserName, claims), roleIDs); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// link 首次登录时按用户声明关联本地用户并记录签发方及用户标识，用户不存在时按配置自动创建(created为true)；
+// 用户声明未必经过身份提供方验证，默认仅关联认证来源为OIDC且尚未关联的用户
+func (a *OIDC) link(ctx context.Context, issuer, subject string, claims oidc.Claims) (*schema.User, bool, error) {
+	userName := claims.String(a.opts.userClaim)
+	if userName == "" {
+		return nil, false, fmt.Errorf("ID令牌缺少用户声明[%s]", a.opts.userClaim)
+	}
+	if a.opts.userClaim == "email" {
+		// 未经验证的邮箱可以由用户自行填写，不能用于关联本地用户
+		if verified, _ := claims.Bool("email_verified"); !verified {
+			return nil, false, fmt.Errorf("OIDC用户[%s]的邮箱未验证", userName)
+		}
+	}
+	if rootUser := viper.GetStringSlice("system_root_user"); len(rootUser) == 2 && rootUser[0] == userName {
+		logger.LoginWithContext(ctx).Warnf("OIDC用户[%s]与超级用户重名", userName)
+		return nil, false, ErrInvalidUserName
+	}
+
+	user, err := a.UserModel.GetByUserName(ctx, userName, true)
+	if err != nil {
+		return nil, false, err
+	} else if user == nil {
+		if !a.opts.autoProvision {
+			logger.LoginWithContext(ctx).Warnf("OIDC用户[%s]未开通本地用户", userName)
+			return nil, false, ErrInvalidUserName
+		}
+		user, err = a.provision(ctx, userName, issuer, subject, claims)
+		return user, err == nil, err
+	} else if user.OIDCSubject != "" {
+		logger.LoginWithContext(ctx).Warnf("OIDC用户[%s]的同名用户已关联其它OIDC用户", userName)
+		return nil, false, ErrInvalidUserName
+	} else if user.Source != schema.UserSourceOIDC && !a.opts.linkExisting {
+		logger.LoginWithContext(ctx).Warnf("OIDC用户[%s]的同名用户不是OIDC用户，未允许关联", userName)
+		return nil, false, ErrInvalidUserName
+	}
+
+	if err := a.UserModel.UpdateOIDCSubject(ctx, user.RecordID, issuer, subject); err != nil {
+		return nil, false, err
+	}
+	a.UserBll.invalidate(ctx)
+	logger.LoginWithContext(ctx).Infof("OIDC用户[%s]已关联本地用户", userName)
+
+	user.OIDCIssuer, user.OIDCSubject = issuer, subject
+	user.Version++ // 更新时版本号递增，同步角色时需要使用新的版本号
+	return user, false, nil
+}
+
+// realName 获取真实姓名(为空时使用用户名)
+func (a *OIDC) realName(userName string, claims oidc.Claims) string {
+	if v := claims.String(a.opts.nameClaim); v != "" {
+		return v
+	}
+	return userName
+}
+
+// provision 为首次登录的OIDC用户创建本地用户
+func (a *OIDC) provision(ctx context.Context, userName, issuer, subject string, claims oidc.Claims) (*schema.User, error) {
+	roleIDs, err := a.mapRoles(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &schema.User{
+		UserName: userName,
+		RealName: a.realName(userName, claims),
+		Source:   schema.UserSourceOIDC,
+		Status:   1,
+		RoleIDs:  roleIDs,
+
+		OIDCIssuer:  issuer,
+		OIDCSubject: subject,
+	}
+	if err := a.UserBll.Create(ctx, item); err != nil {
+		return nil, err
+	}
+	logger.LoginWithContext(ctx).Infof("已为OIDC用户[%s]创建本地用户", userName)
+
+	return item, nil
+}
+
+// mapRoles 根据声明值映射启用的角色，未匹配到角色时使用默认角色
+func (a *OIDC) mapRoles(ctx context.Context, claims oidc.Claims) ([]string, error) {
+	names := make(map[string]bool)
+	if a.opts.roleClaim != "" {
+		for _, v := range claims.Strings(a.opts.roleClaim) {
+			for _, name := range a.opts.claimRoles[v] {
+				names[name] = true
+			}
+		}
+	}
+	if len(names) == 0 && a.opts.defaultRole != "" {
+		names[a.opts.defaultRole] = true
+	}
+	return resolveRoles(ctx, a.RoleModel, names, "OIDC声明")
+}
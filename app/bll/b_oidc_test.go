@@ -0,0 +1,132 @@
+package bll
+
+import (
+	"context"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/app/service/oidc"
+	"moddns/app/service/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/casbin/casbin"
+)
+
+// newTestOIDC 创建使用进程内身份提供方的OIDC登录，返回使用指定声明登录的函数及关闭身份提供方的函数
+func newTestOIDC(t *testing.T, users *modeltest.User, opts ...OIDCOption) (func(claims map[string]interface{}) (*schema.User, error), func()) {
+	srv, err := oidctest.NewServer("moddns", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const redirectURL = "http://127.0.0.1/api/v1/login/oidc/callback"
+	provider := oidc.NewProvider(
+		oidc.SetIssuer(srv.Issuer()),
+		oidc.SetClient("moddns", "s3cret"),
+		oidc.SetRedirectURL(redirectURL),
+		oidc.SetJWKSRefreshInterval(0),
+	)
+
+	roles := new(modeltest.Role)
+	a := NewOIDC(append([]OIDCOption{SetOIDCProvider(provider)}, opts...)...)
+	a.UserModel = users
+	a.RoleModel = roles
+	a.UserBll = &User{
+		UserModel:  users,
+		RoleModel:  roles,
+		TransModel: new(modeltest.Trans),
+		Enforcer:   casbin.NewEnforcer("../../config/model.conf", false),
+	}
+
+	cli := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	login := func(claims map[string]interface{}) (*schema.User, error) {
+		ctx := context.Background()
+		srv.SetClaims(claims)
+
+		verifier, _ := oidc.RandomString(32)
+		authURL, err := a.AuthCodeURL(ctx, "state", "nonce", verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cli.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		loc, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.Login(ctx, loc.Query().Get("code"), verifier, "nonce")
+	}
+	return login, srv.Close
+}
+
+// TestOIDCLink 首次登录按用户声明关联用户并记录用户标识，之后按用户标识匹配；
+// 默认不关联同名的本地或LDAP用户，已关联的用户不能被其它用户标识关联
+func TestOIDCLink(t *testing.T) {
+	users := &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "alice", Status: 1},
+		{RecordID: "u2", UserName: "bob", Source: schema.UserSourceOIDC, Status: 1},
+		{RecordID: "u3", UserName: "carol", Source: schema.UserSourceLDAP, Status: 1},
+	}}
+	login, closeFn := newTestOIDC(t, users)
+	defer closeFn()
+
+	if _, err := login(map[string]interface{}{"sub": "s1", "preferred_username": "alice"}); err != ErrInvalidUserName {
+		t.Fatalf("不应关联同名的本地用户：%v", err)
+	} else if _, err := login(map[string]interface{}{"sub": "s1", "preferred_username": "carol"}); err != ErrInvalidUserName {
+		t.Fatalf("不应关联同名的LDAP用户：%v", err)
+	} else if _, err := login(map[string]interface{}{"preferred_username": "bob"}); err == nil {
+		t.Fatal("缺少用户标识时应登录失败")
+	}
+
+	user, err := login(map[string]interface{}{"sub": "s2", "preferred_username": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	} else if user.RecordID != "u2" || users.Find("u2").OIDCSubject != "s2" {
+		t.Fatalf("应关联认证来源为OIDC的用户：%+v", users.Find("u2"))
+	}
+
+	// 用户声明被修改后仍按用户标识匹配
+	if user, err := login(map[string]interface{}{"sub": "s2", "preferred_username": "alice"}); err != nil || user.RecordID != "u2" {
+		t.Fatalf("已关联的用户应按用户标识匹配：%v,%v", user, err)
+	}
+	// 其它用户标识使用已关联用户的用户名
+	if _, err := login(map[string]interface{}{"sub": "s3", "preferred_username": "bob"}); err != ErrInvalidUserName {
+		t.Fatalf("已关联的用户不能被其它用户标识关联：%v", err)
+	}
+
+	users.Find("u2").Status = 2
+	if _, err := login(map[string]interface{}{"sub": "s2", "preferred_username": "bob"}); err != ErrUserDisable {
+		t.Fatalf("停用的用户应登录失败：%v", err)
+	}
+}
+
+// TestOIDCLinkExisting 允许关联时首次登录关联同名的本地用户，自动创建的用户记录用户标识
+func TestOIDCLinkExisting(t *testing.T) {
+	users := &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "alice", Status: 1},
+	}}
+	login, closeFn := newTestOIDC(t, users, SetOIDCLinkExisting(true), SetOIDCProvision(true, ""))
+	defer closeFn()
+
+	if user, err := login(map[string]interface{}{"sub": "s1", "preferred_username": "alice"}); err != nil || user.RecordID != "u1" {
+		t.Fatalf("允许关联时应关联同名的本地用户：%v,%v", user, err)
+	} else if item := users.Find("u1"); item.OIDCSubject != "s1" || item.Source != schema.UserSourceLocal {
+		t.Fatalf("关联后应记录用户标识且不修改认证来源：%+v", item)
+	}
+
+	user, err := login(map[string]interface{}{"sub": "s2", "preferred_username": "dave"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := users.FindByUserName("dave")
+	if item == nil || item.RecordID != user.RecordID || item.Source != schema.UserSourceOIDC || item.OIDCSubject != "s2" || item.OIDCIssuer == "" {
+		t.Fatalf("自动创建的用户应记录签发方及用户标识：%+v", item)
+	}
+}
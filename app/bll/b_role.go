@@ -2,7 +2,10 @@ package bll
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,20 +14,52 @@ import (
 	"github.com/pkg/errors"
 	"moddns/app/models"
 	"moddns/app/schema"
+	"moddns/app/service/cache"
+	"moddns/app/service/exchange"
 	"moddns/app/util"
 )
 
+// RoleColumns 角色导入导出的列(menus为以|分隔的菜单编号路径)
+var RoleColumns = []string{"name", "memo", "status", "menus"}
+
 // Role 角色管理
 type Role struct {
-	RoleModel models.IRole     `inject:"IRole"`
-	MenuModel models.IMenu     `inject:"IMenu"`
-	UserModel models.IUser     `inject:"IUser"`
-	Enforcer  *casbin.Enforcer `inject:""`
+	RoleModel  models.IRole     `inject:"IRole"`
+	MenuModel  models.IMenu     `inject:"IMenu"`
+	UserModel  models.IUser     `inject:"IUser"`
+	TransModel models.ITrans    `inject:"ITrans"`
+	Enforcer   *casbin.Enforcer `inject:""`
+	Loader     *Loader          `inject:""`
+	Cache      *cache.Cache     `inject:""`
+}
+
+// invalidate 数据提交后使角色、菜单(用户菜单)及用户(用户角色)的查询缓存失效
+func (a *Role) invalidate(ctx context.Context) {
+	invalidateCache(ctx, a.TransModel, a.Cache, cache.NSRole, cache.NSMenu, cache.NSUser)
 }
 
 // QueryPage 查询分页数据
 func (a *Role) QueryPage(ctx context.Context, params schema.RoleQueryParam, pageIndex, pageSize uint) (int64, []*schema.RoleQueryResult, error) {
-	return a.RoleModel.QueryPage(ctx, params, pageIndex, pageSize)
+	total, items, err := a.RoleModel.QueryPage(ctx, params, pageIndex, pageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	creators := make([]string, len(items))
+	for i, item := range items {
+		creators[i] = item.Creator
+	}
+
+	creatorNames, err := a.Loader.UserNames(ctx, creators)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, item := range items {
+		item.CreatorName = creatorNames[item.Creator]
+	}
+
+	return total, items, nil
 }
 
 // QuerySelect 查询选择数据
@@ -46,6 +81,10 @@ func (a *Role) Get(ctx context.Context, recordID string) (*schema.Role, error) {
 
 // 过滤叶子节点
 func (a *Role) filterLeafMenuIDs(ctx context.Context, menuIDs []string) ([]string, error) {
+	if len(menuIDs) == 0 {
+		return nil, nil
+	}
+
 	menus, err := a.MenuModel.QuerySelect(ctx, schema.MenuSelectQueryParam{
 		RecordIDs: menuIDs,
 		Status:    1,
@@ -54,19 +93,17 @@ func (a *Role) filterLeafMenuIDs(ctx context.Context, menuIDs []string) ([]strin
 		return nil, err
 	}
 
+	// 按分级码排序后，下级菜单紧随上级菜单之后
+	sort.Slice(menus, func(i, j int) bool {
+		return menus[i].LevelCode < menus[j].LevelCode
+	})
+
 	var leafMenuIDs []string
-	for _, m := range menus {
-		var exists bool
-		for _, m2 := range menus {
-			if strings.HasPrefix(m2.LevelCode, m.LevelCode) &&
-				m2.LevelCode != m.LevelCode {
-				exists = true
-				break
-			}
-		}
-		if !exists {
-			leafMenuIDs = append(leafMenuIDs, m.RecordID)
+	for i, m := range menus {
+		if i+1 < len(menus) && strings.HasPrefix(menus[i+1].LevelCode, m.LevelCode) {
+			continue
 		}
+		leafMenuIDs = append(leafMenuIDs, m.RecordID)
 	}
 
 	return leafMenuIDs, nil
@@ -86,15 +123,18 @@ func (a *Role) Create(ctx context.Context, item *schema.Role) error {
 		return err
 	}
 	item.MenuIDs = leafMenuIDs
+	item.Require2FA = normalizeRequire2FA(item.Require2FA)
 
 	item.ID = 0
 	item.RecordID = uuid.New().String()
 	item.Created = time.Now().Unix()
 	item.Deleted = 0
+	item.Version = 1
 	err = a.RoleModel.Create(ctx, item)
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
 
 	return a.LoadPolicy(ctx, item.RecordID)
 }
@@ -120,6 +160,7 @@ func (a *Role) Update(ctx context.Context, recordID string, item *schema.Role) e
 		return err
 	}
 	item.MenuIDs = leafMenuIDs
+	item.Require2FA = normalizeRequire2FA(item.Require2FA)
 
 	info := util.StructToMap(item)
 	delete(info, "id")
@@ -129,10 +170,11 @@ func (a *Role) Update(ctx context.Context, recordID string, item *schema.Role) e
 	delete(info, "updated")
 	delete(info, "deleted")
 
-	err = a.RoleModel.UpdateWithMenuIDs(ctx, recordID, info, item.MenuIDs)
+	err = a.RoleModel.UpdateWithMenuIDs(ctx, recordID, info, item.MenuIDs, item.Version)
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
 
 	return a.LoadPolicy(ctx, item.RecordID)
 }
@@ -157,13 +199,21 @@ func (a *Role) Delete(ctx context.Context, recordID string) error {
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
 
-	a.Enforcer.DeletePermissionsForUser(recordID)
+	a.TransModel.AfterCommit(ctx, func() {
+		a.Enforcer.DeletePermissionsForUser(recordID)
+	})
 	return nil
 }
 
-// UpdateStatus 更新状态
-func (a *Role) UpdateStatus(ctx context.Context, recordID string, status int) error {
+// DeleteMany 删除多条数据(全部成功或全部回滚)
+func (a *Role) DeleteMany(ctx context.Context, recordIDs []string) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, a.Delete)
+}
+
+// UpdateStatus 更新状态(version大于0时校验版本号)
+func (a *Role) UpdateStatus(ctx context.Context, recordID string, status int, version int64) error {
 	exists, err := a.RoleModel.Check(ctx, recordID)
 	if err != nil {
 		return err
@@ -175,13 +225,16 @@ func (a *Role) UpdateStatus(ctx context.Context, recordID string, status int) er
 		"status": status,
 	}
 
-	err = a.RoleModel.Update(ctx, recordID, info)
+	err = a.RoleModel.Update(ctx, recordID, info, version)
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
 
 	if status == 2 {
-		a.Enforcer.DeletePermissionsForUser(recordID)
+		a.TransModel.AfterCommit(ctx, func() {
+			a.Enforcer.DeletePermissionsForUser(recordID)
+		})
 	} else {
 		err = a.LoadPolicy(ctx, recordID)
 		if err != nil {
@@ -192,6 +245,13 @@ func (a *Role) UpdateStatus(ctx context.Context, recordID string, status int) er
 	return nil
 }
 
+// UpdateStatusMany 更新多条数据的状态(全部成功或全部回滚)
+func (a *Role) UpdateStatusMany(ctx context.Context, recordIDs []string, status int) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, func(ctx context.Context, recordID string) error {
+		return a.UpdateStatus(ctx, recordID, status, 0)
+	})
+}
+
 // LoadAllPolicy 加载所有的角色策略
 func (a *Role) LoadAllPolicy() error {
 	ctx := context.Background()
@@ -224,13 +284,197 @@ func (a *Role) LoadPolicy(ctx context.Context, roleID string) error {
 		return err
 	}
 
-	a.Enforcer.DeletePermissionsForUser(roleID)
-	for _, menu := range menus {
-		if menu.Path == "" || menu.Method == "" {
-			continue
+	a.TransModel.AfterCommit(ctx, func() {
+		a.Enforcer.DeletePermissionsForUser(roleID)
+		for _, menu := range menus {
+			if menu.Path == "" || menu.Method == "" {
+				continue
+			}
+			a.Enforcer.AddPermissionForUser(roleID, menu.Path, menu.Method)
 		}
-		a.Enforcer.AddPermissionForUser(roleID, menu.Path, menu.Method)
+	})
+
+	return nil
+}
+
+// QueryDeletedPage 查询已删除的分页数据(回收站)
+func (a *Role) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	return a.RoleModel.QueryDeletedPage(ctx, pageIndex, pageSize)
+}
+
+// Restore 恢复已删除的数据
+func (a *Role) Restore(ctx context.Context, recordID string) error {
+	item, err := a.RoleModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	exists, err := a.RoleModel.CheckName(ctx, item.Name)
+	if err != nil {
+		return err
+	} else if exists {
+		return util.NewConflictError("角色名称已经存在，不能恢复")
 	}
 
+	return a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		err := a.RoleModel.Restore(ctx, recordID, item.Deleted)
+		if err != nil {
+			return err
+		}
+		a.invalidate(ctx)
+
+		if item.Status == 2 {
+			return nil
+		}
+		return a.LoadPolicy(ctx, recordID)
+	})
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Role) Purge(ctx context.Context, recordID string) error {
+	item, err := a.RoleModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	if err := a.RoleModel.Purge(ctx, recordID); err != nil {
+		return err
+	}
+
+	a.invalidate(ctx)
 	return nil
 }
+
+// PurgeExpired 彻底删除指定时间之前删除的数据
+func (a *Role) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	n, err := a.RoleModel.PurgeExpired(ctx, before.Unix())
+	if err == nil && n > 0 {
+		a.invalidate(ctx)
+	}
+	return n, err
+}
+
+// Export 导出数据(查询条件与分页查询一致)
+func (a *Role) Export(ctx context.Context, params schema.RoleQueryParam, w exchange.Writer) error {
+	menus, err := a.MenuModel.QuerySelect(ctx, schema.MenuSelectQueryParam{})
+	if err != nil {
+		return err
+	}
+	menuPaths := menuCodePaths(menus)
+
+	return exportPages(func(beforeID int64) (int, int64, error) {
+		params.BeforeID = beforeID
+		_, items, err := a.RoleModel.QueryPage(ctx, params, 1, exportPageSize)
+		if err != nil {
+			return 0, 0, err
+		} else if len(items) == 0 {
+			return 0, 0, nil
+		}
+
+		roleIDs := make([]string, len(items))
+		for i, item := range items {
+			roleIDs[i] = item.RecordID
+		}
+
+		roleMenus, err := a.RoleModel.QueryRoleMenus(ctx, schema.RoleMenuQueryParam{RoleIDs: roleIDs})
+		if err != nil {
+			return 0, 0, err
+		}
+
+		paths := make(map[string][]string)
+		for _, rm := range roleMenus {
+			if path, ok := menuPaths[rm.MenuID]; ok {
+				paths[rm.RoleID] = append(paths[rm.RoleID], path)
+			}
+		}
+
+		for _, item := range items {
+			err := w.Write([]string{
+				item.Name,
+				item.Memo,
+				strconv.Itoa(item.Status),
+				exchange.JoinList(paths[item.RecordID]),
+			})
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		return len(items), items[len(items)-1].ID, nil
+	})
+}
+
+// Import 导入数据(菜单通过编号路径关联)，dryRun为true时仅校验，校验未通过时返回校验报告
+func (a *Role) Import(ctx context.Context, rows []*exchange.Row, dryRun bool, creator string) (*schema.ImportResult, error) {
+	menus, err := a.MenuModel.QuerySelect(ctx, schema.MenuSelectQueryParam{})
+	if err != nil {
+		return nil, err
+	}
+
+	menuIDs := make(map[string]string, len(menus))
+	for recordID, path := range menuCodePaths(menus) {
+		menuIDs[path] = recordID
+	}
+
+	result := &schema.ImportResult{DryRun: dryRun, Total: len(rows)}
+	names := make(map[string]int)
+
+	var items []*importItem
+	for _, row := range rows {
+		n := len(result.Errors)
+		item := &schema.Role{
+			Name:    row.Get("name"),
+			Memo:    row.Get("memo"),
+			Creator: creator,
+		}
+
+		if item.Name == "" {
+			addImportError(result, row, "name", "角色名称不能为空")
+		} else if line, ok := names[item.Name]; ok {
+			addImportError(result, row, "name", fmt.Sprintf("角色名称与第%d行重复", line))
+		} else {
+			names[item.Name] = row.Line
+			exists, err := a.RoleModel.CheckName(ctx, item.Name)
+			if err != nil {
+				return nil, err
+			} else if exists {
+				addImportError(result, row, "name", "角色名称已经存在")
+			}
+		}
+		item.Status = parseImportStatus(result, row, "status")
+
+		paths := exchange.SplitList(row.Get("menus"))
+		if len(paths) == 0 {
+			addImportError(result, row, "menus", "菜单不能为空")
+		}
+		for _, path := range paths {
+			if menuID, ok := menuIDs[path]; ok {
+				item.MenuIDs = append(item.MenuIDs, menuID)
+			} else {
+				addImportError(result, row, "menus", fmt.Sprintf("菜单[%s]不存在", path))
+			}
+		}
+
+		if len(result.Errors) == n {
+			items = append(items, &importItem{
+				line: row.Line,
+				create: func(ctx context.Context) error {
+					return a.Create(ctx, item)
+				},
+			})
+		}
+	}
+
+	return execImport(ctx, a.TransModel, result, items)
+}
+
+// normalizeRequire2FA 规范化是否强制两步验证(1是 2否，未指定时不强制)
+func normalizeRequire2FA(v int) int {
+	if v != 1 {
+		return 2
+	}
+	return v
+}
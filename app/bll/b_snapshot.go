@@ -0,0 +1,720 @@
+package bll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/cache"
+)
+
+// 配置快照的格式
+const (
+	SnapshotFormatYAML = "yaml"
+	SnapshotFormatJSON = "json"
+)
+
+// ParseSnapshotFormat 解析配置快照的格式(为空时默认为yaml，兼容文件扩展名)
+func ParseSnapshotFormat(s string) (string, error) {
+	s = strings.ToLower(strings.TrimPrefix(filepath.Ext("."+s), "."))
+	switch s {
+	case "", "yml", SnapshotFormatYAML:
+		return SnapshotFormatYAML, nil
+	case SnapshotFormatJSON:
+		return SnapshotFormatJSON, nil
+	}
+	return "", fmt.Errorf("不支持的快照格式：%s", s)
+}
+
+// MarshalSnapshot 编码配置快照
+func MarshalSnapshot(snap *schema.Snapshot, format string) ([]byte, error) {
+	var (
+		buf []byte
+		err error
+	)
+	if format == SnapshotFormatJSON {
+		buf, err = json.MarshalIndent(snap, "", "  ")
+	} else {
+		buf, err = yaml.Marshal(snap)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "编码配置快照发生错误")
+	}
+	return buf, nil
+}
+
+// UnmarshalSnapshot 解码配置快照
+func UnmarshalSnapshot(buf []byte, format string) (*schema.Snapshot, error) {
+	var (
+		snap schema.Snapshot
+		err  error
+	)
+	if format == SnapshotFormatJSON {
+		err = json.Unmarshal(buf, &snap)
+	} else {
+		err = yaml.Unmarshal(buf, &snap)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "解析配置快照发生错误")
+	}
+	return &snap, nil
+}
+
+// Snapshot 配置快照(用于在不同环境之间迁移菜单、角色授权及用户配置)
+type Snapshot struct {
+	MenuBll    *Menu         `inject:""`
+	RoleBll    *Role         `inject:""`
+	UserBll    *User         `inject:""`
+	MenuModel  models.IMenu  `inject:"IMenu"`
+	RoleModel  models.IRole  `inject:"IRole"`
+	UserModel  models.IUser  `inject:"IUser"`
+	TransModel models.ITrans `inject:"ITrans"`
+	Cache      *cache.Cache  `inject:""`
+}
+
+// snapshotState 当前的配置数据
+type snapshotState struct {
+	menus     []*schema.MenuSelectQueryResult          // 菜单(按分级码排序)
+	menuPaths map[string]string                        // 菜单内码与编号路径
+	menuItems map[string]*schema.MenuSelectQueryResult // 编号路径与菜单
+	roles     map[string]*schema.RoleQueryResult       // 角色名称与角色
+	roleMenus map[string][]string                      // 角色内码与授权菜单的编号路径(已排序)
+	users     map[string]*schema.UserQueryResult       // 用户名与用户
+	userRoles map[string][]string                      // 用户内码与角色名称(已排序)
+}
+
+// load 加载当前的配置数据
+func (a *Snapshot) load(ctx context.Context, includeUsers bool) (*snapshotState, error) {
+	menus, err := a.MenuModel.QuerySelect(ctx, schema.MenuSelectQueryParam{})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(menus, func(i, j int) bool {
+		return menus[i].LevelCode < menus[j].LevelCode
+	})
+
+	st := &snapshotState{
+		menus:     menus,
+		menuPaths: menuCodePaths(menus),
+		menuItems: make(map[string]*schema.MenuSelectQueryResult),
+		roles:     make(map[string]*schema.RoleQueryResult),
+		roleMenus: make(map[string][]string),
+		users:     make(map[string]*schema.UserQueryResult),
+		userRoles: make(map[string][]string),
+	}
+	for _, m := range menus {
+		st.menuItems[st.menuPaths[m.RecordID]] = m
+	}
+
+	roleNames := make(map[string]string)
+	err = exportPages(func(beforeID int64) (int, int64, error) {
+		_, items, err := a.RoleModel.QueryPage(ctx, schema.RoleQueryParam{BeforeID: beforeID}, 1, exportPageSize)
+		if err != nil || len(items) == 0 {
+			return 0, 0, err
+		}
+		for _, item := range items {
+			st.roles[item.Name] = item
+			roleNames[item.RecordID] = item.Name
+		}
+		return len(items), items[len(items)-1].ID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	roleMenus, err := a.RoleModel.QueryRoleMenus(ctx, schema.RoleMenuQueryParam{})
+	if err != nil {
+		return nil, err
+	}
+	for _, rm := range roleMenus {
+		if path, ok := st.menuPaths[rm.MenuID]; ok {
+			st.roleMenus[rm.RoleID] = append(st.roleMenus[rm.RoleID], path)
+		}
+	}
+	for _, paths := range st.roleMenus {
+		sort.Strings(paths)
+	}
+
+	if !includeUsers {
+		return st, nil
+	}
+
+	err = exportPages(func(beforeID int64) (int, int64, error) {
+		_, items, err := a.UserModel.QueryPage(ctx, schema.UserQueryParam{BeforeID: beforeID}, 1, exportPageSize)
+		if err != nil || len(items) == 0 {
+			return 0, 0, err
+		}
+		for _, item := range items {
+			st.users[item.UserName] = item
+		}
+		return len(items), items[len(items)-1].ID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	userRoles, err := a.UserModel.QueryUserRoles(ctx, schema.UserRoleQueryParam{})
+	if err != nil {
+		return nil, err
+	}
+	for _, ur := range userRoles {
+		if name, ok := roleNames[ur.RoleID]; ok {
+			st.userRoles[ur.UserID] = append(st.userRoles[ur.UserID], name)
+		}
+	}
+	for _, names := range st.userRoles {
+		sort.Strings(names)
+	}
+
+	return st, nil
+}
+
+// Export 导出配置快照，includeUsers为true时包含用户(不包含密码)
+func (a *Snapshot) Export(ctx context.Context, includeUsers bool) (*schema.Snapshot, error) {
+	st, err := a.load(ctx, includeUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &schema.Snapshot{
+		Version: schema.SnapshotVersion,
+		Menus:   make([]*schema.SnapshotMenu, 0, len(st.menus)),
+		Roles:   make([]*schema.SnapshotRole, 0, len(st.roles)),
+	}
+
+	for _, m := range st.menus {
+		path := st.menuPaths[m.RecordID]
+		if m.Code == "" {
+			return nil, fmt.Errorf("菜单[%s]未设置编号，不能导出快照", m.Name)
+		} else if st.menuItems[path] != m {
+			return nil, fmt.Errorf("菜单编号路径[%s]重复，不能导出快照", path)
+		}
+
+		snap.Menus = append(snap.Menus, &schema.SnapshotMenu{
+			Code:     path,
+			Name:     m.Name,
+			Type:     m.Type,
+			Sequence: m.Sequence,
+			Icon:     m.Icon,
+			Path:     m.Path,
+			Method:   m.Method,
+			IsHide:   m.IsHide,
+			Status:   m.Status,
+		})
+	}
+
+	for _, name := range sortedKeys(st.roles) {
+		role := st.roles[name]
+		item := &schema.SnapshotRole{
+			Name:   role.Name,
+			Memo:   role.Memo,
+			Status: role.Status,
+			Menus:  nonNil(st.roleMenus[role.RecordID]),
+		}
+		if role.Require2FA == 1 {
+			item.Require2FA = 1
+		}
+		snap.Roles = append(snap.Roles, item)
+	}
+
+	for _, name := range sortedKeys(st.users) {
+		user := st.users[name]
+		snap.Users = append(snap.Users, &schema.SnapshotUser{
+			UserName: user.UserName,
+			RealName: user.RealName,
+			Source:   user.Source,
+			Status:   user.Status,
+			Roles:    nonNil(st.userRoles[user.RecordID]),
+		})
+	}
+
+	return snap, nil
+}
+
+// snapshotStep 应用配置快照的一个步骤
+type snapshotStep struct {
+	change *schema.SnapshotChange
+	exec   func(context.Context) error
+}
+
+// Apply 应用配置快照：对比当前数据生成变更计划，非仅生成计划时在同一事务中执行，
+// 执行后再次应用同一快照不会产生变更
+func (a *Snapshot) Apply(ctx context.Context, snap *schema.Snapshot, param schema.SnapshotApplyParam) (*schema.SnapshotPlan, error) {
+	if snap.Version != schema.SnapshotVersion {
+		return nil, fmt.Errorf("不支持的快照版本：%d", snap.Version)
+	}
+	normalizeSnapshot(snap)
+
+	st, err := a.load(ctx, len(snap.Users) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateSnapshot(snap, st, param.Prune); err != nil {
+		return nil, err
+	}
+
+	steps := a.planSteps(snap, st, param.Prune)
+
+	plan := &schema.SnapshotPlan{
+		DryRun:  param.DryRun,
+		Changes: make([]*schema.SnapshotChange, len(steps)),
+	}
+	for i, step := range steps {
+		plan.Changes[i] = step.change
+	}
+
+	if param.DryRun || len(steps) == 0 {
+		return plan, nil
+	}
+
+	err = a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		for _, step := range steps {
+			if err := step.exec(ctx); err != nil {
+				c := step.change
+				return errors.Wrapf(err, "%s%s[%s]失败：%s", snapshotActions[c.Action], snapshotKinds[c.Kind], c.Key, errorMessage(err))
+			}
+		}
+
+		invalidateCache(ctx, a.TransModel, a.Cache, cache.NSMenu, cache.NSRole, cache.NSUser)
+		return a.reloadRolePolicies(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+var (
+	snapshotKinds   = map[string]string{"menu": "菜单", "role": "角色", "user": "用户"}
+	snapshotActions = map[string]string{"create": "创建", "update": "更新", "delete": "删除"}
+)
+
+// normalizeSnapshot 为未指定的状态等字段设置默认值，并去除重复的关联
+func normalizeSnapshot(snap *schema.Snapshot) {
+	for _, m := range snap.Menus {
+		m.Method = strings.ToUpper(m.Method)
+		if m.IsHide == 0 {
+			m.IsHide = 2
+		}
+		if m.Status == 0 {
+			m.Status = 1
+		}
+	}
+
+	for _, r := range snap.Roles {
+		if r.Status == 0 {
+			r.Status = 1
+		}
+		r.Require2FA = normalizeRequire2FA(r.Require2FA)
+		r.Menus = uniqueStrings(r.Menus)
+	}
+
+	for _, u := range snap.Users {
+		if u.Status == 0 {
+			u.Status = 1
+		}
+		u.Roles = uniqueStrings(u.Roles)
+	}
+}
+
+// validateSnapshot 校验配置快照的完整性(编号路径、名称唯一且关联的数据存在)
+func validateSnapshot(snap *schema.Snapshot, st *snapshotState, prune bool) error {
+	var msgs []string
+	addError := func(format string, args ...interface{}) {
+		msgs = append(msgs, fmt.Sprintf(format, args...))
+	}
+
+	// 应用后存在的菜单及角色
+	menus := make(map[string]bool)
+	roles := make(map[string]bool)
+	if !prune {
+		for path := range st.menuItems {
+			menus[path] = true
+		}
+		for name := range st.roles {
+			roles[name] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range snap.Menus {
+		if seen[m.Code] {
+			addError("菜单[%s]重复", m.Code)
+		}
+		seen[m.Code] = true
+		menus[m.Code] = true
+	}
+
+	for _, m := range snap.Menus {
+		switch {
+		case m.Code == "" || strings.Contains("/"+m.Code+"/", "//"):
+			addError("菜单[%s]的编号路径无效", m.Code)
+		case m.Name == "":
+			addError("菜单[%s]的名称不能为空", m.Code)
+		case m.Type != 10 && m.Type != 20 && m.Type != 30 && m.Type != 40:
+			addError("菜单[%s]的类型无效：%d", m.Code, m.Type)
+		}
+
+		if parent := parentCodePath(m.Code); parent != "" && !menus[parent] {
+			addError("菜单[%s]的上级菜单不存在", m.Code)
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, r := range snap.Roles {
+		if r.Name == "" {
+			addError("角色名称不能为空")
+		} else if seen[r.Name] {
+			addError("角色[%s]重复", r.Name)
+		} else if len(r.Menus) == 0 {
+			addError("角色[%s]未授权菜单", r.Name)
+		}
+		seen[r.Name] = true
+		roles[r.Name] = true
+
+		for _, path := range r.Menus {
+			if !menus[path] {
+				addError("角色[%s]授权的菜单[%s]不存在", r.Name, path)
+			}
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, u := range snap.Users {
+		if u.UserName == "" {
+			addError("用户名不能为空")
+		} else if seen[u.UserName] {
+			addError("用户[%s]重复", u.UserName)
+		} else if len(u.Roles) == 0 {
+			addError("用户[%s]未分配角色", u.UserName)
+		} else if checkUserSource(u.Source) != nil {
+			addError("用户[%s]的认证来源[%s]无效", u.UserName, u.Source)
+		} else if old, ok := st.users[u.UserName]; !ok && u.Password == "" && u.Source == schema.UserSourceLocal {
+			addError("新建的用户[%s]需要指定密码", u.UserName)
+		} else if ok && u.Password == "" && isLocalSource(old.Source) != isLocalSource(u.Source) {
+			addError("用户[%s]在本地用户与外部认证的用户之间转换时需要指定密码", u.UserName)
+		}
+		seen[u.UserName] = true
+
+		for _, name := range u.Roles {
+			if !roles[name] {
+				addError("用户[%s]的角色[%s]不存在", u.UserName, name)
+			}
+		}
+	}
+
+	if len(msgs) > 0 {
+		return fmt.Errorf("配置快照校验未通过：%s", strings.Join(msgs, "；"))
+	}
+	return nil
+}
+
+// planSteps 对比当前数据生成变更步骤(依次为菜单、角色、用户的创建及更新，然后为用户、角色、菜单的删除)
+func (a *Snapshot) planSteps(snap *schema.Snapshot, st *snapshotState, prune bool) []*snapshotStep {
+	var steps []*snapshotStep
+	add := func(kind, action, key string, fields []string, exec func(context.Context) error) {
+		steps = append(steps, &snapshotStep{
+			change: &schema.SnapshotChange{Kind: kind, Action: action, Key: key, Fields: fields},
+			exec:   exec,
+		})
+	}
+
+	// 编号路径、角色名称与记录内码的对应关系，执行时加入新创建的数据
+	menuIDs := make(map[string]string)
+	for path, m := range st.menuItems {
+		menuIDs[path] = m.RecordID
+	}
+	roleIDs := make(map[string]string)
+	for name, r := range st.roles {
+		roleIDs[name] = r.RecordID
+	}
+
+	// 应用后停用的菜单(角色授权时会被忽略)
+	disabled := make(map[string]bool)
+	for path, m := range st.menuItems {
+		disabled[path] = m.Status == 2
+	}
+
+	menus := make([]*schema.SnapshotMenu, len(snap.Menus))
+	copy(menus, snap.Menus)
+	sort.SliceStable(menus, func(i, j int) bool {
+		return strings.Count(menus[i].Code, "/") < strings.Count(menus[j].Code, "/")
+	})
+
+	for _, m := range menus {
+		m := m
+		disabled[m.Code] = m.Status == 2
+
+		old, ok := st.menuItems[m.Code]
+		if !ok {
+			add("menu", "create", m.Code, nil, func(ctx context.Context) error {
+				item := &schema.Menu{
+					Code:     m.Code[strings.LastIndex(m.Code, "/")+1:],
+					Name:     m.Name,
+					Type:     m.Type,
+					Sequence: m.Sequence,
+					Icon:     m.Icon,
+					Path:     m.Path,
+					Method:   m.Method,
+					ParentID: menuIDs[parentCodePath(m.Code)],
+					IsHide:   m.IsHide,
+					Status:   m.Status,
+				}
+				if err := a.MenuBll.Create(ctx, item); err != nil {
+					return err
+				}
+				menuIDs[m.Code] = item.RecordID
+				return nil
+			})
+			continue
+		}
+
+		info := diffFields(map[string][2]interface{}{
+			"name":     {old.Name, m.Name},
+			"type":     {old.Type, m.Type},
+			"sequence": {old.Sequence, m.Sequence},
+			"icon":     {old.Icon, m.Icon},
+			"path":     {old.Path, m.Path},
+			"method":   {old.Method, m.Method},
+			"is_hide":  {old.IsHide, m.IsHide},
+			"status":   {old.Status, m.Status},
+		})
+		if len(info) > 0 {
+			add("menu", "update", m.Code, sortedKeys(info), func(ctx context.Context) error {
+				return a.MenuModel.Update(ctx, old.RecordID, info, 0)
+			})
+		}
+	}
+
+	for _, r := range snap.Roles {
+		r := r
+		paths := leafCodePaths(r.Menus, disabled)
+		resolve := func() []string {
+			ids := make([]string, len(paths))
+			for i, path := range paths {
+				ids[i] = menuIDs[path]
+			}
+			return ids
+		}
+
+		old, ok := st.roles[r.Name]
+		if !ok {
+			add("role", "create", r.Name, nil, func(ctx context.Context) error {
+				item := &schema.Role{Name: r.Name, Memo: r.Memo, Status: r.Status, Require2FA: r.Require2FA, MenuIDs: resolve()}
+				if err := a.RoleBll.Create(ctx, item); err != nil {
+					return err
+				}
+				roleIDs[r.Name] = item.RecordID
+				return nil
+			})
+			continue
+		}
+
+		fields := sortedKeys(diffFields(map[string][2]interface{}{
+			"memo":        {old.Memo, r.Memo},
+			"status":      {old.Status, r.Status},
+			"require_2fa": {normalizeRequire2FA(old.Require2FA), r.Require2FA},
+			"menus":       {nonNil(st.roleMenus[old.RecordID]), paths},
+		}))
+		if len(fields) > 0 {
+			add("role", "update", r.Name, fields, func(ctx context.Context) error {
+				item := &schema.Role{RecordID: old.RecordID, Name: r.Name, Memo: r.Memo, Status: r.Status, Require2FA: r.Require2FA, MenuIDs: resolve()}
+				return a.RoleBll.Update(ctx, old.RecordID, item)
+			})
+		}
+	}
+
+	for _, u := range snap.Users {
+		u := u
+		sort.Strings(u.Roles)
+		resolve := func() []string {
+			ids := make([]string, len(u.Roles))
+			for i, name := range u.Roles {
+				ids[i] = roleIDs[name]
+			}
+			return ids
+		}
+
+		old, ok := st.users[u.UserName]
+		if !ok {
+			add("user", "create", u.UserName, nil, func(ctx context.Context) error {
+				item := &schema.User{UserName: u.UserName, RealName: u.RealName, Password: u.Password, Source: u.Source, Status: u.Status, RoleIDs: resolve()}
+				return a.UserBll.Create(ctx, item)
+			})
+			continue
+		}
+
+		fields := sortedKeys(diffFields(map[string][2]interface{}{
+			"real_name": {old.RealName, u.RealName},
+			"source":    {old.Source, u.Source},
+			"status":    {old.Status, u.Status},
+			"roles":     {nonNil(st.userRoles[old.RecordID]), u.Roles},
+		}))
+		if len(fields) > 0 {
+			add("user", "update", u.UserName, fields, func(ctx context.Context) error {
+				item := &schema.User{RecordID: old.RecordID, UserName: u.UserName, RealName: u.RealName, Source: u.Source, Status: u.Status, RoleIDs: resolve()}
+				if item.Source == schema.UserSourceLocal {
+					item.Source = schema.UserSourceLocalName
+				}
+				if isLocalSource(old.Source) != isLocalSource(u.Source) {
+					item.Password = u.Password
+				}
+				return a.UserBll.Update(ctx, old.RecordID, item)
+			})
+		}
+	}
+
+	if !prune {
+		return steps
+	}
+
+	if len(snap.Users) > 0 {
+		users := make(map[string]bool)
+		for _, u := range snap.Users {
+			users[u.UserName] = true
+		}
+		for _, name := range sortedKeys(st.users) {
+			if recordID := st.users[name].RecordID; !users[name] {
+				add("user", "delete", name, nil, func(ctx context.Context) error {
+					return a.UserBll.Delete(ctx, recordID)
+				})
+			}
+		}
+	}
+
+	roles := make(map[string]bool)
+	for _, r := range snap.Roles {
+		roles[r.Name] = true
+	}
+	for _, name := range sortedKeys(st.roles) {
+		if recordID := st.roles[name].RecordID; !roles[name] {
+			add("role", "delete", name, nil, func(ctx context.Context) error {
+				return a.RoleBll.Delete(ctx, recordID)
+			})
+		}
+	}
+
+	menuSet := make(map[string]bool)
+	for _, m := range snap.Menus {
+		menuSet[m.Code] = true
+	}
+	// 下级菜单先于上级菜单删除
+	for i := len(st.menus) - 1; i >= 0; i-- {
+		recordID := st.menus[i].RecordID
+		if path := st.menuPaths[recordID]; !menuSet[path] {
+			add("menu", "delete", path, nil, func(ctx context.Context) error {
+				return a.MenuBll.Delete(ctx, recordID)
+			})
+		}
+	}
+
+	return steps
+}
+
+// reloadRolePolicies 菜单的状态、访问路径等变更后重新加载所有角色的权限策略(停用的角色不具有权限)
+func (a *Snapshot) reloadRolePolicies(ctx context.Context) error {
+	roles, err := a.RoleModel.QuerySelect(ctx, schema.RoleSelectQueryParam{Status: 1})
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		if err := a.RoleBll.LoadPolicy(ctx, role.RecordID); err != nil {
+			return err
+		}
+	}
+
+	roles, err = a.RoleModel.QuerySelect(ctx, schema.RoleSelectQueryParam{Status: 2})
+	if err != nil {
+		return err
+	}
+
+	a.TransModel.AfterCommit(ctx, func() {
+		for _, role := range roles {
+			a.RoleBll.Enforcer.DeletePermissionsForUser(role.RecordID)
+		}
+	})
+	return nil
+}
+
+// parentCodePath 获取上级菜单的编号路径
+func parentCodePath(path string) string {
+	if i := strings.LastIndex(path, "/"); i != -1 {
+		return path[:i]
+	}
+	return ""
+}
+
+// leafCodePaths 过滤角色授权的菜单编号路径(与角色保存时一致：去除停用的菜单及存在已授权下级的菜单)，返回排序后的结果
+func leafCodePaths(paths []string, disabled map[string]bool) []string {
+	result := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if disabled[path] {
+			continue
+		}
+
+		leaf := true
+		for _, p := range paths {
+			if !disabled[p] && strings.HasPrefix(p, path+"/") {
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			result = append(result, path)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// diffFields 对比字段的新旧值，返回变更的字段及新值
+func diffFields(values map[string][2]interface{}) map[string]interface{} {
+	info := make(map[string]interface{})
+	for field, v := range values {
+		if !reflect.DeepEqual(v[0], v[1]) {
+			info[field] = v[1]
+		}
+	}
+	return info
+}
+
+// sortedKeys 获取字典排序后的键
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	result := make([]string, len(keys))
+	for i, k := range keys {
+		result[i] = k.String()
+	}
+	sort.Strings(result)
+	return result
+}
+
+func uniqueStrings(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" && !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
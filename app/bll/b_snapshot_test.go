@@ -0,0 +1,110 @@
+package bll
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/casbin/casbin"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+)
+
+func newTestSnapshot() (*Snapshot, *modeltest.Menu, *modeltest.Role) {
+	trans := new(modeltest.Trans)
+	roles := new(modeltest.Role)
+	menus := &modeltest.Menu{Roles: roles}
+
+	menuBll := &Menu{MenuModel: menus, TransModel: trans}
+	roleBll := &Role{
+		RoleModel:  roles,
+		MenuModel:  menus,
+		TransModel: trans,
+		Enforcer:   casbin.NewEnforcer("../../config/model.conf", false),
+	}
+	return &Snapshot{
+		MenuBll:    menuBll,
+		RoleBll:    roleBll,
+		MenuModel:  menus,
+		RoleModel:  roles,
+		TransModel: trans,
+	}, menus, roles
+}
+
+func TestSnapshotApplyIdempotent(t *testing.T) {
+	ctx := context.Background()
+	a, menus, roles := newTestSnapshot()
+
+	buf, err := ioutil.ReadFile("../../database/snapshot.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := UnmarshalSnapshot(buf, SnapshotFormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap.Roles = []*schema.SnapshotRole{{
+		Name:  "管理员",
+		Menus: []string{snap.Menus[0].Code, snap.Menus[len(snap.Menus)-1].Code},
+	}}
+
+	// 已存在的菜单与快照不一致时更新
+	if err := a.MenuBll.Create(ctx, &schema.Menu{Code: snap.Menus[0].Code, Name: "旧名称", Type: 10, IsHide: 2, Status: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := a.Apply(ctx, snap, schema.SnapshotApplyParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(plan.Changes); n != len(snap.Menus)+1 {
+		t.Fatalf("变更数量错误：%d", n)
+	} else if c := plan.Changes[0]; c.Action != "update" || c.Key != snap.Menus[0].Code {
+		t.Fatalf("已存在的菜单应更新：%+v", c)
+	}
+	if len(menus.Items) != len(snap.Menus) || len(roles.Items) != 1 {
+		t.Fatalf("应用后的数据错误：%d,%d", len(menus.Items), len(roles.Items))
+	}
+
+	leaf := snap.Menus[len(snap.Menus)-1]
+	if item := menus.FindByPath(leaf.Code); item == nil || item.Name != leaf.Name || item.Path != leaf.Path {
+		t.Fatalf("菜单[%s]未按快照创建：%+v", leaf.Code, item)
+	}
+	if !a.RoleBll.Enforcer.HasPermissionForUser(roles.Items[0].RecordID, leaf.Path, leaf.Method) {
+		t.Fatal("应加载角色的权限策略")
+	}
+
+	// 再次应用同一快照不产生变更，数据保持不变
+	versions := make(map[string]int64)
+	for _, item := range menus.Items {
+		versions[item.RecordID] = item.Version
+	}
+	for _, dryRun := range []bool{true, false} {
+		plan, err = a.Apply(ctx, snap, schema.SnapshotApplyParam{DryRun: dryRun})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(plan.Changes) != 0 {
+			t.Fatalf("再次应用不应产生变更：%+v", plan.Changes[0])
+		}
+	}
+	for _, item := range menus.Items {
+		if item.Version != versions[item.RecordID] {
+			t.Fatalf("再次应用不应更新菜单[%s]", item.Code)
+		}
+	}
+	if len(menus.Items) != len(snap.Menus) || len(roles.Items) != 1 {
+		t.Fatalf("再次应用不应创建数据：%d,%d", len(menus.Items), len(roles.Items))
+	}
+
+	// 导出的快照与当前数据一致
+	exported, err := a.Export(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = a.Apply(ctx, exported, schema.SnapshotApplyParam{DryRun: true, Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(plan.Changes) != 0 {
+		t.Fatalf("应用导出的快照不应产生变更：%+v", plan.Changes[0])
+	}
+}
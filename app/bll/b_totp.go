@@ -0,0 +1,359 @@
+package bll
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/totp"
+	"moddns/app/util"
+)
+
+// 定义错误
+var (
+	ErrInvalidTOTPCode = errors.New("无效的两步验证码")
+	ErrTOTPEnabled     = errors.New("两步验证已启用")
+	ErrTOTPNotEnabled  = errors.New("两步验证未启用")
+	ErrTOTPRequired    = errors.New("用户的角色要求启用两步验证")
+	ErrTOTPLocked      = errors.New("两步验证失败次数过多，请稍后再试")
+)
+
+// 两步验证参数
+const (
+	totpSkew          = 1  // 允许的时钟偏差(时间步)
+	totpRecoveryCodes = 10 // 生成的恢复码数量
+)
+
+// TOTP 两步验证管理
+type TOTP struct {
+	TOTPModel models.ITOTP `inject:"ITOTP"`
+	UserModel models.IUser `inject:"IUser"`
+	RoleModel models.IRole `inject:"IRole"`
+	LoginBll  *Login       `inject:""`
+}
+
+// getEnabled 查询已启用的两步验证设置(未启用时返回nil)
+func (a *TOTP) getEnabled(ctx context.Context, userID string) (*schema.UserTOTP, error) {
+	item, err := a.TOTPModel.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	} else if item == nil || item.Status != 1 {
+		return nil, nil
+	}
+	return item, nil
+}
+
+// IsRequired 检查用户的角色是否要求启用两步验证(超级用户不受角色约束)
+func (a *TOTP) IsRequired(ctx context.Context, userID string) (bool, error) {
+	if a.LoginBll.CheckIsRoot(ctx, userID) {
+		return false, nil
+	}
+
+	user, err := a.UserModel.Get(ctx, userID, true)
+	if err != nil {
+		return false, err
+	} else if user == nil || len(user.RoleIDs) == 0 {
+		return false, nil
+	}
+
+	items, err := a.RoleModel.QuerySelect(ctx, schema.RoleSelectQueryParam{
+		RecordIDs:  user.RoleIDs,
+		Status:     1,
+		Require2FA: 1,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(items) > 0, nil
+}
+
+// Status 查询用户的两步验证状态
+func (a *TOTP) Status(ctx context.Context, userID string) (*schema.TOTPStatus, error) {
+	item, err := a.getEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := a.IsRequired(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &schema.TOTPStatus{Required: required}
+	if item != nil {
+		status.Enabled = true
+		status.RecoveryCodes = len(splitRecoveryCodes(item.RecoveryCodes))
+	}
+	return status, nil
+}
+
+// Begin 生成待确认的密钥(已启用时返回ErrTOTPEnabled)，确认前不影响登录
+func (a *TOTP) Begin(ctx context.Context, userID string) (*schema.TOTPSetup, error) {
+	item, err := a.getEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	} else if item != nil {
+		return nil, ErrTOTPEnabled
+	}
+
+	account, err := a.accountName(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.TOTPModel.Save(ctx, &schema.UserTOTP{
+		UserID: userID,
+		Secret: secret,
+		Status: 2,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := util.T(viper.GetStringMap("totp")["issuer"]).String()
+	return &schema.TOTPSetup{
+		Secret: secret,
+		URI:    totp.URI(issuer, account, secret),
+	}, nil
+}
+
+// accountName 获取认证器应用中显示的账户名称(用户名)
+func (a *TOTP) accountName(ctx context.Context, userID string) (string, error) {
+	if a.LoginBll.CheckIsRoot(ctx, userID) {
+		return a.LoginBll.getRootUser().UserName, nil
+	}
+
+	user, err := a.UserModel.Get(ctx, userID, false)
+	if err != nil {
+		return "", err
+	} else if user == nil {
+		return "", ErrInvalidUser
+	}
+	return user.UserName, nil
+}
+
+// Confirm 使用验证码确认待确认的密钥并启用两步验证，返回恢复码(仅返回一次)
+func (a *TOTP) Confirm(ctx context.Context, userID, code string) ([]string, error) {
+	item, err := a.TOTPModel.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	} else if item == nil {
+		return nil, ErrTOTPNotEnabled
+	} else if item.Status == 1 {
+		return nil, ErrTOTPEnabled
+	}
+
+	step, err := totp.Validate(item.Secret, code, time.Now(), totpSkew)
+	if err != nil {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	item.Status = 1
+	item.LastStep = step
+	item.RecoveryCodes = hashes
+	err = a.TOTPModel.Save(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// totpLockConfig 获取连续验证失败的最大次数及锁定时长(秒)
+func totpLockConfig() (int, int64) {
+	config := viper.GetStringMap("totp")
+
+	maxFailures := util.T(config["max_failures"]).Int()
+	if maxFailures <= 0 {
+		maxFailures = 10
+	}
+
+	duration := util.T(config["lock_duration"]).Int64()
+	if duration <= 0 {
+		duration = 900
+	}
+	return maxFailures, duration
+}
+
+// Verify 校验已启用的两步验证码或恢复码(恢复码使用后失效，验证码不可重复使用)，
+// 所有入口按用户统一计数，连续失败次数过多时锁定(返回ErrTOTPLocked)
+func (a *TOTP) Verify(ctx context.Context, userID, code string) error {
+	item, err := a.getEnabled(ctx, userID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return ErrTOTPNotEnabled
+	} else if item.LockedUntil > time.Now().Unix() {
+		return ErrTOTPLocked
+	}
+
+	err = a.verify(ctx, item, code)
+	if err == ErrInvalidTOTPCode {
+		maxFailures, duration := totpLockConfig()
+		if err := a.TOTPModel.AddFailure(ctx, userID, maxFailures, time.Now().Unix()+duration); err != nil {
+			return err
+		}
+	} else if err == nil && (item.Failures > 0 || item.LockedUntil > 0) {
+		return a.TOTPModel.ResetFailures(ctx, userID)
+	}
+	return err
+}
+
+// verify 校验验证码或恢复码
+func (a *TOTP) verify(ctx context.Context, item *schema.UserTOTP, code string) error {
+	userID := item.UserID
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, err := totp.Validate(item.Secret, code, time.Now(), totpSkew)
+		if err != nil || step <= item.LastStep {
+			return ErrInvalidTOTPCode
+		}
+
+		// 并发使用同一验证码时仅有一个请求能更新成功
+		ok, err := a.TOTPModel.UpdateLastStep(ctx, userID, step)
+		if err != nil {
+			return err
+		} else if !ok {
+			return ErrInvalidTOTPCode
+		}
+		return nil
+	}
+
+	return a.useRecoveryCode(ctx, item, code)
+}
+
+// useRecoveryCode 使用恢复码(使用后从未使用的恢复码中移除)
+func (a *TOTP) useRecoveryCode(ctx context.Context, item *schema.UserTOTP, code string) error {
+	code = totp.NormalizeRecoveryCode(code)
+	hash := hashRecoveryCode(code)
+	legacy := util.SHA1HashString(code) // 兼容以sha1哈希存储的恢复码
+	hashes := splitRecoveryCodes(item.RecoveryCodes)
+
+	var (
+		found bool
+		rest  []string
+	)
+	for _, h := range hashes {
+		if !found && (hmac.Equal([]byte(h), []byte(hash)) || hmac.Equal([]byte(h), []byte(legacy))) {
+			found = true
+			continue
+		}
+		rest = append(rest, h)
+	}
+	if !found {
+		return ErrInvalidTOTPCode
+	}
+
+	// 并发使用恢复码时仅有一个请求能更新成功
+	ok, err := a.TOTPModel.UpdateRecoveryCodes(ctx, item.UserID, item.RecoveryCodes, strings.Join(rest, ","))
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// Disable 停用当前用户的两步验证(需要校验验证码或恢复码，角色要求启用时不允许停用)
+func (a *TOTP) Disable(ctx context.Context, userID, code string) error {
+	required, err := a.IsRequired(ctx, userID)
+	if err != nil {
+		return err
+	} else if required {
+		return ErrTOTPRequired
+	}
+
+	err = a.Verify(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+	return a.TOTPModel.Delete(ctx, userID)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码(需要校验验证码，原有的恢复码全部失效)
+func (a *TOTP) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	err := a.Verify(ctx, userID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := a.getEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	} else if item == nil {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := a.TOTPModel.UpdateRecoveryCodes(ctx, userID, item.RecoveryCodes, hashes)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("恢复码已被修改，请重试")
+	}
+	return codes, nil
+}
+
+// Reset 重置用户的两步验证(管理员操作，用户下次登录时需重新注册)
+func (a *TOTP) Reset(ctx context.Context, userID string) error {
+	if !a.LoginBll.CheckIsRoot(ctx, userID) {
+		exists, err := a.UserModel.Check(ctx, userID)
+		if err != nil {
+			return err
+		} else if !exists {
+			return util.ErrNotFound
+		}
+	}
+	return a.TOTPModel.Delete(ctx, userID)
+}
+
+// newRecoveryCodes 生成恢复码，返回恢复码及以逗号分隔的哈希值
+func newRecoveryCodes() ([]string, string, error) {
+	codes, err := totp.GenerateRecoveryCodes(totpRecoveryCodes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = hashRecoveryCode(totp.NormalizeRecoveryCode(c))
+	}
+	return codes, strings.Join(hashes, ","), nil
+}
+
+// hashRecoveryCode 计算恢复码的哈希值(HMAC-SHA256，密钥由会话签名派生，
+// 泄露的哈希值无法在不知道密钥的情况下离线穷举)
+func hashRecoveryCode(code string) string {
+	key := "totp-recovery:" + util.T(viper.GetStringMap("session")["sign"]).String()
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(code))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// splitRecoveryCodes 拆分以逗号分隔的恢复码哈希值
+func splitRecoveryCodes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,153 @@
+package bll
+
+import (
+	"context"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/app/service/totp"
+	"moddns/app/util"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// newTestTOTP 创建用户u1(角色r1)的两步验证管理
+func newTestTOTP() (*TOTP, *modeltest.TOTP, *modeltest.Role) {
+	model := new(modeltest.TOTP)
+	roles := &modeltest.Role{Items: []*schema.Role{{RecordID: "r1", Status: 1, Require2FA: 2}}}
+	return &TOTP{
+		TOTPModel: model,
+		UserModel: &modeltest.User{Items: []*schema.User{{RecordID: "u1", UserName: "alice", Status: 1, RoleIDs: []string{"r1"}}}},
+		RoleModel: roles,
+		LoginBll:  new(Login),
+	}, model, roles
+}
+
+// enableTestTOTP 注册并启用用户u1的两步验证，返回密钥及恢复码
+func enableTestTOTP(t *testing.T, a *TOTP) (string, []string) {
+	ctx := context.Background()
+	setup, err := a.Begin(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 确认使用上一时间步的验证码，登录时可使用当前时间步的验证码
+	code, _ := totp.Code(setup.Secret, totp.Step(time.Now())-1)
+	codes, err := a.Confirm(ctx, "u1", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setup.Secret, codes
+}
+
+// currentCode 当前时间步的验证码
+func currentCode(secret string) string {
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+	return code
+}
+
+// TestTOTPVerifyReplay 已使用的验证码(时间步不大于最后验证通过的时间步)不能再次使用
+func TestTOTPVerifyReplay(t *testing.T) {
+	ctx := context.Background()
+	a, _, _ := newTestTOTP()
+	secret, _ := enableTestTOTP(t, a)
+
+	code := currentCode(secret)
+	if err := a.Verify(ctx, "u1", code); err != nil {
+		t.Fatal(err)
+	} else if err := a.Verify(ctx, "u1", code); err != ErrInvalidTOTPCode {
+		t.Fatalf("重复使用验证码应失败：%v", err)
+	}
+
+	prev, _ := totp.Code(secret, totp.Step(time.Now())-1)
+	if err := a.Verify(ctx, "u1", prev); err != ErrInvalidTOTPCode {
+		t.Fatalf("早于最后验证通过的验证码应失败：%v", err)
+	}
+}
+
+// TestTOTPRecoveryCodes 恢复码使用后失效，哈希值不使用无密钥的sha1存储(兼容已存储的sha1哈希)
+func TestTOTPRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	a, model, _ := newTestTOTP()
+	_, codes := enableTestTOTP(t, a)
+
+	item := model.Find("u1")
+	if len(codes) != totpRecoveryCodes || len(splitRecoveryCodes(item.RecoveryCodes)) != totpRecoveryCodes {
+		t.Fatalf("恢复码数量错误：%d", len(codes))
+	}
+	for _, h := range splitRecoveryCodes(item.RecoveryCodes) {
+		if h == util.SHA1HashString(totp.NormalizeRecoveryCode(codes[0])) {
+			t.Fatal("恢复码不应使用sha1哈希存储")
+		}
+	}
+
+	if err := a.Verify(ctx, "u1", codes[0]); err != nil {
+		t.Fatal(err)
+	} else if err := a.Verify(ctx, "u1", codes[0]); err != ErrInvalidTOTPCode {
+		t.Fatalf("恢复码不能重复使用：%v", err)
+	}
+	if status, _ := a.Status(ctx, "u1"); status.RecoveryCodes != totpRecoveryCodes-1 {
+		t.Fatalf("剩余的恢复码数量错误：%d", status.RecoveryCodes)
+	}
+
+	legacy := "abcde-12345"
+	item.RecoveryCodes += "," + util.SHA1HashString(totp.NormalizeRecoveryCode(legacy))
+	if err := a.Verify(ctx, "u1", legacy); err != nil {
+		t.Fatalf("应兼容sha1哈希存储的恢复码：%v", err)
+	}
+}
+
+// TestTOTPDisableRequired 角色要求启用两步验证时不能停用
+func TestTOTPDisableRequired(t *testing.T) {
+	ctx := context.Background()
+	a, model, roles := newTestTOTP()
+	secret, _ := enableTestTOTP(t, a)
+
+	roles.Items[0].Require2FA = 1
+	if err := a.Disable(ctx, "u1", currentCode(secret)); err != ErrTOTPRequired {
+		t.Fatalf("角色要求启用时应拒绝停用：%v", err)
+	} else if model.Find("u1") == nil {
+		t.Fatal("拒绝停用时不应删除设置")
+	}
+
+	roles.Items[0].Require2FA = 2
+	if err := a.Disable(ctx, "u1", currentCode(secret)); err != nil {
+		t.Fatal(err)
+	} else if model.Find("u1") != nil {
+		t.Fatal("停用后应删除设置")
+	}
+}
+
+// TestTOTPLockout 连续验证失败达到最大次数后锁定(正确的验证码同样拒绝)，锁定到期后验证通过时清除计数
+func TestTOTPLockout(t *testing.T) {
+	viper.Set("totp", map[string]interface{}{"max_failures": 3, "lock_duration": 60})
+	defer viper.Set("totp", nil)
+
+	ctx := context.Background()
+	a, model, _ := newTestTOTP()
+	secret, _ := enableTestTOTP(t, a)
+
+	for i := 0; i < 3; i++ {
+		if err := a.Verify(ctx, "u1", "invalid"); err != ErrInvalidTOTPCode {
+			t.Fatalf("第%d次验证应失败：%v", i+1, err)
+		}
+	}
+	item := model.Find("u1")
+	if item.LockedUntil <= time.Now().Unix() {
+		t.Fatalf("连续失败后应锁定：%+v", item)
+	}
+	if err := a.Verify(ctx, "u1", currentCode(secret)); err != ErrTOTPLocked {
+		t.Fatalf("锁定期间应拒绝验证：%v", err)
+	} else if err := a.Disable(ctx, "u1", currentCode(secret)); err != ErrTOTPLocked {
+		t.Fatalf("锁定期间应拒绝停用：%v", err)
+	}
+
+	item.LockedUntil = time.Now().Unix() - 1
+	item.Failures = 2
+	if err := a.Verify(ctx, "u1", currentCode(secret)); err != nil {
+		t.Fatal(err)
+	} else if item.Failures != 0 || item.LockedUntil != 0 {
+		t.Fatalf("验证通过后应清除计数：%+v", item)
+	}
+}
@@ -2,21 +2,50 @@ package bll
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
+	"strconv"
 	"time"
 
 	"github.com/casbin/casbin"
 	"github.com/pkg/errors"
+	"moddns/app/logger"
 	"moddns/app/models"
 	"moddns/app/schema"
+	"moddns/app/service/cache"
+	"moddns/app/service/exchange"
+	"moddns/app/service/sessionstore"
 	"moddns/app/util"
 )
 
+// UserColumns 用户导出的列(roles为以|分隔的角色名称)；导出不包含密码，导入时必须指定password列，
+// 且导入仅创建用户名不存在的用户，因此导出的文件不能直接用于导入(需删除已存在的用户并补充密码)
+var UserColumns = []string{"user_name", "real_name", "status", "roles"}
+
 // User 用户管理
 type User struct {
-	UserModel models.IUser     `inject:"IUser"`
-	RoleModel models.IRole     `inject:"IRole"`
-	Enforcer  *casbin.Enforcer `inject:""`
+	UserModel  models.IUser           `inject:"IUser"`
+	RoleModel  models.IRole           `inject:"IRole"`
+	TransModel models.ITrans          `inject:"ITrans"`
+	Enforcer   *casbin.Enforcer       `inject:""`
+	Loader     *Loader                `inject:""`
+	Cache      *cache.Cache           `inject:""`
+	Sessions   *sessionstore.Registry `inject:""`
+}
+
+// invalidate 数据提交后使用户及菜单(用户菜单)的查询缓存失效
+func (a *User) invalidate(ctx context.Context) {
+	invalidateCache(ctx, a.TransModel, a.Cache, cache.NSUser, cache.NSMenu)
+}
+
+// revokeSessions 数据提交后撤销用户的全部会话(禁用、删除、修改密码或移除角色时)，
+// 撤销失败时仅记录日志
+func (a *User) revokeSessions(ctx context.Context, userID string) {
+	a.TransModel.AfterCommit(ctx, func() {
+		if _, err := a.Sessions.Revoke(ctx, userID); err != nil {
+			logger.SystemWithContext(ctx).Errorf("撤销用户[%s]的会话发生错误：%s", userID, err.Error())
+		}
+	})
 }
 
 // QueryPage 查询分页数据
@@ -26,18 +55,26 @@ func (a *User) QueryPage(ctx context.Context, params schema.UserQueryParam, page
 		return 0, nil, err
 	}
 
+	userIDs := make([]string, len(items))
+	creators := make([]string, len(items))
 	for i, item := range items {
-		user, err := a.UserModel.Get(ctx, item.RecordID, true)
-		if err == nil && user != nil && len(user.RoleIDs) > 0 {
-			roleItems, err := a.RoleModel.QuerySelect(ctx, schema.RoleSelectQueryParam{RecordIDs: user.RoleIDs})
-			if err == nil {
-				roleNames := make([]string, len(roleItems))
-				for i, item := range roleItems {
-					roleNames[i] = item.Name
-				}
-				items[i].RoleNames = roleNames
-			}
-		}
+		userIDs[i] = item.RecordID
+		creators[i] = item.Creator
+	}
+
+	roleNames, err := a.Loader.UserRoleNames(ctx, userIDs)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	creatorNames, err := a.Loader.UserNames(ctx, creators)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, item := range items {
+		item.RoleNames = roleNames[item.RecordID]
+		item.CreatorName = creatorNames[item.Creator]
 	}
 
 	return total, items, nil
@@ -66,22 +103,34 @@ func (a *User) Create(ctx context.Context, item *schema.User) error {
 		return errors.New("用户名已经存在")
 	}
 
+	item.Source = parseUserSource(item.Source)
+	if err := checkUserSource(item.Source); err != nil {
+		return err
+	}
+
+	// LDAP及OIDC用户不使用本地密码，未指定时使用随机密码
+	if item.Source != schema.UserSourceLocal && item.Password == "" {
+		item.Password = uuid.New().String()
+	}
+
 	item.Password = util.SHA1HashString(item.Password)
 	item.ID = 0
 	item.RecordID = uuid.New().String()
 	item.Created = time.Now().Unix()
 	item.Deleted = 0
+	item.Version = 1
 	err = a.UserModel.Create(ctx, item)
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
 
 	return a.LoadPolicy(ctx, item.RecordID)
 }
 
 // Update 更新数据
 func (a *User) Update(ctx context.Context, recordID string, item *schema.User) error {
-	oldItem, err := a.UserModel.Get(ctx, recordID, false)
+	oldItem, err := a.UserModel.Get(ctx, recordID, true)
 	if err != nil {
 		return err
 	} else if oldItem == nil {
@@ -95,6 +144,18 @@ func (a *User) Update(ctx context.Context, recordID string, item *schema.User) e
 		}
 	}
 
+	// 未指定认证来源时不修改(避免遗漏该字段时外部认证的用户变为本地用户)
+	if item.Source == "" {
+		item.Source = oldItem.Source
+	} else {
+		item.Source = parseUserSource(item.Source)
+	}
+	if err := checkUserSource(item.Source); err != nil {
+		return err
+	} else if isLocalSource(item.Source) != isLocalSource(oldItem.Source) && item.Password == "" {
+		return errors.New("本地用户与外部认证的用户相互转换时必须设置密码")
+	}
+
 	info := util.StructToMap(item)
 	delete(info, "id")
 	delete(info, "record_id")
@@ -108,14 +169,56 @@ func (a *User) Update(ctx context.Context, recordID string, item *schema.User) e
 		info["password"] = util.SHA1HashString(item.Password)
 	}
 
-	err = a.UserModel.UpdateWithRoleIDs(ctx, recordID, info, item.RoleIDs)
+	err = a.UserModel.UpdateWithRoleIDs(ctx, recordID, info, item.RoleIDs, item.Version)
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
+
+	// 修改密码、停用或移除角色时撤销用户的会话
+	if item.Password != "" || item.Status == 2 || hasRemoved(oldItem.RoleIDs, item.RoleIDs) {
+		a.revokeSessions(ctx, recordID)
+	}
 
 	return a.LoadPolicy(ctx, recordID)
 }
 
+// parseUserSource 解析请求中的认证来源(local表示本地用户)
+func parseUserSource(source string) string {
+	if source == schema.UserSourceLocalName {
+		return schema.UserSourceLocal
+	}
+	return source
+}
+
+// isLocalSource 检查是否为本地用户
+func isLocalSource(source string) bool {
+	return source == schema.UserSourceLocal
+}
+
+// checkUserSource 检查用户的认证来源
+func checkUserSource(source string) error {
+	switch source {
+	case schema.UserSourceLocal, schema.UserSourceLDAP, schema.UserSourceOIDC:
+		return nil
+	}
+	return errors.New("无效的认证来源")
+}
+
+// hasRemoved 检查新的列表中是否移除了原有的项
+func hasRemoved(oldItems, newItems []string) bool {
+	exists := make(map[string]bool, len(newItems))
+	for _, item := range newItems {
+		exists[item] = true
+	}
+	for _, item := range oldItems {
+		if !exists[item] {
+			return true
+		}
+	}
+	return false
+}
+
 // Delete 删除数据
 func (a *User) Delete(ctx context.Context, recordID string) error {
 	exists, err := a.UserModel.Check(ctx, recordID)
@@ -129,13 +232,22 @@ func (a *User) Delete(ctx context.Context, recordID string) error {
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
+	a.revokeSessions(ctx, recordID)
 
-	a.Enforcer.DeleteRolesForUser(recordID)
+	a.TransModel.AfterCommit(ctx, func() {
+		a.Enforcer.DeleteRolesForUser(recordID)
+	})
 	return nil
 }
 
-// UpdateStatus 更新状态
-func (a *User) UpdateStatus(ctx context.Context, recordID string, status int) error {
+// DeleteMany 删除多条数据(全部成功或全部回滚)
+func (a *User) DeleteMany(ctx context.Context, recordIDs []string) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, a.Delete)
+}
+
+// UpdateStatus 更新状态(version大于0时校验版本号)
+func (a *User) UpdateStatus(ctx context.Context, recordID string, status int, version int64) error {
 	exists, err := a.UserModel.Check(ctx, recordID)
 	if err != nil {
 		return err
@@ -146,13 +258,17 @@ func (a *User) UpdateStatus(ctx context.Context, recordID string, status int) er
 	info := map[string]interface{}{
 		"status": status,
 	}
-	err = a.UserModel.Update(ctx, recordID, info)
+	err = a.UserModel.Update(ctx, recordID, info, version)
 	if err != nil {
 		return err
 	}
+	a.invalidate(ctx)
 
 	if status == 2 {
-		a.Enforcer.DeleteRolesForUser(recordID)
+		a.revokeSessions(ctx, recordID)
+		a.TransModel.AfterCommit(ctx, func() {
+			a.Enforcer.DeleteRolesForUser(recordID)
+		})
 	} else {
 		err = a.LoadPolicy(ctx, recordID)
 		if err != nil {
@@ -163,6 +279,38 @@ func (a *User) UpdateStatus(ctx context.Context, recordID string, status int) er
 	return nil
 }
 
+// UpdateStatusMany 更新多条数据的状态(全部成功或全部回滚)
+func (a *User) UpdateStatusMany(ctx context.Context, recordIDs []string, status int) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, func(ctx context.Context, recordID string) error {
+		return a.UpdateStatus(ctx, recordID, status, 0)
+	})
+}
+
+// QuerySessions 查询用户在线的会话
+func (a *User) QuerySessions(ctx context.Context, userID string) ([]*schema.UserSession, error) {
+	items, err := a.Sessions.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return toUserSessions(items, ""), nil
+}
+
+// RevokeSessions 撤销用户的会话(sessionID为会话的记录ID，为空时撤销全部会话)
+func (a *User) RevokeSessions(ctx context.Context, userID, sessionID string) error {
+	var recordIDs []string
+	if sessionID != "" {
+		recordIDs = append(recordIDs, sessionID)
+	}
+
+	n, err := a.Sessions.Revoke(ctx, userID, recordIDs...)
+	if err != nil {
+		return err
+	} else if n == 0 && sessionID != "" {
+		return util.ErrNotFound
+	}
+	return nil
+}
+
 // LoadAllPolicy 加载所有的用户策略
 func (a *User) LoadAllPolicy() error {
 	ctx := context.Background()
@@ -188,9 +336,180 @@ func (a *User) LoadPolicy(ctx context.Context, userID string) error {
 		return err
 	}
 
-	a.Enforcer.DeleteRolesForUser(userID)
-	for _, ur := range userRoles {
-		a.Enforcer.AddRoleForUser(ur.UserID, ur.RoleID)
+	a.TransModel.AfterCommit(ctx, func() {
+		a.Enforcer.DeleteRolesForUser(userID)
+		for _, ur := range userRoles {
+			a.Enforcer.AddRoleForUser(ur.UserID, ur.RoleID)
+		}
+	})
+	return nil
+}
+
+// QueryDeletedPage 查询已删除的分页数据(回收站)
+func (a *User) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	return a.UserModel.QueryDeletedPage(ctx, pageIndex, pageSize)
+}
+
+// Restore 恢复已删除的数据
+func (a *User) Restore(ctx context.Context, recordID string) error {
+	item, err := a.UserModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	exists, err := a.UserModel.CheckUserName(ctx, item.UserName)
+	if err != nil {
+		return err
+	} else if exists {
+		return util.NewConflictError("用户名已经存在，不能恢复")
+	}
+
+	return a.TransModel.Exec(ctx, func(ctx context.Context) error {
+		err := a.UserModel.Restore(ctx, recordID, item.Deleted)
+		if err != nil {
+			return err
+		}
+		a.invalidate(ctx)
+
+		if item.Status == 2 {
+			return nil
+		}
+		return a.LoadPolicy(ctx, recordID)
+	})
+}
+
+// Purge 彻底删除已删除的数据
+func (a *User) Purge(ctx context.Context, recordID string) error {
+	item, err := a.UserModel.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
 	}
+
+	if err := a.UserModel.Purge(ctx, recordID); err != nil {
+		return err
+	}
+
+	a.invalidate(ctx)
 	return nil
 }
+
+// PurgeExpired 彻底删除指定时间之前删除的数据
+func (a *User) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	n, err := a.UserModel.PurgeExpired(ctx, before.Unix())
+	if err == nil && n > 0 {
+		a.invalidate(ctx)
+	}
+	return n, err
+}
+
+// Export 导出数据(查询条件与分页查询一致，不包含密码)
+func (a *User) Export(ctx context.Context, params schema.UserQueryParam, w exchange.Writer) error {
+	return exportPages(func(beforeID int64) (int, int64, error) {
+		params.BeforeID = beforeID
+		_, items, err := a.UserModel.QueryPage(ctx, params, 1, exportPageSize)
+		if err != nil {
+			return 0, 0, err
+		} else if len(items) == 0 {
+			return 0, 0, nil
+		}
+
+		userIDs := make([]string, len(items))
+		for i, item := range items {
+			userIDs[i] = item.RecordID
+		}
+
+		roleNames, err := a.Loader.UserRoleNames(ctx, userIDs)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, item := range items {
+			err := w.Write([]string{
+				item.UserName,
+				item.RealName,
+				strconv.Itoa(item.Status),
+				exchange.JoinList(roleNames[item.RecordID]),
+			})
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		return len(items), items[len(items)-1].ID, nil
+	})
+}
+
+// Import 导入数据(角色通过名称关联，仅创建新用户且必须指定密码)，dryRun为true时仅校验，校验未通过时返回校验报告
+func (a *User) Import(ctx context.Context, rows []*exchange.Row, dryRun bool, creator string) (*schema.ImportResult, error) {
+	roles, err := a.RoleModel.QuerySelect(ctx, schema.RoleSelectQueryParam{})
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDs := make(map[string]string, len(roles))
+	for _, role := range roles {
+		roleIDs[role.Name] = role.RecordID
+	}
+
+	result := &schema.ImportResult{DryRun: dryRun, Total: len(rows)}
+	userNames := make(map[string]int)
+
+	var items []*importItem
+	for _, row := range rows {
+		n := len(result.Errors)
+		item := &schema.User{
+			UserName: row.Get("user_name"),
+			RealName: row.Get("real_name"),
+			Password: row.Get("password"),
+			Creator:  creator,
+		}
+
+		if item.UserName == "" {
+			addImportError(result, row, "user_name", "用户名不能为空")
+		} else if line, ok := userNames[item.UserName]; ok {
+			addImportError(result, row, "user_name", fmt.Sprintf("用户名与第%d行重复", line))
+		} else {
+			userNames[item.UserName] = row.Line
+			exists, err := a.UserModel.CheckUserName(ctx, item.UserName)
+			if err != nil {
+				return nil, err
+			} else if exists {
+				addImportError(result, row, "user_name", "用户名已经存在")
+			}
+		}
+
+		if item.RealName == "" {
+			addImportError(result, row, "real_name", "真实姓名不能为空")
+		}
+		if item.Password == "" {
+			addImportError(result, row, "password", "密码不能为空")
+		}
+		item.Status = parseImportStatus(result, row, "status")
+
+		names := exchange.SplitList(row.Get("roles"))
+		if len(names) == 0 {
+			addImportError(result, row, "roles", "角色不能为空")
+		}
+		for _, name := range names {
+			if roleID, ok := roleIDs[name]; ok {
+				item.RoleIDs = append(item.RoleIDs, roleID)
+			} else {
+				addImportError(result, row, "roles", fmt.Sprintf("角色[%s]不存在", name))
+			}
+		}
+
+		if len(result.Errors) == n {
+			items = append(items, &importItem{
+				line: row.Line,
+				create: func(ctx context.Context) error {
+					return a.Create(ctx, item)
+				},
+			})
+		}
+	}
+
+	return execImport(ctx, a.TransModel, result, items)
+}
@@ -0,0 +1,94 @@
+package bll
+
+import (
+	"context"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/app/service/sessionstore"
+	"moddns/app/util"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin"
+)
+
+func TestUserRestoreConflict(t *testing.T) {
+	model := &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "alice", Status: 2, Deleted: 100},
+		{RecordID: "u2", UserName: "alice", Status: 1},
+	}}
+	a := &User{UserModel: model, TransModel: new(modeltest.Trans)}
+
+	// 已存在同名用户时不能恢复
+	err := a.Restore(context.Background(), "u1")
+	if _, ok := err.(*util.ConflictError); !ok || err.Error() != "用户名已经存在，不能恢复" {
+		t.Fatalf("用户名冲突时应拒绝恢复：%v", err)
+	} else if model.Find("u1") != nil {
+		t.Fatal("用户名冲突时不应恢复数据")
+	}
+
+	model.Items[1].UserName = "bob"
+	if err := a.Restore(context.Background(), "u1"); err != nil || model.Find("u1") == nil {
+		t.Fatalf("恢复数据错误：%v", err)
+	}
+}
+
+func TestUserPurgeExpired(t *testing.T) {
+	before := time.Now().AddDate(0, 0, -30)
+	model := &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "a", Deleted: before.Unix() - 1},
+		{RecordID: "u2", UserName: "b", Deleted: before.Unix() + 1},
+		{RecordID: "u3", UserName: "c"},
+	}}
+	a := &User{UserModel: model, TransModel: new(modeltest.Trans)}
+
+	n, err := a.PurgeExpired(context.Background(), before)
+	if err != nil || n != 1 {
+		t.Fatalf("清理结果错误：%d,%v", n, err)
+	}
+	// 仅清理保留期限之前删除的数据
+	if len(model.Items) != 2 || model.Items[0].RecordID != "u2" {
+		t.Fatalf("清理后的数据错误：%d", len(model.Items))
+	}
+}
+
+// TestUserUpdateSource 未指定认证来源时保持不变，本地用户与外部认证的用户相互转换时必须设置密码
+func TestUserUpdateSource(t *testing.T) {
+	ctx := context.Background()
+	model := &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "alice", Source: schema.UserSourceLDAP, Status: 1, Version: 1},
+	}}
+	a := &User{
+		UserModel:  model,
+		TransModel: new(modeltest.Trans),
+		Enforcer:   casbin.NewEnforcer("../../config/model.conf", false),
+		Sessions:   sessionstore.NewRegistry(nil, sessionstore.NewMemoryIndex(0)),
+	}
+	update := func(source, password string) error {
+		return a.Update(ctx, "u1", &schema.User{UserName: "alice", Source: source, Password: password, Status: 1})
+	}
+
+	if err := update("", ""); err != nil {
+		t.Fatal(err)
+	} else if source := model.Find("u1").Source; source != schema.UserSourceLDAP {
+		t.Fatalf("未指定认证来源时不应修改：%q", source)
+	}
+
+	if err := update(schema.UserSourceLocalName, ""); err == nil {
+		t.Fatal("转换为本地用户时未设置密码应失败")
+	} else if err := update(schema.UserSourceOIDC, ""); err != nil {
+		t.Fatalf("外部认证的用户之间转换无需密码：%v", err)
+	}
+
+	if err := update(schema.UserSourceLocalName, "123456"); err != nil {
+		t.Fatal(err)
+	} else if item := model.Find("u1"); item.Source != schema.UserSourceLocal || item.Password != util.SHA1HashString("123456") {
+		t.Fatalf("应转换为本地用户并设置密码：%+v", item)
+	}
+
+	if err := update(schema.UserSourceLDAP, ""); err == nil {
+		t.Fatal("本地用户转换为外部认证的用户时未设置密码应失败")
+	} else if err := update("unknown", ""); err == nil {
+		t.Fatal("认证来源无效时应失败")
+	}
+}
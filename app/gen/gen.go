@@ -0,0 +1,375 @@
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// 系统内置字段，不允许通过--fields定义
+var reservedFields = map[string]bool{
+	"id":        true,
+	"record_id": true,
+	"creator":   true,
+	"created":   true,
+	"updated":   true,
+	"deleted":   true,
+	"version":   true,
+}
+
+// 字段类型与Go类型的对应关系
+var fieldTypes = map[string]string{
+	"string":  "string",
+	"int":     "int",
+	"int64":   "int64",
+	"float64": "float64",
+	"bool":    "bool",
+}
+
+var (
+	namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	sizePattern = regexp.MustCompile(`^string\((\d+)\)$`)
+)
+
+// Run 执行代码生成命令，args为gen之后的命令行参数
+func Run(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "module" {
+		return errors.New("用法：gen module <name> --fields name:type[:label][:required],...")
+	}
+
+	fs := flag.NewFlagSet("gen module", flag.ContinueOnError)
+	fs.SetOutput(out)
+	var (
+		fields = fs.String("fields", "", "字段定义(name:type[:label][:required]，多个字段以逗号分隔，type可选string|string(N)|int|int64|float64|bool)")
+		title  = fs.String("title", "", "模块中文名称(默认为模块名称)")
+		dir    = fs.String("dir", ".", "项目根目录")
+		parent = fs.String("parent", "admin/system", "模块菜单的上级菜单编号路径(默认为系统管理)")
+		force  = fs.Bool("force", false, "覆盖已存在的文件")
+	)
+
+	// 允许模块名称出现在参数的任意位置
+	var names []string
+	rest := args[1:]
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		names = append(names, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+	if len(names) != 1 {
+		return errors.New("请指定一个模块名称")
+	}
+
+	m, err := newModule(names[0], *title, *fields)
+	if err != nil {
+		return err
+	}
+	m.Parent = strings.Trim(*parent, "/")
+
+	g := &generator{dir: *dir, force: *force, out: out}
+	return g.generate(m)
+}
+
+// module 模块定义
+type module struct {
+	Name    string   // 模块名称(小写下划线)
+	GoName  string   // Go类型名称
+	VarName string   // Go变量名称
+	Title   string   // 中文名称
+	Plural  string   // 路由名称
+	Fields  []*field // 自定义字段
+	Parent  string   // 上级菜单编号路径
+}
+
+// field 字段定义
+type field struct {
+	Name     string // 列名
+	GoName   string // Go字段名称
+	Type     string // Go类型
+	Label    string // 说明
+	Size     int    // 字符串长度
+	Required bool   // 是否必填
+}
+
+func newModule(name, title, spec string) (*module, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("无效的模块名称：%s", name)
+	}
+
+	m := &module{
+		Name:   name,
+		GoName: toGoName(name),
+		Title:  title,
+		Plural: plural(name),
+	}
+	m.VarName = strings.ToLower(m.GoName[:1]) + m.GoName[1:]
+	if m.Title == "" {
+		m.Title = m.GoName
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		f, err := parseField(s)
+		if err != nil {
+			return nil, err
+		} else if seen[f.Name] {
+			return nil, fmt.Errorf("字段重复定义：%s", f.Name)
+		}
+		seen[f.Name] = true
+		m.Fields = append(m.Fields, f)
+	}
+
+	if len(m.Fields) == 0 {
+		return nil, errors.New("请通过--fields指定至少一个字段")
+	}
+	return m, nil
+}
+
+func parseField(s string) (*field, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 4 {
+		return nil, fmt.Errorf("无效的字段定义：%s", s)
+	}
+
+	f := &field{Name: parts[0], GoName: toGoName(parts[0]), Label: parts[0]}
+	if !namePattern.MatchString(f.Name) {
+		return nil, fmt.Errorf("无效的字段名称：%s", f.Name)
+	} else if reservedFields[f.Name] {
+		return nil, fmt.Errorf("字段[%s]为系统内置字段", f.Name)
+	}
+
+	if sm := sizePattern.FindStringSubmatch(parts[1]); sm != nil {
+		f.Type = "string"
+		f.Size, _ = strconv.Atoi(sm[1])
+	} else if t, ok := fieldTypes[parts[1]]; ok {
+		f.Type = t
+		if t == "string" {
+			f.Size = 50
+		}
+	} else {
+		return nil, fmt.Errorf("字段[%s]的类型无效：%s", f.Name, parts[1])
+	}
+
+	for _, p := range parts[2:] {
+		if p == "required" {
+			f.Required = true
+		} else if p != "" {
+			f.Label = p
+		}
+	}
+	return f, nil
+}
+
+// AllFields 包含系统内置字段的全部字段
+func (m *module) AllFields() []*field {
+	fields := []*field{
+		{Name: "id", GoName: "ID", Type: "int64", Label: "唯一标识(自增ID)"},
+		{Name: "record_id", GoName: "RecordID", Type: "string", Label: "记录内码(uuid)", Size: 36},
+	}
+	fields = append(fields, m.Fields...)
+	return append(fields,
+		&field{Name: "creator", GoName: "Creator", Type: "string", Label: "创建者", Size: 36},
+		&field{Name: "created", GoName: "Created", Type: "int64", Label: "创建时间戳"},
+		&field{Name: "updated", GoName: "Updated", Type: "int64", Label: "更新时间戳"},
+		&field{Name: "deleted", GoName: "Deleted", Type: "int64", Label: "删除时间戳"},
+		&field{Name: "version", GoName: "Version", Type: "int64", Label: "版本号(乐观锁)"},
+	)
+}
+
+// StringFields 可作为模糊查询条件的字段
+func (m *module) StringFields() []*field {
+	var fields []*field
+	for _, f := range m.Fields {
+		if f.Type == "string" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// RecycleColumns 回收站查询的列(code及name列不存在时返回空字符串)
+func (m *module) RecycleColumns() string {
+	cols := []string{"id", "record_id"}
+	for _, name := range []string{"code", "name"} {
+		col := fmt.Sprintf("'' AS %s", name)
+		for _, f := range m.Fields {
+			if f.Name == name {
+				col = name
+			}
+		}
+		cols = append(cols, col)
+	}
+	return strings.Join(append(cols, "deleted"), ",")
+}
+
+// Tag 结构体字段标签
+func (f *field) Tag() string {
+	db := f.Name
+	switch {
+	case f.Name == "id":
+		db += ",primarykey,autoincrement"
+	case f.Size > 0:
+		db += fmt.Sprintf(",size:%d", f.Size)
+	}
+
+	structs := f.Name
+	if f.Name == "version" {
+		structs = "-"
+	}
+
+	tag := fmt.Sprintf(`json:"%s" db:"%s" structs:"%s"`, f.Name, db, structs)
+	if f.Required {
+		tag += ` binding:"required"`
+	}
+	return "`" + tag + "`"
+}
+
+// ResultTag 查询结果的字段标签
+func (f *field) ResultTag() string {
+	return fmt.Sprintf("`json:\"%s\" db:\"%s\"`", f.Name, f.Name)
+}
+
+// Sample 测试用例中的字段取值
+func (f *field) Sample(n int) string {
+	switch f.Type {
+	case "string":
+		return strconv.Quote(fmt.Sprintf("test_%s_%d", f.Name, n))
+	case "float64":
+		return fmt.Sprintf("%d.5", n)
+	case "bool":
+		return strconv.FormatBool(n%2 == 1)
+	}
+	return strconv.Itoa(n)
+}
+
+// generator 代码生成器
+type generator struct {
+	dir   string
+	force bool
+	out   io.Writer
+}
+
+func (g *generator) generate(m *module) error {
+	files := []struct {
+		path string
+		tpl  string
+	}{
+		{"app/schema/s_%s.go", schemaTemplate},
+		{"app/models/m_%s.go", modelTemplate},
+		{"app/models/mysql/m_%s.go", mysqlTemplate},
+		{"app/bll/b_%s.go", bllTemplate},
+		{"app/http/ctl/c_%s.go", ctlTemplate},
+		{"routes/r_api_%s.go", routerTemplate},
+		{"app/models/modeltest/%s.go", modeltestTemplate},
+		{"routes/r_api_%s_test.go", testTemplate},
+	}
+
+	// 先检查再写入，避免生成一半的模块
+	for _, f := range files {
+		path := filepath.Join(g.dir, fmt.Sprintf(f.path, m.Name))
+		if _, err := os.Stat(path); err == nil && !g.force {
+			return fmt.Errorf("文件已存在：%s(使用--force覆盖)", path)
+		}
+	}
+
+	for _, f := range files {
+		buf, err := render(f.tpl, m)
+		if err != nil {
+			return err
+		}
+
+		path := fmt.Sprintf(f.path, m.Name)
+		if err := g.writeFile(path, buf); err != nil {
+			return err
+		}
+	}
+
+	if err := g.register(m); err != nil {
+		return err
+	}
+
+	if err := g.registerSnapshot(m); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(g.out, "模块[%s]生成完成，请执行snapshot apply导入%s中的菜单及资源数据\n", m.Name, snapshotFile)
+	return nil
+}
+
+func (g *generator) writeFile(path string, buf []byte) error {
+	full := filepath.Join(g.dir, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return errors.Wrapf(err, "创建目录发生错误")
+	}
+
+	if err := ioutil.WriteFile(full, buf, 0644); err != nil {
+		return errors.Wrapf(err, "写入文件[%s]发生错误", path)
+	}
+
+	fmt.Fprintf(g.out, "生成文件：%s\n", path)
+	return nil
+}
+
+func render(text string, m *module) ([]byte, error) {
+	tpl, err := template.New("").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "解析模板发生错误")
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, m); err != nil {
+		return nil, errors.Wrap(err, "渲染模板发生错误")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "格式化代码发生错误")
+	}
+	return src, nil
+}
+
+// toGoName 将下划线名称转换为Go名称
+func toGoName(name string) string {
+	var buf strings.Builder
+	for _, s := range strings.Split(name, "_") {
+		switch s {
+		case "":
+		case "id", "url", "ip", "api":
+			buf.WriteString(strings.ToUpper(s))
+		default:
+			buf.WriteString(strings.ToUpper(s[:1]) + s[1:])
+		}
+	}
+	return buf.String()
+}
+
+// plural 获取名称的复数形式(用于路由)
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
@@ -0,0 +1,91 @@
+package gen
+
+import (
+	"bytes"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// copyDir 复制目录
+func copyDir(t *testing.T, src, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, buf, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGenerateCompile 在项目副本中生成模块，编译并执行生成的测试
+func TestGenerateCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("编译项目耗时较长")
+	}
+	goBin := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, err := os.Stat(goBin); err != nil {
+		t.Skip("未找到go命令")
+	}
+
+	gopath, err := ioutil.TempDir("", "gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	root, _ := filepath.Abs("../..")
+	dir := filepath.Join(gopath, "src", "moddns")
+	for _, name := range []string{"app", "routes", "database", "config"} {
+		copyDir(t, filepath.Join(root, name), filepath.Join(dir, name))
+	}
+	for _, name := range []string{"main.go", "vendor"} {
+		if err := os.Symlink(filepath.Join(root, name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	err = Run([]string{"module", "widget",
+		"--fields", "name:string(50):名称:required,price:float64:价格,count:int,enabled:bool,remark:string",
+		"--title", "部件", "--dir", dir}, &out)
+	if err != nil {
+		t.Fatalf("生成模块发生错误：%v\n%s", err, out.String())
+	}
+
+	if buf, _ := ioutil.ReadFile(filepath.Join(dir, "app/recycle.go")); !strings.Contains(string(buf), "ctlCommon.WidgetAPI.WidgetBll.PurgeExpired") {
+		t.Fatal("生成的模块未注册到回收站清理任务")
+	}
+
+	env := append(os.Environ(),
+		"GOPATH="+strings.Join([]string{gopath, build.Default.GOPATH}, string(os.PathListSeparator)),
+		"GO111MODULE=off")
+	for _, args := range [][]string{
+		{"build", "./..."},
+		{"vet", "./app/models/modeltest/", "./routes/"},
+		{"test", "-run", "TestWidgetRouter", "./routes/"},
+	} {
+		cmd := exec.Command(goBin, args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		if buf, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("生成的代码执行go %s失败：%v\n%s", args[0], err, buf)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package gen
+
+import (
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"moddns/app/schema"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// register 在models/mysql.Common、ctl.Common、routes.APIV1Handler及回收站清理任务中注册模块
+func (g *generator) register(m *module) error {
+	patches := []struct {
+		path   string
+		anchor string // 在该位置之后查找插入点
+		before string // 在该内容之前插入
+		line   string
+	}{
+		{
+			path:   "app/models/mysql/m_common.go",
+			anchor: "type Common struct {",
+			before: "\n}",
+			line:   fmt.Sprintf("\t%s *%s", m.GoName, m.GoName),
+		},
+		{
+			path:   "app/models/mysql/m_common.go",
+			anchor: "func (a *Common) Init(",
+			before: "\n\treturn a\n",
+			line:   fmt.Sprintf("\ta.%s = new(%s).Init(g, db, a)", m.GoName, m.GoName),
+		},
+		{
+			path:   "app/http/ctl/c_common.go",
+			anchor: "type Common struct {",
+			before: "\n}",
+			line:   fmt.Sprintf("\t%sAPI *%s `inject:\"\"`", m.GoName, m.GoName),
+		},
+		{
+			path:   "routes/r_api.go",
+			anchor: "func APIV1Handler(",
+			before: "\n}",
+			line:   fmt.Sprintf("\tAPI%sRouter(v1, c.%sAPI)", m.GoName, m.GoName),
+		},
+		{
+			path:   "app/recycle.go",
+			anchor: "purges := []struct",
+			before: "\n\t}\n",
+			line:   fmt.Sprintf("\t\t{%q, ctlCommon.%sAPI.%sBll.PurgeExpired},", m.Title, m.GoName, m.GoName),
+		},
+	}
+
+	for _, p := range patches {
+		if err := g.patchFile(p.path, p.anchor, p.before, p.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) patchFile(path, anchor, before, line string) error {
+	full := filepath.Join(g.dir, path)
+	buf, err := ioutil.ReadFile(full)
+	if err != nil {
+		return errors.Wrapf(err, "读取文件[%s]发生错误", path)
+	}
+
+	src := string(buf)
+	if strings.Contains(src, strings.TrimSpace(line)) {
+		return nil
+	}
+
+	start := strings.Index(src, anchor)
+	if start == -1 {
+		return fmt.Errorf("文件[%s]中未找到：%s", path, anchor)
+	}
+
+	i := strings.Index(src[start:], before)
+	if i == -1 {
+		return fmt.Errorf("文件[%s]中未找到插入位置", path)
+	}
+	i += start
+
+	src = src[:i] + "\n" + line + src[i:]
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return errors.Wrapf(err, "格式化文件[%s]发生错误", path)
+	}
+
+	if err := ioutil.WriteFile(full, out, 0644); err != nil {
+		return errors.Wrapf(err, "写入文件[%s]发生错误", path)
+	}
+
+	fmt.Fprintf(g.out, "注册模块：%s\n", path)
+	return nil
+}
+
+// snapshotFile 初始配置快照文件
+const snapshotFile = "database/snapshot.yaml"
+
+// registerSnapshot 在配置快照中加入模块的菜单及资源(已存在时忽略)
+func (g *generator) registerSnapshot(m *module) error {
+	full := filepath.Join(g.dir, snapshotFile)
+	buf, err := ioutil.ReadFile(full)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "读取文件[%s]发生错误", snapshotFile)
+	}
+
+	snap := schema.Snapshot{Version: schema.SnapshotVersion}
+	if err := yaml.Unmarshal(buf, &snap); err != nil {
+		return errors.Wrapf(err, "解析文件[%s]发生错误", snapshotFile)
+	}
+
+	code := m.VarName
+	if m.Parent != "" {
+		code = m.Parent + "/" + code
+	}
+	for _, item := range snap.Menus {
+		if item.Code == code {
+			return nil
+		}
+	}
+
+	snap.Menus = append(snap.Menus, &schema.SnapshotMenu{
+		Code:     code,
+		Name:     m.Title,
+		Type:     30,
+		Sequence: 90,
+		Path:     "/system/" + m.Name,
+		IsHide:   2,
+		Status:   1,
+	})
+
+	path := "/api/v1/" + m.Plural
+	resources := []struct {
+		code, name, path, method string
+	}{
+		{"query", "查询%s数据", path, "GET"},
+		{"one", "查询指定%s数据", path + "/:id", "GET"},
+		{"create", "创建%s数据", path, "POST"},
+		{"update", "更新%s数据", path + "/:id", "PUT"},
+		{"delete", "删除%s数据", path + "/:id", "DELETE"},
+		{"deleteMany", "删除多条%s数据", path, "DELETE"},
+		{"recycleQuery", "查询已删除%s数据", "/api/v1/recycle/" + m.Plural, "GET"},
+		{"restore", "恢复已删除%s数据", "/api/v1/recycle/" + m.Plural + "/:id/restore", "PATCH"},
+		{"purge", "彻底删除%s数据", "/api/v1/recycle/" + m.Plural + "/:id", "DELETE"},
+	}
+	for i, r := range resources {
+		snap.Menus = append(snap.Menus, &schema.SnapshotMenu{
+			Code:     code + "/" + r.code,
+			Name:     fmt.Sprintf(r.name, m.Title),
+			Type:     40,
+			Sequence: i + 1,
+			Path:     r.path,
+			Method:   r.method,
+			IsHide:   1,
+			Status:   1,
+		})
+	}
+
+	out, err := yaml.Marshal(&snap)
+	if err != nil {
+		return errors.Wrapf(err, "编码文件[%s]发生错误", snapshotFile)
+	}
+
+	// 保留文件开头的注释
+	var header strings.Builder
+	for _, line := range strings.SplitAfter(string(buf), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		header.WriteString(line)
+	}
+
+	if err := g.writeFile(snapshotFile, append([]byte(header.String()), out...)); err != nil {
+		return err
+	}
+	return nil
+}
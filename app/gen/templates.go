@@ -0,0 +1,685 @@
+package gen
+
+// 以下模板均以Demo模块为蓝本
+
+const schemaTemplate = `package schema
+
+// {{.GoName}} {{.Title}}
+type {{.GoName}} struct {
+{{- range .AllFields}}
+	{{.GoName}} {{.Type}} {{.Tag}} // {{.Label}}
+{{- end}}
+}
+
+// {{.GoName}}QueryParam {{.Title}}查询条件
+type {{.GoName}}QueryParam struct {
+{{- range .StringFields}}
+	{{.GoName}} string // {{.Label}}
+{{- end}}
+}
+
+// {{.GoName}}QueryResult {{.Title}}查询结果
+type {{.GoName}}QueryResult struct {
+	ID int64 {{(index .AllFields 0).ResultTag}} // 唯一标识(自增ID)
+	RecordID string {{(index .AllFields 1).ResultTag}} // 记录内码(uuid)
+{{- range .Fields}}
+	{{.GoName}} {{.Type}} {{.ResultTag}} // {{.Label}}
+{{- end}}
+}
+`
+
+const modelTemplate = `package models
+
+import (
+	"context"
+	"moddns/app/schema"
+)
+
+// I{{.GoName}} {{.Title}}
+type I{{.GoName}} interface {
+	// 查询分页数据
+	QueryPage(ctx context.Context, param schema.{{.GoName}}QueryParam, pageIndex, pageSize uint) (int64, []*schema.{{.GoName}}QueryResult, error)
+	// Get 查询指定数据
+	Get(ctx context.Context, recordID string) (*schema.{{.GoName}}, error)
+	// Check 检查数据是否存在
+	Check(ctx context.Context, recordID string) (bool, error)
+	// Create 创建数据
+	Create(ctx context.Context, item *schema.{{.GoName}}) error
+	// Update 更新数据
+	Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error
+	// Delete 删除数据
+	Delete(ctx context.Context, recordID string) error
+	// 查询已删除的分页数据
+	QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error)
+	// 查询指定的已删除数据
+	GetDeleted(ctx context.Context, recordID string) (*schema.{{.GoName}}, error)
+	// 恢复已删除的数据
+	Restore(ctx context.Context, recordID string, deleted int64) error
+	// 彻底删除已删除的数据
+	Purge(ctx context.Context, recordID string) error
+	// 彻底删除指定时间之前删除的数据
+	PurgeExpired(ctx context.Context, before int64) (int64, error)
+}
+`
+
+const mysqlTemplate = `package mysql
+
+import (
+	"context"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/mysql"
+
+	"github.com/facebookgo/inject"
+)
+
+// {{.GoName}} {{.Title}}
+type {{.GoName}} struct {
+	DB     *mysql.DB
+	Common *Common
+	repo   *mysql.Repository
+}
+
+// Init 初始化
+func (a *{{.GoName}}) Init(g *inject.Graph, db *mysql.DB, c *Common) *{{.GoName}} {
+	a.DB = db
+	a.Common = c
+	a.repo = mysql.NewRepository(db, a.TableName())
+
+	g.Provide(&inject.Object{Value: models.I{{.GoName}}(a), Name: "I{{.GoName}}"})
+
+	db.CreateTableIfNotExists(schema.{{.GoName}}{}, a.TableName())
+	db.CreateTableColumn(a.TableName(), "version", "bigint NOT NULL DEFAULT 1")
+	db.BackfillVersion(a.TableName())
+
+	db.CreateTableIndex(a.TableName(), "idx_record_id", true, "record_id")
+{{- range .StringFields}}
+	db.CreateTableIndex(a.TableName(), "idx_{{.Name}}", false, "{{.Name}}")
+{{- end}}
+	db.CreateTableIndex(a.TableName(), "idx_deleted", false, "deleted")
+
+	return a
+}
+
+// TableName 表名
+func (a *{{.GoName}}) TableName() string {
+	return a.Common.TableName("{{.Name}}")
+}
+
+// QueryPage 查询分页数据
+func (a *{{.GoName}}) QueryPage(ctx context.Context, params schema.{{.GoName}}QueryParam, pageIndex, pageSize uint) (int64, []*schema.{{.GoName}}QueryResult, error) {
+	filter := mysql.NewFilter()
+{{- range .StringFields}}
+	filter.Like("{{.Name}}", params.{{.GoName}})
+{{- end}}
+
+	var items []*schema.{{.GoName}}QueryResult
+	count, err := a.repo.QueryPage(ctx, filter, "id DESC", pageIndex, pageSize, &items)
+	return count, items, err
+}
+
+// Get 查询指定数据
+func (a *{{.GoName}}) Get(ctx context.Context, recordID string) (*schema.{{.GoName}}, error) {
+	var item schema.{{.GoName}}
+	if ok, err := a.repo.Get(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Check 检查数据是否存在
+func (a *{{.GoName}}) Check(ctx context.Context, recordID string) (bool, error) {
+	return a.repo.Check(ctx, recordID)
+}
+
+// Create 创建数据
+func (a *{{.GoName}}) Create(ctx context.Context, item *schema.{{.GoName}}) error {
+	return a.repo.Create(ctx, item)
+}
+
+// Update 更新数据(version大于0时校验版本号)
+func (a *{{.GoName}}) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	return a.repo.Update(ctx, recordID, info, version)
+}
+
+// Delete 删除数据
+func (a *{{.GoName}}) Delete(ctx context.Context, recordID string) error {
+	_, err := a.repo.Delete(ctx, recordID)
+	return err
+}
+
+// QueryDeletedPage 查询已删除的分页数据
+func (a *{{.GoName}}) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	var items []*schema.RecycleQueryResult
+	count, err := a.repo.QueryDeletedPage(ctx, "{{.RecycleColumns}}", pageIndex, pageSize, &items)
+	return count, items, err
+}
+
+// GetDeleted 查询指定的已删除数据
+func (a *{{.GoName}}) GetDeleted(ctx context.Context, recordID string) (*schema.{{.GoName}}, error) {
+	var item schema.{{.GoName}}
+	if ok, err := a.repo.GetDeleted(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Restore 恢复已删除的数据
+func (a *{{.GoName}}) Restore(ctx context.Context, recordID string, deleted int64) error {
+	return a.repo.Restore(ctx, recordID, deleted, nil)
+}
+
+// Purge 彻底删除已删除的数据
+func (a *{{.GoName}}) Purge(ctx context.Context, recordID string) error {
+	return a.repo.Purge(ctx, recordID)
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据，返回删除的数据条数
+func (a *{{.GoName}}) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	return a.repo.PurgeExpired(ctx, before)
+}
+`
+
+const bllTemplate = `package bll
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/util"
+	"time"
+)
+
+// {{.GoName}} {{.Title}}
+type {{.GoName}} struct {
+	{{.GoName}}Model models.I{{.GoName}} ` + "`" + `inject:"I{{.GoName}}"` + "`" + `
+	TransModel models.ITrans ` + "`" + `inject:"ITrans"` + "`" + `
+}
+
+// QueryPage 查询分页数据
+func (a *{{.GoName}}) QueryPage(ctx context.Context, params schema.{{.GoName}}QueryParam, pageIndex, pageSize uint) (int64, []*schema.{{.GoName}}QueryResult, error) {
+	return a.{{.GoName}}Model.QueryPage(ctx, params, pageIndex, pageSize)
+}
+
+// Get 查询指定数据
+func (a *{{.GoName}}) Get(ctx context.Context, recordID string) (*schema.{{.GoName}}, error) {
+	item, err := a.{{.GoName}}Model.Get(ctx, recordID)
+	if err != nil {
+		return nil, err
+	} else if item == nil {
+		return nil, util.ErrNotFound
+	}
+
+	return item, nil
+}
+
+// Create 创建数据
+func (a *{{.GoName}}) Create(ctx context.Context, item *schema.{{.GoName}}) error {
+	item.ID = 0
+	item.RecordID = uuid.New().String()
+	item.Created = time.Now().Unix()
+	item.Deleted = 0
+	item.Version = 1
+	return a.{{.GoName}}Model.Create(ctx, item)
+}
+
+// Update 更新数据
+func (a *{{.GoName}}) Update(ctx context.Context, recordID string, item *schema.{{.GoName}}) error {
+	exists, err := a.{{.GoName}}Model.Check(ctx, recordID)
+	if err != nil {
+		return err
+	} else if !exists {
+		return util.ErrNotFound
+	}
+
+	info := util.StructToMap(item)
+	delete(info, "id")
+	delete(info, "record_id")
+	delete(info, "creator")
+	delete(info, "created")
+	delete(info, "updated")
+	delete(info, "deleted")
+
+	return a.{{.GoName}}Model.Update(ctx, recordID, info, item.Version)
+}
+
+// Delete 删除数据
+func (a *{{.GoName}}) Delete(ctx context.Context, recordID string) error {
+	exists, err := a.{{.GoName}}Model.Check(ctx, recordID)
+	if err != nil {
+		return err
+	} else if !exists {
+		return util.ErrNotFound
+	}
+
+	return a.{{.GoName}}Model.Delete(ctx, recordID)
+}
+
+// DeleteMany 删除多条数据(全部成功或全部回滚)
+func (a *{{.GoName}}) DeleteMany(ctx context.Context, recordIDs []string) ([]*schema.BatchResult, error) {
+	return execBatch(ctx, a.TransModel, recordIDs, a.Delete)
+}
+
+// QueryDeletedPage 查询已删除的分页数据(回收站)
+func (a *{{.GoName}}) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	return a.{{.GoName}}Model.QueryDeletedPage(ctx, pageIndex, pageSize)
+}
+
+// Restore 恢复已删除的数据
+func (a *{{.GoName}}) Restore(ctx context.Context, recordID string) error {
+	item, err := a.{{.GoName}}Model.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	return a.{{.GoName}}Model.Restore(ctx, recordID, item.Deleted)
+}
+
+// Purge 彻底删除已删除的数据
+func (a *{{.GoName}}) Purge(ctx context.Context, recordID string) error {
+	item, err := a.{{.GoName}}Model.GetDeleted(ctx, recordID)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return util.ErrNotFound
+	}
+
+	return a.{{.GoName}}Model.Purge(ctx, recordID)
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据
+func (a *{{.GoName}}) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	return a.{{.GoName}}Model.PurgeExpired(ctx, before.Unix())
+}
+`
+
+const ctlTemplate = `package ctl
+
+import (
+	"moddns/app/bll"
+	"moddns/app/http/context"
+	"moddns/app/schema"
+)
+
+// {{.GoName}} {{.Title}}
+type {{.GoName}} struct {
+	{{.GoName}}Bll *bll.{{.GoName}} ` + "`" + `inject:""` + "`" + `
+}
+
+// Query 查询数据
+func (a *{{.GoName}}) Query(ctx *context.Context) {
+	switch ctx.Query("type") {
+	case "page":
+		a.QueryPage(ctx)
+	default:
+		ctx.ResBadRequest(nil)
+	}
+}
+
+// QueryPage 查询分页数据
+func (a *{{.GoName}}) QueryPage(ctx *context.Context) {
+	pageIndex, pageSize := ctx.GetPageIndex(), ctx.GetPageSize()
+
+	var params schema.{{.GoName}}QueryParam
+{{range .StringFields}}
+	params.{{.GoName}} = ctx.Query("{{.Name}}")
+{{- end}}
+
+	total, items, err := a.{{.GoName}}Bll.QueryPage(ctx.NewContext(), params, pageIndex, pageSize)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResPage(total, items)
+}
+
+// Get 查询指定数据
+func (a *{{.GoName}}) Get(ctx *context.Context) {
+	item, err := a.{{.GoName}}Bll.Get(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.SetETag(item.Version)
+	ctx.ResSuccess(item)
+}
+
+// Create 创建数据
+func (a *{{.GoName}}) Create(ctx *context.Context) {
+	var item schema.{{.GoName}}
+	if err := ctx.ParseJSON(&item); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	item.Creator = ctx.GetUserID()
+	err := a.{{.GoName}}Bll.Create(ctx.NewContext(), &item)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	newItem, err := a.{{.GoName}}Bll.Get(ctx.NewContext(), item.RecordID)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResSuccess(newItem)
+}
+
+// Update 更新数据
+func (a *{{.GoName}}) Update(ctx *context.Context) {
+	var item schema.{{.GoName}}
+	if err := ctx.ParseJSON(&item); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	if version, err := ctx.GetIfMatch(); err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	} else if version > 0 {
+		item.Version = version
+	}
+
+	err := a.{{.GoName}}Bll.Update(ctx.NewContext(), ctx.Param("id"), &item)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResOK()
+}
+
+// Delete 删除数据
+func (a *{{.GoName}}) Delete(ctx *context.Context) {
+	err := a.{{.GoName}}Bll.Delete(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// DeleteMany 删除多条数据
+func (a *{{.GoName}}) DeleteMany(ctx *context.Context) {
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	ctx.ResBatch(a.{{.GoName}}Bll.DeleteMany(ctx.NewContext(), param.IDs))
+}
+
+// QueryDeleted 查询已删除的分页数据(回收站)
+func (a *{{.GoName}}) QueryDeleted(ctx *context.Context) {
+	total, items, err := a.{{.GoName}}Bll.QueryDeletedPage(ctx.NewContext(), ctx.GetPageIndex(), ctx.GetPageSize())
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResPage(total, items)
+}
+
+// Restore 恢复已删除的数据
+func (a *{{.GoName}}) Restore(ctx *context.Context) {
+	err := a.{{.GoName}}Bll.Restore(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Purge 彻底删除已删除的数据
+func (a *{{.GoName}}) Purge(ctx *context.Context) {
+	err := a.{{.GoName}}Bll.Purge(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+`
+
+const routerTemplate = `package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"moddns/app/http/context"
+	"moddns/app/http/ctl"
+)
+
+// API{{.GoName}}Router 注册/{{.Plural}}路由
+func API{{.GoName}}Router(g *gin.RouterGroup, {{.VarName}} *ctl.{{.GoName}}) {
+	g.GET("/{{.Plural}}", context.WrapContext({{.VarName}}.Query, "查询{{.Title}}数据"))
+	g.GET("/{{.Plural}}/:id", context.WrapContext({{.VarName}}.Get, "查询指定{{.Title}}数据"))
+	g.POST("/{{.Plural}}", context.WrapContext({{.VarName}}.Create, "创建{{.Title}}数据"))
+	g.PUT("/{{.Plural}}/:id", context.WrapContext({{.VarName}}.Update, "更新{{.Title}}数据"))
+	g.DELETE("/{{.Plural}}/:id", context.WrapContext({{.VarName}}.Delete, "删除{{.Title}}数据"))
+	g.DELETE("/{{.Plural}}", context.WrapContext({{.VarName}}.DeleteMany, "删除多条{{.Title}}数据"))
+	g.GET("/recycle/{{.Plural}}", context.WrapContext({{.VarName}}.QueryDeleted, "查询已删除{{.Title}}数据"))
+	g.PATCH("/recycle/{{.Plural}}/:id/restore", context.WrapContext({{.VarName}}.Restore, "恢复已删除{{.Title}}数据"))
+	g.DELETE("/recycle/{{.Plural}}/:id", context.WrapContext({{.VarName}}.Purge, "彻底删除{{.Title}}数据"))
+}
+`
+
+const modeltestTemplate = `package modeltest
+
+import (
+	"context"
+	"time"
+
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/util"
+)
+
+// {{.GoName}} 内存中的{{.Title}}存储(Deleted大于0的数据为已删除的数据，未实现的方法调用时panic)
+type {{.GoName}} struct {
+	models.I{{.GoName}}
+	Items []*schema.{{.GoName}}
+}
+
+// Find 查找数据(包括已删除的数据)
+func (m *{{.GoName}}) Find(recordID string) *schema.{{.GoName}} {
+	for _, item := range m.Items {
+		if item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+// Get 查询指定数据
+func (m *{{.GoName}}) Get(ctx context.Context, recordID string) (*schema.{{.GoName}}, error) {
+	if item := m.Find(recordID); item != nil && item.Deleted == 0 {
+		v := *item
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// Check 检查数据是否存在
+func (m *{{.GoName}}) Check(ctx context.Context, recordID string) (bool, error) {
+	item := m.Find(recordID)
+	return item != nil && item.Deleted == 0, nil
+}
+
+// Create 创建数据
+func (m *{{.GoName}}) Create(ctx context.Context, item *schema.{{.GoName}}) error {
+	v := *item
+	v.ID = int64(len(m.Items) + 1)
+	m.Items = append(m.Items, &v)
+	return nil
+}
+
+// Update 更新数据(version大于0时校验版本号)
+func (m *{{.GoName}}) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	item := m.Find(recordID)
+	if item == nil || item.Deleted > 0 || (version > 0 && version != item.Version) {
+		return util.ErrConflict
+	}
+	setFields(item, info)
+	item.Version++
+	return nil
+}
+
+// Delete 删除数据
+func (m *{{.GoName}}) Delete(ctx context.Context, recordID string) error {
+	if item := m.Find(recordID); item != nil && item.Deleted == 0 {
+		item.Deleted = time.Now().Unix()
+	}
+	return nil
+}
+
+// GetDeleted 查询指定的已删除数据
+func (m *{{.GoName}}) GetDeleted(ctx context.Context, recordID string) (*schema.{{.GoName}}, error) {
+	if item := m.Find(recordID); item != nil && item.Deleted > 0 {
+		v := *item
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// Restore 恢复已删除的数据
+func (m *{{.GoName}}) Restore(ctx context.Context, recordID string, deleted int64) error {
+	if item := m.Find(recordID); item != nil && item.Deleted > 0 && item.Deleted == deleted {
+		item.Deleted = 0
+		return nil
+	}
+	return util.ErrConflict
+}
+
+// Purge 彻底删除已删除的数据
+func (m *{{.GoName}}) Purge(ctx context.Context, recordID string) error {
+	return m.purge(func(item *schema.{{.GoName}}) bool { return item.RecordID == recordID })
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据
+func (m *{{.GoName}}) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	n := len(m.Items)
+	m.purge(func(item *schema.{{.GoName}}) bool { return item.Deleted < before })
+	return int64(n - len(m.Items)), nil
+}
+
+func (m *{{.GoName}}) purge(match func(*schema.{{.GoName}}) bool) error {
+	items := m.Items[:0]
+	for _, item := range m.Items {
+		if item.Deleted > 0 && match(item) {
+			continue
+		}
+		items = append(items, item)
+	}
+	m.Items = items
+	return nil
+}
+`
+
+const testTemplate = `package routes_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"moddns/app/bll"
+	"moddns/app/http/ctl"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Test{{.GoName}}Router 创建、查询、按版本号更新、删除、恢复及彻底删除{{.Title}}数据
+func Test{{.GoName}}Router(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	model := new(modeltest.{{.GoName}})
+	{{.VarName}}Bll := &bll.{{.GoName}}{ {{- .GoName}}Model: model, TransModel: new(modeltest.Trans)}
+	app := gin.New()
+	routes.API{{.GoName}}Router(app.Group("/api/v1"), &ctl.{{.GoName}}{ {{- .GoName}}Bll: {{.VarName}}Bll})
+
+	do := func(method, path, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, "/api/v1/"+path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		return w
+	}
+
+	addItem := &schema.{{.GoName}}{
+{{- range .Fields}}
+		{{.GoName}}: {{.Sample 1}},
+{{- end}}
+	}
+	w := do(http.MethodPost, "{{.Plural}}", "", addItem)
+	var newItem schema.{{.GoName}}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &newItem) != nil || newItem.RecordID == "" {
+		t.Fatalf("创建数据错误：%d %s", w.Code, w.Body.String())
+	}
+	path := "{{.Plural}}/" + newItem.RecordID
+
+	w = do(http.MethodGet, path, "", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag != ` + "`" + `"1"` + "`" + ` {
+		t.Fatalf("查询响应错误：%d %s", w.Code, etag)
+	}
+
+	putItem := newItem
+{{- range .Fields}}
+	putItem.{{.GoName}} = {{.Sample 2}}
+{{- end}}
+	if w := do(http.MethodPut, path, etag, putItem); w.Code != http.StatusOK {
+		t.Fatalf("版本号一致时应更新成功：%d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, path, etag, putItem); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("版本号过期时应返回412：%d", w.Code)
+	}
+	item := model.Find(newItem.RecordID)
+	if item.Version != 2 {{- range .Fields}} || item.{{.GoName}} != putItem.{{.GoName}} {{- end}} {
+		t.Fatalf("更新数据错误：%+v", item)
+	}
+
+	// 删除后可从回收站恢复
+	if w := do(http.MethodDelete, path, "", nil); w.Code != http.StatusOK || item.Deleted == 0 {
+		t.Fatalf("删除数据错误：%d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, path, "", nil); w.Code == http.StatusOK {
+		t.Fatal("不应查询到已删除的数据")
+	}
+	if w := do(http.MethodPatch, "recycle/"+path+"/restore", "", nil); w.Code != http.StatusOK || item.Deleted != 0 {
+		t.Fatalf("恢复数据错误：%d %s", w.Code, w.Body.String())
+	}
+
+	// 彻底删除已删除的数据，过期的数据由回收任务清理
+	do(http.MethodDelete, path, "", nil)
+	if w := do(http.MethodDelete, "recycle/"+path, "", nil); w.Code != http.StatusOK || model.Find(newItem.RecordID) != nil {
+		t.Fatalf("彻底删除数据错误：%d %s", w.Code, w.Body.String())
+	}
+
+	do(http.MethodPost, "{{.Plural}}", "", addItem)
+	model.Items[0].Deleted = time.Now().AddDate(0, 0, -2).Unix()
+	if n, err := {{.VarName}}Bll.PurgeExpired(context.Background(), time.Now().AddDate(0, 0, -1)); err != nil || n != 1 || len(model.Items) != 0 {
+		t.Fatalf("清理过期数据错误：%d,%v", n, err)
+	}
+}
+`
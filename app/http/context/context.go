@@ -1,24 +1,61 @@
 package context
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"io"
 	"moddns/app/logger"
+	"moddns/app/schema"
+	"moddns/app/service/exchange"
+	"moddns/app/service/mysql"
 	"moddns/app/util"
 	"net/http"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+	"unsafe"
 )
 
+// routeMemos WrapContext返回的处理函数与路由说明的对应关系(注册路由时登记)
+var routeMemos sync.Map
+
+// handlerKey 处理函数的标识(闭包的地址，每次调用WrapContext返回的闭包不同)
+func handlerKey(h gin.HandlerFunc) uintptr {
+	return *(*uintptr)(unsafe.Pointer(&h))
+}
+
 // WrapContext 包装上下文
 func WrapContext(ctx func(*Context), memo ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
+	h := func(c *gin.Context) {
 		if len(memo) > 0 {
 			c.Set(util.ContextKeyURLMemo, memo[0])
 		}
 		ctx(&Context{c})
 	}
+
+	if len(memo) > 0 {
+		routeMemos.Store(handlerKey(h), memo[0])
+	}
+	return h
+}
+
+// ResolveMemo 获取当前路由的说明，中间件执行时WrapContext尚未设置路由说明，
+// 因此按路由的处理函数查询注册时登记的说明(非WrapContext的处理函数返回空)
+func ResolveMemo(c *gin.Context) string {
+	if v := c.GetString(util.ContextKeyURLMemo); v != "" {
+		return v
+	}
+
+	if h := c.Handler(); h != nil {
+		if v, ok := routeMemos.Load(handlerKey(h)); ok {
+			return v.(string)
+		}
+	}
+	return ""
 }
 
 // NewContext 创建上下文实例
@@ -31,15 +68,43 @@ type Context struct {
 	*gin.Context
 }
 
-// NewContext 创建上下文实例
+// NewContext 创建上下文实例(继承请求的上下文，客户端断开连接时取消)
 func (a *Context) NewContext() context.Context {
-	parent := context.Background()
+	parent := a.Request.Context()
 	parent = util.NewTraceIDContext(parent, a.GetTraceID())
 	parent = util.NewUserIDContext(parent, a.GetUserID())
+	parent = util.NewRequestCacheContext(parent, a.getRequestCache())
+	parent = mysql.NewReadPinContext(parent, a.getReadPin())
 
 	return parent
 }
 
+// getReadPin 获取请求范围内的主库读取标记(同一请求中写入数据后，查询不再路由到只读副本)
+func (a *Context) getReadPin() *mysql.ReadPin {
+	if v, ok := a.Get(util.ContextKeyReadPin); ok {
+		if pin, ok := v.(*mysql.ReadPin); ok {
+			return pin
+		}
+	}
+
+	pin := new(mysql.ReadPin)
+	a.Set(util.ContextKeyReadPin, pin)
+	return pin
+}
+
+// getRequestCache 获取请求范围内的缓存(同一请求中创建的上下文共享)
+func (a *Context) getRequestCache() *util.RequestCache {
+	if v, ok := a.Get(util.ContextKeyRequestCache); ok {
+		if cache, ok := v.(*util.RequestCache); ok {
+			return cache
+		}
+	}
+
+	cache := new(util.RequestCache)
+	a.Set(util.ContextKeyRequestCache, cache)
+	return cache
+}
+
 // GetPageIndex 获取分页的页索引
 func (a *Context) GetPageIndex() uint {
 	if v := a.Query("current"); v != "" {
@@ -81,25 +146,223 @@ func (a *Context) ParseJSON(obj interface{}) error {
 	return nil
 }
 
+// MaxBatchSize 批量操作允许的最大数据条数
+const MaxBatchSize = 500
+
+// GetBatchParam 获取批量操作参数(优先解析JSON请求体，兼容查询参数batch)
+func (a *Context) GetBatchParam() (*schema.BatchParam, error) {
+	var param schema.BatchParam
+	if a.Request.ContentLength != 0 && strings.Contains(a.ContentType(), "json") {
+		if err := a.ParseJSON(&param); err != nil {
+			return nil, err
+		}
+	} else if v := a.Query("batch"); v != "" {
+		param.IDs = strings.Split(v, ",")
+	}
+
+	var ids []string
+	exists := make(map[string]bool)
+	for _, id := range param.IDs {
+		id = strings.TrimSpace(id)
+		if id == "" || exists[id] {
+			continue
+		}
+		exists[id] = true
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("请指定需要操作的数据")
+	} else if len(ids) > MaxBatchSize {
+		return nil, fmt.Errorf("单次最多允许操作%d条数据", MaxBatchSize)
+	}
+	param.IDs = ids
+
+	return &param, nil
+}
+
+// 数据导入的限制
+const (
+	MaxImportSize = 10 << 20 // 导入文件的最大字节数
+	MaxImportRows = 5000     // 单次导入的最大数据条数
+)
+
+// GetImportRows 获取导入的数据，支持multipart表单的file字段或直接提交的请求体，
+// 格式由查询参数format、上传文件的扩展名依次确定(默认为csv)
+func (a *Context) GetImportRows() ([]*exchange.Row, error) {
+	a.Request.Body = http.MaxBytesReader(a.Writer, a.Request.Body, MaxImportSize)
+
+	var (
+		r    io.Reader = a.Request.Body
+		name           = a.Query("format")
+	)
+	if strings.HasPrefix(a.ContentType(), "multipart/") {
+		file, header, err := a.Request.FormFile("file")
+		if err != nil {
+			return nil, errors.Wrap(err, "获取导入文件发生错误")
+		}
+		defer file.Close()
+
+		r = file
+		if name == "" {
+			name = filepath.Ext(header.Filename)
+		}
+	}
+
+	format, err := exchange.ParseFormat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := exchange.ReadAll(r, format)
+	if err != nil {
+		return nil, err
+	} else if len(rows) == 0 {
+		return nil, errors.New("导入数据为空")
+	} else if len(rows) > MaxImportRows {
+		return nil, fmt.Errorf("单次最多允许导入%d条数据", MaxImportRows)
+	}
+	return rows, nil
+}
+
+// GetDryRun 获取是否仅校验(查询参数dry_run为1或true)
+func (a *Context) GetDryRun() bool {
+	v := a.Query("dry_run")
+	return v == "1" || v == "true"
+}
+
+// SetETag 设置响应头ETag(数据版本号)
+func (a *Context) SetETag(version int64) {
+	a.Header("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// GetIfMatch 获取请求头If-Match中的数据版本号(未指定或为*时返回0)
+func (a *Context) GetIfMatch() (int64, error) {
+	v := strings.TrimSpace(a.GetHeader("If-Match"))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+
+	v = strings.Trim(strings.TrimPrefix(v, "W/"), `"`)
+	version := util.S(v).Int64()
+	if version <= 0 {
+		return 0, errors.New("无效的If-Match请求头")
+	}
+	return version, nil
+}
+
 // ResBadRequest 响应客户端请求错误
 func (a *Context) ResBadRequest(err error, code ...int) {
 	a.ResError(err, http.StatusBadRequest, code...)
 }
 
+// ResPreconditionFailed 响应前置条件失败
+func (a *Context) ResPreconditionFailed(err error, code ...int) {
+	a.ResError(err, http.StatusPreconditionFailed, code...)
+}
+
 // ResInternalServerError 响应服务器错误
 func (a *Context) ResInternalServerError(err error, code ...int) {
 	status := http.StatusInternalServerError
 
+	if _, ok := err.(*util.ConflictError); ok {
+		status = http.StatusConflict
+	}
+
 	switch err {
 	case util.ErrNotFound:
 		status = http.StatusNotFound
+	case util.ErrConflict:
+		// 指定了If-Match时版本冲突属于前置条件失败
+		status = http.StatusConflict
+		if a.GetHeader("If-Match") != "" {
+			status = http.StatusPreconditionFailed
+		}
 	}
 
 	a.ResError(err, status, code...)
 }
 
+// ResBatch 响应批量操作结果，批量操作失败时在错误响应中附带每条数据的处理结果
+func (a *Context) ResBatch(results []*schema.BatchResult, err error) {
+	if err == nil {
+		a.ResList(results)
+		return
+	} else if err != util.ErrBatchFailed {
+		a.ResInternalServerError(err)
+		return
+	}
+
+	a.JSON(http.StatusBadRequest, gin.H{
+		"error": a.errorObject(err, http.StatusBadRequest),
+		"list":  results,
+	})
+	a.Abort()
+}
+
+// ResImport 响应数据导入结果，校验未通过时在错误响应中附带校验报告
+func (a *Context) ResImport(result *schema.ImportResult, err error) {
+	if err == nil {
+		a.ResSuccess(result)
+		return
+	} else if err != util.ErrImportInvalid {
+		a.ResInternalServerError(err)
+		return
+	}
+
+	a.JSON(http.StatusBadRequest, gin.H{
+		"error":  a.errorObject(err, http.StatusBadRequest),
+		"result": result,
+	})
+	a.Abort()
+}
+
+// ResExport 以查询参数format指定的格式(csv、jsonl、xlsx)导出数据，name为下载文件名的前缀，
+// 输出经过缓冲，在首次写出前发生的错误仍以JSON响应，之后发生的错误只能记录日志并中断输出
+func (a *Context) ResExport(name string, columns []string, fn func(exchange.Writer) error) {
+	format, err := exchange.ParseFormat(a.Query("format"))
+	if err != nil {
+		a.ResBadRequest(err)
+		return
+	}
+
+	header := a.Writer.Header()
+	header.Set("Content-Type", exchange.ContentType(format))
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_%s.%s"`, name, time.Now().Format("20060102150405"), format))
+
+	bw := bufio.NewWriterSize(a.Writer, 64<<10)
+	w, err := exchange.NewWriter(bw, format, columns)
+	if err == nil {
+		if err = fn(w); err == nil {
+			if err = w.Close(); err == nil {
+				err = bw.Flush()
+			}
+		}
+	}
+	if err == nil {
+		a.Abort()
+		return
+	}
+
+	if !a.Writer.Written() {
+		header.Del("Content-Type")
+		header.Del("Content-Disposition")
+		a.ResInternalServerError(err)
+		return
+	}
+
+	logger.SystemWithContext(a.NewContext()).Errorf("[导出错误] %s", err.Error())
+	a.Abort()
+}
+
 // ResError 响应错误
 func (a *Context) ResError(err error, status int, code ...int) {
+	a.JSON(status, gin.H{"error": a.errorObject(err, status, code...)})
+	a.Abort()
+}
+
+// errorObject 记录错误日志并构造错误响应对象
+func (a *Context) errorObject(err error, status int, code ...int) gin.H {
 	var message string
 	if err != nil {
 		ss := strings.Split(err.Error(), ": ")
@@ -143,8 +406,10 @@ func (a *Context) ResError(err error, status int, code ...int) {
 	if len(code) > 0 {
 		obj["code"] = code[0]
 	}
-	a.JSON(status, gin.H{"error": obj})
-	a.Abort()
+	if traceID := a.GetTraceID(); traceID != "" {
+		obj["trace_id"] = traceID
+	}
+	return obj
 }
 
 // ResSuccess 响应成功
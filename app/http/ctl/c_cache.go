@@ -0,0 +1,16 @@
+package ctl
+
+import (
+	"moddns/app/http/context"
+	"moddns/app/service/cache"
+)
+
+// Cache 查询缓存
+type Cache struct {
+	Cache *cache.Cache `inject:""`
+}
+
+// Stats 查询各命名空间的缓存命中统计
+func (a *Cache) Stats(ctx *context.Context) {
+	ctx.ResList(a.Cache.Stats())
+}
@@ -4,7 +4,6 @@ import (
 	"moddns/app/bll"
 	"moddns/app/schema"
 	"moddns/app/http/context"
-	"strings"
 
 
 )
@@ -49,6 +48,7 @@ func (a *Demo) Get(ctx *context.Context) {
 		ctx.ResInternalServerError(err)
 		return
 	}
+	ctx.SetETag(item.Version)
 	ctx.ResSuccess(item)
 }
 
@@ -84,6 +84,13 @@ func (a *Demo) Update(ctx *context.Context) {
 		return
 	}
 
+	if version, err := ctx.GetIfMatch(); err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	} else if version > 0 {
+		item.Version = version
+	}
+
 	err := a.DemoBll.Update(ctx.NewContext(), ctx.Param("id"), &item)
 	if err != nil {
 		ctx.ResInternalServerError(err)
@@ -105,15 +112,42 @@ func (a *Demo) Delete(ctx *context.Context) {
 
 // DeleteMany 删除多条数据
 func (a *Demo) DeleteMany(ctx *context.Context) {
-	ids := strings.Split(ctx.Query("batch"), ",")
-
-	for _, id := range ids {
-		err := a.DemoBll.Delete(ctx.NewContext(), id)
-		if err != nil {
-			ctx.ResInternalServerError(err)
-			return
-		}
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	ctx.ResBatch(a.DemoBll.DeleteMany(ctx.NewContext(), param.IDs))
+}
+
+// QueryDeleted 查询已删除的分页数据(回收站)
+func (a *Demo) QueryDeleted(ctx *context.Context) {
+	total, items, err := a.DemoBll.QueryDeletedPage(ctx.NewContext(), ctx.GetPageIndex(), ctx.GetPageSize())
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
 	}
 
+	ctx.ResPage(total, items)
+}
+
+// Restore 恢复已删除的数据
+func (a *Demo) Restore(ctx *context.Context) {
+	err := a.DemoBll.Restore(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Demo) Purge(ctx *context.Context) {
+	err := a.DemoBll.Purge(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
 	ctx.ResOK()
 }
@@ -1,21 +1,31 @@
 package ctl
 
 import (
+	"encoding/json"
 	"fmt"
 	"moddns/app/logger"
+	"moddns/app/service/oidc"
 	"moddns/app/util"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"moddns/app/bll"
 	"moddns/app/schema"
 	"moddns/app/http/context"
+	"moddns/app/service/sessionstore"
 	"github.com/gin-gonic/gin"
 	"github.com/go-session/gin-session"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
 )
 
 // Login 登录管理
 type Login struct {
 	LoginBll *bll.Login `inject:""`
+	TOTPBll  *bll.TOTP  `inject:""`
+	OIDCBll  *bll.OIDC  `inject:""`
 }
 
 // Login 用户登录
@@ -27,7 +37,7 @@ func (a *Login) Login(ctx *context.Context) {
 	}
 
 	nctx := ctx.NewContext()
-	userInfo, err := a.LoginBll.Verify(nctx, item.UserName, item.Password)
+	userInfo, err := a.LoginBll.Verify(nctx, item.UserName, item.Password, item.Plain)
 	if err != nil {
 		logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
 
@@ -42,7 +52,47 @@ func (a *Login) Login(ctx *context.Context) {
 		return
 	}
 
-	// 更新会话
+	a.loginVerified(ctx, userInfo.RecordID)
+}
+
+// loginVerified 用户通过身份验证(密码或单点登录)后，按两步验证的要求创建挑战或完成登录
+func (a *Login) loginVerified(ctx *context.Context, userID string) {
+	nctx := ctx.NewContext()
+
+	// 已启用或角色要求启用两步验证时，需要校验验证码后才能完成登录
+	status, err := a.TOTPBll.Status(nctx, userID)
+	if err != nil {
+		logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
+		ctx.ResSuccess(gin.H{"status": "error"})
+		return
+	} else if status.Enabled || status.Required {
+		a.beginTOTP(ctx, userID, !status.Enabled)
+		return
+	}
+
+	a.completeLogin(ctx, userID, nil)
+}
+
+// completeLogin 完成登录：更新会话并登记，extra为附加的响应数据
+func (a *Login) completeLogin(ctx *context.Context, userID string, extra gin.H) {
+	nctx := ctx.NewContext()
+
+	// 检查同时在线的会话数(登录前的会话将被替换，不计入)
+	oldSID := ginsession.FromContext(ctx.Context).SessionID()
+	err := a.LoginBll.CheckSessionLimit(nctx, userID, oldSID)
+	if err != nil {
+		logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
+
+		status := "error"
+		if err == sessionstore.ErrSessionLimit {
+			status = "limit"
+		}
+
+		ctx.ResSuccess(gin.H{"status": status})
+		return
+	}
+
+	// 更新会话(登录前会话中的两步验证挑战不再保留)
 	store, err := ginsession.Refresh(ctx.Context)
 	if err != nil {
 		logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
@@ -50,16 +100,402 @@ func (a *Login) Login(ctx *context.Context) {
 		return
 	}
 
-	store.Set(util.SessionKeyUserID, userInfo.RecordID)
+	store.Delete(util.SessionKeyTOTPChallenge)
+	store.Set(util.SessionKeyUserID, userID)
 	err = store.Save()
 	if err != nil {
 		logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
 		ctx.ResSuccess(gin.H{"status": "error"})
 		return
 	}
+
+	// 登记会话
+	err = a.LoginBll.AddSession(nctx, oldSID, &sessionstore.Record{
+		SessionID: store.SessionID(),
+		UserID:    userID,
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
+	if err != nil {
+		logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
+		ctx.ResSuccess(gin.H{"status": "error"})
+		return
+	}
 	logger.LoginWithContext(nctx).Infof("登入系统")
 
-	ctx.ResOK()
+	if len(extra) == 0 {
+		ctx.ResOK()
+		return
+	}
+
+	result := gin.H{"status": "OK"}
+	for k, v := range extra {
+		result[k] = v
+	}
+	ctx.ResSuccess(result)
+}
+
+// totpChallenge 登录的两步验证挑战(存储在登录前的会话中，完成登录后删除)
+type totpChallenge struct {
+	ID        string `json:"id"`         // 挑战标识
+	UserID    string `json:"user_id"`    // 通过密码验证的用户
+	Setup     bool   `json:"setup"`      // 是否需要注册(角色要求启用但用户尚未启用)
+	ExpiresAt int64  `json:"expires_at"` // 过期时间
+	Attempts  int    `json:"attempts"`   // 验证失败的次数
+}
+
+// totpConfig 获取两步验证的挑战有效期(秒)及最大尝试次数
+func totpConfig() (int64, int) {
+	config := viper.GetStringMap("totp")
+
+	expired := util.T(config["challenge_expired"]).Int64()
+	if expired <= 0 {
+		expired = 300
+	}
+
+	maxAttempts := util.T(config["max_attempts"]).Int()
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	return expired, maxAttempts
+}
+
+// beginTOTP 通过密码验证后创建两步验证挑战，setup为true时同时生成待确认的密钥
+func (a *Login) beginTOTP(ctx *context.Context, userID string, setup bool) {
+	nctx := ctx.NewContext()
+	expired, _ := totpConfig()
+
+	challenge := &totpChallenge{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Setup:     setup,
+		ExpiresAt: time.Now().Unix() + expired,
+	}
+	result := gin.H{
+		"status":     "2fa_required",
+		"challenge":  challenge.ID,
+		"expires_in": expired,
+	}
+
+	if setup {
+		info, err := a.TOTPBll.Begin(nctx, userID)
+		if err != nil {
+			logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
+			ctx.ResSuccess(gin.H{"status": "error"})
+			return
+		}
+		result["setup"] = true
+		result["secret"] = info.Secret
+		result["uri"] = info.URI
+	}
+
+	if err := saveTOTPChallenge(ctx, challenge); err != nil {
+		logger.LoginWithContext(nctx).Errorf("登录发生错误：%s", err.Error())
+		ctx.ResSuccess(gin.H{"status": "error"})
+		return
+	}
+	ctx.ResSuccess(result)
+}
+
+// saveTOTPChallenge 保存两步验证挑战到当前会话(为nil时删除)
+func saveTOTPChallenge(ctx *context.Context, challenge *totpChallenge) error {
+	store := ginsession.FromContext(ctx.Context)
+	if challenge == nil {
+		store.Delete(util.SessionKeyTOTPChallenge)
+	} else {
+		buf, err := json.Marshal(challenge)
+		if err != nil {
+			return err
+		}
+		store.Set(util.SessionKeyTOTPChallenge, string(buf))
+	}
+	return store.Save()
+}
+
+// loadTOTPChallenge 从当前会话中读取两步验证挑战(不存在时返回nil)
+func loadTOTPChallenge(ctx *context.Context) *totpChallenge {
+	v, ok := ginsession.FromContext(ctx.Context).Get(util.SessionKeyTOTPChallenge)
+	if !ok {
+		return nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return nil
+	}
+
+	var challenge totpChallenge
+	if err := json.Unmarshal([]byte(s), &challenge); err != nil {
+		return nil
+	}
+	return &challenge
+}
+
+// LoginTOTP 用户登录的两步验证(校验验证码或恢复码后完成登录)
+func (a *Login) LoginTOTP(ctx *context.Context) {
+	var item schema.LoginTOTPParam
+	if err := ctx.ParseJSON(&item); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	nctx := ctx.NewContext()
+	challenge := loadTOTPChallenge(ctx)
+	if challenge == nil || challenge.ID != item.Challenge ||
+		challenge.ExpiresAt <= time.Now().Unix() {
+		if challenge != nil && challenge.ID == item.Challenge {
+			saveTOTPChallenge(ctx, nil)
+		}
+		ctx.ResSuccess(gin.H{"status": "expired"})
+		return
+	}
+
+	var (
+		codes []string
+		err   error
+	)
+	if challenge.Setup {
+		codes, err = a.TOTPBll.Confirm(nctx, challenge.UserID, item.Code)
+	} else {
+		err = a.TOTPBll.Verify(nctx, challenge.UserID, item.Code)
+	}
+	if err != nil {
+		logger.LoginWithContext(nctx).Errorf("两步验证发生错误：%s", err.Error())
+		if err == bll.ErrTOTPLocked {
+			saveTOTPChallenge(ctx, nil)
+			ctx.ResSuccess(gin.H{"status": "locked"})
+			return
+		} else if err != bll.ErrInvalidTOTPCode {
+			ctx.ResSuccess(gin.H{"status": "error"})
+			return
+		}
+
+		// 超出最大尝试次数后挑战失效，需要重新登录
+		_, maxAttempts := totpConfig()
+		challenge.Attempts++
+		if challenge.Attempts >= maxAttempts {
+			challenge = nil
+		}
+		if err := saveTOTPChallenge(ctx, challenge); err != nil {
+			logger.LoginWithContext(nctx).Errorf("两步验证发生错误：%s", err.Error())
+		}
+
+		ctx.ResSuccess(gin.H{"status": "fail"})
+		return
+	}
+
+	var extra gin.H
+	if len(codes) > 0 {
+		extra = gin.H{"recovery_codes": codes}
+	}
+	a.completeLogin(ctx, challenge.UserID, extra)
+}
+
+// OIDC授权流程cookie的名称及路径(仅回调及换取登录票据时携带)
+const (
+	oidcFlowCookie     = "oidc_flow"
+	oidcFlowCookiePath = "/api/v1/login/oidc"
+	oidcTicketExpired  = 60
+)
+
+// oidcFlow OIDC授权流程的状态，会话仅通过header传递，浏览器重定向时无法携带，
+// 因此加密后存储在cookie中
+type oidcFlow struct {
+	State     string `json:"state"`      // 防止跨站请求伪造
+	Nonce     string `json:"nonce"`      // 绑定ID令牌
+	Verifier  string `json:"verifier"`   // PKCE的验证码
+	Redirect  string `json:"redirect"`   // 登录完成后前端的跳转路径
+	ExpiresAt int64  `json:"expires_at"` // 过期时间
+}
+
+// oidcTicket OIDC登录票据(回调完成身份验证后签发，由前端换取会话)
+type oidcTicket struct {
+	UserID    string `json:"user_id"`    // 通过身份验证的用户
+	State     string `json:"state"`      // 绑定签发票据的授权流程
+	ExpiresAt int64  `json:"expires_at"` // 过期时间
+}
+
+// oidcConfig 获取前端地址及授权流程的有效期(秒)
+func oidcConfig() (string, int64) {
+	config := viper.GetStringMap("oidc")
+
+	expired := util.T(config["flow_expired"]).Int64()
+	if expired <= 0 {
+		expired = 600
+	}
+	return strings.TrimRight(util.T(config["front_url"]).String(), "/"), expired
+}
+
+// oidcSealer 创建加密OIDC登录状态的加密器(密钥由会话签名及用途派生)
+func oidcSealer(purpose string) *oidc.Sealer {
+	return oidc.NewSealer("oidc-" + purpose + ":" + util.T(viper.GetStringMap("session")["sign"]).String())
+}
+
+// safeRedirect 检查前端的跳转路径，仅允许站内的相对路径(防止开放重定向)
+func safeRedirect(v string) string {
+	if i := strings.IndexByte(v, '#'); i >= 0 {
+		v = v[:i]
+	}
+	if !strings.HasPrefix(v, "/") || strings.HasPrefix(v, "//") || strings.Contains(v, "\\") {
+		return "/"
+	}
+	return v
+}
+
+// redirectFront 重定向到前端的跳转路径，结果通过URL片段传递(不会发送到服务端或出现在Referer中)
+func redirectFront(ctx *context.Context, redirect, key, value string) {
+	frontURL, _ := oidcConfig()
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Redirect(http.StatusFound, frontURL+redirect+"#"+key+"="+url.QueryEscape(value))
+}
+
+// setOIDCFlowCookie 设置授权流程cookie(maxAge小于0时删除)
+func setOIDCFlowCookie(ctx *context.Context, value string, maxAge int) {
+	redirectURL := util.T(viper.GetStringMap("oidc")["redirect_url"]).String()
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     oidcFlowCookiePath,
+		MaxAge:   maxAge,
+		Secure:   ctx.Request.TLS != nil || strings.HasPrefix(redirectURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// loadOIDCFlow 读取授权流程cookie(不存在、无效或已过期时返回nil)
+func loadOIDCFlow(ctx *context.Context) *oidcFlow {
+	v, err := ctx.Cookie(oidcFlowCookie)
+	if err != nil || v == "" {
+		return nil
+	}
+
+	var flow oidcFlow
+	if err := oidcSealer("flow").Open(v, &flow); err != nil ||
+		flow.State == "" || flow.ExpiresAt <= time.Now().Unix() {
+		return nil
+	}
+	return &flow
+}
+
+// LoginOIDC OIDC登录：重定向到身份提供方的授权地址(redirect为登录完成后前端的跳转路径)
+func (a *Login) LoginOIDC(ctx *context.Context) {
+	if !a.OIDCBll.Enabled() {
+		ctx.ResBadRequest(bll.ErrOIDCDisabled)
+		return
+	}
+
+	nctx := ctx.NewContext()
+	_, expired := oidcConfig()
+	flow := &oidcFlow{
+		Redirect:  safeRedirect(ctx.Query("redirect")),
+		ExpiresAt: time.Now().Unix() + expired,
+	}
+
+	authURL, sealed, err := a.beginOIDC(ctx, flow)
+	if err != nil {
+		logger.LoginWithContext(nctx).Errorf("OIDC登录发生错误：%s", err.Error())
+		redirectFront(ctx, flow.Redirect, "oidc_error", "error")
+		return
+	}
+
+	setOIDCFlowCookie(ctx, sealed, int(expired))
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+// beginOIDC 生成授权流程的随机参数，返回授权地址及加密后的流程状态
+func (a *Login) beginOIDC(ctx *context.Context, flow *oidcFlow) (string, string, error) {
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		s, err := oidc.RandomString(32)
+		if err != nil {
+			return "", "", err
+		}
+		*v = s
+	}
+
+	authURL, err := a.OIDCBll.AuthCodeURL(ctx.NewContext(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := oidcSealer("flow").Seal(flow)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, sealed, nil
+}
+
+// LoginOIDCCallback OIDC登录的回调：校验授权流程并换取ID令牌，
+// 通过后重定向到前端并携带登录票据(oidc_ticket)，失败时携带错误(oidc_error)
+func (a *Login) LoginOIDCCallback(ctx *context.Context) {
+	nctx := ctx.NewContext()
+
+	flow := loadOIDCFlow(ctx)
+	if flow == nil || flow.State != ctx.Query("state") {
+		setOIDCFlowCookie(ctx, "", -1)
+		redirectFront(ctx, "/", "oidc_error", "expired")
+		return
+	}
+
+	if v := ctx.Query("error"); v != "" {
+		logger.LoginWithContext(nctx).Warnf("身份提供方拒绝授权：%s(%s)", v, ctx.Query("error_description"))
+		setOIDCFlowCookie(ctx, "", -1)
+		redirectFront(ctx, flow.Redirect, "oidc_error", "fail")
+		return
+	}
+
+	user, err := a.OIDCBll.Login(nctx, ctx.Query("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		logger.LoginWithContext(nctx).Errorf("OIDC登录发生错误：%s", err.Error())
+
+		status := "error"
+		if err == bll.ErrInvalidUserName ||
+			err == bll.ErrUserDisable {
+			status = "fail"
+		}
+
+		setOIDCFlowCookie(ctx, "", -1)
+		redirectFront(ctx, flow.Redirect, "oidc_error", status)
+		return
+	}
+
+	// 保留流程cookie，换取会话时校验票据与当前浏览器的授权流程一致
+	ticket, err := oidcSealer("ticket").Seal(&oidcTicket{
+		UserID:    user.RecordID,
+		State:     flow.State,
+		ExpiresAt: time.Now().Unix() + oidcTicketExpired,
+	})
+	if err != nil {
+		logger.LoginWithContext(nctx).Errorf("OIDC登录发生错误：%s", err.Error())
+		setOIDCFlowCookie(ctx, "", -1)
+		redirectFront(ctx, flow.Redirect, "oidc_error", "error")
+		return
+	}
+	redirectFront(ctx, flow.Redirect, "oidc_ticket", ticket)
+}
+
+// LoginOIDCToken 使用OIDC登录票据换取会话(与用户登录相同，需要时进行两步验证)
+func (a *Login) LoginOIDCToken(ctx *context.Context) {
+	var item schema.LoginOIDCParam
+	if err := ctx.ParseJSON(&item); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	// 票据只能使用一次：换取时删除授权流程cookie
+	flow := loadOIDCFlow(ctx)
+	setOIDCFlowCookie(ctx, "", -1)
+
+	var ticket oidcTicket
+	if err := oidcSealer("ticket").Open(item.Ticket, &ticket); err != nil ||
+		ticket.UserID == "" || ticket.ExpiresAt <= time.Now().Unix() ||
+		flow == nil || flow.State != ticket.State {
+		ctx.ResSuccess(gin.H{"status": "expired"})
+		return
+	}
+
+	a.loginVerified(ctx, ticket.UserID)
 }
 
 // Logout 用户登出
@@ -75,6 +511,11 @@ func (a *Login) Logout(ctx *context.Context) {
 			ctx.ResInternalServerError(err)
 			return
 		}
+
+		err = a.LoginBll.RemoveSession(nctx, store.SessionID())
+		if err != nil {
+			logger.LoginWithContext(nctx).Errorf("登出发生错误：%s", err.Error())
+		}
 		logger.LoginWithContext(nctx).Infof("登出系统")
 	}
 
@@ -93,6 +534,18 @@ func (a *Login) GetCurrentUserInfo(ctx *context.Context) {
 	ctx.ResSuccess(info)
 }
 
+// QueryCurrentUserSessions 查询当前用户在线的会话
+func (a *Login) QueryCurrentUserSessions(ctx *context.Context) {
+	sid := ginsession.FromContext(ctx.Context).SessionID()
+
+	items, err := a.LoginBll.QueryCurrentUserSessions(ctx.NewContext(), ctx.GetUserID(), sid)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResList(items)
+}
+
 // QueryCurrentUserMenus 查询当前用户菜单
 func (a *Login) QueryCurrentUserMenus(ctx *context.Context) {
 	userID := ctx.GetUserID()
@@ -107,3 +560,87 @@ func (a *Login) QueryCurrentUserMenus(ctx *context.Context) {
 	}
 	ctx.ResList(menus)
 }
+
+// GetCurrentUserTOTP 查询当前用户的两步验证状态
+func (a *Login) GetCurrentUserTOTP(ctx *context.Context) {
+	status, err := a.TOTPBll.Status(ctx.NewContext(), ctx.GetUserID())
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResSuccess(status)
+}
+
+// BeginCurrentUserTOTP 生成当前用户两步验证的密钥(启用前需要确认)
+func (a *Login) BeginCurrentUserTOTP(ctx *context.Context) {
+	info, err := a.TOTPBll.Begin(ctx.NewContext(), ctx.GetUserID())
+	if err != nil {
+		if err == bll.ErrTOTPEnabled {
+			ctx.ResBadRequest(err)
+			return
+		}
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResSuccess(info)
+}
+
+// EnableCurrentUserTOTP 校验验证码并启用当前用户的两步验证，返回恢复码
+func (a *Login) EnableCurrentUserTOTP(ctx *context.Context) {
+	var item schema.TOTPParam
+	if err := ctx.ParseJSON(&item); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	codes, err := a.TOTPBll.Confirm(ctx.NewContext(), ctx.GetUserID(), item.Code)
+	if err != nil {
+		resTOTPError(ctx, err)
+		return
+	}
+	ctx.ResSuccess(gin.H{"recovery_codes": codes})
+}
+
+// DisableCurrentUserTOTP 校验验证码并停用当前用户的两步验证
+func (a *Login) DisableCurrentUserTOTP(ctx *context.Context) {
+	var item schema.TOTPParam
+	if err := ctx.ParseJSON(&item); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	err := a.TOTPBll.Disable(ctx.NewContext(), ctx.GetUserID(), item.Code)
+	if err != nil {
+		resTOTPError(ctx, err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// RegenerateCurrentUserRecoveryCodes 校验验证码并重新生成当前用户的恢复码
+func (a *Login) RegenerateCurrentUserRecoveryCodes(ctx *context.Context) {
+	var item schema.TOTPParam
+	if err := ctx.ParseJSON(&item); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	codes, err := a.TOTPBll.RegenerateRecoveryCodes(ctx.NewContext(), ctx.GetUserID(), item.Code)
+	if err != nil {
+		resTOTPError(ctx, err)
+		return
+	}
+	ctx.ResSuccess(gin.H{"recovery_codes": codes})
+}
+
+// resTOTPError 响应两步验证的错误(验证码及状态错误属于请求错误，锁定时响应429)
+func resTOTPError(ctx *context.Context, err error) {
+	switch err {
+	case bll.ErrInvalidTOTPCode, bll.ErrTOTPEnabled, bll.ErrTOTPNotEnabled, bll.ErrTOTPRequired:
+		ctx.ResBadRequest(err)
+	case bll.ErrTOTPLocked:
+		ctx.ResError(err, http.StatusTooManyRequests)
+	default:
+		ctx.ResInternalServerError(err)
+	}
+}
@@ -1,12 +1,13 @@
 package ctl
 
 import (
+	"errors"
 	"moddns/app/util"
-	"strings"
 
 	"moddns/app/bll"
-	"moddns/app/schema"
 	"moddns/app/http/context"
+	"moddns/app/schema"
+	"moddns/app/service/exchange"
 )
 
 // Menu 菜单管理
@@ -30,14 +31,7 @@ func (a *Menu) Query(ctx *context.Context) {
 func (a *Menu) QueryPage(ctx *context.Context) {
 	pageIndex, pageSize := ctx.GetPageIndex(), ctx.GetPageSize()
 
-	params := schema.MenuQueryParam{
-		Name:     ctx.Query("name"),
-		ParentID: ctx.Query("parent_id"),
-		Status:   util.S(ctx.Query("status")).Int(),
-		Type:     util.S(ctx.Query("mtype")).Int(),
-	}
-
-	total, items, err := a.MenuBll.QueryPage(ctx.NewContext(), params, pageIndex, pageSize)
+	total, items, err := a.MenuBll.QueryPage(ctx.NewContext(), a.queryParam(ctx), pageIndex, pageSize)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
@@ -46,6 +40,16 @@ func (a *Menu) QueryPage(ctx *context.Context) {
 	ctx.ResPage(total, items)
 }
 
+// queryParam 获取查询条件
+func (a *Menu) queryParam(ctx *context.Context) schema.MenuQueryParam {
+	return schema.MenuQueryParam{
+		Name:     ctx.Query("name"),
+		ParentID: ctx.Query("parent_id"),
+		Status:   util.S(ctx.Query("status")).Int(),
+		Type:     util.S(ctx.Query("mtype")).Int(),
+	}
+}
+
 // QueryTree 查询菜单树
 func (a *Menu) QueryTree(ctx *context.Context) {
 	params := schema.MenuSelectQueryParam{
@@ -73,6 +77,7 @@ func (a *Menu) Get(ctx *context.Context) {
 		ctx.ResInternalServerError(err)
 		return
 	}
+	ctx.SetETag(item.Version)
 	ctx.ResSuccess(item)
 }
 
@@ -108,6 +113,13 @@ func (a *Menu) Update(ctx *context.Context) {
 		return
 	}
 
+	if version, err := ctx.GetIfMatch(); err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	} else if version > 0 {
+		item.Version = version
+	}
+
 	err := a.MenuBll.Update(ctx.NewContext(), ctx.Param("id"), &item)
 	if err != nil {
 		ctx.ResInternalServerError(err)
@@ -116,6 +128,69 @@ func (a *Menu) Update(ctx *context.Context) {
 	ctx.ResOK()
 }
 
+// Move 移动菜单到新的上级菜单的指定位置
+func (a *Menu) Move(ctx *context.Context) {
+	var param schema.MenuMoveParam
+	if err := ctx.ParseJSON(&param); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	version, err := ctx.GetIfMatch()
+	if err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	}
+
+	err = a.MenuBll.Move(ctx.NewContext(), ctx.Param("id"), param, version)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Reorder 重新排序同级菜单
+func (a *Menu) Reorder(ctx *context.Context) {
+	var param schema.MenuReorderParam
+	if err := ctx.ParseJSON(&param); err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	err := a.MenuBll.Reorder(ctx.NewContext(), param)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Copy 复制菜单及全部下级菜单
+func (a *Menu) Copy(ctx *context.Context) {
+	var param schema.MenuCopyParam
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ParseJSON(&param); err != nil {
+			ctx.ResBadRequest(err)
+			return
+		}
+	}
+
+	item, err := a.MenuBll.Copy(ctx.NewContext(), ctx.Param("id"), param, ctx.GetUserID())
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	newItem, err := a.MenuBll.Get(ctx.NewContext(), item.RecordID)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResSuccess(newItem)
+}
+
 // Delete 删除数据
 func (a *Menu) Delete(ctx *context.Context) {
 	err := a.MenuBll.Delete(ctx.NewContext(), ctx.Param("id"))
@@ -128,22 +203,38 @@ func (a *Menu) Delete(ctx *context.Context) {
 
 // DeleteMany 删除多条数据
 func (a *Menu) DeleteMany(ctx *context.Context) {
-	ids := strings.Split(ctx.Query("batch"), ",")
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
 
-	for _, id := range ids {
-		err := a.MenuBll.Delete(ctx.NewContext(), id)
-		if err != nil {
-			ctx.ResInternalServerError(err)
-			return
-		}
+	ctx.ResBatch(a.MenuBll.DeleteMany(ctx.NewContext(), param.IDs))
+}
+
+// UpdateStatusMany 更新多条数据的状态
+func (a *Menu) UpdateStatusMany(ctx *context.Context) {
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	} else if param.Status != 1 && param.Status != 2 {
+		ctx.ResBadRequest(errors.New("无效的状态值"))
+		return
 	}
 
-	ctx.ResOK()
+	ctx.ResBatch(a.MenuBll.UpdateStatusMany(ctx.NewContext(), param.IDs, param.Status))
 }
 
 // Enable 启用数据
 func (a *Menu) Enable(ctx *context.Context) {
-	err := a.MenuBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 1)
+	version, err := ctx.GetIfMatch()
+	if err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	}
+
+	err = a.MenuBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 1, version)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
@@ -153,10 +244,67 @@ func (a *Menu) Enable(ctx *context.Context) {
 
 // Disable 禁用数据
 func (a *Menu) Disable(ctx *context.Context) {
-	err := a.MenuBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 2)
+	version, err := ctx.GetIfMatch()
+	if err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	}
+
+	err = a.MenuBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 2, version)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
 	}
 	ctx.ResOK()
 }
+
+// QueryDeleted 查询已删除的分页数据(回收站)
+func (a *Menu) QueryDeleted(ctx *context.Context) {
+	total, items, err := a.MenuBll.QueryDeletedPage(ctx.NewContext(), ctx.GetPageIndex(), ctx.GetPageSize())
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResPage(total, items)
+}
+
+// Restore 恢复已删除的数据
+func (a *Menu) Restore(ctx *context.Context) {
+	err := a.MenuBll.Restore(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Menu) Purge(ctx *context.Context) {
+	err := a.MenuBll.Purge(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Export 导出数据(查询条件与分页查询一致)
+func (a *Menu) Export(ctx *context.Context) {
+	params := a.queryParam(ctx)
+	ctx.ResExport("menus", bll.MenuColumns, func(w exchange.Writer) error {
+		return a.MenuBll.Export(ctx.NewContext(), params, w)
+	})
+}
+
+// Import 导入数据(dry_run=1时仅校验)
+func (a *Menu) Import(ctx *context.Context) {
+	rows, err := ctx.GetImportRows()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	result, err := a.MenuBll.Import(ctx.NewContext(), rows, ctx.GetDryRun(), ctx.GetUserID())
+	ctx.ResImport(result, err)
+}
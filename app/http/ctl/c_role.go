@@ -1,12 +1,13 @@
 package ctl
 
 import (
+	"errors"
 	"moddns/app/util"
-	"strings"
 
 	"moddns/app/bll"
-	"moddns/app/schema"
 	"moddns/app/http/context"
+	"moddns/app/schema"
+	"moddns/app/service/exchange"
 )
 
 // Role 角色管理
@@ -30,12 +31,7 @@ func (a *Role) Query(ctx *context.Context) {
 func (a *Role) QueryPage(ctx *context.Context) {
 	pageIndex, pageSize := ctx.GetPageIndex(), ctx.GetPageSize()
 
-	var params schema.RoleQueryParam
-
-	params.Name = ctx.Query("name")
-	params.Status = util.S(ctx.Query("status")).Int()
-
-	total, items, err := a.RoleBll.QueryPage(ctx.NewContext(), params, pageIndex, pageSize)
+	total, items, err := a.RoleBll.QueryPage(ctx.NewContext(), a.queryParam(ctx), pageIndex, pageSize)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
@@ -44,6 +40,14 @@ func (a *Role) QueryPage(ctx *context.Context) {
 	ctx.ResPage(total, items)
 }
 
+// queryParam 获取查询条件
+func (a *Role) queryParam(ctx *context.Context) schema.RoleQueryParam {
+	return schema.RoleQueryParam{
+		Name:   ctx.Query("name"),
+		Status: util.S(ctx.Query("status")).Int(),
+	}
+}
+
 // QuerySelect 查询分页数据
 func (a *Role) QuerySelect(ctx *context.Context) {
 	var params schema.RoleSelectQueryParam
@@ -67,6 +71,7 @@ func (a *Role) Get(ctx *context.Context) {
 		ctx.ResInternalServerError(err)
 		return
 	}
+	ctx.SetETag(item.Version)
 	ctx.ResSuccess(item)
 }
 
@@ -102,6 +107,13 @@ func (a *Role) Update(ctx *context.Context) {
 		return
 	}
 
+	if version, err := ctx.GetIfMatch(); err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	} else if version > 0 {
+		item.Version = version
+	}
+
 	err := a.RoleBll.Update(ctx.NewContext(), ctx.Param("id"), &item)
 	if err != nil {
 		ctx.ResInternalServerError(err)
@@ -122,22 +134,38 @@ func (a *Role) Delete(ctx *context.Context) {
 
 // DeleteMany 删除多条数据
 func (a *Role) DeleteMany(ctx *context.Context) {
-	ids := strings.Split(ctx.Query("batch"), ",")
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
 
-	for _, id := range ids {
-		err := a.RoleBll.Delete(ctx.NewContext(), id)
-		if err != nil {
-			ctx.ResInternalServerError(err)
-			return
-		}
+	ctx.ResBatch(a.RoleBll.DeleteMany(ctx.NewContext(), param.IDs))
+}
+
+// UpdateStatusMany 更新多条数据的状态
+func (a *Role) UpdateStatusMany(ctx *context.Context) {
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	} else if param.Status != 1 && param.Status != 2 {
+		ctx.ResBadRequest(errors.New("无效的状态值"))
+		return
 	}
 
-	ctx.ResOK()
+	ctx.ResBatch(a.RoleBll.UpdateStatusMany(ctx.NewContext(), param.IDs, param.Status))
 }
 
 // Enable 启用数据
 func (a *Role) Enable(ctx *context.Context) {
-	err := a.RoleBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 1)
+	version, err := ctx.GetIfMatch()
+	if err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	}
+
+	err = a.RoleBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 1, version)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
@@ -147,10 +175,67 @@ func (a *Role) Enable(ctx *context.Context) {
 
 // Disable 禁用数据
 func (a *Role) Disable(ctx *context.Context) {
-	err := a.RoleBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 2)
+	version, err := ctx.GetIfMatch()
+	if err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	}
+
+	err = a.RoleBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 2, version)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
 	}
 	ctx.ResOK()
 }
+
+// QueryDeleted 查询已删除的分页数据(回收站)
+func (a *Role) QueryDeleted(ctx *context.Context) {
+	total, items, err := a.RoleBll.QueryDeletedPage(ctx.NewContext(), ctx.GetPageIndex(), ctx.GetPageSize())
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResPage(total, items)
+}
+
+// Restore 恢复已删除的数据
+func (a *Role) Restore(ctx *context.Context) {
+	err := a.RoleBll.Restore(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Role) Purge(ctx *context.Context) {
+	err := a.RoleBll.Purge(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Export 导出数据(查询条件与分页查询一致)
+func (a *Role) Export(ctx *context.Context) {
+	params := a.queryParam(ctx)
+	ctx.ResExport("roles", bll.RoleColumns, func(w exchange.Writer) error {
+		return a.RoleBll.Export(ctx.NewContext(), params, w)
+	})
+}
+
+// Import 导入数据(dry_run=1时仅校验)
+func (a *Role) Import(ctx *context.Context) {
+	rows, err := ctx.GetImportRows()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	result, err := a.RoleBll.Import(ctx.NewContext(), rows, ctx.GetDryRun(), ctx.GetUserID())
+	ctx.ResImport(result, err)
+}
@@ -0,0 +1,83 @@
+package ctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"moddns/app/bll"
+	"moddns/app/http/context"
+	"moddns/app/schema"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Snapshot 配置快照
+type Snapshot struct {
+	SnapshotBll *bll.Snapshot `inject:""`
+}
+
+// Export 导出配置快照(format为yaml或json，users=1时包含用户)
+func (a *Snapshot) Export(ctx *context.Context) {
+	format, err := bll.ParseSnapshotFormat(ctx.Query("format"))
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	snap, err := a.SnapshotBll.Export(ctx.NewContext(), ctx.Query("users") == "1")
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	buf, err := bll.MarshalSnapshot(snap, format)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	contentType := "application/x-yaml; charset=utf-8"
+	if format == bll.SnapshotFormatJSON {
+		contentType = "application/json; charset=utf-8"
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="snapshot_%s.%s"`, time.Now().Format("20060102150405"), format))
+	ctx.Data(http.StatusOK, contentType, buf)
+	ctx.Abort()
+}
+
+// Apply 应用配置快照(请求体为yaml或json，dry_run=1时仅生成变更计划，prune=1时删除快照中不存在的数据)
+func (a *Snapshot) Apply(ctx *context.Context) {
+	name := ctx.Query("format")
+	if name == "" && strings.Contains(ctx.ContentType(), "json") {
+		name = bll.SnapshotFormatJSON
+	}
+
+	format, err := bll.ParseSnapshotFormat(name)
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, context.MaxImportSize))
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	snap, err := bll.UnmarshalSnapshot(buf, format)
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	plan, err := a.SnapshotBll.Apply(ctx.NewContext(), snap, schema.SnapshotApplyParam{
+		DryRun: ctx.GetDryRun(),
+		Prune:  ctx.Query("prune") == "1",
+	})
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResSuccess(plan)
+}
@@ -1,17 +1,19 @@
 package ctl
 
 import (
+	"errors"
 	"moddns/app/bll"
 	"moddns/app/http/context"
 	"moddns/app/schema"
+	"moddns/app/service/exchange"
 	"moddns/app/util"
-	"strings"
 
 )
 
 // User 用户管理
 type User struct {
 	UserBll *bll.User `inject:""`
+	TOTPBll *bll.TOTP `inject:""`
 }
 
 // Query 查询数据
@@ -28,14 +30,7 @@ func (a *User) Query(ctx *context.Context) {
 func (a *User) QueryPage(ctx *context.Context) {
 	pageIndex, pageSize := ctx.GetPageIndex(), ctx.GetPageSize()
 
-	var params schema.UserQueryParam
-
-	params.UserName = ctx.Query("user_name")
-	params.RealName = ctx.Query("real_name")
-	params.RoleID = ctx.Query("role_id")
-	params.Status = util.S(ctx.Query("status")).Int()
-
-	total, items, err := a.UserBll.QueryPage(ctx.NewContext(), params, pageIndex, pageSize)
+	total, items, err := a.UserBll.QueryPage(ctx.NewContext(), a.queryParam(ctx), pageIndex, pageSize)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
@@ -44,6 +39,16 @@ func (a *User) QueryPage(ctx *context.Context) {
 	ctx.ResPage(total, items)
 }
 
+// queryParam 获取查询条件
+func (a *User) queryParam(ctx *context.Context) schema.UserQueryParam {
+	return schema.UserQueryParam{
+		UserName: ctx.Query("user_name"),
+		RealName: ctx.Query("real_name"),
+		RoleID:   ctx.Query("role_id"),
+		Status:   util.S(ctx.Query("status")).Int(),
+	}
+}
+
 // Get 查询指定数据
 func (a *User) Get(ctx *context.Context) {
 	item, err := a.UserBll.Get(ctx.NewContext(), ctx.Param("id"))
@@ -52,6 +57,7 @@ func (a *User) Get(ctx *context.Context) {
 		return
 	}
 
+	ctx.SetETag(item.Version)
 	ctx.ResSuccess(item)
 }
 
@@ -87,6 +93,13 @@ func (a *User) Update(ctx *context.Context) {
 		return
 	}
 
+	if version, err := ctx.GetIfMatch(); err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	} else if version > 0 {
+		item.Version = version
+	}
+
 	err := a.UserBll.Update(ctx.NewContext(), ctx.Param("id"), &item)
 	if err != nil {
 		ctx.ResInternalServerError(err)
@@ -107,22 +120,38 @@ func (a *User) Delete(ctx *context.Context) {
 
 // DeleteMany 删除多条数据
 func (a *User) DeleteMany(ctx *context.Context) {
-	ids := strings.Split(ctx.Query("batch"), ",")
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
 
-	for _, id := range ids {
-		err := a.UserBll.Delete(ctx.NewContext(), id)
-		if err != nil {
-			ctx.ResInternalServerError(err)
-			return
-		}
+	ctx.ResBatch(a.UserBll.DeleteMany(ctx.NewContext(), param.IDs))
+}
+
+// UpdateStatusMany 更新多条数据的状态
+func (a *User) UpdateStatusMany(ctx *context.Context) {
+	param, err := ctx.GetBatchParam()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	} else if param.Status != 1 && param.Status != 2 {
+		ctx.ResBadRequest(errors.New("无效的状态值"))
+		return
 	}
 
-	ctx.ResOK()
+	ctx.ResBatch(a.UserBll.UpdateStatusMany(ctx.NewContext(), param.IDs, param.Status))
 }
 
 // Enable 启用数据
 func (a *User) Enable(ctx *context.Context) {
-	err := a.UserBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 1)
+	version, err := ctx.GetIfMatch()
+	if err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	}
+
+	err = a.UserBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 1, version)
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
@@ -132,10 +161,97 @@ func (a *User) Enable(ctx *context.Context) {
 
 // Disable 禁用数据
 func (a *User) Disable(ctx *context.Context) {
-	err := a.UserBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 2)
+	version, err := ctx.GetIfMatch()
+	if err != nil {
+		ctx.ResPreconditionFailed(err)
+		return
+	}
+
+	err = a.UserBll.UpdateStatus(ctx.NewContext(), ctx.Param("id"), 2, version)
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// QuerySessions 查询用户在线的会话
+func (a *User) QuerySessions(ctx *context.Context) {
+	items, err := a.UserBll.QuerySessions(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResList(items)
+}
+
+// RevokeSessions 撤销用户的会话(指定session_id时仅撤销该会话)
+func (a *User) RevokeSessions(ctx *context.Context) {
+	err := a.UserBll.RevokeSessions(ctx.NewContext(), ctx.Param("id"), ctx.Query("session_id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// ResetTOTP 重置用户的两步验证
+func (a *User) ResetTOTP(ctx *context.Context) {
+	err := a.TOTPBll.Reset(ctx.NewContext(), ctx.Param("id"))
 	if err != nil {
 		ctx.ResInternalServerError(err)
 		return
 	}
 	ctx.ResOK()
 }
+
+// QueryDeleted 查询已删除的分页数据(回收站)
+func (a *User) QueryDeleted(ctx *context.Context) {
+	total, items, err := a.UserBll.QueryDeletedPage(ctx.NewContext(), ctx.GetPageIndex(), ctx.GetPageSize())
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+
+	ctx.ResPage(total, items)
+}
+
+// Restore 恢复已删除的数据
+func (a *User) Restore(ctx *context.Context) {
+	err := a.UserBll.Restore(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Purge 彻底删除已删除的数据
+func (a *User) Purge(ctx *context.Context) {
+	err := a.UserBll.Purge(ctx.NewContext(), ctx.Param("id"))
+	if err != nil {
+		ctx.ResInternalServerError(err)
+		return
+	}
+	ctx.ResOK()
+}
+
+// Export 导出数据(查询条件与分页查询一致)
+func (a *User) Export(ctx *context.Context) {
+	params := a.queryParam(ctx)
+	ctx.ResExport("users", bll.UserColumns, func(w exchange.Writer) error {
+		return a.UserBll.Export(ctx.NewContext(), params, w)
+	})
+}
+
+// Import 导入数据(dry_run=1时仅校验)
+func (a *User) Import(ctx *context.Context) {
+	rows, err := ctx.GetImportRows()
+	if err != nil {
+		ctx.ResBadRequest(err)
+		return
+	}
+
+	result, err := a.UserBll.Import(ctx.NewContext(), rows, ctx.GetDryRun(), ctx.GetUserID())
+	ctx.ResImport(result, err)
+}
@@ -4,16 +4,17 @@ import (
 	"fmt"
 	"moddns/app/http/context"
 	"moddns/app/http/ctl"
-	"moddns/app/service/mysql"
+	"moddns/app/service/ratelimit"
 	"moddns/routes"
 
 	"github.com/casbin/casbin"
 	"github.com/gin-gonic/gin"
+	"github.com/go-session/session"
 	"github.com/spf13/viper"
 )
 
 // Init 初始化所有服务
-func Init(db *mysql.DB, enforcer *casbin.Enforcer, ctlCommon *ctl.Common) *gin.Engine {
+func Init(sessionStore session.ManagerStore, enforcer *casbin.Enforcer, ctlCommon *ctl.Common, limiter *ratelimit.Limiter) *gin.Engine {
 	gin.SetMode(viper.GetString("run_mode"))
 	app := gin.New()
 
@@ -22,7 +23,11 @@ func Init(db *mysql.DB, enforcer *casbin.Enforcer, ctlCommon *ctl.Common) *gin.E
 	app.Use(routes.TraceMiddleware(apiPrefixes...))
 	app.Use(routes.LoggerMiddleware(apiPrefixes, "/api/v1/loggers"))
 	app.Use(routes.RecoveryMiddleware())
-	app.Use(routes.SessionMiddleware(db, apiPrefixes...))
+	if viper.GetBool("cors.enable") {
+		app.Use(routes.CORSMiddleware(apiPrefixes...))
+	}
+	app.Use(routes.SecureHeadersMiddleware())
+	app.Use(routes.SessionMiddleware(sessionStore, apiPrefixes...))
 
 	app.NoMethod(context.WrapContext(func(ctx *context.Context) {
 		ctx.ResError(fmt.Errorf("方法不允许"), 405)
@@ -33,7 +38,7 @@ func Init(db *mysql.DB, enforcer *casbin.Enforcer, ctlCommon *ctl.Common) *gin.E
 	}))
 
 	// 注册/api/v1路由
-	routes.APIV1Handler(app, enforcer, ctlCommon)
+	routes.APIV1Handler(app, enforcer, ctlCommon, limiter)
 
 	// 加载casbin策略数据
 	err := loadCasbinPolicyData(ctlCommon)
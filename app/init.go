@@ -1,20 +1,33 @@
 package app
 
 import (
-	"database/sql"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/LyricTian/logrus-mysql-hook"
+	"io/ioutil"
+	"moddns/app/bll"
 	models "moddns/app/models/mysql"
 	"moddns/app/http"
 	"moddns/app/http/ctl"
 	"moddns/app/logger"
+	"moddns/app/service/cache"
+	"moddns/app/service/ldap"
 	"moddns/app/service/mysql"
+	"moddns/app/service/oidc"
+	"moddns/app/service/ratelimit"
+	"moddns/app/service/redis"
+	"moddns/app/service/sessionstore"
 	"moddns/app/util"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 	"github.com/casbin/casbin"
 	"github.com/facebookgo/inject"
 	"github.com/gin-gonic/gin"
+	"github.com/go-session/session"
 	"github.com/spf13/viper"
 )
 
@@ -23,27 +36,61 @@ type CloseHandle func()
 
 // Init 初始化所有服务
 func Init(version, traceID string) (*gin.Engine, CloseHandle) {
-	// 初始化MySQL
-	db := InitMySQL()
+	// 初始化密钥配置
+	InitSecrets()
+
+	// 初始化数据库
+	db := InitDB()
 
 	// 初始化日志
-	loggerHook := InitLogger(db.Db)
+	loggerHook := InitLogger(db)
 
 	logger.System(traceID).Infof("服务已运行在[%s]模式下，版本号:%s，进程号：%d",
 		viper.GetString("run_mode"), version, os.Getpid())
 
+	// 初始化Redis
+	redisCli := InitRedis()
+
+	// 初始化查询缓存
+	queryCache := InitCache(db, redisCli)
+
+	// 初始化会话存储及会话登记
+	sessionStore, sessions := InitSession(db, redisCli)
+
 	// 初始化依赖注入
-	enforcer, _, ctlCommon := InitInject(db)
+	enforcer, _, ctlCommon := InitInject(db, queryCache, sessions)
+
+	// 初始化限流器
+	limiter := InitRateLimiter(db, redisCli)
+
+	// 初始化回收站的定期清理
+	recycleClose := InitRecycle(ctlCommon, traceID)
 
 	// 初始化HTTP服务
-	httpHandler := http.Init(db, enforcer, ctlCommon)
+	httpHandler := http.Init(sessionStore, enforcer, ctlCommon, limiter)
 
 	return httpHandler, func() {
+		if limiter != nil {
+			limiter.Close()
+		}
+
+		queryCache.Close()
+		sessions.Close()
+		sessionStore.Close()
+
+		if recycleClose != nil {
+			recycleClose()
+		}
+
 		// 等待日志钩子写入完成
 		if loggerHook != nil {
 			loggerHook.Flush()
 		}
 
+		if redisCli != nil {
+			redisCli.Close()
+		}
+
 		// 关闭数据库
 		err := db.Close()
 		if err != nil {
@@ -52,16 +99,67 @@ func Init(version, traceID string) (*gin.Engine, CloseHandle) {
 	}
 }
 
+// 默认的会话签名
+const defaultSessionSign = "GINADMIN"
+
+// InitSecrets 解析配置中的密钥引用(file:/env:)，并注册日志脱敏
+func InitSecrets() {
+	for key, value := range viper.AllSettings() {
+		v, secrets, err := util.ResolveSecrets(value)
+		if err != nil {
+			panic(fmt.Sprintf("解析配置项[%s]发生错误：%s", key, err.Error()))
+		}
+
+		if len(secrets) > 0 {
+			viper.Set(key, v)
+			logger.AddSecrets(secrets...)
+		}
+	}
+
+	// 明文配置的密钥同样需要脱敏
+	logger.AddSecrets(
+		util.T(viper.GetStringMap("mysql")["password"]).String(),
+		util.T(viper.GetStringMap("postgres")["password"]).String(),
+		util.T(viper.GetStringMap("redis")["password"]).String(),
+		util.T(viper.GetStringMap("ldap")["bind_password"]).String(),
+		util.T(viper.GetStringMap("oidc")["client_secret"]).String(),
+		util.T(viper.GetStringMap("session")["sign"]).String(),
+	)
+	if rootUser := viper.GetStringSlice("system_root_user"); len(rootUser) == 2 {
+		logger.AddSecrets(rootUser[1], util.MD5HashString(rootUser[1]))
+	}
+
+	if viper.GetString("run_mode") == util.ReleaseMode &&
+		util.T(viper.GetStringMap("session")["sign"]).String() == defaultSessionSign {
+		panic("正式模式下不允许使用默认的会话签名，请修改session.sign配置")
+	}
+}
+
 // InitInject 初始化依赖注入
-func InitInject(db *mysql.DB) (*casbin.Enforcer, *models.Common, *ctl.Common) {
+func InitInject(db *mysql.DB, queryCache *cache.Cache, sessions *sessionstore.Registry) (*casbin.Enforcer, *models.Common, *ctl.Common) {
 	g := new(inject.Graph)
 
+	// 设置菜单分级码的位数(初始化菜单存储时转换已有的分级码)
+	util.SetLevelCodeWidth(util.T(viper.GetStringMap("menu")["level_code_width"]).Int())
+
 	// 注入casbin
 	enforcer := casbin.NewEnforcer(viper.GetString("casbin_model_conf"), false)
 	g.Provide(&inject.Object{Value: enforcer})
 
+	// 注入查询缓存
+	g.Provide(&inject.Object{Value: queryCache})
+
+	// 注入会话登记
+	g.Provide(&inject.Object{Value: sessions})
+
+	// 注入认证链
+	g.Provide(&inject.Object{Value: InitAuth()})
+
+	// 注入OIDC登录
+	g.Provide(&inject.Object{Value: InitOIDC()})
+
 	// 注入mysql存储
-	modelCommom := new(models.Common).Init(g, db)
+	modelCommom := new(models.Common).Init(g, db, queryCache)
 
 	// 注入控制器
 	ctlCommon := new(ctl.Common)
@@ -74,14 +172,73 @@ func InitInject(db *mysql.DB) (*casbin.Enforcer, *models.Common, *ctl.Common) {
 	return enforcer, modelCommom, ctlCommon
 }
 
-// InitMySQL 初始化mysql数据库
-func InitMySQL() *mysql.DB {
-	mysqlConfig := viper.GetStringMap("mysql")
+// InitDB 根据配置的存储方式(mysql/postgres)初始化数据库
+func InitDB() *mysql.DB {
+	switch v := viper.GetString("storage"); v {
+	case "", mysql.DialectMySQL:
+		return InitMySQL()
+	case mysql.DialectPostgres:
+		return InitPostgres()
+	default:
+		panic("无效的存储方式：" + v)
+	}
+}
+
+// dbOptions 数据库的通用配置项(连接池、只读副本、超时及慢查询)，key为配置节点
+func dbOptions(key string) []mysql.Option {
+	dbConfig := viper.GetStringMap(key)
+
 	var opts []mysql.Option
-	if v := util.T(mysqlConfig["trace"]).Bool(); v {
+	if v := util.T(dbConfig["trace"]).Bool(); v {
 		opts = append(opts, mysql.SetTrace(v))
 	}
 
+	if v := util.T(dbConfig["table_prefix"]).String(); v != "" {
+		opts = append(opts, mysql.SetTablePrefix(v))
+	}
+
+	if v := util.T(dbConfig["max_lifetime"]).Int(); v > 0 {
+		opts = append(opts, mysql.SetMaxLifetime(time.Duration(v)*time.Second))
+	}
+
+	if v := util.T(dbConfig["max_open_conns"]).Int(); v > 0 {
+		opts = append(opts, mysql.SetMaxOpenConns(v))
+	}
+
+	if v := util.T(dbConfig["max_idle_conns"]).Int(); v > 0 {
+		opts = append(opts, mysql.SetMaxIdleConns(v))
+	}
+
+	if v := util.T(dbConfig["query_timeout"]).Int(); v > 0 {
+		opts = append(opts, mysql.SetQueryTimeout(time.Duration(v)*time.Second))
+	}
+
+	// 只读副本(连接串格式与主库一致)
+	if v := viper.GetStringSlice(key + ".replicas"); len(v) > 0 {
+		opts = append(opts, mysql.SetReplicas(v...))
+	}
+
+	if v := util.T(dbConfig["replica_check_interval"]).Int(); v > 0 {
+		opts = append(opts, mysql.SetReplicaCheckInterval(time.Duration(v)*time.Second))
+	}
+
+	if v := util.T(dbConfig["slow_query"]).Int(); v > 0 {
+		opts = append(opts, mysql.SetSlowQuery(time.Duration(v)*time.Millisecond,
+			func(ctx context.Context, query string, elapsed time.Duration) {
+				logger.SystemWithContext(ctx).
+					WithField("elapsed", elapsed.String()).
+					Warnf("[慢查询] %s", query)
+			}))
+	}
+
+	return opts
+}
+
+// InitMySQL 初始化mysql数据库
+func InitMySQL() *mysql.DB {
+	mysqlConfig := viper.GetStringMap("mysql")
+	opts := dbOptions("mysql")
+
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s",
 		mysqlConfig["username"],
 		mysqlConfig["password"],
@@ -98,28 +255,390 @@ func InitMySQL() *mysql.DB {
 		opts = append(opts, mysql.SetEncoding(v))
 	}
 
-	if v := util.T(mysqlConfig["max_lifetime"]).Int(); v > 0 {
-		opts = append(opts, mysql.SetMaxLifetime(time.Duration(v)*time.Second))
+	db, err := mysql.NewDB(opts...)
+	if err != nil {
+		panic("初始化MySQL数据库发生错误：" + err.Error())
 	}
 
-	if v := util.T(mysqlConfig["max_open_conns"]).Int(); v > 0 {
-		opts = append(opts, mysql.SetMaxOpenConns(v))
-	}
+	return db
+}
 
-	if v := util.T(mysqlConfig["max_idle_conns"]).Int(); v > 0 {
-		opts = append(opts, mysql.SetMaxIdleConns(v))
+// InitPostgres 初始化postgres数据库
+func InitPostgres() *mysql.DB {
+	pgConfig := viper.GetStringMap("postgres")
+	if util.T(pgConfig["table_prefix"]).String() == "" {
+		// user为PostgreSQL的保留字，用户表必须使用前缀
+		panic("PostgreSQL数据库必须配置表名前缀(postgres.table_prefix)")
 	}
+	opts := dbOptions("postgres")
+
+	dsn := url.URL{
+		Scheme: "postgres",
+		User: url.UserPassword(util.T(pgConfig["user"]).String(),
+			util.T(pgConfig["password"]).String()),
+		Host: fmt.Sprintf("%s:%d", util.T(pgConfig["host"]).String(), util.T(pgConfig["port"]).Int()),
+		Path: "/" + util.T(pgConfig["dbname"]).String(),
+	}
+	if v := util.T(pgConfig["sslmode"]).String(); v != "" {
+		dsn.RawQuery = url.Values{"sslmode": {v}}.Encode()
+	}
+	opts = append(opts, mysql.SetDialect(mysql.DialectPostgres), mysql.SetDSN(dsn.String()))
 
 	db, err := mysql.NewDB(opts...)
 	if err != nil {
-		panic("初始化MySQL数据库发生错误：" + err.Error())
+		panic("初始化PostgreSQL数据库发生错误：" + err.Error())
 	}
 
 	return db
 }
 
-// InitLogger 初始化日志
-func InitLogger(mysqlDB *sql.DB) logger.HookFlusher {
+// InitRedis 初始化Redis客户端(会话、限流或缓存使用redis存储时创建，否则返回nil)
+func InitRedis() *redis.Client {
+	var used bool
+	for _, name := range []string{"session", "rate-limit", "cache"} {
+		c := viper.GetStringMap(name)
+		if util.T(c["store"]).String() == "redis" &&
+			(name == "session" || util.T(c["enable"]).Bool()) {
+			used = true
+		}
+	}
+	if !used {
+		return nil
+	}
+
+	redisConfig := viper.GetStringMap("redis")
+	var opts []redis.Option
+	if v := util.T(redisConfig["addr"]).String(); v != "" {
+		opts = append(opts, redis.SetAddr(v))
+	}
+
+	if v := util.T(redisConfig["password"]).String(); v != "" {
+		opts = append(opts, redis.SetPassword(v))
+	}
+
+	if v := util.T(redisConfig["db"]).Int(); v > 0 {
+		opts = append(opts, redis.SetDB(v))
+	}
+
+	if v := util.T(redisConfig["pool_size"]).Int(); v > 0 {
+		opts = append(opts, redis.SetPoolSize(v))
+	}
+
+	if v := util.T(redisConfig["dial_timeout"]).Int(); v > 0 {
+		opts = append(opts, redis.SetDialTimeout(time.Duration(v)*time.Second))
+	}
+
+	if v := util.T(redisConfig["io_timeout"]).Int(); v > 0 {
+		opts = append(opts, redis.SetIOTimeout(time.Duration(v)*time.Second))
+	}
+
+	if v := util.T(redisConfig["key_prefix"]).String(); v != "" {
+		opts = append(opts, redis.SetKeyPrefix(v))
+	}
+
+	client := redis.NewClient(opts...)
+	err := util.DoFunc(5, func() error {
+		return client.Ping(context.Background())
+	}, func(i int) time.Duration {
+		return time.Second * time.Duration(i)
+	})
+	if err != nil {
+		panic("初始化Redis发生错误：" + err.Error())
+	}
+
+	return client
+}
+
+// InitAuth 根据配置的认证方式(local/ldap，按顺序尝试)初始化认证链
+func InitAuth() *bll.Auth {
+	var providers []string
+	for _, v := range strings.Split(util.T(viper.GetStringMap("auth")["providers"]).String(), ",") {
+		switch v = strings.TrimSpace(v); v {
+		case "":
+		case bll.AuthProviderLocal, bll.AuthProviderLDAP:
+			providers = append(providers, v)
+		default:
+			panic("无效的认证方式：" + v)
+		}
+	}
+	if len(providers) == 0 {
+		providers = []string{bll.AuthProviderLocal}
+	}
+
+	opts := []bll.AuthOption{bll.SetAuthProviders(providers...)}
+	for _, v := range providers {
+		if v == bll.AuthProviderLDAP {
+			opts = append(opts, ldapOptions()...)
+		}
+	}
+	return bll.NewAuth(opts...)
+}
+
+// ldapOptions LDAP认证的配置项
+func ldapOptions() []bll.AuthOption {
+	ldapConfig := viper.GetStringMap("ldap")
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: util.T(ldapConfig["insecure_skip_verify"]).Bool(),
+	}
+	if v := util.T(ldapConfig["ca_file"]).String(); v != "" {
+		buf, err := ioutil.ReadFile(v)
+		if err != nil {
+			panic("读取LDAP的CA证书发生错误：" + err.Error())
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			panic("无效的LDAP的CA证书：" + v)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	opts := []ldap.Option{
+		ldap.SetURL(util.T(ldapConfig["url"]).String()),
+		ldap.SetBind(util.T(ldapConfig["bind_dn"]).String(), util.T(ldapConfig["bind_password"]).String()),
+		ldap.SetBaseDN(util.T(ldapConfig["base_dn"]).String()),
+		ldap.SetGroupSearch(
+			util.T(ldapConfig["group_base_dn"]).String(),
+			util.T(ldapConfig["group_filter"]).String(),
+			util.T(ldapConfig["group_attribute"]).String(),
+		),
+		ldap.SetMemberOfAttribute(util.T(ldapConfig["member_of_attribute"]).String()),
+		ldap.SetStartTLS(util.T(ldapConfig["start_tls"]).Bool()),
+		ldap.SetTLSConfig(tlsConfig),
+	}
+
+	if v := util.T(ldapConfig["user_filter"]).String(); v != "" {
+		if _, err := ldap.CompileFilter(strings.Replace(v, "%s", "x", -1)); err != nil {
+			panic("无效的LDAP用户过滤器：" + err.Error())
+		}
+		opts = append(opts, ldap.SetUserFilter(v))
+	}
+
+	if v := util.T(ldapConfig["name_attribute"]).String(); v != "" {
+		opts = append(opts, ldap.SetNameAttribute(v))
+	}
+
+	if v := util.T(ldapConfig["timeout"]).Int(); v > 0 {
+		opts = append(opts, ldap.SetTimeout(time.Duration(v)*time.Second))
+	}
+
+	authOpts := []bll.AuthOption{
+		bll.SetLDAP(ldap.NewAuthenticator(opts...)),
+		bll.SetLDAPProvision(
+			util.T(ldapConfig["auto_provision"]).Bool(),
+			util.T(ldapConfig["default_role"]).String(),
+		),
+	}
+
+	if items, ok := ldapConfig["group_roles"].([]interface{}); ok {
+		for _, v := range items {
+			item, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			group, role := util.T(item["group"]).String(), util.T(item["role"]).String()
+			if group == "" || role == "" {
+				panic("LDAP组与角色的映射需要指定group及role")
+			}
+			authOpts = append(authOpts, bll.SetLDAPGroupRole(group, role))
+		}
+	}
+
+	return authOpts
+}
+
+// InitOIDC 初始化OIDC登录(未启用时不配置身份提供方)
+func InitOIDC() *bll.OIDC {
+	oidcConfig := viper.GetStringMap("oidc")
+	if !util.T(oidcConfig["enable"]).Bool() {
+		return bll.NewOIDC()
+	}
+
+	issuer := util.T(oidcConfig["issuer"]).String()
+	clientID := util.T(oidcConfig["client_id"]).String()
+	redirectURL := util.T(oidcConfig["redirect_url"]).String()
+	if issuer == "" || clientID == "" || redirectURL == "" {
+		panic("OIDC登录需要配置issuer、client_id及redirect_url")
+	}
+
+	opts := []oidc.Option{
+		oidc.SetIssuer(issuer),
+		oidc.SetClient(clientID, util.T(oidcConfig["client_secret"]).String()),
+		oidc.SetRedirectURL(redirectURL),
+	}
+	if v := util.T(oidcConfig["scopes"]).String(); v != "" {
+		opts = append(opts, oidc.SetScopes(strings.Fields(v)...))
+	}
+
+	oidcOpts := []bll.OIDCOption{
+		bll.SetOIDCProvider(oidc.NewProvider(opts...)),
+		bll.SetOIDCUserClaim(
+			util.T(oidcConfig["user_claim"]).String(),
+			util.T(oidcConfig["name_claim"]).String(),
+		),
+		bll.SetOIDCProvision(
+			util.T(oidcConfig["auto_provision"]).Bool(),
+			util.T(oidcConfig["default_role"]).String(),
+		),
+		bll.SetOIDCLinkExisting(util.T(oidcConfig["link_existing"]).Bool()),
+		bll.SetOIDCRoleClaim(util.T(oidcConfig["role_claim"]).String()),
+	}
+
+	if items, ok := oidcConfig["claim_roles"].([]interface{}); ok {
+		for _, v := range items {
+			item, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			value, role := util.T(item["value"]).String(), util.T(item["role"]).String()
+			if value == "" || role == "" {
+				panic("OIDC声明与角色的映射需要指定value及role")
+			}
+			oidcOpts = append(oidcOpts, bll.SetOIDCClaimRole(value, role))
+		}
+	}
+
+	return bll.NewOIDC(oidcOpts...)
+}
+
+// InitSession 初始化会话存储及会话登记(按用户记录在线的会话，会话记录与会话使用相同的存储方式)
+func InitSession(db *mysql.DB, redisCli *redis.Client) (session.ManagerStore, *sessionstore.Registry) {
+	sessionConfig := viper.GetStringMap("session")
+
+	var (
+		store session.ManagerStore
+		index sessionstore.Index
+	)
+	switch v := util.T(sessionConfig["store"]).String(); v {
+	case "mysql", "database":
+		// mysql为兼容旧配置保留的名称，实际使用配置的存储方式
+		tableName := db.TablePrefix() + util.T(sessionConfig["table"]).String()
+		store = sessionstore.NewStore(db, tableName, 0)
+		recordTableName := db.TablePrefix() + util.T(sessionConfig["record_table"]).String()
+		index = sessionstore.NewIndex(db, recordTableName, 0)
+	case "redis":
+		store = sessionstore.NewRedisStore(redisCli)
+		index = sessionstore.NewRedisIndex(redisCli)
+	case "", "memory":
+		store = session.NewMemoryStore()
+		index = sessionstore.NewMemoryIndex(0)
+	default:
+		panic("无效的会话存储方式：" + v)
+	}
+
+	var opts []sessionstore.RegistryOption
+	if v := util.T(sessionConfig["expired"]).Int64(); v > 0 {
+		opts = append(opts, sessionstore.SetExpired(v))
+	}
+
+	if v := util.T(sessionConfig["max_sessions"]).Int(); v > 0 {
+		policy := util.T(sessionConfig["over_limit"]).String()
+		switch policy {
+		case "":
+			policy = sessionstore.PolicyKickOldest
+		case sessionstore.PolicyKickOldest, sessionstore.PolicyReject:
+		default:
+			panic("无效的会话数超限处理方式：" + policy)
+		}
+		opts = append(opts, sessionstore.SetMaxSessions(v, policy))
+	}
+
+	return store, sessionstore.NewRegistry(store, index, opts...)
+}
+
+// InitCache 初始化查询缓存(未启用时不缓存)
+func InitCache(db *mysql.DB, redisCli *redis.Client) *cache.Cache {
+	cacheConfig := viper.GetStringMap("cache")
+	if !util.T(cacheConfig["enable"]).Bool() {
+		return cache.New(nil, 0)
+	}
+
+	var store cache.Store
+	switch v := util.T(cacheConfig["store"]).String(); v {
+	case "mysql":
+		tableName := db.TablePrefix() + util.T(cacheConfig["table"]).String()
+		store = cache.NewMySQLStore(db, tableName, 0)
+	case "redis":
+		store = cache.NewRedisStore(redisCli)
+	case "", "memory":
+		store = cache.NewMemoryStore(util.T(cacheConfig["size"]).Int())
+	default:
+		panic("无效的缓存存储方式：" + v)
+	}
+
+	ttl := time.Duration(util.T(cacheConfig["ttl"]).Int()) * time.Second
+	return cache.New(store, ttl)
+}
+
+// InitRateLimiter 初始化限流器
+func InitRateLimiter(db *mysql.DB, redisCli *redis.Client) *ratelimit.Limiter {
+	limitConfig := viper.GetStringMap("rate-limit")
+	if !util.T(limitConfig["enable"]).Bool() {
+		return nil
+	}
+
+	var store ratelimit.Store
+	switch v := util.T(limitConfig["store"]).String(); v {
+	case "mysql":
+		tableName := db.TablePrefix() + util.T(limitConfig["table"]).String()
+		store = ratelimit.NewMySQLStore(db, tableName, 0)
+	case "redis":
+		store = ratelimit.NewRedisStore(redisCli)
+	case "", "memory":
+		store = ratelimit.NewMemoryStore(0)
+	default:
+		panic("无效的限流存储方式：" + v)
+	}
+
+	var defaultRule *ratelimit.Rule
+	if v := util.T(limitConfig["rate"]).Float64(); v > 0 {
+		defaultRule = &ratelimit.Rule{
+			Name:  "default",
+			Rate:  v,
+			Burst: util.T(limitConfig["burst"]).Int(),
+		}
+	}
+
+	var rules []*ratelimit.Rule
+	if items, ok := limitConfig["rules"].([]interface{}); ok {
+		for i, v := range items {
+			item, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			rule := &ratelimit.Rule{
+				Name:   fmt.Sprintf("rule%d", i),
+				Prefix: util.T(item["prefix"]).String(),
+				Memo:   util.T(item["memo"]).String(),
+				Rate:   util.T(item["rate"]).Float64(),
+				Burst:  util.T(item["burst"]).Int(),
+			}
+			if rule.Burst < 1 {
+				rule.Burst = 1
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	if defaultRule != nil && defaultRule.Burst < 1 {
+		defaultRule.Burst = 1
+	}
+
+	// 没有任何限流规则时不启用限流(停止存储的定期清理)
+	if defaultRule == nil && len(rules) == 0 {
+		store.Close()
+		return nil
+	}
+
+	return ratelimit.NewLimiter(store, defaultRule, rules...)
+}
+
+// InitLogger 初始化日志(日志钩子写入配置的数据库)
+func InitLogger(db *mysql.DB) logger.HookFlusher {
 	logConfig := viper.GetStringMap("log")
 
 	var opts []logger.Option
@@ -134,7 +653,7 @@ func InitLogger(mysqlDB *sql.DB) logger.HookFlusher {
 	l := logger.New(opts...)
 	if v := util.T(logConfig["hook"]).String(); v != "" {
 		switch v {
-		case "mysql":
+		case "mysql", "db":
 			extraItems := []*mysqlhook.ExecExtraItem{
 				mysqlhook.NewExecExtraItem(logger.FieldKeyType, "varchar(20)"),
 				mysqlhook.NewExecExtraItem(logger.FieldKeyUserID, "varchar(36)"),
@@ -151,14 +670,15 @@ func InitLogger(mysqlDB *sql.DB) logger.HookFlusher {
 				hookOpts = append(hookOpts, mysqlhook.SetMaxWorkers(v))
 			}
 
-			hook := mysqlhook.DefaultWithExtra(
-				mysqlDB,
-				fmt.Sprintf("%s_%s",
-					viper.GetStringMap("mysql")["table_prefix"],
-					util.T(hookConfig["table"]).String()),
-				extraItems,
-				hookOpts...,
-			)
+			tableName := db.TablePrefix() + util.T(hookConfig["table"]).String()
+
+			var hook *mysqlhook.Hook
+			if db.Dialect().Name() == mysql.DialectPostgres {
+				hookOpts = append(hookOpts, mysqlhook.SetExec(logger.NewPostgresExec(db, tableName, extraItems...)))
+				hook = mysqlhook.New(hookOpts...)
+			} else {
+				hook = mysqlhook.DefaultWithExtra(db.Db, tableName, extraItems, hookOpts...)
+			}
 
 			l.AddHook(hook)
 			return hook
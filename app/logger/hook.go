@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"moddns/app/service/mysql"
+	"strings"
+
+	"github.com/LyricTian/logrus-mysql-hook"
+	"github.com/sirupsen/logrus"
+)
+
+// NewPostgresExec 创建写入PostgreSQL的日志钩子执行器(表结构与MySQL的日志表一致)
+func NewPostgresExec(db *mysql.DB, tableName string, extraItems ...*mysqlhook.ExecExtraItem) mysqlhook.Execer {
+	var items []*mysqlhook.ExecExtraItem
+	items = append(items, mysqlhook.NewExecExtraItem("level", "int"))
+	items = append(items, mysqlhook.NewExecExtraItem("message", "varchar(1024)"))
+	items = append(items, extraItems...)
+	items = append(items, mysqlhook.NewExecExtraItem("data", "text"))
+	items = append(items, mysqlhook.NewExecExtraItem("created", "bigint"))
+
+	fields := []string{"id bigserial primary key"}
+	for _, item := range items {
+		fields = append(fields, fmt.Sprintf("%s %s", item.Field, item.DBType))
+	}
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", tableName, strings.Join(fields, ","))
+	_, err := db.Exec(query)
+	if err != nil {
+		panic(err)
+	}
+
+	var columns []string
+	for _, item := range items {
+		columns = append(columns, item.Field)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)", tableName,
+		strings.Join(columns, ","), strings.Repeat(",?", len(columns))[1:])
+
+	// 使用底层连接写入(与MySQL的日志钩子一致)，避免写入日志的语句再次记录慢查询日志而循环写入
+	return &postgresExec{db: db.Db, query: db.Dialect().Rebind(insert), items: items}
+}
+
+type postgresExec struct {
+	db    *sql.DB
+	query string
+	items []*mysqlhook.ExecExtraItem
+}
+
+func (e *postgresExec) Exec(entry *logrus.Entry) error {
+	var values []interface{}
+	for _, item := range e.items {
+		switch item.Field {
+		case "level":
+			values = append(values, int(entry.Level))
+		case "message":
+			values = append(values, entry.Message)
+		case "data":
+			data, _ := json.Marshal(entry.Data)
+			values = append(values, string(data))
+		case "created":
+			values = append(values, entry.Time.Unix())
+		default:
+			if v, ok := entry.Data[item.Field]; ok {
+				delete(entry.Data, item.Field)
+				values = append(values, fmt.Sprint(v))
+			} else {
+				values = append(values, "")
+			}
+		}
+	}
+
+	_, err := e.db.Exec(e.query, values...)
+	return err
+}
@@ -107,6 +107,7 @@ func New(opts ...Option) *Logger {
 		if o.format == "json" {
 			l.Formatter = new(logrus.JSONFormatter)
 		}
+		l.AddHook(new(redactHook))
 		internalLogger = &Logger{l}
 	})
 	return internalLogger
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactedText 脱敏后的替换文本
+const RedactedText = "******"
+
+var (
+	secretsLock sync.RWMutex
+	secrets     []string
+)
+
+// AddSecrets 添加需要在日志中脱敏的密钥(不限长度，过短的密钥可能误替换正常的日志内容)
+func AddSecrets(values ...string) {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+
+		var exists bool
+		for _, s := range secrets {
+			if s == v {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			secrets = append(secrets, v)
+		}
+	}
+
+	// 先替换较长的密钥，避免较短的密钥先替换了较长密钥的一部分
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+}
+
+// Redact 将字符串中的密钥替换为脱敏文本
+func Redact(s string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+
+	for _, v := range secrets {
+		if strings.Contains(s, v) {
+			s = strings.Replace(s, v, RedactedText, -1)
+		}
+	}
+	return s
+}
+
+// redactHook 日志脱敏钩子(需在其它钩子之前注册)
+type redactHook struct{}
+
+func (h *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		switch vv := v.(type) {
+		case string:
+			data[k] = Redact(vv)
+		case error:
+			if s := vv.Error(); Redact(s) != s {
+				data[k] = Redact(s)
+			} else {
+				data[k] = v
+			}
+		default:
+			if s := fmt.Sprint(v); Redact(s) != s {
+				data[k] = Redact(s)
+			} else {
+				data[k] = v
+			}
+		}
+	}
+	entry.Data = data
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package logger_test
+
+import (
+	"bytes"
+	"errors"
+	"moddns/app/logger"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	logger.AddSecrets("123", "", "s3cret-123-long")
+
+	if v := logger.Redact("password=123"); v != "password="+logger.RedactedText {
+		t.Fatalf("短密钥应脱敏：%s", v)
+	}
+	if v := logger.Redact("token=s3cret-123-long"); v != "token="+logger.RedactedText {
+		t.Fatalf("较长的密钥应整体脱敏：%s", v)
+	}
+	if v := logger.Redact("nothing"); v != "nothing" {
+		t.Fatalf("空密钥不应参与脱敏：%s", v)
+	}
+
+	var buf bytes.Buffer
+	l := logger.Default()
+	out := l.Out
+	l.Out = &buf
+	defer func() { l.Out = out }()
+
+	logger.System("trace").
+		WithField("dsn", "root:123@tcp").
+		WithField("err", errors.New("auth s3cret-123-long failed")).
+		WithField("args", []string{"123"}).
+		Infof("连接密码123")
+
+	s := buf.String()
+	if strings.Contains(s, "123") || strings.Contains(s, "s3cret") {
+		t.Fatalf("日志中的密钥应脱敏：%s", s)
+	}
+	if strings.Count(s, logger.RedactedText) != 4 {
+		t.Fatalf("脱敏的字段错误：%s", s)
+	}
+}
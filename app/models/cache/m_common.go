@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"context"
+	"moddns/app/service/cache"
+	"moddns/app/service/mysql"
+	"moddns/app/util"
+)
+
+// load 通过缓存加载数据，事务中的查询直接读取数据库(避免读取到事务外的旧数据或缓存事务中未提交的数据)
+func load(ctx context.Context, c *cache.Cache, ns, key string, v interface{}, fn func() error) error {
+	if mysql.InTrans(ctx) {
+		return fn()
+	}
+	return c.Load(ctx, ns, key, v, fn)
+}
+
+// paramsKey 根据查询参数生成缓存键
+func paramsKey(prefix string, params interface{}) string {
+	return prefix + ":" + util.SHA1HashString(util.JSONMarshalToString(params))
+}
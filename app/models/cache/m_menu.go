@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/cache"
+)
+
+// NewMenu 创建带缓存的菜单存储，缓存未启用时直接返回原存储
+func NewMenu(m models.IMenu, c *cache.Cache) models.IMenu {
+	if !c.Enabled() {
+		return m
+	}
+	return &Menu{IMenu: m, Cache: c}
+}
+
+// Menu 缓存菜单的选择数据及指定数据查询(用户菜单依赖角色授权及用户角色，统一使用菜单命名空间)
+type Menu struct {
+	models.IMenu
+	Cache *cache.Cache
+}
+
+// QuerySelect 查询选择数据
+func (a *Menu) QuerySelect(ctx context.Context, params schema.MenuSelectQueryParam) ([]*schema.MenuSelectQueryResult, error) {
+	var items []*schema.MenuSelectQueryResult
+	err := load(ctx, a.Cache, cache.NSMenu, paramsKey("select", params), &items, func() (err error) {
+		items, err = a.IMenu.QuerySelect(ctx, params)
+		return
+	})
+	return items, err
+}
+
+// Get 查询指定数据
+func (a *Menu) Get(ctx context.Context, recordID string) (*schema.Menu, error) {
+	var item *schema.Menu
+	err := load(ctx, a.Cache, cache.NSMenu, "get:"+recordID, &item, func() (err error) {
+		item, err = a.IMenu.Get(ctx, recordID)
+		return
+	})
+	return item, err
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/cache"
+)
+
+// NewRole 创建带缓存的角色存储，缓存未启用时直接返回原存储
+func NewRole(m models.IRole, c *cache.Cache) models.IRole {
+	if !c.Enabled() {
+		return m
+	}
+	return &Role{IRole: m, Cache: c}
+}
+
+// Role 缓存角色的选择数据、指定数据及角色菜单(权限策略)查询
+type Role struct {
+	models.IRole
+	Cache *cache.Cache
+}
+
+// QuerySelect 查询选择数据
+func (a *Role) QuerySelect(ctx context.Context, params schema.RoleSelectQueryParam) ([]*schema.RoleSelectQueryResult, error) {
+	var items []*schema.RoleSelectQueryResult
+	err := load(ctx, a.Cache, cache.NSRole, paramsKey("select", params), &items, func() (err error) {
+		items, err = a.IRole.QuerySelect(ctx, params)
+		return
+	})
+	return items, err
+}
+
+// Get 查询指定数据
+func (a *Role) Get(ctx context.Context, recordID string, includeMenuIDs bool) (*schema.Role, error) {
+	var item *schema.Role
+	key := fmt.Sprintf("get:%s:%t", recordID, includeMenuIDs)
+	err := load(ctx, a.Cache, cache.NSRole, key, &item, func() (err error) {
+		item, err = a.IRole.Get(ctx, recordID, includeMenuIDs)
+		return
+	})
+	return item, err
+}
+
+// QueryRoleMenus 查询角色菜单
+func (a *Role) QueryRoleMenus(ctx context.Context, params schema.RoleMenuQueryParam) ([]*schema.RoleMenu, error) {
+	var items []*schema.RoleMenu
+	err := load(ctx, a.Cache, cache.NSRole, paramsKey("menus", params), &items, func() (err error) {
+		items, err = a.IRole.QueryRoleMenus(ctx, params)
+		return
+	})
+	return items, err
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/cache"
+)
+
+// NewUser 创建带缓存的用户存储，缓存未启用时直接返回原存储
+func NewUser(m models.IUser, c *cache.Cache) models.IUser {
+	if !c.Enabled() {
+		return m
+	}
+	return &User{IUser: m, Cache: c}
+}
+
+// User 缓存用户指定数据的查询(当前用户信息)
+type User struct {
+	models.IUser
+	Cache *cache.Cache
+}
+
+// Get 查询指定数据
+func (a *User) Get(ctx context.Context, recordID string, includeRoleIDs bool) (*schema.User, error) {
+	var item *schema.User
+	key := fmt.Sprintf("get:%s:%t", recordID, includeRoleIDs)
+	err := load(ctx, a.Cache, cache.NSUser, key, &item, func() (err error) {
+		item, err = a.IUser.Get(ctx, recordID, includeRoleIDs)
+		return
+	})
+	return item, err
+}
@@ -16,7 +16,17 @@ type IDemo interface {
 	// Create 创建数据
 	Create(ctx context.Context, item *schema.Demo) error
 	// Update 更新数据
-	Update(ctx context.Context, recordID string, info map[string]interface{}) error
+	Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error
 	// Delete 删除数据
 	Delete(ctx context.Context, recordID string) error
+	// 查询已删除的分页数据
+	QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error)
+	// 查询指定的已删除数据
+	GetDeleted(ctx context.Context, recordID string) (*schema.Demo, error)
+	// 恢复已删除的数据
+	Restore(ctx context.Context, recordID string, deleted int64) error
+	// 彻底删除已删除的数据
+	Purge(ctx context.Context, recordID string) error
+	// 彻底删除指定时间之前删除的数据
+	PurgeExpired(ctx context.Context, before int64) (int64, error)
 }
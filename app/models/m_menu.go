@@ -17,16 +17,28 @@ type IMenu interface {
 	Check(ctx context.Context, recordID string) (bool, error)
 	// 检查编号是否存在
 	CheckCode(ctx context.Context, code string, parentID string) (bool, error)
-	// 根据父级查询分级码
-	QueryLevelCodesByParentID(parentID string) ([]string, error)
+	// 锁定上级菜单的分级码分配并查询上级及下级的分级码(须在事务中调用)
+	LockLevelCodesByParentID(ctx context.Context, parentID string) ([]string, error)
+	// 查询直接下级(按排序值)
+	QueryChildren(ctx context.Context, parentID string) ([]*schema.Menu, error)
 	// 检查子级是否存在
 	CheckChild(ctx context.Context, parentID string) (bool, error)
 	// Create 创建数据
 	Create(ctx context.Context, item *schema.Menu) error
 	// Update 更新数据
-	Update(ctx context.Context, recordID string, info map[string]interface{}) error
+	Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error
 	// 更新数据
-	UpdateWithLevelCode(ctx context.Context, recordID string, info map[string]interface{}, oldLevelCode, newLevelCode string) error
+	UpdateWithLevelCode(ctx context.Context, recordID string, info map[string]interface{}, oldLevelCode, newLevelCode string, version int64) error
 	// Delete 删除数据
 	Delete(ctx context.Context, recordID string) error
+	// 查询已删除的分页数据
+	QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error)
+	// 查询指定的已删除数据
+	GetDeleted(ctx context.Context, recordID string) (*schema.Menu, error)
+	// 恢复已删除的数据
+	Restore(ctx context.Context, recordID string, deleted int64, levelCode string) error
+	// 彻底删除已删除的数据
+	Purge(ctx context.Context, recordID string) error
+	// 彻底删除指定时间之前删除的数据
+	PurgeExpired(ctx context.Context, before int64) (int64, error)
 }
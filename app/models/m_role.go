@@ -13,6 +13,12 @@ type IRole interface {
 	QuerySelect(ctx context.Context, params schema.RoleSelectQueryParam) ([]*schema.RoleSelectQueryResult, error)
 	// 查询指定数据
 	Get(ctx context.Context, recordID string, includeMenuIDs bool) (*schema.Role, error)
+	// 查询角色菜单
+	QueryRoleMenus(ctx context.Context, params schema.RoleMenuQueryParam) ([]*schema.RoleMenu, error)
+	// 批量查询角色的菜单内码，返回角色内码与菜单内码列表的对应关系
+	QueryMenuIDsByRoleIDs(ctx context.Context, roleIDs []string) (map[string][]string, error)
+	// 批量查询角色名称，返回角色内码与名称的对应关系
+	QueryNamesByIDs(ctx context.Context, recordIDs []string) (map[string]string, error)
 	// Check 检查数据是否存在
 	Check(ctx context.Context, recordID string) (bool, error)
 	// 检查名称
@@ -20,9 +26,19 @@ type IRole interface {
 	// 创建数据
 	Create(ctx context.Context, item *schema.Role) error
 	// 更新数据
-	Update(ctx context.Context, recordID string, info map[string]interface{}) error
+	Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error
 	// 更新数据
-	UpdateWithMenuIDs(ctx context.Context, recordID string, info map[string]interface{}, menuIDs []string) error
+	UpdateWithMenuIDs(ctx context.Context, recordID string, info map[string]interface{}, menuIDs []string, version int64) error
 	// 删除数据
 	Delete(ctx context.Context, recordID string) error
+	// 查询已删除的分页数据
+	QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error)
+	// 查询指定的已删除数据
+	GetDeleted(ctx context.Context, recordID string) (*schema.Role, error)
+	// 恢复已删除的数据
+	Restore(ctx context.Context, recordID string, deleted int64) error
+	// 彻底删除已删除的数据
+	Purge(ctx context.Context, recordID string) error
+	// 彻底删除指定时间之前删除的数据
+	PurgeExpired(ctx context.Context, before int64) (int64, error)
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"context"
+	"moddns/app/schema"
+)
+
+// ITOTP 用户两步验证(TOTP)管理
+type ITOTP interface {
+	// 查询用户的两步验证设置(不存在时返回nil)
+	Get(ctx context.Context, userID string) (*schema.UserTOTP, error)
+	// 保存用户的两步验证设置(不存在时创建，存在时覆盖)
+	Save(ctx context.Context, item *schema.UserTOTP) error
+	// 更新最后验证通过的时间步(仅大于已记录的时间步时更新)，返回是否更新
+	UpdateLastStep(ctx context.Context, userID string, step int64) (bool, error)
+	// 更新未使用的恢复码(仅当前值与oldCodes一致时更新)，返回是否更新
+	UpdateRecoveryCodes(ctx context.Context, userID, oldCodes, newCodes string) (bool, error)
+	// 增加连续验证失败的次数，达到maxFailures时锁定至lockedUntil并重新计数
+	AddFailure(ctx context.Context, userID string, maxFailures int, lockedUntil int64) error
+	// 清除连续验证失败的次数及锁定
+	ResetFailures(ctx context.Context, userID string) error
+	// 删除用户的两步验证设置
+	Delete(ctx context.Context, userID string) error
+}
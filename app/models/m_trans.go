@@ -0,0 +1,13 @@
+package models
+
+import (
+	"context"
+)
+
+// ITrans 事务管理(工作单元)
+type ITrans interface {
+	// 在事务中执行，上下文中已存在事务时加入该事务
+	Exec(ctx context.Context, fn func(context.Context) error) error
+	// 注册事务提交后执行的函数(上下文中不存在事务时立即执行)
+	AfterCommit(ctx context.Context, fn func())
+}
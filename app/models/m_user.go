@@ -17,16 +17,34 @@ type IUser interface {
 	CheckUserName(ctx context.Context, userName string) (bool, error)
 	// 根据用户名查询指定数据
 	GetByUserName(ctx context.Context, userName string, includeRoleIDs bool) (*schema.User, error)
+	// 根据关联的OIDC签发方及用户标识查询指定数据
+	GetByOIDCSubject(ctx context.Context, issuer, subject string, includeRoleIDs bool) (*schema.User, error)
+	// 关联OIDC签发方及用户标识
+	UpdateOIDCSubject(ctx context.Context, recordID, issuer, subject string) error
 	// 检查角色下是否存在用户
 	CheckByRoleID(ctx context.Context, roleID string) (bool, error)
 	// 查询用户角色
 	QueryUserRoles(ctx context.Context, params schema.UserRoleQueryParam) ([]*schema.UserRole, error)
+	// 批量查询用户的角色内码，返回用户内码与角色内码列表的对应关系
+	QueryRoleIDsByUserIDs(ctx context.Context, userIDs []string) (map[string][]string, error)
+	// 批量查询用户名称(真实姓名为空时使用用户名)，返回用户内码与名称的对应关系
+	QueryNamesByIDs(ctx context.Context, recordIDs []string) (map[string]string, error)
 	// 创建数据
 	Create(ctx context.Context, item *schema.User) error
 	// 更新数据
-	Update(ctx context.Context, recordID string, info map[string]interface{}) error
+	Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error
 	// 更新数据
-	UpdateWithRoleIDs(ctx context.Context, recordID string, info map[string]interface{}, roleIDs []string) error
+	UpdateWithRoleIDs(ctx context.Context, recordID string, info map[string]interface{}, roleIDs []string, version int64) error
 	// 删除数据
 	Delete(ctx context.Context, recordID string) error
+	// 查询已删除的分页数据
+	QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error)
+	// 查询指定的已删除数据
+	GetDeleted(ctx context.Context, recordID string) (*schema.User, error)
+	// 恢复已删除的数据
+	Restore(ctx context.Context, recordID string, deleted int64) error
+	// 彻底删除已删除的数据
+	Purge(ctx context.Context, recordID string) error
+	// 彻底删除指定时间之前删除的数据
+	PurgeExpired(ctx context.Context, before int64) (int64, error)
 }
@@ -0,0 +1,50 @@
+package modeltest
+
+import (
+	"context"
+
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/util"
+)
+
+// Demo 内存中的示例数据存储
+type Demo struct {
+	models.IDemo
+	Items []*schema.Demo
+}
+
+// Find 查找示例数据
+func (m *Demo) Find(recordID string) *schema.Demo {
+	for _, item := range m.Items {
+		if item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+// Get 查询指定数据
+func (m *Demo) Get(ctx context.Context, recordID string) (*schema.Demo, error) {
+	if item := m.Find(recordID); item != nil {
+		v := *item
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// Check 检查数据是否存在
+func (m *Demo) Check(ctx context.Context, recordID string) (bool, error) {
+	return m.Find(recordID) != nil, nil
+}
+
+// Update 更新数据(version大于0时校验版本号)
+func (m *Demo) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	item := m.Find(recordID)
+	if item == nil || (version > 0 && version != item.Version) {
+		return util.ErrConflict
+	}
+	setFields(item, info)
+	item.Version++
+	return nil
+}
@@ -0,0 +1,196 @@
+package modeltest
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/util"
+)
+
+// Menu 内存中的菜单存储
+type Menu struct {
+	models.IMenu
+	Items []*schema.Menu
+	Roles *Role // 按角色查询菜单时使用
+}
+
+// Find 查找菜单
+func (m *Menu) Find(recordID string) *schema.Menu {
+	for _, item := range m.Items {
+		if item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+// FindByPath 根据编号路径(以/分隔)查找菜单
+func (m *Menu) FindByPath(path string) *schema.Menu {
+	var parentID string
+	var item *schema.Menu
+	for _, code := range strings.Split(path, "/") {
+		item = nil
+		for _, v := range m.Items {
+			if v.ParentID == parentID && v.Code == code {
+				item = v
+				break
+			}
+		}
+		if item == nil {
+			return nil
+		}
+		parentID = item.RecordID
+	}
+	return item
+}
+
+// QuerySelect 查询选择数据
+func (m *Menu) QuerySelect(ctx context.Context, params schema.MenuSelectQueryParam) ([]*schema.MenuSelectQueryResult, error) {
+	var roleMenus map[string]bool
+	if params.RoleID != "" {
+		roleMenus = make(map[string]bool)
+		if role := m.Roles.Find(params.RoleID); role != nil {
+			for _, menuID := range role.MenuIDs {
+				roleMenus[menuID] = true
+			}
+		}
+	}
+
+	var result []*schema.MenuSelectQueryResult
+	for _, item := range m.Items {
+		switch {
+		case len(params.RecordIDs) > 0 && !contains(params.RecordIDs, item.RecordID):
+			continue
+		case params.Status > 0 && item.Status != params.Status:
+			continue
+		case len(params.Types) > 0 && !contains(params.Types, item.Type):
+			continue
+		case roleMenus != nil && !roleMenus[item.RecordID]:
+			continue
+		}
+		result = append(result, &schema.MenuSelectQueryResult{
+			RecordID:  item.RecordID,
+			Code:      item.Code,
+			Name:      item.Name,
+			LevelCode: item.LevelCode,
+			ParentID:  item.ParentID,
+			Type:      item.Type,
+			Icon:      item.Icon,
+			Path:      item.Path,
+			Method:    item.Method,
+			Sequence:  item.Sequence,
+			IsHide:    item.IsHide,
+			Status:    item.Status,
+		})
+	}
+	return result, nil
+}
+
+// Get 查询指定数据
+func (m *Menu) Get(ctx context.Context, recordID string) (*schema.Menu, error) {
+	if item := m.Find(recordID); item != nil {
+		v := *item
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// Check 检查数据是否存在
+func (m *Menu) Check(ctx context.Context, recordID string) (bool, error) {
+	return m.Find(recordID) != nil, nil
+}
+
+// CheckCode 检查编号是否存在
+func (m *Menu) CheckCode(ctx context.Context, code string, parentID string) (bool, error) {
+	for _, item := range m.Items {
+		if item.ParentID == parentID && item.Code == code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LockLevelCodesByParentID 查询上级及下级的分级码(按分级码排序，上级在前)
+func (m *Menu) LockLevelCodesByParentID(ctx context.Context, parentID string) ([]string, error) {
+	var levelCodes, siblings []string
+	if parentID != "" {
+		parent := m.Find(parentID)
+		if parent == nil {
+			return nil, nil
+		}
+		levelCodes = append(levelCodes, parent.LevelCode)
+	}
+	for _, item := range m.Items {
+		if item.ParentID == parentID {
+			siblings = append(siblings, item.LevelCode)
+		}
+	}
+	sort.Strings(siblings)
+	return append(levelCodes, siblings...), nil
+}
+
+// QueryChildren 查询直接下级(按排序值)
+func (m *Menu) QueryChildren(ctx context.Context, parentID string) ([]*schema.Menu, error) {
+	var items []*schema.Menu
+	for _, item := range m.Items {
+		if item.ParentID == parentID {
+			v := *item
+			items = append(items, &v)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Sequence < items[j].Sequence
+	})
+	return items, nil
+}
+
+// CheckChild 检查子级是否存在
+func (m *Menu) CheckChild(ctx context.Context, parentID string) (bool, error) {
+	children, _ := m.QueryChildren(ctx, parentID)
+	return len(children) > 0, nil
+}
+
+// Create 创建数据
+func (m *Menu) Create(ctx context.Context, item *schema.Menu) error {
+	v := *item
+	m.Items = append(m.Items, &v)
+	return nil
+}
+
+// Update 更新数据(version大于0时校验版本号)
+func (m *Menu) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	item := m.Find(recordID)
+	if item == nil || (version > 0 && version != item.Version) {
+		return util.ErrConflict
+	}
+	setFields(item, info)
+	item.Version++
+	return nil
+}
+
+// UpdateWithLevelCode 更新数据，同时更新下级的分级码
+func (m *Menu) UpdateWithLevelCode(ctx context.Context, recordID string, info map[string]interface{}, oldLevelCode, newLevelCode string, version int64) error {
+	if err := m.Update(ctx, recordID, info, version); err != nil {
+		return err
+	}
+	for _, item := range m.Items {
+		if strings.HasPrefix(item.LevelCode, oldLevelCode) {
+			item.LevelCode = newLevelCode + item.LevelCode[len(oldLevelCode):]
+		}
+	}
+	return nil
+}
+
+// Delete 删除数据
+func (m *Menu) Delete(ctx context.Context, recordID string) error {
+	for i, item := range m.Items {
+		if item.RecordID == recordID {
+			m.Items = append(m.Items[:i], m.Items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Package modeltest 内存中的存储替身，实现业务测试使用的存储接口子集(未实现的方法调用时panic)，
+// 业务及路由的测试共用，测试无需依赖数据库
+package modeltest
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// Trans 直接执行的事务管理(记录最近一次事务是否回滚，提交后的回调立即执行)
+type Trans struct {
+	Rollback bool
+}
+
+// Exec 执行事务
+func (t *Trans) Exec(ctx context.Context, fn func(context.Context) error) error {
+	err := fn(ctx)
+	t.Rollback = err != nil
+	return err
+}
+
+// AfterCommit 立即执行提交后的回调
+func (t *Trans) AfterCommit(ctx context.Context, fn func()) {
+	fn()
+}
+
+// setFields 按db标签将info中的字段设置到结构体(忽略版本号)
+func setFields(item interface{}, info map[string]interface{}) {
+	v := reflect.ValueOf(item).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("db"), ",")[0]
+		if value, ok := info[name]; ok && name != "version" {
+			v.Field(i).Set(reflect.ValueOf(value).Convert(v.Field(i).Type()))
+		}
+	}
+}
+
+// contains 检查切片中是否包含指定的值
+func contains(items interface{}, item interface{}) bool {
+	v := reflect.ValueOf(items)
+	for i := 0; i < v.Len(); i++ {
+		if v.Index(i).Interface() == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package modeltest
+
+import (
+	"context"
+
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/util"
+)
+
+// Role 内存中的角色存储
+type Role struct {
+	models.IRole
+	Items []*schema.Role
+}
+
+// Find 查找角色
+func (m *Role) Find(recordID string) *schema.Role {
+	for _, item := range m.Items {
+		if item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+// QueryPage 查询分页数据(按ID倒序)
+func (m *Role) QueryPage(ctx context.Context, params schema.RoleQueryParam, pageIndex, pageSize uint) (int64, []*schema.RoleQueryResult, error) {
+	var all []*schema.RoleQueryResult
+	for i := len(m.Items) - 1; i >= 0; i-- { // 按ID倒序
+		item := m.Items[i]
+		if params.BeforeID > 0 && item.ID >= params.BeforeID {
+			continue
+		}
+		all = append(all, &schema.RoleQueryResult{
+			ID:         item.ID,
+			RecordID:   item.RecordID,
+			Name:       item.Name,
+			Memo:       item.Memo,
+			Status:     item.Status,
+			Require2FA: item.Require2FA,
+		})
+	}
+
+	var items []*schema.RoleQueryResult
+	for i, item := range all {
+		if uint(i) >= (pageIndex-1)*pageSize && uint(i) < pageIndex*pageSize {
+			items = append(items, item)
+		}
+	}
+	return int64(len(all)), items, nil
+}
+
+// QuerySelect 查询选择数据
+func (m *Role) QuerySelect(ctx context.Context, params schema.RoleSelectQueryParam) ([]*schema.RoleSelectQueryResult, error) {
+	var items []*schema.RoleSelectQueryResult
+	for _, item := range m.Items {
+		switch {
+		case len(params.RecordIDs) > 0 && !contains(params.RecordIDs, item.RecordID):
+			continue
+		case params.Status > 0 && item.Status != params.Status:
+			continue
+		case params.Require2FA > 0 && item.Require2FA != params.Require2FA:
+			continue
+		}
+		items = append(items, &schema.RoleSelectQueryResult{RecordID: item.RecordID, Name: item.Name})
+	}
+	return items, nil
+}
+
+// Get 查询指定数据
+func (m *Role) Get(ctx context.Context, recordID string, includeMenuIDs bool) (*schema.Role, error) {
+	if item := m.Find(recordID); item != nil {
+		v := *item
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// QueryRoleMenus 查询角色菜单
+func (m *Role) QueryRoleMenus(ctx context.Context, params schema.RoleMenuQueryParam) ([]*schema.RoleMenu, error) {
+	var items []*schema.RoleMenu
+	for _, item := range m.Items {
+		for _, menuID := range item.MenuIDs {
+			items = append(items, &schema.RoleMenu{RoleID: item.RecordID, MenuID: menuID})
+		}
+	}
+	return items, nil
+}
+
+// CheckName 检查角色名称是否存在
+func (m *Role) CheckName(ctx context.Context, name string) (bool, error) {
+	for _, item := range m.Items {
+		if item.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Create 创建数据
+func (m *Role) Create(ctx context.Context, item *schema.Role) error {
+	v := *item
+	v.ID = int64(len(m.Items) + 1)
+	m.Items = append(m.Items, &v)
+	return nil
+}
+
+// UpdateWithMenuIDs 更新数据及角色菜单(version大于0时校验版本号)
+func (m *Role) UpdateWithMenuIDs(ctx context.Context, recordID string, info map[string]interface{}, menuIDs []string, version int64) error {
+	item := m.Find(recordID)
+	if item == nil || (version > 0 && version != item.Version) {
+		return util.ErrConflict
+	}
+	setFields(item, info)
+	item.MenuIDs = menuIDs
+	item.Version++
+	return nil
+}
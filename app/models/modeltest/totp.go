@@ -0,0 +1,95 @@
+package modeltest
+
+import (
+	"context"
+
+	"moddns/app/models"
+	"moddns/app/schema"
+)
+
+// TOTP 内存中的两步验证设置存储
+type TOTP struct {
+	models.ITOTP
+	Items []*schema.UserTOTP
+}
+
+// Find 查找用户的两步验证设置
+func (m *TOTP) Find(userID string) *schema.UserTOTP {
+	for _, item := range m.Items {
+		if item.UserID == userID {
+			return item
+		}
+	}
+	return nil
+}
+
+// Get 查询用户的两步验证设置(不存在时返回nil)
+func (m *TOTP) Get(ctx context.Context, userID string) (*schema.UserTOTP, error) {
+	if item := m.Find(userID); item != nil {
+		v := *item
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// Save 保存用户的两步验证设置(不存在时创建，存在时覆盖)
+func (m *TOTP) Save(ctx context.Context, item *schema.UserTOTP) error {
+	v := *item
+	if old := m.Find(item.UserID); old != nil {
+		*old = v
+		return nil
+	}
+	m.Items = append(m.Items, &v)
+	return nil
+}
+
+// UpdateLastStep 更新最后验证通过的时间步(仅大于已记录的时间步时更新)
+func (m *TOTP) UpdateLastStep(ctx context.Context, userID string, step int64) (bool, error) {
+	item := m.Find(userID)
+	if item == nil || step <= item.LastStep {
+		return false, nil
+	}
+	item.LastStep = step
+	return true, nil
+}
+
+// UpdateRecoveryCodes 更新未使用的恢复码(仅当前值与oldCodes一致时更新)
+func (m *TOTP) UpdateRecoveryCodes(ctx context.Context, userID, oldCodes, newCodes string) (bool, error) {
+	item := m.Find(userID)
+	if item == nil || item.RecoveryCodes != oldCodes {
+		return false, nil
+	}
+	item.RecoveryCodes = newCodes
+	return true, nil
+}
+
+// AddFailure 增加连续验证失败的次数，达到maxFailures时锁定至lockedUntil并重新计数
+func (m *TOTP) AddFailure(ctx context.Context, userID string, maxFailures int, lockedUntil int64) error {
+	if item := m.Find(userID); item != nil {
+		if item.Failures++; item.Failures >= maxFailures {
+			item.Failures = 0
+			item.LockedUntil = lockedUntil
+		}
+	}
+	return nil
+}
+
+// ResetFailures 清除连续验证失败的次数及锁定
+func (m *TOTP) ResetFailures(ctx context.Context, userID string) error {
+	if item := m.Find(userID); item != nil {
+		item.Failures = 0
+		item.LockedUntil = 0
+	}
+	return nil
+}
+
+// Delete 删除用户的两步验证设置
+func (m *TOTP) Delete(ctx context.Context, userID string) error {
+	for i, item := range m.Items {
+		if item.UserID == userID {
+			m.Items = append(m.Items[:i], m.Items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
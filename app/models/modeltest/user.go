@@ -0,0 +1,242 @@
+package modeltest
+
+import (
+	"context"
+	"time"
+
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/util"
+)
+
+// User 内存中的用户存储(Deleted大于0的数据为已删除的数据)
+type User struct {
+	models.IUser
+	Items []*schema.User
+}
+
+// Find 查找未删除的用户
+func (m *User) Find(recordID string) *schema.User {
+	for _, item := range m.Items {
+		if item.RecordID == recordID && item.Deleted == 0 {
+			return item
+		}
+	}
+	return nil
+}
+
+// FindByUserName 根据用户名查找未删除的用户
+func (m *User) FindByUserName(userName string) *schema.User {
+	for _, item := range m.Items {
+		if item.UserName == userName && item.Deleted == 0 {
+			return item
+		}
+	}
+	return nil
+}
+
+// copyUser 复制用户(includeRoleIDs为false时不包含角色)
+func copyUser(item *schema.User, includeRoleIDs bool) *schema.User {
+	if item == nil {
+		return nil
+	}
+	v := *item
+	if !includeRoleIDs {
+		v.RoleIDs = nil
+	}
+	return &v
+}
+
+// QueryPage 查询分页数据(按ID倒序)
+func (m *User) QueryPage(ctx context.Context, params schema.UserQueryParam, pageIndex, pageSize uint) (int64, []*schema.UserQueryResult, error) {
+	var all []*schema.UserQueryResult
+	for i := len(m.Items) - 1; i >= 0; i-- {
+		item := m.Items[i]
+		switch {
+		case item.Deleted > 0:
+			continue
+		case params.Status > 0 && item.Status != params.Status:
+			continue
+		case params.BeforeID > 0 && item.ID >= params.BeforeID:
+			continue
+		}
+		all = append(all, &schema.UserQueryResult{
+			ID:       item.ID,
+			RecordID: item.RecordID,
+			UserName: item.UserName,
+			RealName: item.RealName,
+			Source:   item.Source,
+			Status:   item.Status,
+			Creator:  item.Creator,
+		})
+	}
+
+	var items []*schema.UserQueryResult
+	for i, item := range all {
+		if uint(i) >= (pageIndex-1)*pageSize && uint(i) < pageIndex*pageSize {
+			items = append(items, item)
+		}
+	}
+	return int64(len(all)), items, nil
+}
+
+// Get 查询指定数据
+func (m *User) Get(ctx context.Context, recordID string, includeRoleIDs bool) (*schema.User, error) {
+	return copyUser(m.Find(recordID), includeRoleIDs), nil
+}
+
+// Check 检查数据是否存在
+func (m *User) Check(ctx context.Context, recordID string) (bool, error) {
+	return m.Find(recordID) != nil, nil
+}
+
+// CheckUserName 检查用户名
+func (m *User) CheckUserName(ctx context.Context, userName string) (bool, error) {
+	return m.FindByUserName(userName) != nil, nil
+}
+
+// GetByUserName 根据用户名查询指定数据
+func (m *User) GetByUserName(ctx context.Context, userName string, includeRoleIDs bool) (*schema.User, error) {
+	return copyUser(m.FindByUserName(userName), includeRoleIDs), nil
+}
+
+// GetByOIDCSubject 根据关联的OIDC签发方及用户标识查询指定数据
+func (m *User) GetByOIDCSubject(ctx context.Context, issuer, subject string, includeRoleIDs bool) (*schema.User, error) {
+	for _, item := range m.Items {
+		if item.OIDCIssuer == issuer && item.OIDCSubject == subject && item.Deleted == 0 {
+			return copyUser(item, includeRoleIDs), nil
+		}
+	}
+	return nil, nil
+}
+
+// UpdateOIDCSubject 关联OIDC签发方及用户标识
+func (m *User) UpdateOIDCSubject(ctx context.Context, recordID, issuer, subject string) error {
+	item := m.Find(recordID)
+	if item == nil {
+		return util.ErrConflict
+	}
+	item.OIDCIssuer = issuer
+	item.OIDCSubject = subject
+	item.Version++
+	return nil
+}
+
+// QueryUserRoles 查询用户角色
+func (m *User) QueryUserRoles(ctx context.Context, params schema.UserRoleQueryParam) ([]*schema.UserRole, error) {
+	var items []*schema.UserRole
+	for _, item := range m.Items {
+		switch {
+		case item.Deleted > 0:
+			continue
+		case params.UserID != "" && item.RecordID != params.UserID:
+			continue
+		case len(params.UserIDs) > 0 && !contains(params.UserIDs, item.RecordID):
+			continue
+		}
+		for _, roleID := range item.RoleIDs {
+			items = append(items, &schema.UserRole{UserID: item.RecordID, RoleID: roleID})
+		}
+	}
+	return items, nil
+}
+
+// QueryRoleIDsByUserIDs 批量查询用户的角色内码
+func (m *User) QueryRoleIDsByUserIDs(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, userID := range userIDs {
+		if item := m.Find(userID); item != nil && len(item.RoleIDs) > 0 {
+			result[userID] = append([]string(nil), item.RoleIDs...)
+		}
+	}
+	return result, nil
+}
+
+// QueryNamesByIDs 批量查询用户名称(与数据库查询一致，没有数据时返回nil)
+func (m *User) QueryNamesByIDs(ctx context.Context, recordIDs []string) (map[string]string, error) {
+	var names map[string]string
+	for _, recordID := range recordIDs {
+		if item := m.Find(recordID); item != nil {
+			if names == nil {
+				names = make(map[string]string)
+			}
+			names[recordID] = item.RealName
+			if item.RealName == "" {
+				names[recordID] = item.UserName
+			}
+		}
+	}
+	return names, nil
+}
+
+// Create 创建数据
+func (m *User) Create(ctx context.Context, item *schema.User) error {
+	v := *item
+	v.ID = int64(len(m.Items) + 1)
+	m.Items = append(m.Items, &v)
+	return nil
+}
+
+// Update 更新数据(version大于0时校验版本号)
+func (m *User) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	item := m.Find(recordID)
+	if item == nil || (version > 0 && version != item.Version) {
+		return util.ErrConflict
+	}
+	setFields(item, info)
+	item.Version++
+	return nil
+}
+
+// UpdateWithRoleIDs 更新数据及用户角色(version大于0时校验版本号)
+func (m *User) UpdateWithRoleIDs(ctx context.Context, recordID string, info map[string]interface{}, roleIDs []string, version int64) error {
+	if err := m.Update(ctx, recordID, info, version); err != nil {
+		return err
+	}
+	m.Find(recordID).RoleIDs = roleIDs
+	return nil
+}
+
+// Delete 删除数据
+func (m *User) Delete(ctx context.Context, recordID string) error {
+	if item := m.Find(recordID); item != nil {
+		item.Deleted = time.Now().Unix()
+	}
+	return nil
+}
+
+// GetDeleted 查询指定的已删除数据
+func (m *User) GetDeleted(ctx context.Context, recordID string) (*schema.User, error) {
+	for _, item := range m.Items {
+		if item.RecordID == recordID && item.Deleted > 0 {
+			return copyUser(item, true), nil
+		}
+	}
+	return nil, nil
+}
+
+// Restore 恢复已删除的数据
+func (m *User) Restore(ctx context.Context, recordID string, deleted int64) error {
+	for _, item := range m.Items {
+		if item.RecordID == recordID && item.Deleted == deleted {
+			item.Deleted = 0
+			return nil
+		}
+	}
+	return util.ErrConflict
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据
+func (m *User) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	var n int64
+	items := m.Items[:0]
+	for _, item := range m.Items {
+		if item.Deleted > 0 && item.Deleted < before {
+			n++
+			continue
+		}
+		items = append(items, item)
+	}
+	m.Items = items
+	return n, nil
+}
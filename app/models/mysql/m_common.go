@@ -2,40 +2,40 @@ package mysql
 
 import (
 	"fmt"
+	"moddns/app/service/cache"
 	"moddns/app/service/mysql"
-	"moddns/app/util"
 
 	"github.com/facebookgo/inject"
-	"github.com/spf13/viper"
 )
 
 // Common mysql存储模块
 type Common struct {
-	User *User
-	Role *Role
-	Demo *Demo
-	Menu *Menu
+	User  *User
+	Role  *Role
+	Demo  *Demo
+	Menu  *Menu
+	Trans *Trans
+	TOTP  *TOTP
+	Cache *cache.Cache
+	DB    *mysql.DB
 }
 
-// Init 初始化
-func (a *Common) Init(g *inject.Graph, db *mysql.DB) *Common {
+// Init 初始化(c为查询缓存，未启用时直接查询数据库)
+func (a *Common) Init(g *inject.Graph, db *mysql.DB, c *cache.Cache) *Common {
+	a.Cache = c
+	a.DB = db
 	a.User = new(User).Init(g, db, a)
 	a.Role = new(Role).Init(g, db, a)
 	a.Demo = new(Demo).Init(g, db, a)
 	a.Menu = new(Menu).Init(g, db, a)
+	a.Trans = new(Trans).Init(g, db, a)
+	a.TOTP = new(TOTP).Init(g, db, a)
 	return a
 }
 
 // TablePrefix 获取表名前缀
 func (a *Common) TablePrefix() string {
-	prefix := util.T(viper.GetStringMap("mysql")["table_prefix"]).String()
-	if prefix != "" {
-		if prefix[len(prefix)-1] != '_' {
-			prefix += "_"
-		}
-		return prefix
-	}
-	return ""
+	return a.DB.TablePrefix()
 }
 
 // TableName 获取表名
@@ -2,31 +2,31 @@ package mysql
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
 	"moddns/app/models"
 	"moddns/app/schema"
 	"moddns/app/service/mysql"
-	"time"
 
 	"github.com/facebookgo/inject"
-	"github.com/pkg/errors"
 )
 
 // Demo 示例程序
 type Demo struct {
 	DB     *mysql.DB
 	Common *Common
+	repo   *mysql.Repository
 }
 
 // Init 初始化
 func (a *Demo) Init(g *inject.Graph, db *mysql.DB, c *Common) *Demo {
 	a.DB = db
 	a.Common = c
+	a.repo = mysql.NewRepository(db, a.TableName())
 
 	g.Provide(&inject.Object{Value: models.IDemo(a), Name: "IDemo"})
 
 	db.CreateTableIfNotExists(schema.Demo{}, a.TableName())
+	db.CreateTableColumn(a.TableName(), "version", "bigint NOT NULL DEFAULT 1")
+	db.BackfillVersion(a.TableName())
 
 	db.CreateTableIndex(a.TableName(), "idx_record_id", true, "record_id")
 	db.CreateTableIndex(a.TableName(), "idx_code", false, "code")
@@ -43,94 +43,72 @@ func (a *Demo) TableName() string {
 
 // QueryPage 查询分页数据
 func (a *Demo) QueryPage(ctx context.Context, params schema.DemoQueryParam, pageIndex, pageSize uint) (int64, []*schema.DemoQueryResult, error) {
-	var (
-		where = "WHERE deleted=0"
-		args  []interface{}
-	)
-
-	if params.Code != "" {
-		where = fmt.Sprintf("%s AND code LIKE ?", where)
-		args = append(args, "%"+params.Code+"%")
-	}
-
-	if params.Name != "" {
-		where = fmt.Sprintf("%s AND name LIKE ?", where)
-		args = append(args, "%"+params.Name+"%")
-	}
-
-	count, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s %s", a.TableName(), where), args...)
-	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
-	} else if count == 0 {
-		return 0, nil, nil
-	}
+	filter := mysql.NewFilter().
+		Like("code", params.Code).
+		Like("name", params.Name)
 
 	var items []*schema.DemoQueryResult
-	fields := "id,record_id,code,name"
-	_, err = a.DB.Select(&items, fmt.Sprintf("SELECT %s FROM %s %s ORDER BY id DESC LIMIT %d,%d", fields, a.TableName(), where, (pageIndex-1)*pageSize, pageSize), args...)
-	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
-	}
-
-	return count, items, nil
+	count, err := a.repo.QueryPage(ctx, filter, "id DESC", pageIndex, pageSize, &items)
+	return count, items, err
 }
 
 // Get 查询指定数据
 func (a *Demo) Get(ctx context.Context, recordID string) (*schema.Demo, error) {
 	var item schema.Demo
-	fields := "id,record_id,code,name,creator,created,deleted"
-
-	err := a.DB.SelectOne(&item, fmt.Sprintf("SELECT %s FROM %s WHERE deleted=0 AND record_id=?", fields, a.TableName()), recordID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, errors.Wrap(err, "查询指定数据发生错误")
+	if ok, err := a.repo.Get(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
 	return &item, nil
 }
 
 // Check 检查数据是否存在
 func (a *Demo) Check(ctx context.Context, recordID string) (bool, error) {
-	n, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND record_id=?", a.TableName()), recordID)
-	if err != nil {
-		return false, errors.Wrap(err, "检查数据是否存在发生错误")
-	}
-
-	return n > 0, nil
+	return a.repo.Primary().Check(ctx, recordID)
 }
 
 // Create 创建数据
 func (a *Demo) Create(ctx context.Context, item *schema.Demo) error {
-	err := a.DB.Insert(item)
-	if err != nil {
-		return errors.Wrap(err, "创建数据发生错误")
-	}
-	return nil
+	return a.repo.Create(ctx, item)
 }
 
-// Update 更新数据
-func (a *Demo) Update(ctx context.Context, recordID string, info map[string]interface{}) error {
-	if _, ok := info["updated"]; !ok {
-		info["updated"] = time.Now().Unix()
-	}
-
-	_, err := a.DB.UpdateByPK(a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		info)
-	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
-	}
-	return nil
+// Update 更新数据(version大于0时校验版本号)
+func (a *Demo) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	return a.repo.Update(ctx, recordID, info, version)
 }
 
 // Delete 删除数据
 func (a *Demo) Delete(ctx context.Context, recordID string) error {
-	_, err := a.DB.UpdateByPK(a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		return errors.Wrap(err, "删除数据发生错误")
+	_, err := a.repo.Delete(ctx, recordID)
+	return err
+}
+
+// QueryDeletedPage 查询已删除的分页数据
+func (a *Demo) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	var items []*schema.RecycleQueryResult
+	count, err := a.repo.QueryDeletedPage(ctx, "id,record_id,code,name,deleted", pageIndex, pageSize, &items)
+	return count, items, err
+}
+
+// GetDeleted 查询指定的已删除数据
+func (a *Demo) GetDeleted(ctx context.Context, recordID string) (*schema.Demo, error) {
+	var item schema.Demo
+	if ok, err := a.repo.Primary().GetDeleted(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
-	return nil
+	return &item, nil
+}
+
+// Restore 恢复已删除的数据
+func (a *Demo) Restore(ctx context.Context, recordID string, deleted int64) error {
+	return a.repo.Restore(ctx, recordID, deleted, nil)
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Demo) Purge(ctx context.Context, recordID string) error {
+	return a.repo.Purge(ctx, recordID)
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据，返回删除的数据条数
+func (a *Demo) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	return a.repo.PurgeExpired(ctx, before)
 }
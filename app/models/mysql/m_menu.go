@@ -2,13 +2,13 @@ package mysql
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"moddns/app/models"
+	cachemodels "moddns/app/models/cache"
 	"moddns/app/schema"
 	"moddns/app/service/mysql"
 	"moddns/app/util"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/facebookgo/inject"
 	"github.com/pkg/errors"
@@ -18,16 +18,20 @@ import (
 type Menu struct {
 	DB     *mysql.DB
 	Common *Common
+	repo   *mysql.Repository
 }
 
 // Init 初始化
 func (a *Menu) Init(g *inject.Graph, db *mysql.DB, c *Common) *Menu {
 	a.DB = db
 	a.Common = c
+	a.repo = mysql.NewRepository(db, a.TableName())
 
-	g.Provide(&inject.Object{Value: models.IMenu(a), Name: "IMenu"})
+	g.Provide(&inject.Object{Value: cachemodels.NewMenu(a, c.Cache), Name: "IMenu"})
 
 	db.CreateTableIfNotExists(schema.Menu{}, a.TableName())
+	db.CreateTableColumn(a.TableName(), "version", "bigint NOT NULL DEFAULT 1")
+	db.BackfillVersion(a.TableName())
 	db.CreateTableIndex(a.TableName(), "idx_record_id", true, "record_id")
 	db.CreateTableIndex(a.TableName(), "idx_code", false, "code")
 	db.CreateTableIndex(a.TableName(), "idx_name", false, "name")
@@ -37,70 +41,153 @@ func (a *Menu) Init(g *inject.Graph, db *mysql.DB, c *Common) *Menu {
 	db.CreateTableIndex(a.TableName(), "idx_status", false, "status")
 	db.CreateTableIndex(a.TableName(), "idx_deleted", false, "deleted")
 
+	if err := a.migrateLevelCode(); err != nil {
+		panic("转换菜单分级码发生错误：" + err.Error())
+	}
+
+	if err := a.checkLevelCode(); err != nil {
+		panic(err.Error())
+	}
+	db.CreateTableIndex(a.TableName(), "idx_level_code", true, "level_code", "deleted")
+
+	db.CreateTableIfNotExists(menuLevelLock{}, a.LevelLockTableName())
+	db.CreateTableIndex(a.LevelLockTableName(), "idx_parent_id", true, "parent_id")
+
 	return a
 }
 
-// TableName 表名
-func (a *Menu) TableName() string {
-	return a.Common.TableName("menu")
+// levelCodeSize 分级码字段的长度
+const levelCodeSize = 100
+
+// menuLevelLock 分级码分配锁
+type menuLevelLock struct {
+	ID       int64  `db:"id,primarykey,autoincrement"` // 唯一标识(自增ID)
+	ParentID string `db:"parent_id,size:36"`           // 上级菜单内码(顶级菜单为空)
 }
 
-// QueryPage 查询分页数据
-func (a *Menu) QueryPage(ctx context.Context, params schema.MenuQueryParam, pageIndex, pageSize uint) (int64, []*schema.MenuQueryResult, error) {
-	var (
-		where = "WHERE deleted=0"
-		args  []interface{}
-	)
+// checkLevelCode 检查未删除的菜单中是否存在重复的分级码(创建唯一索引之前，多实例并发创建可能产生重复)
+func (a *Menu) checkLevelCode() error {
+	var items []*schema.Menu
+	query := fmt.Sprintf("SELECT level_code FROM %s WHERE deleted=0 GROUP BY level_code HAVING COUNT(*)>1 LIMIT 10", a.TableName())
+	_, err := a.DB.Primary().Select(&items, query)
+	if err != nil {
+		return errors.Wrap(err, "检查菜单分级码发生错误")
+	} else if len(items) == 0 {
+		return nil
+	}
 
-	if v := params.Name; v != "" {
-		where = fmt.Sprintf("%s AND name LIKE ?", where)
-		args = append(args, "%"+v+"%")
+	levelCodes := make([]string, len(items))
+	for i, item := range items {
+		levelCodes[i] = item.LevelCode
 	}
-	if v := params.ParentID; v != "" {
-		where = fmt.Sprintf("%s AND parent_id=?", where)
-		args = append(args, v)
+	return fmt.Errorf("菜单分级码存在重复[%s]，请手动修正重复的分级码后重启", strings.Join(levelCodes, ","))
+}
+
+// migrateLevelCode 扩展分级码字段的长度，分级码位数配置变化时转换已有的分级码(顶级菜单的分级码长度即为原位数)
+func (a *Menu) migrateLevelCode() error {
+	db := a.DB.Primary()
+	size, err := db.ColumnSize(a.TableName(), "level_code")
+	if err != nil {
+		return errors.Wrap(err, "查询分级码字段发生错误")
+	} else if size > 0 && size < levelCodeSize {
+		_, err := a.DB.Exec(a.DB.Dialect().ModifyColumnSQL(a.TableName(), "level_code", fmt.Sprintf("varchar(%d)", levelCodeSize)))
+		if err != nil {
+			return errors.Wrap(err, "扩展分级码字段发生错误")
+		}
 	}
-	if v := params.Status; v > 0 {
-		where = fmt.Sprintf("%s AND status=?", where)
-		args = append(args, v)
+
+	// 转换中断时(如存储引擎不支持事务)，带前缀的分级码为尚未转换的分级码，继续转换这部分分级码
+	var top []*schema.Menu
+	_, err = db.Select(&top, fmt.Sprintf("SELECT level_code FROM %s WHERE parent_id='' AND level_code LIKE '-%%' LIMIT 1", a.TableName()))
+	if err != nil {
+		return errors.Wrap(err, "查询分级码发生错误")
 	}
-	if v := params.Type; v > 0 {
-		where = fmt.Sprintf("%s AND type=?", where)
-		args = append(args, v)
+
+	resume := len(top) > 0
+	where := "level_code LIKE '-%'"
+	if !resume {
+		_, err = db.Select(&top, fmt.Sprintf("SELECT level_code FROM %s WHERE parent_id='' AND level_code<>'' LIMIT 1", a.TableName()))
+		if err != nil {
+			return errors.Wrap(err, "查询分级码发生错误")
+		} else if len(top) == 0 || len(top[0].LevelCode) == util.LevelCodeWidth() {
+			return nil
+		}
+		where = "level_code<>''"
 	}
+	fromWidth := len(strings.TrimPrefix(top[0].LevelCode, "-"))
 
-	count, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s %s", a.TableName(), where), args...)
+	var items []*schema.Menu
+	_, err = db.Select(&items, fmt.Sprintf("SELECT id,level_code FROM %s WHERE %s", a.TableName(), where))
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
-	} else if count == 0 {
-		return 0, nil, nil
+		return errors.Wrap(err, "查询分级码发生错误")
 	}
 
-	var items []*schema.MenuQueryResult
-	fields := "id,record_id,code,name,icon,path,type,sequence,is_hide,status"
-	_, err = a.DB.Select(&items, fmt.Sprintf("SELECT %s FROM %s %s ORDER BY type,sequence,id LIMIT %d,%d", fields, a.TableName(), where, (pageIndex-1)*pageSize, pageSize), args...)
-	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
+	// 顶级菜单最后转换：转换中断后只要存在未转换的分级码，就存在未转换的顶级菜单(用于确定原位数)
+	sort.SliceStable(items, func(i, j int) bool {
+		return len(items[i].LevelCode) > len(items[j].LevelCode)
+	})
+
+	return a.DB.ExecTrans(context.Background(), func(ctx context.Context) error {
+		// 先为全部分级码添加前缀，避免逐条转换时与未转换的分级码冲突(分级码唯一索引)
+		if !resume {
+			_, err := a.DB.WithContext(ctx).Exec(fmt.Sprintf("UPDATE %s SET level_code=%s WHERE level_code<>''", a.TableName(), a.DB.Dialect().Concat("'-'", "level_code")))
+			if err != nil {
+				return errors.Wrap(err, "更新分级码发生错误")
+			}
+		}
+
+		query := fmt.Sprintf("UPDATE %s SET level_code=? WHERE id=?", a.TableName())
+		for _, item := range items {
+			oldCode := strings.TrimPrefix(item.LevelCode, "-")
+			levelCode, ok := util.ConvertLevelCode(oldCode, fromWidth)
+			if !ok {
+				return fmt.Errorf("分级码[%s]无法由%d位转换为%d位", oldCode, fromWidth, util.LevelCodeWidth())
+			}
+
+			_, err := a.DB.WithContext(ctx).Exec(query, levelCode, item.ID)
+			if err != nil {
+				return errors.Wrap(err, "更新分级码发生错误")
+			}
+		}
+		return nil
+	})
+}
+
+// TableName 表名
+func (a *Menu) TableName() string {
+	return a.Common.TableName("menu")
+}
+
+// LevelLockTableName 分级码分配锁表名(每个上级菜单一行，分配分级码时锁定)
+func (a *Menu) LevelLockTableName() string {
+	return a.Common.TableName("menu_level_lock")
+}
+
+// QueryPage 查询分页数据
+func (a *Menu) QueryPage(ctx context.Context, params schema.MenuQueryParam, pageIndex, pageSize uint) (int64, []*schema.MenuQueryResult, error) {
+	filter := mysql.NewFilter().
+		Like("name", params.Name).
+		Equal("parent_id", params.ParentID).
+		Equal("status", params.Status).
+		Equal("type", params.Type)
+
+	order := "type,sequence,id"
+	if params.BeforeID > 0 {
+		filter.Where("id<?", params.BeforeID)
+		order = "id DESC"
 	}
 
-	return count, items, nil
+	var items []*schema.MenuQueryResult
+	count, err := a.repo.QueryPage(ctx, filter, order, pageIndex, pageSize, &items)
+	return count, items, err
 }
 
 // QuerySelect 查询选择数据
 func (a *Menu) QuerySelect(ctx context.Context, params schema.MenuSelectQueryParam) ([]*schema.MenuSelectQueryResult, error) {
-	var (
-		where = "WHERE deleted=0"
-		args  []interface{}
-	)
+	filter := mysql.NewFilter().
+		Like("name", params.Name).
+		Equal("status", params.Status)
 
-	if v := params.Name; v != "" {
-		where = fmt.Sprintf("%s AND name LIKE ?", where)
-		args = append(args, "%"+v+"%")
-	}
-	if v := params.Status; v > 0 {
-		where = fmt.Sprintf("%s AND status=?", where)
-		args = append(args, v)
-	}
 	if v := params.SystemCode; v != "" {
 		menu, err := a.GetByCodeAndType(ctx, v, 10)
 		if err != nil {
@@ -109,60 +196,38 @@ func (a *Menu) QuerySelect(ctx context.Context, params schema.MenuSelectQueryPar
 			return nil, nil
 		}
 
-		where = fmt.Sprintf("%s AND level_code!=? AND level_code LIKE ?", where)
-		args = append(args, menu.LevelCode, menu.LevelCode+"%")
+		filter.Where("level_code!=? AND level_code LIKE ?", menu.LevelCode, menu.LevelCode+"%")
 	}
 
 	if v := params.UserID; v != "" {
-		levelCodes, err := a.QueryLevelCodesByUserID(v)
+		levelCodes, err := a.QueryLevelCodesByUserID(ctx, v)
 		if err != nil {
 			return nil, err
 		} else if len(levelCodes) == 0 {
 			return nil, nil
 		}
 
-		where = fmt.Sprintf("%s AND level_code IN(?)", where)
-		args = append(args, levelCodes)
+		filter.In("level_code", levelCodes)
 	}
 
 	if v := params.RoleID; v != "" {
-		where = fmt.Sprintf("%s AND record_id IN(SELECT menu_id FROM %s WHERE deleted=0 AND role_id=?)", where, a.Common.Role.RoleMenuTableName())
-		args = append(args, v)
-	}
-
-	if v := params.RecordIDs; len(v) > 0 {
-		where = fmt.Sprintf("%s AND record_id IN(?)", where)
-		args = append(args, v)
-	}
-
-	if v := params.Types; len(v) > 0 {
-		where = fmt.Sprintf("%s AND type IN(?)", where)
-		args = append(args, v)
+		filter.Where(fmt.Sprintf("record_id IN(SELECT menu_id FROM %s WHERE deleted=0 AND role_id=?)", a.Common.Role.RoleMenuTableName()), v)
 	}
 
-	if v := params.IsHide; v > 0 {
-		where = fmt.Sprintf("%s AND is_hide=?", where)
-		args = append(args, v)
-	}
+	filter.In("record_id", params.RecordIDs).
+		In("type", params.Types).
+		Equal("is_hide", params.IsHide)
 
 	var items []*schema.MenuSelectQueryResult
-
-	fields := "record_id,code,name,level_code,parent_id,type,icon,path,method"
-	query, args, err := a.DB.In(fmt.Sprintf("SELECT %s FROM %s %s ORDER BY sequence,id", fields, a.TableName(), where), args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "查询选择数据发生错误")
-	}
-
-	_, err = a.DB.Select(&items, query, args...)
+	err := a.repo.Query(ctx, filter, "sequence,id", &items)
 	if err != nil {
-		return nil, errors.Wrap(err, "查询选择数据发生错误")
+		return nil, err
 	}
-
 	return items, nil
 }
 
 // QueryLevelCodesByUserID 查询用户所拥有的菜单权限
-func (a *Menu) QueryLevelCodesByUserID(userID string) ([]string, error) {
+func (a *Menu) QueryLevelCodesByUserID(ctx context.Context, userID string) ([]string, error) {
 	query := fmt.Sprintf("SELECT level_code FROM %s WHERE deleted=0 AND status=1", a.TableName())
 	query = fmt.Sprintf("%s AND record_id IN(SELECT menu_id FROM %s WHERE deleted=0 AND role_id IN(SELECT role_id FROM %s WHERE deleted=0 AND user_id=?))",
 		query,
@@ -171,7 +236,7 @@ func (a *Menu) QueryLevelCodesByUserID(userID string) ([]string, error) {
 	)
 
 	var items []*schema.MenuSelectQueryResult
-	_, err := a.DB.Select(&items, query, userID)
+	_, err := a.DB.WithContext(ctx).Select(&items, query, userID)
 	if err != nil {
 		return nil, errors.Wrap(err, "查询用户所拥有的菜单权限发生错误")
 	}
@@ -184,19 +249,11 @@ func (a *Menu) QueryLevelCodesByUserID(userID string) ([]string, error) {
 	return util.ParseLevelCodes(levelCodes...), nil
 }
 
-func (a *Menu) getAllFields() string {
-	fields := "id,record_id,code,name,type,sequence,icon,path,method,level_code,parent_id,is_hide,status,creator,created,updated,deleted"
-	return fields
-}
-
 // GetByCodeAndType 根据编号和类型查询指定数据
 func (a *Menu) GetByCodeAndType(ctx context.Context, code string, typ int) (*schema.Menu, error) {
 	var item schema.Menu
-
-	fields := a.getAllFields()
-	err := a.DB.SelectOne(&item, fmt.Sprintf("SELECT %s FROM %s WHERE deleted=0 AND code=? AND type=?", fields, a.TableName()), code, typ)
-	if err != nil {
-		return nil, errors.Wrap(err, "根据编号和类型查询指定数据发生错误")
+	if ok, err := a.repo.GetBy(ctx, mysql.NewFilter().Where("code=? AND type=?", code, typ), &item); err != nil || !ok {
+		return nil, err
 	}
 	return &item, nil
 }
@@ -204,126 +261,202 @@ func (a *Menu) GetByCodeAndType(ctx context.Context, code string, typ int) (*sch
 // Get 查询指定数据
 func (a *Menu) Get(ctx context.Context, recordID string) (*schema.Menu, error) {
 	var item schema.Menu
-
-	fields := a.getAllFields()
-	err := a.DB.SelectOne(&item, fmt.Sprintf("SELECT %s FROM %s WHERE deleted=0 AND record_id=?", fields, a.TableName()), recordID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, errors.Wrap(err, "查询指定数据发生错误")
+	if ok, err := a.repo.Get(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
 	return &item, nil
 }
 
 // Check 检查数据是否存在
 func (a *Menu) Check(ctx context.Context, recordID string) (bool, error) {
-	n, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND record_id=?", a.TableName()), recordID)
-	if err != nil {
-		return false, errors.Wrap(err, "检查数据是否存在发生错误")
-	}
-
-	return n > 0, nil
+	return a.repo.Primary().Check(ctx, recordID)
 }
 
 // CheckCode 检查编号是否存在
 func (a *Menu) CheckCode(ctx context.Context, code string, parentID string) (bool, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND code=? AND parent_id=?", a.TableName())
+	return a.repo.Primary().Exists(ctx, mysql.NewFilter().Where("code=? AND parent_id=?", code, parentID))
+}
 
-	n, err := a.DB.SelectInt(query, code, parentID)
+// LockLevelCodesByParentID 锁定上级菜单的分级码分配，并查询上级及下级的分级码(按分级码排序，上级在前)；
+// 必须在事务中调用，同一上级的分配在事务结束前排队等待(多实例部署时同样有效)
+func (a *Menu) LockLevelCodesByParentID(ctx context.Context, parentID string) ([]string, error) {
+	if !mysql.InTrans(ctx) {
+		return nil, errors.New("分配分级码必须在事务中执行")
+	}
+
+	err := a.lockLevel(ctx, parentID)
 	if err != nil {
-		return false, errors.Wrap(err, "检查编号是否存在发生错误")
+		return nil, err
 	}
-	return n > 0, nil
-}
 
-// QueryLevelCodesByParentID 根据父级查询分级码
-func (a *Menu) QueryLevelCodesByParentID(parentID string) ([]string, error) {
-	query := fmt.Sprintf("SELECT level_code FROM %s WHERE deleted=0 AND (parent_id=? OR record_id=?) ORDER BY level_code", a.TableName())
+	// 事务中的普通查询读取事务开始时的快照，可能不包含其它实例刚提交的分级码，
+	// 因此使用锁定读取查询最新提交的数据(上级可能刚被其它实例移动)
+	query := fmt.Sprintf("SELECT record_id,level_code FROM %s WHERE deleted=0 AND (parent_id=? OR record_id=?) FOR UPDATE", a.TableName())
 
 	var items []*schema.Menu
-	_, err := a.DB.Select(&items, query, parentID, parentID)
+	_, err = a.DB.WithContext(ctx).Select(&items, query, parentID, parentID)
 	if err != nil {
 		return nil, errors.Wrap(err, "根据父级查询分级码发生错误")
 	}
 
-	levelCodes := make([]string, len(items))
-	for i, item := range items {
-		levelCodes[i] = item.LevelCode
+	var parentCode string
+	codes := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.RecordID == parentID {
+			parentCode = item.LevelCode
+			continue
+		}
+		codes = append(codes, item.LevelCode)
 	}
+	sort.Strings(codes)
 
-	return levelCodes, nil
-}
+	var levelCodes []string
+	if parentID != "" {
+		if parentCode == "" {
+			return nil, nil
+		}
+		levelCodes = append(levelCodes, parentCode)
+	}
 
-// CheckChild 检查子级是否存在
-func (a *Menu) CheckChild(ctx context.Context, parentID string) (bool, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND parent_id=?", a.TableName())
+	return append(levelCodes, codes...), nil
+}
 
-	n, err := a.DB.SelectInt(query, parentID)
+// lockLevel 在事务中锁定上级菜单的分配锁(锁不存在时在事务中创建)；
+// 先使用普通查询检查锁是否存在，只锁定已存在的行(锁定不存在的行会产生间隙锁，并发创建时互相等待)
+func (a *Menu) lockLevel(ctx context.Context, parentID string) error {
+	db := a.DB.WithContext(ctx)
+	exists, err := db.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE parent_id=?", a.LevelLockTableName()), parentID)
 	if err != nil {
-		return false, errors.Wrap(err, "检查子级是否存在发生错误")
+		return errors.Wrap(err, "锁定分级码分配发生错误")
+	} else if exists == 0 {
+		_, err = db.Exec(a.DB.Dialect().InsertIgnoreSQL(a.LevelLockTableName(), "parent_id"), parentID)
+		if err != nil {
+			return errors.Wrap(err, "锁定分级码分配发生错误")
+		}
 	}
-	return n > 0, nil
-}
 
-// Create 创建数据
-func (a *Menu) Create(ctx context.Context, item *schema.Menu) error {
-	err := a.DB.Insert(item)
+	_, err = db.SelectInt(fmt.Sprintf("SELECT id FROM %s WHERE parent_id=? FOR UPDATE", a.LevelLockTableName()), parentID)
 	if err != nil {
-		return errors.Wrap(err, "创建数据发生错误")
+		return errors.Wrap(err, "锁定分级码分配发生错误")
 	}
 	return nil
 }
 
-// Update 更新数据
-func (a *Menu) Update(ctx context.Context, recordID string, info map[string]interface{}) error {
-	if _, ok := info["updated"]; !ok {
-		info["updated"] = time.Now().Unix()
-	}
-
-	_, err := a.DB.UpdateByPK(a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		info)
+// QueryChildren 查询直接下级(按排序值)
+func (a *Menu) QueryChildren(ctx context.Context, parentID string) ([]*schema.Menu, error) {
+	var items []*schema.Menu
+	err := a.repo.Query(ctx, mysql.NewFilter().Where("parent_id=?", parentID), "sequence,id", &items)
 	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
+		return nil, err
 	}
-	return nil
+	return items, nil
 }
 
-// UpdateWithLevelCode 更新数据
-func (a *Menu) UpdateWithLevelCode(ctx context.Context, recordID string, info map[string]interface{}, oldLevelCode, newLevelCode string) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrapf(err, "更新数据发生错误")
-	}
+// CheckChild 检查子级是否存在
+func (a *Menu) CheckChild(ctx context.Context, parentID string) (bool, error) {
+	return a.repo.Primary().Exists(ctx, mysql.NewFilter().Where("parent_id=?", parentID))
+}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.TableName(), map[string]interface{}{"record_id": recordID}, info)
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrapf(err, "更新数据发生错误")
-	}
+// Create 创建数据
+func (a *Menu) Create(ctx context.Context, item *schema.Menu) error {
+	return a.repo.Create(ctx, item)
+}
 
-	query := fmt.Sprintf("UPDATE %s SET level_code=concat('%s',substr(level_code,%d)) WHERE deleted=0 AND level_code LIKE '%s%%' ORDER BY level_code", a.TableName(), newLevelCode, len(oldLevelCode)+1, oldLevelCode)
-	_, err = tran.Exec(query)
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrapf(err, "更新数据发生错误")
-	}
+// Update 更新数据(version大于0时校验版本号)
+func (a *Menu) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	return a.repo.Update(ctx, recordID, info, version)
+}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrapf(err, "更新数据提交事物发生错误")
-	}
-	return nil
+// UpdateWithLevelCode 更新数据(version大于0时校验版本号)，同时更新下级的分级码；
+// 新上级的分级码分配由调用方锁定，此处锁定原上级及菜单自身(下级的分级码随之变化)的分级码分配
+func (a *Menu) UpdateWithLevelCode(ctx context.Context, recordID string, info map[string]interface{}, oldLevelCode, newLevelCode string, version int64) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		var items []*schema.Menu
+		_, err := a.DB.WithContext(ctx).Select(&items, fmt.Sprintf("SELECT parent_id FROM %s WHERE deleted=0 AND record_id=?", a.TableName()), recordID)
+		if err != nil {
+			return errors.Wrap(err, "查询数据发生错误")
+		}
+
+		for _, item := range items {
+			if err := a.lockLevel(ctx, item.ParentID); err != nil {
+				return err
+			}
+		}
+		if err := a.lockLevel(ctx, recordID); err != nil {
+			return err
+		}
+
+		err = a.repo.Update(ctx, recordID, info, version)
+		if err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("UPDATE %s SET level_code=%s WHERE deleted=0 AND level_code LIKE ?",
+			a.TableName(), a.DB.Dialect().Concat("?", "substr(level_code,?)"))
+		_, err = a.DB.WithContext(ctx).Exec(query, newLevelCode, len(oldLevelCode)+1, oldLevelCode+"%")
+		if err != nil {
+			return errors.Wrapf(err, "更新数据发生错误")
+		}
+		return nil
+	})
 }
 
 // Delete 删除数据
 func (a *Menu) Delete(ctx context.Context, recordID string) error {
-	_, err := a.DB.UpdateByPK(a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		return errors.Wrap(err, "删除数据发生错误")
+	_, err := a.repo.Delete(ctx, recordID)
+	return err
+}
+
+// QueryDeletedPage 查询已删除的分页数据
+func (a *Menu) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	var items []*schema.RecycleQueryResult
+	count, err := a.repo.QueryDeletedPage(ctx, "id,record_id,code,name,deleted", pageIndex, pageSize, &items)
+	return count, items, err
+}
+
+// GetDeleted 查询指定的已删除数据
+func (a *Menu) GetDeleted(ctx context.Context, recordID string) (*schema.Menu, error) {
+	var item schema.Menu
+	if ok, err := a.repo.Primary().GetDeleted(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
-	return nil
+	return &item, nil
+}
+
+// Restore 恢复已删除的数据，levelCode为恢复后的分级码
+func (a *Menu) Restore(ctx context.Context, recordID string, deleted int64, levelCode string) error {
+	return a.repo.Restore(ctx, recordID, deleted, map[string]interface{}{"level_code": levelCode})
+}
+
+// Purge 彻底删除已删除的数据(同时删除角色菜单中的授权)
+func (a *Menu) Purge(ctx context.Context, recordID string) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Purge(ctx, recordID)
+		if err != nil {
+			return err
+		}
+
+		_, err = a.DB.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE menu_id=?", a.Common.Role.RoleMenuTableName()), recordID)
+		if err != nil {
+			return errors.Wrap(err, "彻底删除数据发生错误")
+		}
+		return nil
+	})
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据，返回删除的数据条数
+func (a *Menu) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	var n int64
+	err := a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		query := fmt.Sprintf("DELETE FROM %s WHERE menu_id IN(SELECT record_id FROM %s WHERE deleted<>0 AND deleted<?)",
+			a.Common.Role.RoleMenuTableName(), a.TableName())
+		_, err := a.DB.WithContext(ctx).Exec(query, before)
+		if err != nil {
+			return errors.Wrap(err, "清理已删除数据发生错误")
+		}
+
+		n, err = a.repo.PurgeExpired(ctx, before)
+		return err
+	})
+	return n, err
 }
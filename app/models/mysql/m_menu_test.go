@@ -0,0 +1,298 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/cache"
+	"moddns/app/service/mysql"
+	"moddns/app/util"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/facebookgo/inject"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// allocateMenu 与菜单业务一致地分配分级码：在事务中锁定上级的分级码分配，
+// parentID为空时分配顶级菜单的分级码
+func allocateMenu(ctx context.Context, menu models.IMenu, parentID string) (string, error) {
+	levelCodes, err := menu.LockLevelCodesByParentID(ctx, parentID)
+	if err != nil {
+		return "", err
+	}
+
+	var parentCode string
+	if parentID != "" {
+		if len(levelCodes) == 0 {
+			return "", errors.New("上级菜单不存在")
+		}
+		parentCode, levelCodes = levelCodes[0], levelCodes[1:]
+	}
+
+	levelCode := util.GetLevelCode(parentCode, levelCodes)
+	if levelCode == "" {
+		return "", errors.New("同级菜单数量已达到分级码位数的上限")
+	}
+	return levelCode, nil
+}
+
+// createMenu 在事务中分配分级码并创建菜单
+func createMenu(ctx context.Context, common *Common, item *schema.Menu) error {
+	return common.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		levelCode, err := allocateMenu(ctx, common.Menu, item.ParentID)
+		if err != nil {
+			return err
+		}
+
+		item.RecordID = uuid.New().String()
+		item.LevelCode = levelCode
+		item.Name, item.Type, item.Status, item.IsHide, item.Version = item.Code, 20, 1, 2, 1
+		return common.Menu.Create(ctx, item)
+	})
+}
+
+// moveMenu 在事务中为新上级分配分级码并移动菜单
+func moveMenu(ctx context.Context, common *Common, recordID, parentID string) error {
+	item, err := common.Menu.Get(ctx, recordID)
+	if err != nil {
+		return err
+	}
+
+	return common.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		levelCode, err := allocateMenu(ctx, common.Menu, parentID)
+		if err != nil {
+			return err
+		}
+		return common.Menu.UpdateWithLevelCode(ctx, recordID, map[string]interface{}{"parent_id": parentID}, item.LevelCode, levelCode, item.Version)
+	})
+}
+
+// checkMenuLevelCodes 检查未删除的菜单数量，以及分级码不重复且与上级的分级码一致
+func checkMenuLevelCodes(t *testing.T, common *Common, count int) {
+	var items []*schema.Menu
+	_, err := common.DB.Select(&items, fmt.Sprintf("SELECT record_id,parent_id,level_code FROM %s WHERE deleted=0", common.Menu.TableName()))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(items) != count {
+		t.Fatalf("菜单数量应为%d，实际为%d", count, len(items))
+	}
+
+	codes := make(map[string]string, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if seen[item.LevelCode] {
+			t.Errorf("分级码重复：%s", item.LevelCode)
+		}
+		seen[item.LevelCode] = true
+		codes[item.RecordID] = item.LevelCode
+	}
+
+	for _, item := range items {
+		parentCode := codes[item.ParentID]
+		if len(item.LevelCode) != len(parentCode)+util.LevelCodeWidth() || !strings.HasPrefix(item.LevelCode, parentCode) {
+			t.Errorf("菜单的分级码[%s]与上级的分级码[%s]不一致", item.LevelCode, parentCode)
+		}
+	}
+}
+
+// TestMenuLevelCodeConcurrent 多个实例(独立的数据库连接)并发创建菜单时分配的分级码不重复
+func TestMenuLevelCodeConcurrent(t *testing.T) {
+	common, clean := newTestCommon(t, "test_level_")
+	defer clean()
+
+	const instances, workers, count = 4, 8, 5
+	commons := []*Common{common}
+	for i := 1; i < instances; i++ {
+		db, err := mysql.NewDB(mysql.SetDSN(testDSN()), mysql.SetTablePrefix("test_level_"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		commons = append(commons, new(Common).Init(new(inject.Graph), db, cache.New(nil, 0)))
+	}
+
+	ctx := context.Background()
+	parent := &schema.Menu{Code: "parent"}
+	if err := createMenu(ctx, common, parent); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, instances*workers*count)
+	for i, c := range commons {
+		for j := 0; j < workers; j++ {
+			wg.Add(1)
+			go func(c *Common, i, j int) {
+				defer wg.Done()
+				for k := 0; k < count; k++ {
+					parentID := parent.RecordID
+					if k%2 == 1 {
+						parentID = "" // 同时并发创建顶级菜单
+					}
+					item := &schema.Menu{Code: fmt.Sprintf("m_%d_%d_%d", i, j, k), ParentID: parentID}
+					if err := createMenu(ctx, c, item); err != nil {
+						errs <- err
+					}
+				}
+			}(c, i, j)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("并发创建菜单发生错误：%s", err.Error())
+	}
+	checkMenuLevelCodes(t, common, instances*workers*count+1)
+}
+
+// TestMenuMoveConcurrent 移动菜单的同时在原上级及菜单自身下并发创建菜单，分级码不重复且与上级一致
+func TestMenuMoveConcurrent(t *testing.T) {
+	common, clean := newTestCommon(t, "test_move_")
+	defer clean()
+
+	ctx := context.Background()
+	from, to, moved := &schema.Menu{Code: "from"}, &schema.Menu{Code: "to"}, &schema.Menu{Code: "moved"}
+	for _, item := range []*schema.Menu{from, to} {
+		if err := createMenu(ctx, common, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	moved.ParentID = from.RecordID
+	if err := createMenu(ctx, common, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, count, moves = 4, 10, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*workers*count+moves)
+	for _, parentID := range []string{from.RecordID, moved.RecordID} {
+		for j := 0; j < workers; j++ {
+			wg.Add(1)
+			go func(parentID string) {
+				defer wg.Done()
+				for k := 0; k < count; k++ {
+					if err := createMenu(ctx, common, &schema.Menu{Code: uuid.New().String(), ParentID: parentID}); err != nil {
+						errs <- err
+					}
+				}
+			}(parentID)
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for k := 0; k < moves; k++ {
+			parentID := to.RecordID
+			if k%2 == 1 {
+				parentID = from.RecordID
+			}
+			if err := moveMenu(ctx, common, moved.RecordID, parentID); err != nil {
+				errs <- err
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("并发移动菜单发生错误：%s", err.Error())
+	}
+	checkMenuLevelCodes(t, common, 3+2*workers*count)
+}
+
+// testDSN 测试库的连接串，可通过环境变量MYSQL_TEST_DSN指定
+func testDSN() string {
+	if dsn := os.Getenv("MYSQL_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+	return "root:123456@tcp(127.0.0.1:3306)/myapp_test?charset=utf8"
+}
+
+// newTestCommon 使用指定的表名前缀初始化存储模块，返回清理测试表的函数
+func newTestCommon(t *testing.T, tablePrefix string) (*Common, func()) {
+	db, err := mysql.NewDB(mysql.SetDSN(testDSN()), mysql.SetTablePrefix(tablePrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	common := new(Common).Init(new(inject.Graph), db, cache.New(nil, 0))
+	return common, func() {
+		for _, name := range []string{"menu", "menu_level_lock", "role", "role_menu", "user", "user_role", "user_totp", "demo"} {
+			db.Exec("DROP TABLE IF EXISTS " + common.TableName(name))
+		}
+		db.Close()
+	}
+}
+
+// TestMenuMigrateLevelCode 分级码位数由2位改为3位，转换中断(已添加前缀或已转换部分分级码)后重新转换的结果一致，重复转换不产生变化
+func TestMenuMigrateLevelCode(t *testing.T) {
+	common, clean := newTestCommon(t, "test_migrate_")
+	defer clean()
+	defer util.SetLevelCodeWidth(util.LevelCodeWidth())
+
+	menus := []*schema.Menu{
+		{RecordID: "a", Code: "a", LevelCode: "01"},
+		{RecordID: "a1", Code: "a1", LevelCode: "0101", ParentID: "a"},
+		{RecordID: "a11", Code: "a11", LevelCode: "010101", ParentID: "a1"},
+		{RecordID: "b", Code: "b", LevelCode: "02"},
+		{RecordID: "b1", Code: "b1", LevelCode: "020z", ParentID: "b"},
+	}
+	expected := map[string]string{"a": "001", "a1": "001001", "a11": "001001001", "b": "002", "b1": "00200z"}
+
+	cases := []struct {
+		name      string
+		converted map[string]string // 中断前已转换的分级码
+	}{
+		{"未中断", nil},
+		{"添加前缀后中断", map[string]string{}},
+		{"转换部分下级后中断", map[string]string{"a11": "001001001", "b1": "00200z"}},
+		{"转换部分顶级后中断", map[string]string{"a11": "001001001", "a1": "001001", "b1": "00200z", "a": "001"}},
+	}
+
+	ctx := context.Background()
+	menu := common.Menu
+	query := fmt.Sprintf("SELECT record_id,level_code FROM %s", menu.TableName())
+	for _, c := range cases {
+		util.SetLevelCodeWidth(2)
+		menu.DB.Exec("DELETE FROM " + menu.TableName())
+		for _, item := range menus {
+			item := *item
+			item.Name, item.Type, item.Status, item.IsHide = item.Code, 10, 1, 2
+			if err := menu.Create(ctx, &item); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// 模拟转换中断：已为全部分级码添加前缀，部分分级码已转换
+		if c.converted != nil {
+			menu.DB.Exec(fmt.Sprintf("UPDATE %s SET level_code=%s", menu.TableName(), menu.DB.Dialect().Concat("'-'", "level_code")))
+			for recordID, levelCode := range c.converted {
+				menu.DB.Exec(fmt.Sprintf("UPDATE %s SET level_code=? WHERE record_id=?", menu.TableName()), levelCode, recordID)
+			}
+		}
+
+		util.SetLevelCodeWidth(3)
+		for i := 0; i < 2; i++ {
+			if err := menu.migrateLevelCode(); err != nil {
+				t.Fatalf("%s：%s", c.name, err.Error())
+			}
+
+			var items []*schema.Menu
+			if _, err := menu.DB.Select(&items, query); err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range items {
+				if item.LevelCode != expected[item.RecordID] {
+					t.Errorf("%s(第%d次转换)：菜单[%s]的分级码应为[%s]，实际为[%s]", c.name, i+1, item.RecordID, expected[item.RecordID], item.LevelCode)
+				}
+			}
+		}
+	}
+}
@@ -2,11 +2,11 @@ package mysql
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"moddns/app/models"
+	cachemodels "moddns/app/models/cache"
 	"moddns/app/schema"
 	"moddns/app/service/mysql"
+	"moddns/app/util"
 	"time"
 
 	"github.com/facebookgo/inject"
@@ -17,16 +17,21 @@ import (
 type Role struct {
 	DB     *mysql.DB
 	Common *Common
+	repo   *mysql.Repository
 }
 
 // Init 初始化
 func (a *Role) Init(g *inject.Graph, db *mysql.DB, c *Common) *Role {
 	a.DB = db
 	a.Common = c
+	a.repo = mysql.NewRepository(db, a.TableName())
 
-	g.Provide(&inject.Object{Value: models.IRole(a), Name: "IRole"})
+	g.Provide(&inject.Object{Value: cachemodels.NewRole(a, c.Cache), Name: "IRole"})
 
 	db.CreateTableIfNotExists(schema.Role{}, a.TableName())
+	db.CreateTableColumn(a.TableName(), "version", "bigint NOT NULL DEFAULT 1")
+	db.BackfillVersion(a.TableName())
+	db.CreateTableColumn(a.TableName(), "require_2fa", "integer NOT NULL DEFAULT 2")
 	db.CreateTableIfNotExists(schema.RoleMenu{}, a.RoleMenuTableName())
 
 	db.CreateTableIndex(a.TableName(), "idx_record_id", true, "record_id")
@@ -51,70 +56,30 @@ func (a *Role) RoleMenuTableName() string {
 
 // QueryPage 查询分页数据
 func (a *Role) QueryPage(ctx context.Context, params schema.RoleQueryParam, pageIndex, pageSize uint) (int64, []*schema.RoleQueryResult, error) {
-	var (
-		where = "WHERE deleted=0"
-		args  []interface{}
-	)
-
-	if params.Name != "" {
-		where = fmt.Sprintf("%s AND name LIKE ?", where)
-		args = append(args, "%"+params.Name+"%")
-	}
-
-	if params.Status != 0 {
-		where = fmt.Sprintf("%s AND status = ?", where)
-		args = append(args, params.Status)
-	}
-
-	count, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s %s", a.TableName(), where), args...)
-	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
-	} else if count == 0 {
-		return 0, nil, nil
+	filter := mysql.NewFilter().
+		Like("name", params.Name).
+		Equal("status", params.Status)
+	if params.BeforeID > 0 {
+		filter.Where("id<?", params.BeforeID)
 	}
 
 	var items []*schema.RoleQueryResult
-	fields := "id,record_id,name,memo,status"
-	_, err = a.DB.Select(&items, fmt.Sprintf("SELECT %s FROM %s %s ORDER BY id DESC LIMIT %d,%d", fields, a.TableName(), where, (pageIndex-1)*pageSize, pageSize), args...)
-	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
-	}
-
-	return count, items, nil
+	count, err := a.repo.QueryPage(ctx, filter, "id DESC", pageIndex, pageSize, &items)
+	return count, items, err
 }
 
 // QuerySelect 查询选择数据
 func (a *Role) QuerySelect(ctx context.Context, params schema.RoleSelectQueryParam) ([]*schema.RoleSelectQueryResult, error) {
-	var (
-		where = "WHERE deleted=0"
-		args  []interface{}
-	)
-
-	if params.Name != "" {
-		where = fmt.Sprintf("%s AND name LIKE ?", where)
-		args = append(args, "%"+params.Name+"%")
-	}
-
-	if params.Status != 0 {
-		where = fmt.Sprintf("%s AND status = ?", where)
-		args = append(args, params.Status)
-	}
-
-	if len(params.RecordIDs) > 0 {
-		where = fmt.Sprintf("%s AND record_id IN(?)", where)
-		args = append(args, params.RecordIDs)
-	}
-
-	query := fmt.Sprintf("SELECT record_id,name FROM %s %s", a.TableName(), where)
-	query, args, err := a.DB.In(query, args...)
-	if err != nil {
-		return nil, errors.Wrap(err, "查询选择数据发生错误")
-	}
+	filter := mysql.NewFilter().
+		Like("name", params.Name).
+		Equal("status", params.Status).
+		Equal("require_2fa", params.Require2FA).
+		In("record_id", params.RecordIDs)
 
 	var items []*schema.RoleSelectQueryResult
-	_, err = a.DB.Select(&items, query, args...)
+	err := a.repo.Query(ctx, filter, "", &items)
 	if err != nil {
-		return nil, errors.Wrap(err, "查询选择数据发生错误")
+		return nil, err
 	}
 	return items, nil
 }
@@ -122,14 +87,8 @@ func (a *Role) QuerySelect(ctx context.Context, params schema.RoleSelectQueryPar
 // Get 查询指定数据
 func (a *Role) Get(ctx context.Context, recordID string, includeMenuIDs bool) (*schema.Role, error) {
 	var item schema.Role
-	fields := "id,record_id,name,memo,status,creator,created,deleted"
-
-	err := a.DB.SelectOne(&item, fmt.Sprintf("SELECT %s FROM %s WHERE deleted=0 AND record_id=?", fields, a.TableName()), recordID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, errors.Wrap(err, "查询指定数据发生错误")
+	if ok, err := a.repo.Get(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
 
 	if includeMenuIDs {
@@ -148,7 +107,7 @@ func (a *Role) QueryMenuIDs(ctx context.Context, roleID string) ([]string, error
 	query := fmt.Sprintf("SELECT menu_id FROM %s WHERE deleted=0 AND role_id=?", a.RoleMenuTableName())
 
 	var items []*schema.RoleMenu
-	_, err := a.DB.Select(&items, query, roleID)
+	_, err := a.DB.WithContext(ctx).Select(&items, query, roleID)
 	if err != nil {
 		return nil, errors.Wrap(err, "查询角色菜单发生错误")
 	}
@@ -161,142 +120,235 @@ func (a *Role) QueryMenuIDs(ctx context.Context, roleID string) ([]string, error
 	return menuIDs, nil
 }
 
-// Check 检查数据是否存在
-func (a *Role) Check(ctx context.Context, recordID string) (bool, error) {
-	n, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND record_id=?", a.TableName()), recordID)
-	if err != nil {
-		return false, errors.Wrap(err, "检查数据是否存在发生错误")
-	}
-
-	return n > 0, nil
-}
+// QueryRoleMenus 查询角色菜单
+func (a *Role) QueryRoleMenus(ctx context.Context, params schema.RoleMenuQueryParam) ([]*schema.RoleMenu, error) {
+	var (
+		where = "WHERE deleted=0"
+		args  []interface{}
+	)
 
-// CheckName 检查名称
-func (a *Role) CheckName(ctx context.Context, name string) (bool, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND name=?", a.TableName())
-	n, err := a.DB.SelectInt(query, name)
-	if err != nil {
-		return false, errors.Wrap(err, "检查名称发生错误")
+	if len(params.RoleIDs) > 0 {
+		where = fmt.Sprintf("%s AND role_id IN(?)", where)
+		args = append(args, params.RoleIDs)
 	}
-	return n > 0, nil
-}
 
-// Create 创建数据
-func (a *Role) Create(ctx context.Context, item *schema.Role) error {
-	tran, err := a.DB.Begin()
+	db := a.DB.WithContext(ctx)
+	query, args, err := db.In(fmt.Sprintf("SELECT role_id,menu_id FROM %s %s", a.RoleMenuTableName(), where), args...)
 	if err != nil {
-		return errors.Wrap(err, "创建数据发生错误")
+		return nil, errors.Wrap(err, "查询角色菜单发生错误")
 	}
 
-	err = tran.Insert(item)
+	var items []*schema.RoleMenu
+	_, err = db.Select(&items, query, args...)
 	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "创建数据发生错误")
+		return nil, errors.Wrap(err, "查询角色菜单发生错误")
 	}
+	return items, nil
+}
 
-	for _, menuID := range item.MenuIDs {
-		roleMenuItem := &schema.RoleMenu{
-			RoleID: item.RecordID,
-			MenuID: menuID,
-		}
-		err = tran.Insert(roleMenuItem)
-		if err != nil {
-			tran.Rollback()
-			return errors.Wrap(err, "创建数据发生错误")
-		}
+// QueryMenuIDsByRoleIDs 批量查询角色的菜单内码，返回角色内码与菜单内码列表的对应关系
+func (a *Role) QueryMenuIDsByRoleIDs(ctx context.Context, roleIDs []string) (map[string][]string, error) {
+	menuIDs := make(map[string][]string, len(roleIDs))
+	if len(roleIDs) == 0 {
+		return menuIDs, nil
 	}
 
-	err = tran.Commit()
+	items, err := a.QueryRoleMenus(ctx, schema.RoleMenuQueryParam{RoleIDs: roleIDs})
 	if err != nil {
-		return errors.Wrap(err, "创建数据发生错误")
+		return nil, err
 	}
-	return nil
-}
 
-// Update 更新数据
-func (a *Role) Update(ctx context.Context, recordID string, info map[string]interface{}) error {
-	if _, ok := info["updated"]; !ok {
-		info["updated"] = time.Now().Unix()
+	for _, item := range items {
+		menuIDs[item.RoleID] = append(menuIDs[item.RoleID], item.MenuID)
 	}
-
-	_, err := a.DB.UpdateByPK(a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		info)
-	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
-	}
-	return nil
+	return menuIDs, nil
 }
 
-// UpdateWithMenuIDs 更新数据
-func (a *Role) UpdateWithMenuIDs(ctx context.Context, recordID string, info map[string]interface{}, menuIDs []string) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
+// QueryNamesByIDs 批量查询角色名称，返回角色内码与名称的对应关系
+func (a *Role) QueryNamesByIDs(ctx context.Context, recordIDs []string) (map[string]string, error) {
+	names := make(map[string]string, len(recordIDs))
+	if len(recordIDs) == 0 {
+		return names, nil
 	}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		info)
+	items, err := a.QuerySelect(ctx, schema.RoleSelectQueryParam{RecordIDs: recordIDs})
 	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "更新数据发生错误")
+		return nil, err
 	}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.RoleMenuTableName(),
-		map[string]interface{}{"role_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "更新数据发生错误")
+	for _, item := range items {
+		names[item.RecordID] = item.Name
 	}
+	return names, nil
+}
 
-	for _, menuID := range menuIDs {
-		roleMenuItem := &schema.RoleMenu{
-			RoleID: recordID,
-			MenuID: menuID,
+// Check 检查数据是否存在
+func (a *Role) Check(ctx context.Context, recordID string) (bool, error) {
+	return a.repo.Primary().Check(ctx, recordID)
+}
+
+// CheckName 检查名称
+func (a *Role) CheckName(ctx context.Context, name string) (bool, error) {
+	return a.repo.Primary().Exists(ctx, mysql.NewFilter().Where("name=?", name))
+}
+
+// Create 创建数据
+func (a *Role) Create(ctx context.Context, item *schema.Role) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Create(ctx, item)
+		if err != nil {
+			return err
+		}
+
+		for _, menuID := range item.MenuIDs {
+			roleMenuItem := &schema.RoleMenu{
+				RoleID: item.RecordID,
+				MenuID: menuID,
+			}
+			err = a.DB.WithContext(ctx).Insert(roleMenuItem)
+			if err != nil {
+				return errors.Wrap(err, "创建数据发生错误")
+			}
 		}
-		err = tran.Insert(roleMenuItem)
+		return nil
+	})
+}
+
+// Update 更新数据(version大于0时校验版本号)
+func (a *Role) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	return a.repo.Update(ctx, recordID, info, version)
+}
+
+// UpdateWithMenuIDs 更新数据(version大于0时校验版本号)，仅删除移除的角色菜单并新增增加的角色菜单
+func (a *Role) UpdateWithMenuIDs(ctx context.Context, recordID string, info map[string]interface{}, menuIDs []string, version int64) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Update(ctx, recordID, info, version)
 		if err != nil {
-			tran.Rollback()
-			return errors.Wrap(err, "创建数据发生错误")
+			return err
 		}
-	}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
-	}
-	return nil
+		// 在事务中(主库)锁定并读取当前的角色菜单，避免读取到副本的延迟数据或与并发的更新交错
+		db := a.DB.WithContext(ctx)
+		var oldMenuIDs []string
+		_, err = db.Select(&oldMenuIDs, fmt.Sprintf("SELECT menu_id FROM %s WHERE deleted=0 AND role_id=? FOR UPDATE", a.RoleMenuTableName()), recordID)
+		if err != nil {
+			return errors.Wrap(err, "查询角色菜单发生错误")
+		}
+		addMenuIDs, delMenuIDs := util.DiffStrings(oldMenuIDs, menuIDs)
+
+		if len(delMenuIDs) > 0 {
+			query, args, err := db.In(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND role_id=? AND menu_id IN(?)", a.RoleMenuTableName()),
+				time.Now().Unix(), recordID, delMenuIDs)
+			if err != nil {
+				return errors.Wrap(err, "更新数据发生错误")
+			}
+
+			_, err = db.Exec(query, args...)
+			if err != nil {
+				return errors.Wrap(err, "更新数据发生错误")
+			}
+		}
+
+		for _, menuID := range addMenuIDs {
+			roleMenuItem := &schema.RoleMenu{
+				RoleID: recordID,
+				MenuID: menuID,
+			}
+			err = db.Insert(roleMenuItem)
+			if err != nil {
+				return errors.Wrap(err, "创建数据发生错误")
+			}
+		}
+		return nil
+	})
 }
 
 // Delete 删除数据
 func (a *Role) Delete(ctx context.Context, recordID string) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrap(err, "删除数据发生错误")
-	}
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		// 角色及角色菜单使用相同的删除时间戳，以便从回收站恢复
+		deleted, err := a.repo.Delete(ctx, recordID)
+		if err != nil {
+			return err
+		}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "删除数据发生错误")
-	}
+		_, err = a.DB.WithContext(ctx).UpdateByPK(a.RoleMenuTableName(),
+			map[string]interface{}{"role_id": recordID, "deleted": 0},
+			map[string]interface{}{"deleted": deleted})
+		if err != nil {
+			return errors.Wrap(err, "删除数据发生错误")
+		}
+		return nil
+	})
+}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.RoleMenuTableName(),
-		map[string]interface{}{"role_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "删除数据发生错误")
-	}
+// QueryDeletedPage 查询已删除的分页数据
+func (a *Role) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	var items []*schema.RecycleQueryResult
+	count, err := a.repo.QueryDeletedPage(ctx, "id,record_id,'' AS code,name,deleted", pageIndex, pageSize, &items)
+	return count, items, err
+}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrap(err, "删除数据发生错误")
+// GetDeleted 查询指定的已删除数据
+func (a *Role) GetDeleted(ctx context.Context, recordID string) (*schema.Role, error) {
+	var item schema.Role
+	if ok, err := a.repo.Primary().GetDeleted(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
+	return &item, nil
+}
+
+// Restore 恢复已删除的数据(同时恢复一并删除且菜单仍然存在的角色菜单)
+func (a *Role) Restore(ctx context.Context, recordID string, deleted int64) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Restore(ctx, recordID, deleted, nil)
+		if err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("UPDATE %s SET deleted=0 WHERE role_id=? AND deleted=? AND menu_id IN(SELECT record_id FROM %s WHERE deleted=0)",
+			a.RoleMenuTableName(), a.Common.Menu.TableName())
+		_, err = a.DB.WithContext(ctx).Exec(query, recordID, deleted)
+		if err != nil {
+			return errors.Wrap(err, "恢复数据发生错误")
+		}
+		return nil
+	})
+}
+
+// Purge 彻底删除已删除的数据
+func (a *Role) Purge(ctx context.Context, recordID string) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Purge(ctx, recordID)
+		if err != nil {
+			return err
+		}
+
+		db := a.DB.WithContext(ctx)
+		_, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE role_id=?", a.RoleMenuTableName()), recordID)
+		if err != nil {
+			return errors.Wrap(err, "彻底删除数据发生错误")
+		}
+
+		_, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted<>0 AND role_id=?", a.Common.User.UserRoleTableName()), recordID)
+		if err != nil {
+			return errors.Wrap(err, "彻底删除数据发生错误")
+		}
+		return nil
+	})
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据，返回删除的数据条数
+func (a *Role) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	var n int64
+	err := a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		_, err := a.DB.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted<>0 AND deleted<?", a.RoleMenuTableName()), before)
+		if err != nil {
+			return errors.Wrap(err, "清理已删除数据发生错误")
+		}
 
-	return nil
+		n, err = a.repo.PurgeExpired(ctx, before)
+		return err
+	})
+	return n, err
 }
@@ -0,0 +1,133 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"moddns/app/models"
+	"moddns/app/schema"
+	"moddns/app/service/mysql"
+	"strings"
+	"time"
+
+	"github.com/facebookgo/inject"
+	"github.com/pkg/errors"
+)
+
+// TOTP 用户两步验证管理
+type TOTP struct {
+	DB     *mysql.DB
+	Common *Common
+}
+
+// Init 初始化
+func (a *TOTP) Init(g *inject.Graph, db *mysql.DB, c *Common) *TOTP {
+	// 两步验证的状态不能容忍副本延迟(如启用后立即登录)，读取使用主库
+	a.DB = db.Primary()
+	a.Common = c
+
+	g.Provide(&inject.Object{Value: models.ITOTP(a), Name: "ITOTP"})
+
+	db.CreateTableIfNotExists(schema.UserTOTP{}, a.TableName())
+	db.CreateTableIndex(a.TableName(), "idx_user_id", true, "user_id")
+	db.CreateTableColumn(a.TableName(), "failures", "integer NOT NULL DEFAULT 0")
+	db.CreateTableColumn(a.TableName(), "locked_until", "bigint NOT NULL DEFAULT 0")
+
+	return a
+}
+
+// TableName 表名
+func (a *TOTP) TableName() string {
+	return a.Common.TableName("user_totp")
+}
+
+// Get 查询用户的两步验证设置
+func (a *TOTP) Get(ctx context.Context, userID string) (*schema.UserTOTP, error) {
+	var item schema.UserTOTP
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id=?", strings.Join(mysql.Columns(&item), ","), a.TableName())
+	err := a.DB.WithContext(ctx).SelectOne(&item, query, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "查询两步验证设置发生错误")
+	}
+	return &item, nil
+}
+
+// Save 保存用户的两步验证设置
+func (a *TOTP) Save(ctx context.Context, item *schema.UserTOTP) error {
+	now := time.Now().Unix()
+	query := a.DB.Dialect().UpsertSQL(a.TableName(), []string{"user_id"},
+		[]string{"user_id", "secret", "status", "recovery_codes", "last_step", "created", "updated"},
+		[]string{"secret", "status", "recovery_codes", "last_step", "updated"})
+	_, err := a.DB.WithContext(ctx).Exec(query, item.UserID, item.Secret, item.Status,
+		item.RecoveryCodes, item.LastStep, now, now)
+	if err != nil {
+		return errors.Wrap(err, "保存两步验证设置发生错误")
+	}
+	return nil
+}
+
+// UpdateLastStep 更新最后验证通过的时间步
+func (a *TOTP) UpdateLastStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET last_step=?,updated=? WHERE user_id=? AND last_step<?", a.TableName())
+	result, err := a.DB.WithContext(ctx).Exec(query, step, time.Now().Unix(), userID, step)
+	if err != nil {
+		return false, errors.Wrap(err, "更新两步验证设置发生错误")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "更新两步验证设置发生错误")
+	}
+	return n > 0, nil
+}
+
+// UpdateRecoveryCodes 更新未使用的恢复码
+func (a *TOTP) UpdateRecoveryCodes(ctx context.Context, userID, oldCodes, newCodes string) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET recovery_codes=?,updated=? WHERE user_id=? AND recovery_codes=?", a.TableName())
+	result, err := a.DB.WithContext(ctx).Exec(query, newCodes, time.Now().Unix(), userID, oldCodes)
+	if err != nil {
+		return false, errors.Wrap(err, "更新两步验证设置发生错误")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "更新两步验证设置发生错误")
+	}
+	return n > 0, nil
+}
+
+// AddFailure 增加连续验证失败的次数(在同一语句中计数，并发失败时不会少计)，
+// 达到最大次数时锁定并重新计数
+func (a *TOTP) AddFailure(ctx context.Context, userID string, maxFailures int, lockedUntil int64) error {
+	// 赋值表达式中的failures均为更新前的值(MySQL按顺序赋值，因此locked_until在failures之前赋值)
+	query := fmt.Sprintf("UPDATE %s SET locked_until=CASE WHEN failures+1>=? THEN ? ELSE locked_until END,"+
+		"failures=CASE WHEN failures+1>=? THEN 0 ELSE failures+1 END,updated=? WHERE user_id=?", a.TableName())
+	_, err := a.DB.WithContext(ctx).Exec(query, maxFailures, lockedUntil, maxFailures, time.Now().Unix(), userID)
+	if err != nil {
+		return errors.Wrap(err, "更新两步验证设置发生错误")
+	}
+	return nil
+}
+
+// ResetFailures 清除连续验证失败的次数及锁定
+func (a *TOTP) ResetFailures(ctx context.Context, userID string) error {
+	query := fmt.Sprintf("UPDATE %s SET failures=0,locked_until=0,updated=? WHERE user_id=?", a.TableName())
+	_, err := a.DB.WithContext(ctx).Exec(query, time.Now().Unix(), userID)
+	if err != nil {
+		return errors.Wrap(err, "更新两步验证设置发生错误")
+	}
+	return nil
+}
+
+// Delete 删除用户的两步验证设置
+func (a *TOTP) Delete(ctx context.Context, userID string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id=?", a.TableName())
+	_, err := a.DB.WithContext(ctx).Exec(query, userID)
+	if err != nil {
+		return errors.Wrap(err, "删除两步验证设置发生错误")
+	}
+	return nil
+}
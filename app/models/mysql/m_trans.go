@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"context"
+	"moddns/app/models"
+	"moddns/app/service/mysql"
+
+	"github.com/facebookgo/inject"
+)
+
+// Trans 事务管理
+type Trans struct {
+	DB *mysql.DB
+}
+
+// Init 初始化
+func (a *Trans) Init(g *inject.Graph, db *mysql.DB, c *Common) *Trans {
+	a.DB = db
+
+	g.Provide(&inject.Object{Value: models.ITrans(a), Name: "ITrans"})
+
+	return a
+}
+
+// Exec 在事务中执行
+func (a *Trans) Exec(ctx context.Context, fn func(context.Context) error) error {
+	return a.DB.ExecTrans(ctx, fn)
+}
+
+// AfterCommit 注册事务提交后执行的函数
+func (a *Trans) AfterCommit(ctx context.Context, fn func()) {
+	mysql.AfterCommit(ctx, fn)
+}
@@ -2,11 +2,11 @@ package mysql
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"moddns/app/models"
+	cachemodels "moddns/app/models/cache"
 	"moddns/app/schema"
 	"moddns/app/service/mysql"
+	"moddns/app/util"
 	"time"
 
 	"github.com/facebookgo/inject"
@@ -17,16 +17,23 @@ import (
 type User struct {
 	DB     *mysql.DB
 	Common *Common
+	repo   *mysql.Repository
 }
 
 // Init 初始化
 func (a *User) Init(g *inject.Graph, db *mysql.DB, c *Common) *User {
 	a.DB = db
 	a.Common = c
+	a.repo = mysql.NewRepository(db, a.TableName())
 
-	g.Provide(&inject.Object{Value: models.IUser(a), Name: "IUser"})
+	g.Provide(&inject.Object{Value: cachemodels.NewUser(a, c.Cache), Name: "IUser"})
 
 	db.CreateTableIfNotExists(schema.User{}, a.TableName())
+	db.CreateTableColumn(a.TableName(), "version", "bigint NOT NULL DEFAULT 1")
+	db.BackfillVersion(a.TableName())
+	db.CreateTableColumn(a.TableName(), "source", "varchar(20) NOT NULL DEFAULT ''")
+	db.CreateTableColumn(a.TableName(), "oidc_issuer", "varchar(255) NOT NULL DEFAULT ''")
+	db.CreateTableColumn(a.TableName(), "oidc_subject", "varchar(255) NOT NULL DEFAULT ''")
 	db.CreateTableIfNotExists(schema.UserRole{}, a.UserRoleTableName())
 
 	db.CreateTableIndex(a.TableName(), "idx_record_id", true, "record_id")
@@ -34,6 +41,7 @@ func (a *User) Init(g *inject.Graph, db *mysql.DB, c *Common) *User {
 	db.CreateTableIndex(a.TableName(), "idx_real_name", false, "real_name")
 	db.CreateTableIndex(a.TableName(), "idx_status", false, "status")
 	db.CreateTableIndex(a.TableName(), "idx_deleted", false, "deleted")
+	db.CreateTableIndex(a.TableName(), "idx_oidc_subject", false, "oidc_subject")
 	db.CreateTableIndex(a.UserRoleTableName(), "idx_user_id", false, "user_id")
 	db.CreateTableIndex(a.UserRoleTableName(), "idx_deleted", false, "deleted")
 
@@ -52,59 +60,29 @@ func (a *User) UserRoleTableName() string {
 
 // QueryPage 查询分页数据
 func (a *User) QueryPage(ctx context.Context, params schema.UserQueryParam, pageIndex, pageSize uint) (int64, []*schema.UserQueryResult, error) {
-	var (
-		where = "WHERE deleted=0"
-		args  []interface{}
-	)
-
-	if params.UserName != "" {
-		where = fmt.Sprintf("%s AND user_name LIKE ?", where)
-		args = append(args, "%"+params.UserName+"%")
-	}
-
-	if params.RealName != "" {
-		where = fmt.Sprintf("%s AND real_name LIKE ?", where)
-		args = append(args, "%"+params.RealName+"%")
-	}
-
-	if params.Status != 0 {
-		where = fmt.Sprintf("%s AND status = ?", where)
-		args = append(args, params.Status)
-	}
+	filter := mysql.NewFilter().
+		Like("user_name", params.UserName).
+		Like("real_name", params.RealName).
+		Equal("status", params.Status)
 
 	if params.RoleID != "" {
-		where = fmt.Sprintf("%s AND record_id IN(SELECT user_id FROM %s WHERE deleted=0 AND role_id=?)", where, a.UserRoleTableName())
-		args = append(args, params.RoleID)
+		filter.Where(fmt.Sprintf("record_id IN(SELECT user_id FROM %s WHERE deleted=0 AND role_id=?)", a.UserRoleTableName()), params.RoleID)
 	}
 
-	count, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s %s", a.TableName(), where), args...)
-	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
-	} else if count == 0 {
-		return 0, nil, nil
+	if params.BeforeID > 0 {
+		filter.Where("id<?", params.BeforeID)
 	}
 
 	var items []*schema.UserQueryResult
-	fields := "id,record_id,user_name,real_name,status,created"
-	_, err = a.DB.Select(&items, fmt.Sprintf("SELECT %s FROM %s %s ORDER BY id DESC LIMIT %d,%d", fields, a.TableName(), where, (pageIndex-1)*pageSize, pageSize), args...)
-	if err != nil {
-		return 0, nil, errors.Wrap(err, "查询分页数据发生错误")
-	}
-
-	return count, items, nil
+	count, err := a.repo.QueryPage(ctx, filter, "id DESC", pageIndex, pageSize, &items)
+	return count, items, err
 }
 
 // Get 查询指定数据
 func (a *User) Get(ctx context.Context, recordID string, includeRoleIDs bool) (*schema.User, error) {
 	var item schema.User
-	fields := "id,record_id,user_name,real_name,password,status,creator,created,deleted"
-
-	err := a.DB.SelectOne(&item, fmt.Sprintf("SELECT %s FROM %s WHERE deleted=0 AND record_id=?", fields, a.TableName()), recordID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, errors.Wrap(err, "查询指定数据发生错误")
+	if ok, err := a.repo.Get(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
 
 	if includeRoleIDs {
@@ -120,12 +98,7 @@ func (a *User) Get(ctx context.Context, recordID string, includeRoleIDs bool) (*
 
 // Check 检查数据是否存在
 func (a *User) Check(ctx context.Context, recordID string) (bool, error) {
-	n, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND record_id=?", a.TableName()), recordID)
-	if err != nil {
-		return false, errors.Wrap(err, "检查数据是否存在发生错误")
-	}
-
-	return n > 0, nil
+	return a.repo.Primary().Check(ctx, recordID)
 }
 
 // QueryRoleIDs 查询用户角色
@@ -133,7 +106,7 @@ func (a *User) QueryRoleIDs(ctx context.Context, userID string) ([]string, error
 	query := fmt.Sprintf("SELECT role_id FROM %s WHERE deleted=0 AND user_id=?", a.UserRoleTableName())
 
 	var items []*schema.UserRole
-	_, err := a.DB.Select(&items, query, userID)
+	_, err := a.DB.WithContext(ctx).Select(&items, query, userID)
 	if err != nil {
 		return nil, errors.Wrap(err, "查询用户角色发生错误")
 	}
@@ -148,25 +121,33 @@ func (a *User) QueryRoleIDs(ctx context.Context, userID string) ([]string, error
 
 // CheckUserName 检查用户名
 func (a *User) CheckUserName(ctx context.Context, userName string) (bool, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND user_name=?", a.TableName())
-	n, err := a.DB.SelectInt(query, userName)
-	if err != nil {
-		return false, errors.Wrap(err, "检查用户名发生错误")
-	}
-	return n > 0, nil
+	return a.repo.Primary().Exists(ctx, mysql.NewFilter().Where("user_name=?", userName))
 }
 
 // GetByUserName 根据用户名查询指定数据
 func (a *User) GetByUserName(ctx context.Context, userName string, includeRoleIDs bool) (*schema.User, error) {
 	var item schema.User
-	fields := "id,record_id,user_name,real_name,password,status,creator,created,deleted"
+	if ok, err := a.repo.GetBy(ctx, mysql.NewFilter().Where("user_name=?", userName), &item); err != nil || !ok {
+		return nil, err
+	}
 
-	err := a.DB.SelectOne(&item, fmt.Sprintf("SELECT %s FROM %s WHERE deleted=0 AND user_name=?", fields, a.TableName()), userName)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+	if includeRoleIDs {
+		roleIDs, err := a.QueryRoleIDs(ctx, item.RecordID)
+		if err != nil {
+			return nil, err
 		}
-		return nil, errors.Wrap(err, "根据用户名查询指定数据发生错误")
+		item.RoleIDs = roleIDs
+	}
+
+	return &item, nil
+}
+
+// GetByOIDCSubject 根据关联的OIDC签发方及用户标识查询指定数据
+func (a *User) GetByOIDCSubject(ctx context.Context, issuer, subject string, includeRoleIDs bool) (*schema.User, error) {
+	var item schema.User
+	filter := mysql.NewFilter().Where("oidc_issuer=? AND oidc_subject=?", issuer, subject)
+	if ok, err := a.repo.GetBy(ctx, filter, &item); err != nil || !ok {
+		return nil, err
 	}
 
 	if includeRoleIDs {
@@ -180,9 +161,14 @@ func (a *User) GetByUserName(ctx context.Context, userName string, includeRoleID
 	return &item, nil
 }
 
+// UpdateOIDCSubject 关联OIDC签发方及用户标识
+func (a *User) UpdateOIDCSubject(ctx context.Context, recordID, issuer, subject string) error {
+	return a.repo.Update(ctx, recordID, mysql.M{"oidc_issuer": issuer, "oidc_subject": subject}, 0)
+}
+
 // CheckByRoleID 检查角色下是否存在用户
 func (a *User) CheckByRoleID(ctx context.Context, roleID string) (bool, error) {
-	n, err := a.DB.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND role_id=?", a.UserRoleTableName()), roleID)
+	n, err := a.DB.Primary().WithContext(ctx).SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND role_id=?", a.UserRoleTableName()), roleID)
 	if err != nil {
 		return false, errors.Wrap(err, "检查角色下是否存在用户发生错误")
 	}
@@ -201,131 +187,217 @@ func (a *User) QueryUserRoles(ctx context.Context, params schema.UserRoleQueryPa
 		args = append(args, params.UserID)
 	}
 
+	if len(params.UserIDs) > 0 {
+		where = fmt.Sprintf("%s AND user_id IN(?)", where)
+		args = append(args, params.UserIDs)
+	}
+
+	db := a.DB.WithContext(ctx)
+	query, args, err := db.In(fmt.Sprintf("SELECT user_id,role_id FROM %s %s", a.UserRoleTableName(), where), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "查询用户角色发生错误")
+	}
+
 	var items []*schema.UserRole
-	query := fmt.Sprintf("SELECT user_id,role_id FROM %s %s", a.UserRoleTableName(), where)
-	_, err := a.DB.Select(&items, query, args...)
+	_, err = db.Select(&items, query, args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "查询用户角色发生错误")
 	}
 	return items, nil
 }
 
-// Create 创建数据
-func (a *User) Create(ctx context.Context, item *schema.User) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrap(err, "创建数据发生错误")
+// QueryRoleIDsByUserIDs 批量查询用户的角色内码，返回用户内码与角色内码列表的对应关系
+func (a *User) QueryRoleIDsByUserIDs(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	roleIDs := make(map[string][]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return roleIDs, nil
 	}
 
-	err = tran.Insert(item)
+	items, err := a.QueryUserRoles(ctx, schema.UserRoleQueryParam{UserIDs: userIDs})
 	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "创建数据发生错误")
-	}
-
-	for _, roleID := range item.RoleIDs {
-		userRoleItem := &schema.UserRole{
-			UserID: item.RecordID,
-			RoleID: roleID,
-		}
-		err = tran.Insert(userRoleItem)
-		if err != nil {
-			tran.Rollback()
-			return errors.Wrap(err, "创建数据发生错误")
-		}
+		return nil, err
 	}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrap(err, "创建数据发生错误")
+	for _, item := range items {
+		roleIDs[item.UserID] = append(roleIDs[item.UserID], item.RoleID)
 	}
-	return nil
+	return roleIDs, nil
 }
 
-// Update 更新数据
-func (a *User) Update(ctx context.Context, recordID string, info map[string]interface{}) error {
-	if _, ok := info["updated"]; !ok {
-		info["updated"] = time.Now().Unix()
+// QueryNamesByIDs 批量查询用户名称(真实姓名为空时使用用户名)，返回用户内码与名称的对应关系
+func (a *User) QueryNamesByIDs(ctx context.Context, recordIDs []string) (map[string]string, error) {
+	names := make(map[string]string, len(recordIDs))
+	if len(recordIDs) == 0 {
+		return names, nil
 	}
 
-	_, err := a.DB.UpdateByPK(a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		info)
+	var items []*schema.UserQueryResult
+	err := a.repo.Query(ctx, mysql.NewFilter().In("record_id", recordIDs), "", &items)
 	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
+		return nil, err
 	}
-	return nil
-}
 
-// UpdateWithRoleIDs 更新数据
-func (a *User) UpdateWithRoleIDs(ctx context.Context, recordID string, info map[string]interface{}, roleIDs []string) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
+	for _, item := range items {
+		name := item.RealName
+		if name == "" {
+			name = item.UserName
+		}
+		names[item.RecordID] = name
 	}
+	return names, nil
+}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		info)
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "更新数据发生错误")
-	}
+// Create 创建数据
+func (a *User) Create(ctx context.Context, item *schema.User) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Create(ctx, item)
+		if err != nil {
+			return err
+		}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.UserRoleTableName(),
-		map[string]interface{}{"user_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "更新数据发生错误")
-	}
+		for _, roleID := range item.RoleIDs {
+			userRoleItem := &schema.UserRole{
+				UserID: item.RecordID,
+				RoleID: roleID,
+			}
+			err = a.DB.WithContext(ctx).Insert(userRoleItem)
+			if err != nil {
+				return errors.Wrap(err, "创建数据发生错误")
+			}
+		}
+		return nil
+	})
+}
 
-	for _, roleID := range roleIDs {
-		userRoleItem := &schema.UserRole{
-			UserID: recordID,
-			RoleID: roleID,
+// Update 更新数据(version大于0时校验版本号)
+func (a *User) Update(ctx context.Context, recordID string, info map[string]interface{}, version int64) error {
+	return a.repo.Update(ctx, recordID, info, version)
+}
+
+// UpdateWithRoleIDs 更新数据(version大于0时校验版本号)，仅删除移除的用户角色并新增增加的用户角色
+func (a *User) UpdateWithRoleIDs(ctx context.Context, recordID string, info map[string]interface{}, roleIDs []string, version int64) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Update(ctx, recordID, info, version)
+		if err != nil {
+			return err
 		}
-		err = tran.Insert(userRoleItem)
+
+		// 在事务中(主库)锁定并读取当前的用户角色，避免读取到副本的延迟数据或与并发的更新交错
+		db := a.DB.WithContext(ctx)
+		var oldRoleIDs []string
+		_, err = db.Select(&oldRoleIDs, fmt.Sprintf("SELECT role_id FROM %s WHERE deleted=0 AND user_id=? FOR UPDATE", a.UserRoleTableName()), recordID)
 		if err != nil {
-			tran.Rollback()
-			return errors.Wrap(err, "创建数据发生错误")
+			return errors.Wrap(err, "查询用户角色发生错误")
+		}
+		addRoleIDs, delRoleIDs := util.DiffStrings(oldRoleIDs, roleIDs)
+
+		if len(delRoleIDs) > 0 {
+			query, args, err := db.In(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND user_id=? AND role_id IN(?)", a.UserRoleTableName()),
+				time.Now().Unix(), recordID, delRoleIDs)
+			if err != nil {
+				return errors.Wrap(err, "更新数据发生错误")
+			}
+
+			_, err = db.Exec(query, args...)
+			if err != nil {
+				return errors.Wrap(err, "更新数据发生错误")
+			}
 		}
-	}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrap(err, "更新数据发生错误")
-	}
-	return nil
+		for _, roleID := range addRoleIDs {
+			userRoleItem := &schema.UserRole{
+				UserID: recordID,
+				RoleID: roleID,
+			}
+			err = db.Insert(userRoleItem)
+			if err != nil {
+				return errors.Wrap(err, "创建数据发生错误")
+			}
+		}
+		return nil
+	})
 }
 
 // Delete 删除数据
 func (a *User) Delete(ctx context.Context, recordID string) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrap(err, "删除数据发生错误")
-	}
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		// 用户及用户角色使用相同的删除时间戳，以便从回收站恢复
+		deleted, err := a.repo.Delete(ctx, recordID)
+		if err != nil {
+			return err
+		}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.TableName(),
-		map[string]interface{}{"record_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "删除数据发生错误")
-	}
+		_, err = a.DB.WithContext(ctx).UpdateByPK(a.UserRoleTableName(),
+			map[string]interface{}{"user_id": recordID, "deleted": 0},
+			map[string]interface{}{"deleted": deleted})
+		if err != nil {
+			return errors.Wrap(err, "删除数据发生错误")
+		}
+		return nil
+	})
+}
 
-	_, err = a.DB.UpdateByPKWithTran(tran, a.UserRoleTableName(),
-		map[string]interface{}{"user_id": recordID},
-		map[string]interface{}{"deleted": time.Now().Unix()})
-	if err != nil {
-		tran.Rollback()
-		return errors.Wrap(err, "删除数据发生错误")
-	}
+// QueryDeletedPage 查询已删除的分页数据
+func (a *User) QueryDeletedPage(ctx context.Context, pageIndex, pageSize uint) (int64, []*schema.RecycleQueryResult, error) {
+	var items []*schema.RecycleQueryResult
+	count, err := a.repo.QueryDeletedPage(ctx, "id,record_id,user_name AS code,real_name AS name,deleted", pageIndex, pageSize, &items)
+	return count, items, err
+}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrap(err, "删除数据发生错误")
+// GetDeleted 查询指定的已删除数据
+func (a *User) GetDeleted(ctx context.Context, recordID string) (*schema.User, error) {
+	var item schema.User
+	if ok, err := a.repo.Primary().GetDeleted(ctx, recordID, &item); err != nil || !ok {
+		return nil, err
 	}
+	return &item, nil
+}
+
+// Restore 恢复已删除的数据(同时恢复一并删除且角色仍然存在的用户角色)
+func (a *User) Restore(ctx context.Context, recordID string, deleted int64) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Restore(ctx, recordID, deleted, nil)
+		if err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("UPDATE %s SET deleted=0 WHERE user_id=? AND deleted=? AND role_id IN(SELECT record_id FROM %s WHERE deleted=0)",
+			a.UserRoleTableName(), a.Common.Role.TableName())
+		_, err = a.DB.WithContext(ctx).Exec(query, recordID, deleted)
+		if err != nil {
+			return errors.Wrap(err, "恢复数据发生错误")
+		}
+		return nil
+	})
+}
+
+// Purge 彻底删除已删除的数据
+func (a *User) Purge(ctx context.Context, recordID string) error {
+	return a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := a.repo.Purge(ctx, recordID)
+		if err != nil {
+			return err
+		}
+
+		_, err = a.DB.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE user_id=?", a.UserRoleTableName()), recordID)
+		if err != nil {
+			return errors.Wrap(err, "彻底删除数据发生错误")
+		}
+		return nil
+	})
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据，返回删除的数据条数
+func (a *User) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	var n int64
+	err := a.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		_, err := a.DB.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted<>0 AND deleted<?", a.UserRoleTableName()), before)
+		if err != nil {
+			return errors.Wrap(err, "清理已删除数据发生错误")
+		}
 
-	return nil
+		n, err = a.repo.PurgeExpired(ctx, before)
+		return err
+	})
+	return n, err
 }
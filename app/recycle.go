@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"moddns/app/http/ctl"
+	"moddns/app/logger"
+	"moddns/app/util"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// InitRecycle 初始化回收站的定期清理(彻底删除超过保留天数的已删除数据)
+func InitRecycle(ctlCommon *ctl.Common, traceID string) CloseHandle {
+	recycleConfig := viper.GetStringMap("recycle")
+
+	days := util.T(recycleConfig["retention_days"]).Int()
+	if days <= 0 {
+		return nil
+	}
+
+	interval := time.Hour
+	if v := util.T(recycleConfig["purge_interval"]).Int(); v > 0 {
+		interval = time.Duration(v) * time.Minute
+	}
+
+	purges := []struct {
+		name  string
+		purge func(context.Context, time.Time) (int64, error)
+	}{
+		{"用户", ctlCommon.UserAPI.UserBll.PurgeExpired},
+		{"角色", ctlCommon.RoleAPI.RoleBll.PurgeExpired},
+		{"菜单", ctlCommon.MenuAPI.MenuBll.PurgeExpired},
+		{"示例", ctlCommon.DemoAPI.DemoBll.PurgeExpired},
+	}
+
+	purgeAll := func() {
+		ctx := util.NewTraceIDContext(context.Background(), traceID)
+		before := time.Now().AddDate(0, 0, -days)
+		for _, p := range purges {
+			n, err := p.purge(ctx, before)
+			if err != nil {
+				logger.SystemWithContext(ctx).Errorf("清理已删除的%s数据发生错误：%s", p.name, err.Error())
+			} else if n > 0 {
+				logger.SystemWithContext(ctx).Infof("已彻底删除%d条超过保留期限的%s数据", n, p.name)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{}) // 关闭时停止清理
+	go func() {
+		purgeAll()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				purgeAll()
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
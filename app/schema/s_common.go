@@ -0,0 +1,39 @@
+package schema
+
+// BatchParam 批量操作参数
+type BatchParam struct {
+	IDs    []string `json:"ids"`    // 记录ID列表
+	Status int      `json:"status"` // 状态(批量启用/禁用时使用：1启用 2停用)
+}
+
+// BatchResult 批量操作中单条数据的处理结果
+type BatchResult struct {
+	RecordID string `json:"record_id"`       // 记录ID
+	Success  bool   `json:"success"`         // 是否成功
+	Error    string `json:"error,omitempty"` // 错误信息
+}
+
+// RecycleQueryResult 回收站(已删除数据)查询结果
+type RecycleQueryResult struct {
+	ID       int64  `json:"id" db:"id"`               // 唯一标识(自增ID)
+	RecordID string `json:"record_id" db:"record_id"` // 记录内码(uuid)
+	Code     string `json:"code" db:"code"`           // 编号(用户为用户名)
+	Name     string `json:"name" db:"name"`           // 名称(用户为真实姓名)
+	Deleted  int64  `json:"deleted" db:"deleted"`     // 删除时间戳
+}
+
+// ImportError 导入数据的校验错误
+type ImportError struct {
+	Line    int    `json:"line"`            // 行号
+	Field   string `json:"field,omitempty"` // 列名
+	Value   string `json:"value,omitempty"` // 值
+	Message string `json:"message"`         // 错误信息
+}
+
+// ImportResult 数据导入结果(校验报告)
+type ImportResult struct {
+	DryRun  bool           `json:"dry_run"` // 是否仅校验
+	Total   int            `json:"total"`   // 数据条数
+	Created int            `json:"created"` // 创建条数
+	Errors  []*ImportError `json:"errors"`  // 校验错误
+}
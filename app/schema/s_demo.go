@@ -10,6 +10,7 @@ type Demo struct {
 	Created  int64  `json:"created" db:"created" structs:"created"`                   // 创建时间戳
 	Updated  int64  `json:"updated" db:"updated" structs:"updated"`                   // 更新时间戳
 	Deleted  int64  `json:"deleted" db:"deleted" structs:"deleted"`                   // 删除时间戳
+	Version  int64  `json:"version" db:"version" structs:"-"`                         // 版本号(乐观锁)
 }
 
 // DemoQueryParam 示例查询条件
@@ -3,7 +3,13 @@ package schema
 // LoginParam 登录参数
 type LoginParam struct {
 	UserName string `json:"user_name" binding:"required"` // 用户名
-	Password string `json:"password" binding:"required"`  // 密码(md5加密)
+	Password string `json:"password" binding:"required"`  // 密码(md5加密，plain为true时为明文)
+	Plain    bool   `json:"plain"`                        // 密码是否为明文(LDAP认证需要明文密码，仅应在HTTPS下使用)
+}
+
+// LoginOIDCParam OIDC登录参数
+type LoginOIDCParam struct {
+	Ticket string `json:"ticket" binding:"required"` // 回调重定向到前端时携带的登录票据
 }
 
 // LoginInfo 用户登录信息
@@ -12,3 +18,13 @@ type LoginInfo struct {
 	RealName  string   `json:"real_name"`  // 真实姓名
 	RoleNames []string `json:"role_names"` // 真实姓名
 }
+
+// UserSession 用户会话
+type UserSession struct {
+	RecordID   string `json:"record_id"`   // 记录ID
+	IP         string `json:"ip"`          // 客户端IP
+	UserAgent  string `json:"user_agent"`  // 客户端标识
+	LoginAt    int64  `json:"login_at"`    // 登录时间戳
+	LastActive int64  `json:"last_active"` // 最后活动时间戳
+	Current    bool   `json:"current"`     // 是否为当前请求的会话
+}
@@ -11,7 +11,7 @@ type Menu struct {
 	Icon      string `json:"icon" db:"icon,size:200" structs:"icon"`                    // 菜单图标
 	Path      string `json:"path" db:"path,size:200" structs:"path"`                    // 访问路径
 	Method    string `json:"method" db:"method,size:50" structs:"method"`               // 资源请求方式
-	LevelCode string `json:"level_code" db:"level_code,size:20" structs:"level_code"`   // 分级码
+	LevelCode string `json:"level_code" db:"level_code,size:100" structs:"level_code"`  // 分级码(每级位数由menu.level_code_width配置)
 	ParentID  string `json:"parent_id" db:"parent_id,size:36" structs:"parent_id"`      // 父级内码
 	IsHide    int    `json:"is_hide" db:"is_hide" structs:"is_hide" binding:"required"` // 是否隐藏(1:是 2:否)
 	Status    int    `json:"status" db:"status" structs:"status" binding:"required"`    // 状态(1:启用 2:停用)
@@ -19,6 +19,7 @@ type Menu struct {
 	Created   int64  `json:"created" db:"created" structs:"created"`                    // 创建时间戳
 	Updated   int64  `json:"updated" db:"updated" structs:"updated"`                    // 更新时间戳
 	Deleted   int64  `json:"deleted" db:"deleted" structs:"deleted"`                    // 删除时间戳
+	Version   int64  `json:"version" db:"version" structs:"-"`                          // 版本号(乐观锁)
 }
 
 // MenuQueryParam 菜单查询条件
@@ -27,20 +28,41 @@ type MenuQueryParam struct {
 	Type     int    // 菜单类型(10：系统 20：模块 30：功能 40：资源)
 	ParentID string // 父级内码
 	Status   int    // 状态(1:启用 2:停用)
+	BeforeID int64  // 大于0时仅查询ID小于该值的数据并按ID倒序排序(导出时按ID分页)
 }
 
 // MenuQueryResult 菜单查询结果
 type MenuQueryResult struct {
-	ID       int64  `json:"id" db:"id"`               // 唯一标识(自增ID)
-	RecordID string `json:"record_id" db:"record_id"` // 记录内码(uuid)
-	Code     string `json:"code" db:"code"`           // 菜单编号
-	Name     string `json:"name" db:"name"`           // 菜单名称
-	Icon     string `json:"icon" db:"icon"`           // 菜单图标
-	Path     string `json:"path" db:"path"`           // 访问路径
-	Type     int    `json:"type" db:"type"`           // 菜单类型(10：系统 20：模块 30：功能 40：资源)
-	Sequence int    `json:"sequence" db:"sequence"`   // 排序值
-	IsHide   int    `json:"is_hide" db:"is_hide"`     // 是否隐藏(1:是 2:否)
-	Status   int    `json:"status" db:"status"`       // 状态(1:启用 2:停用)
+	ID          int64  `json:"id" db:"id"`               // 唯一标识(自增ID)
+	RecordID    string `json:"record_id" db:"record_id"` // 记录内码(uuid)
+	Code        string `json:"code" db:"code"`           // 菜单编号
+	Name        string `json:"name" db:"name"`           // 菜单名称
+	Icon        string `json:"icon" db:"icon"`           // 菜单图标
+	Path        string `json:"path" db:"path"`           // 访问路径
+	Type        int    `json:"type" db:"type"`           // 菜单类型(10：系统 20：模块 30：功能 40：资源)
+	Sequence    int    `json:"sequence" db:"sequence"`   // 排序值
+	IsHide      int    `json:"is_hide" db:"is_hide"`     // 是否隐藏(1:是 2:否)
+	Status      int    `json:"status" db:"status"`       // 状态(1:启用 2:停用)
+	Creator     string `json:"creator" db:"creator"`     // 创建人
+	CreatorName string `json:"creator_name" db:"-"`      // 创建人名称
+}
+
+// MenuMoveParam 菜单移动参数
+type MenuMoveParam struct {
+	ParentID string `json:"parent_id"` // 移动到的上级内码(为空时为顶级菜单)
+	Position int    `json:"position"`  // 在同级菜单中的位置(从0开始，小于0或超出范围时放到最后)
+}
+
+// MenuReorderParam 同级菜单排序参数
+type MenuReorderParam struct {
+	ParentID string   `json:"parent_id"`              // 上级内码(为空时为顶级菜单)
+	IDs      []string `json:"ids" binding:"required"` // 按顺序排列的全部同级菜单内码
+}
+
+// MenuCopyParam 菜单复制参数
+type MenuCopyParam struct {
+	Code string `json:"code"` // 复制后的菜单编号(默认为原编号加_copy)
+	Name string `json:"name"` // 复制后的菜单名称(默认为原名称加(副本))
 }
 
 // MenuSelectQueryParam 菜单选择查询条件
@@ -66,4 +88,7 @@ type MenuSelectQueryResult struct {
 	Icon      string `json:"icon" db:"icon" structs:"icon"`                   // 菜单图标
 	Path      string `json:"path" db:"path" structs:"path"`                   // 访问路径
 	Method    string `json:"method" db:"method" structs:"method"`             // 资源请求方式
+	Sequence  int    `json:"sequence" db:"sequence" structs:"sequence"`       // 排序值
+	IsHide    int    `json:"is_hide" db:"is_hide" structs:"is_hide"`          // 是否隐藏(1:是 2:否)
+	Status    int    `json:"status" db:"status" structs:"status"`             // 状态(1:启用 2:停用)
 }
@@ -2,16 +2,18 @@ package schema
 
 // Role 角色管理
 type Role struct {
-	ID       int64    `json:"id" db:"id,primarykey,autoincrement" structs:"id"`         // 唯一标识(自增ID)
-	RecordID string   `json:"record_id" db:"record_id,size:36" structs:"record_id"`     // 记录内码(uuid)
-	Name     string   `json:"name" db:"name,size:50" structs:"name" binding:"required"` // 角色名称
-	Memo     string   `json:"memo" db:"memo,size:1024" structs:"memo"`                  // 角色备注
-	Status   int      `json:"status" db:"status" structs:"status" binding:"required"`   // 角色状态(1:启用 2:停用)
-	Creator  string   `json:"creator" db:"creator,size:36" structs:"creator"`           // 创建者
-	Created  int64    `json:"created" db:"created" structs:"created"`                   // 创建时间戳
-	Updated  int64    `json:"updated" db:"updated" structs:"updated"`                   // 更新时间戳
-	Deleted  int64    `json:"deleted" db:"deleted" structs:"deleted"`                   // 删除时间戳
-	MenuIDs  []string `json:"menu_ids" db:"-" structs:"-" binding:"required,gt=0"`      // 菜单ID列表
+	ID         int64    `json:"id" db:"id,primarykey,autoincrement" structs:"id"`         // 唯一标识(自增ID)
+	RecordID   string   `json:"record_id" db:"record_id,size:36" structs:"record_id"`     // 记录内码(uuid)
+	Name       string   `json:"name" db:"name,size:50" structs:"name" binding:"required"` // 角色名称
+	Memo       string   `json:"memo" db:"memo,size:1024" structs:"memo"`                  // 角色备注
+	Status     int      `json:"status" db:"status" structs:"status" binding:"required"`   // 角色状态(1:启用 2:停用)
+	Require2FA int      `json:"require_2fa" db:"require_2fa" structs:"require_2fa"`       // 要求用户启用两步验证(1:是 2:否)
+	Creator    string   `json:"creator" db:"creator,size:36" structs:"creator"`           // 创建者
+	Created    int64    `json:"created" db:"created" structs:"created"`                   // 创建时间戳
+	Updated    int64    `json:"updated" db:"updated" structs:"updated"`                   // 更新时间戳
+	Deleted    int64    `json:"deleted" db:"deleted" structs:"deleted"`                   // 删除时间戳
+	Version    int64    `json:"version" db:"version" structs:"-"`                         // 版本号(乐观锁)
+	MenuIDs    []string `json:"menu_ids" db:"-" structs:"-" binding:"required,gt=0"`      // 菜单ID列表
 }
 
 // RoleMenu 角色菜单管理
@@ -22,26 +24,36 @@ type RoleMenu struct {
 	Deleted int64  `json:"deleted" db:"deleted"`                // 删除时间戳
 }
 
+// RoleMenuQueryParam 角色菜单查询参数
+type RoleMenuQueryParam struct {
+	RoleIDs []string // 角色内码列表
+}
+
 // RoleQueryParam 角色查询条件
 type RoleQueryParam struct {
-	Name   string // 角色名称
-	Status int    // 角色状态(1:启用 2:停用)
+	Name     string // 角色名称
+	Status   int    // 角色状态(1:启用 2:停用)
+	BeforeID int64  // 大于0时仅查询ID小于该值的数据并按ID倒序排序(导出时按ID分页)
 }
 
 // RoleQueryResult 角色查询结果
 type RoleQueryResult struct {
-	ID       int64  `json:"id" db:"id"`               // 唯一标识(自增ID)
-	RecordID string `json:"record_id" db:"record_id"` // 记录内码
-	Name     string `json:"name" db:"name"`           // 角色名称
-	Memo     string `json:"memo" db:"memo"`           // 角色备注
-	Status   int    `json:"status" db:"status"`       // 角色状态(1:启用 2:停用)
+	ID          int64  `json:"id" db:"id"`                   // 唯一标识(自增ID)
+	RecordID    string `json:"record_id" db:"record_id"`     // 记录内码
+	Name        string `json:"name" db:"name"`               // 角色名称
+	Memo        string `json:"memo" db:"memo"`               // 角色备注
+	Status      int    `json:"status" db:"status"`           // 角色状态(1:启用 2:停用)
+	Require2FA  int    `json:"require_2fa" db:"require_2fa"` // 要求用户启用两步验证(1:是 2:否)
+	Creator     string `json:"creator" db:"creator"`         // 创建者
+	CreatorName string `json:"creator_name" db:"-"`          // 创建者名称
 }
 
 // RoleSelectQueryParam 角色选择查询条件
 type RoleSelectQueryParam struct {
-	RecordIDs []string // 记录ID列表
-	Name      string   // 角色名称
-	Status    int      // 状态(1:启用 2:停用)
+	RecordIDs  []string // 记录ID列表
+	Name       string   // 角色名称
+	Status     int      // 状态(1:启用 2:停用)
+	Require2FA int      // 要求用户启用两步验证(1:是 2:否)
 }
 
 // RoleSelectQueryResult 角色选择查询结果
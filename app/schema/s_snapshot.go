@@ -0,0 +1,64 @@
+package schema
+
+// SnapshotVersion 配置快照的格式版本
+const SnapshotVersion = 1
+
+// Snapshot 配置快照(不包含记录内码，菜单通过编号路径关联，角色通过名称关联)
+type Snapshot struct {
+	Version int             `json:"version" yaml:"version"`                 // 格式版本
+	Menus   []*SnapshotMenu `json:"menus" yaml:"menus"`                     // 菜单(上级菜单在前)
+	Roles   []*SnapshotRole `json:"roles" yaml:"roles"`                     // 角色及菜单授权
+	Users   []*SnapshotUser `json:"users,omitempty" yaml:"users,omitempty"` // 用户(可选)
+}
+
+// SnapshotMenu 配置快照中的菜单
+type SnapshotMenu struct {
+	Code     string `json:"code" yaml:"code"`                         // 编号路径(由顶级至本级的编号以/连接，如admin/system/menu/query)
+	Name     string `json:"name" yaml:"name"`                         // 菜单名称
+	Type     int    `json:"type" yaml:"type"`                         // 菜单类型(10：系统 20：模块 30：功能 40：资源)
+	Sequence int    `json:"sequence" yaml:"sequence"`                 // 排序值
+	Icon     string `json:"icon,omitempty" yaml:"icon,omitempty"`     // 菜单图标
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`     // 访问路径
+	Method   string `json:"method,omitempty" yaml:"method,omitempty"` // 资源请求方式
+	IsHide   int    `json:"is_hide" yaml:"is_hide"`                   // 是否隐藏(1:是 2:否)
+	Status   int    `json:"status" yaml:"status"`                     // 状态(1:启用 2:停用)
+}
+
+// SnapshotRole 配置快照中的角色
+type SnapshotRole struct {
+	Name       string   `json:"name" yaml:"name"`                                   // 角色名称
+	Memo       string   `json:"memo,omitempty" yaml:"memo,omitempty"`               // 角色备注
+	Status     int      `json:"status" yaml:"status"`                               // 角色状态(1:启用 2:停用)
+	Require2FA int      `json:"require_2fa,omitempty" yaml:"require_2fa,omitempty"` // 要求用户启用两步验证(1:是 2:否，为空时不要求)
+	Menus      []string `json:"menus" yaml:"menus"`                                 // 授权菜单的编号路径
+}
+
+// SnapshotUser 配置快照中的用户
+type SnapshotUser struct {
+	UserName string   `json:"user_name" yaml:"user_name"`                   // 用户名
+	RealName string   `json:"real_name" yaml:"real_name"`                   // 真实姓名
+	Password string   `json:"password,omitempty" yaml:"password,omitempty"` // 登录密码(仅创建本地用户时使用，导出时不包含)
+	Source   string   `json:"source,omitempty" yaml:"source,omitempty"`     // 认证来源(为空:本地 ldap:LDAP oidc:OIDC)
+	Status   int      `json:"status" yaml:"status"`                         // 用户状态(1:启用 2:停用)
+	Roles    []string `json:"roles" yaml:"roles"`                           // 角色名称
+}
+
+// SnapshotApplyParam 应用配置快照的参数
+type SnapshotApplyParam struct {
+	DryRun bool // 仅生成变更计划
+	Prune  bool // 删除快照中不存在的数据(快照未包含用户时不删除用户)
+}
+
+// SnapshotChange 配置快照的一项变更
+type SnapshotChange struct {
+	Kind   string   `json:"kind"`             // 数据类型(menu、role、user)
+	Action string   `json:"action"`           // 变更操作(create、update、delete)
+	Key    string   `json:"key"`              // 菜单编号路径、角色名称或用户名
+	Fields []string `json:"fields,omitempty"` // 更新的字段
+}
+
+// SnapshotPlan 应用配置快照的变更计划
+type SnapshotPlan struct {
+	DryRun  bool              `json:"dry_run"` // 是否仅生成计划
+	Changes []*SnapshotChange `json:"changes"` // 变更列表(为空时表示已经一致)
+}
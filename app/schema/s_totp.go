@@ -0,0 +1,39 @@
+package schema
+
+// UserTOTP 用户的两步验证(TOTP)设置，以用户内码关联(超级用户同样适用)
+type UserTOTP struct {
+	ID            int64  `json:"id" db:"id,primarykey,autoincrement"` // 唯一标识(自增ID)
+	UserID        string `json:"user_id" db:"user_id,size:36"`        // 用户内码
+	Secret        string `json:"-" db:"secret,size:64"`               // 密钥(base32)
+	Status        int    `json:"status" db:"status"`                  // 状态(1:已启用 2:待确认)
+	RecoveryCodes string `json:"-" db:"recovery_codes,size:1024"`     // 未使用的恢复码(HMAC-SHA256哈希值，以逗号分隔)
+	LastStep      int64  `json:"-" db:"last_step"`                    // 最后验证通过的时间步(防止验证码重放)
+	Failures      int    `json:"-" db:"failures"`                     // 连续验证失败的次数
+	LockedUntil   int64  `json:"-" db:"locked_until"`                 // 锁定截止时间戳(连续验证失败次数过多时锁定)
+	Created       int64  `json:"created" db:"created"`                // 创建时间戳
+	Updated       int64  `json:"updated" db:"updated"`                // 更新时间戳
+}
+
+// TOTPStatus 两步验证状态
+type TOTPStatus struct {
+	Enabled       bool `json:"enabled"`        // 是否已启用
+	Required      bool `json:"required"`       // 用户的角色是否要求启用
+	RecoveryCodes int  `json:"recovery_codes"` // 剩余的恢复码数量
+}
+
+// TOTPSetup 两步验证的注册信息
+type TOTPSetup struct {
+	Secret string `json:"secret"` // 密钥(base32，用于手动输入)
+	URI    string `json:"uri"`    // 认证器应用的配置URI(用于生成二维码)
+}
+
+// TOTPParam 两步验证参数
+type TOTPParam struct {
+	Code string `json:"code" binding:"required"` // 验证码或恢复码
+}
+
+// LoginTOTPParam 登录的两步验证参数
+type LoginTOTPParam struct {
+	Challenge string `json:"challenge" binding:"required"` // 登录第一步返回的挑战标识
+	Code      string `json:"code" binding:"required"`      // 验证码或恢复码
+}
@@ -1,5 +1,15 @@
 package schema
 
+// 用户的认证来源
+const (
+	UserSourceLocal = ""     // 本地用户(使用本地密码认证)
+	UserSourceLDAP  = "ldap" // LDAP用户(由LDAP认证，本地密码不可用于登录)
+	UserSourceOIDC  = "oidc" // OIDC用户(由身份提供方认证，本地密码不可用于登录)
+
+	// UserSourceLocalName 请求中明确指定本地用户(更新用户时认证来源为空表示不修改)
+	UserSourceLocalName = "local"
+)
+
 // User 用户管理
 type User struct {
 	ID       int64    `json:"id" db:"id,primarykey,autoincrement" structs:"id"`                        // 唯一标识(自增ID)
@@ -7,12 +17,17 @@ type User struct {
 	UserName string   `json:"user_name" db:"user_name,size:50" structs:"user_name" binding:"required"` // 用户名
 	RealName string   `json:"real_name" db:"real_name,size:50" structs:"real_name" binding:"required"` // 真实姓名
 	Password string   `json:"password" db:"password,size:40" structs:"password"`                       // 登录密码(sha1(md5(明文))加密)
+	Source   string   `json:"source" db:"source,size:20" structs:"source"`                             // 认证来源(为空:本地 ldap:LDAP oidc:OIDC，更新时为空表示不修改，local表示本地)
 	Status   int      `json:"status" db:"status" structs:"status" binding:"required"`                  // 用户状态(1:启用 2:停用)
 	Creator  string   `json:"creator" db:"creator,size:36" structs:"creator"`                          // 创建者
 	Created  int64    `json:"created" db:"created" structs:"created"`                                  // 创建时间戳
 	Updated  int64    `json:"updated" db:"updated" structs:"updated"`                                  // 更新时间戳
 	Deleted  int64    `json:"deleted" db:"deleted" structs:"deleted"`                                  // 删除时间戳
+	Version  int64    `json:"version" db:"version" structs:"-"`                                        // 版本号(乐观锁)
 	RoleIDs  []string `json:"role_ids" db:"-" structs:"-" binding:"required,gt=0"`                     // 角色ID列表
+
+	OIDCIssuer  string `json:"-" db:"oidc_issuer,size:255" structs:"-"`  // 关联的OIDC签发方(首次OIDC登录时记录)
+	OIDCSubject string `json:"-" db:"oidc_subject,size:255" structs:"-"` // 关联的OIDC用户标识(sub)
 }
 
 // UserRole 用户角色授权管理
@@ -29,20 +44,25 @@ type UserQueryParam struct {
 	RealName string // 真实姓名
 	Status   int    // 用户状态(1:启用 2:停用)
 	RoleID   string // 角色ID
+	BeforeID int64  // 大于0时仅查询ID小于该值的数据并按ID倒序排序(导出时按ID分页)
 }
 
 // UserQueryResult 用户查询结果
 type UserQueryResult struct {
-	ID        int64    `json:"id" db:"id"`               // 唯一标识(自增ID)
-	RecordID  string   `json:"record_id" db:"record_id"` // 记录内码(uuid)
-	UserName  string   `json:"user_name" db:"user_name"` // 用户名
-	RealName  string   `json:"real_name" db:"real_name"` // 真实姓名
-	Status    int      `json:"status" db:"status"`       // 用户状态(1:启用 2:停用)
-	Created   int64    `json:"created" db:"created"`     // 创建时间戳
-	RoleNames []string `json:"role_names" db:"-"`        // 角色名称
+	ID          int64    `json:"id" db:"id"`               // 唯一标识(自增ID)
+	RecordID    string   `json:"record_id" db:"record_id"` // 记录内码(uuid)
+	UserName    string   `json:"user_name" db:"user_name"` // 用户名
+	RealName    string   `json:"real_name" db:"real_name"` // 真实姓名
+	Status      int      `json:"status" db:"status"`       // 用户状态(1:启用 2:停用)
+	Source      string   `json:"source" db:"source"`       // 认证来源(为空:本地 ldap:LDAP oidc:OIDC，更新时为空表示不修改，local表示本地)
+	Creator     string   `json:"creator" db:"creator"`     // 创建者
+	Created     int64    `json:"created" db:"created"`     // 创建时间戳
+	RoleNames   []string `json:"role_names" db:"-"`        // 角色名称
+	CreatorName string   `json:"creator_name" db:"-"`      // 创建者名称
 }
 
 // UserRoleQueryParam 用户角色查询参数
 type UserRoleQueryParam struct {
-	UserID string
+	UserID  string   // 用户内码
+	UserIDs []string // 用户内码列表
 }
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"moddns/app/logger"
+	"moddns/app/service/cert"
+	"moddns/app/util"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// InitHTTPServer 初始化HTTP服务(超时、TLS及HTTP/2配置)
+func InitHTTPServer(handler http.Handler, traceID string) (*http.Server, CloseHandle) {
+	httpConfig := viper.GetStringMap("http")
+
+	srv := &http.Server{
+		Addr:           viper.GetString("http_addr"),
+		Handler:        handler,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		IdleTimeout:    60 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+
+	if v := util.T(httpConfig["read_timeout"]).Int(); v > 0 {
+		srv.ReadTimeout = time.Duration(v) * time.Second
+	}
+
+	if v := util.T(httpConfig["write_timeout"]).Int(); v > 0 {
+		srv.WriteTimeout = time.Duration(v) * time.Second
+	}
+
+	if v := util.T(httpConfig["idle_timeout"]).Int(); v > 0 {
+		srv.IdleTimeout = time.Duration(v) * time.Second
+	}
+
+	if v := util.T(httpConfig["max_header_bytes"]).Int(); v > 0 {
+		srv.MaxHeaderBytes = v
+	}
+
+	tlsConfig := viper.GetStringMap("http-tls")
+	if !util.T(tlsConfig["enable"]).Bool() {
+		return srv, nil
+	}
+
+	reloader, err := cert.NewReloader(
+		cert.SetCertFile(util.T(tlsConfig["cert_file"]).String()),
+		cert.SetKeyFile(util.T(tlsConfig["key_file"]).String()),
+		cert.SetClientCAFile(util.T(tlsConfig["client_ca_file"]).String()),
+		cert.SetLogger(logger.System(traceID)),
+	)
+	if err != nil {
+		panic("初始化TLS证书发生错误：" + err.Error())
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if v := util.T(tlsConfig["min_version"]).String(); v != "" {
+		version, err := parseTLSVersion(v)
+		if err != nil {
+			panic(err.Error())
+		}
+		base.MinVersion = version
+	}
+
+	switch v := util.T(tlsConfig["cipher_policy"]).String(); v {
+	case "", "default":
+	case "modern":
+		base.CipherSuites = []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		}
+	default:
+		panic(fmt.Sprintf("无效的TLS加密套件策略：%s", v))
+	}
+
+	switch v := util.T(tlsConfig["client_auth"]).String(); v {
+	case "", "none":
+		base.ClientAuth = tls.NoClientCert
+	case "request":
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		panic(fmt.Sprintf("无效的客户端认证方式：%s", v))
+	}
+
+	if v, ok := tlsConfig["http2"]; ok && !util.T(v).Bool() {
+		base.NextProtos = []string{"http/1.1"}
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+
+	srv.TLSConfig = reloader.TLSConfig(base)
+
+	return srv, func() {
+		reloader.Close()
+	}
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "tls") {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("无效的TLS版本：%s", v)
+}
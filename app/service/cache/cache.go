@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 缓存的命名空间
+const (
+	NSMenu = "menu" // 菜单查询(依赖菜单、角色授权及用户角色)
+	NSRole = "role" // 角色查询
+	NSUser = "user" // 用户查询
+)
+
+// Store 缓存存储
+type Store interface {
+	// Get 读取缓存，不存在或已过期时返回false
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set 写入缓存，ttl为0时不过期
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete 删除缓存
+	Delete(ctx context.Context, keys ...string) error
+	// Close 关闭存储
+	Close() error
+}
+
+// Stats 命名空间的缓存统计
+type Stats struct {
+	Namespace   string `json:"namespace"`   // 命名空间
+	Hits        int64  `json:"hits"`        // 命中次数
+	Misses      int64  `json:"misses"`      // 未命中次数
+	Errors      int64  `json:"errors"`      // 存储错误次数
+	Invalidates int64  `json:"invalidates"` // 失效次数
+}
+
+type counter struct {
+	hits, misses, errors, invalidates int64
+}
+
+// New 创建缓存，ttl为缓存数据的有效期；store为nil时不缓存(直接加载数据)
+func New(store Store, ttl time.Duration) *Cache {
+	return &Cache{
+		store:    store,
+		ttl:      ttl,
+		counters: make(map[string]*counter),
+	}
+}
+
+// Cache 按命名空间管理的缓存，数据以JSON编码存储；
+// 每个命名空间有一个存储在Store中的版本号，失效时更换版本号，多实例共享Store时同时失效
+type Cache struct {
+	store    Store
+	ttl      time.Duration
+	lock     sync.RWMutex
+	counters map[string]*counter
+}
+
+// Enabled 是否启用缓存
+func (c *Cache) Enabled() bool {
+	return c != nil && c.store != nil
+}
+
+func (c *Cache) counter(ns string) *counter {
+	c.lock.RLock()
+	cnt, ok := c.counters[ns]
+	c.lock.RUnlock()
+	if ok {
+		return cnt
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cnt, ok = c.counters[ns]; !ok {
+		cnt = new(counter)
+		c.counters[ns] = cnt
+	}
+	return cnt
+}
+
+func versionKey(ns string) string {
+	return "version:" + ns
+}
+
+// version 获取命名空间的版本号，不存在时(首次使用或被淘汰)创建新的版本号
+func (c *Cache) version(ctx context.Context, ns string) (string, error) {
+	buf, ok, err := c.store.Get(ctx, versionKey(ns))
+	if err != nil {
+		return "", err
+	} else if ok {
+		return string(buf), nil
+	}
+	return c.newVersion(ctx, ns)
+}
+
+func (c *Cache) newVersion(ctx context.Context, ns string) (string, error) {
+	v := strconv.FormatInt(now().UnixNano(), 36)
+	if err := c.store.Set(ctx, versionKey(ns), []byte(v), 0); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// Load 读取缓存数据到v(指针)，未命中时调用fn加载数据到v并写入缓存；
+// 存储发生错误时直接调用fn，不影响数据的加载
+func (c *Cache) Load(ctx context.Context, ns, key string, v interface{}, fn func() error) error {
+	if !c.Enabled() {
+		return fn()
+	}
+	cnt := c.counter(ns)
+
+	version, err := c.version(ctx, ns)
+	if err != nil {
+		atomic.AddInt64(&cnt.errors, 1)
+		return fn()
+	}
+	key = ns + ":" + version + ":" + key
+
+	buf, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		atomic.AddInt64(&cnt.errors, 1)
+	} else if ok && json.Unmarshal(buf, v) == nil {
+		atomic.AddInt64(&cnt.hits, 1)
+		return nil
+	}
+	atomic.AddInt64(&cnt.misses, 1)
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	if buf, err = json.Marshal(v); err == nil {
+		err = c.store.Set(ctx, key, buf, c.ttl)
+	}
+	if err != nil {
+		atomic.AddInt64(&cnt.errors, 1)
+	}
+	return nil
+}
+
+// Invalidate 使命名空间中的全部缓存失效
+func (c *Cache) Invalidate(ctx context.Context, namespaces ...string) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	for _, ns := range namespaces {
+		cnt := c.counter(ns)
+		atomic.AddInt64(&cnt.invalidates, 1)
+		if _, err := c.newVersion(ctx, ns); err != nil {
+			atomic.AddInt64(&cnt.errors, 1)
+			return errors.Wrapf(err, "使缓存[%s]失效发生错误", ns)
+		}
+	}
+	return nil
+}
+
+// Stats 获取各命名空间的缓存统计
+func (c *Cache) Stats() []*Stats {
+	if c == nil {
+		return []*Stats{}
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	stats := make([]*Stats, 0, len(c.counters))
+	for ns, cnt := range c.counters {
+		stats = append(stats, &Stats{
+			Namespace:   ns,
+			Hits:        atomic.LoadInt64(&cnt.hits),
+			Misses:      atomic.LoadInt64(&cnt.misses),
+			Errors:      atomic.LoadInt64(&cnt.errors),
+			Invalidates: atomic.LoadInt64(&cnt.invalidates),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Namespace < stats[j].Namespace
+	})
+	return stats
+}
+
+// Close 关闭缓存
+func (c *Cache) Close() error {
+	if !c.Enabled() {
+		return nil
+	}
+	return c.store.Close()
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"moddns/app/service/redis"
+	"moddns/app/service/redis/redistest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	cur := time.Now()
+	now = func() time.Time { return cur }
+	defer func() { now = time.Now }()
+
+	store := NewMemoryStore(2)
+	defer store.Close()
+
+	ctx := context.Background()
+	store.Set(ctx, "a", []byte("1"), time.Second)
+	store.Set(ctx, "b", []byte("2"), 0)
+
+	// 访问a后b成为最久未使用的数据
+	if v, ok, _ := store.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("读取缓存结果错误：%s,%t", v, ok)
+	}
+	store.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Fatal("超出容量时应淘汰最久未使用的数据")
+	}
+
+	cur = cur.Add(time.Second)
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Fatal("缓存过期后不应被读取")
+	}
+	if _, ok, _ := store.Get(ctx, "c"); !ok {
+		t.Fatal("未设置有效期的缓存不应过期")
+	}
+}
+
+func TestCacheLoad(t *testing.T) {
+	c := New(NewMemoryStore(0), time.Minute)
+	defer c.Close()
+
+	ctx := context.Background()
+	var calls int
+	load := func() []string {
+		var items []string
+		err := c.Load(ctx, NSMenu, "select", &items, func() error {
+			calls++
+			items = []string{"foo", "bar"}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return items
+	}
+
+	for i := 0; i < 2; i++ {
+		if items := load(); len(items) != 2 || items[1] != "bar" {
+			t.Fatalf("加载数据错误：%v", items)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("命中缓存时不应重新加载，加载次数：%d", calls)
+	}
+
+	// 其它命名空间失效不影响
+	c.Invalidate(ctx, NSUser)
+	load()
+	if calls != 1 {
+		t.Fatalf("其它命名空间失效后不应重新加载，加载次数：%d", calls)
+	}
+
+	c.Invalidate(ctx, NSMenu)
+	load()
+	if calls != 2 {
+		t.Fatalf("命名空间失效后应重新加载，加载次数：%d", calls)
+	}
+
+	stats := c.Stats()
+	if len(stats) != 2 || stats[0].Namespace != NSMenu || stats[0].Hits != 2 || stats[0].Misses != 2 || stats[0].Invalidates != 1 {
+		t.Fatalf("缓存统计错误：%+v", stats[0])
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := New(nil, 0)
+
+	var calls int
+	for i := 0; i < 2; i++ {
+		var v int
+		c.Load(context.Background(), NSRole, "get", &v, func() error {
+			calls++
+			return nil
+		})
+	}
+	if calls != 2 || c.Enabled() {
+		t.Fatalf("未启用缓存时应直接加载，加载次数：%d", calls)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client := redis.NewClient(redis.SetAddr(srv.Addr()), redis.SetKeyPrefix("app:"))
+	defer client.Close()
+
+	store := NewRedisStore(client)
+	ctx := context.Background()
+	store.Set(ctx, "a", []byte("1"), time.Second)
+	store.Set(ctx, "b", []byte("2"), 0)
+	if v, ok, err := store.Get(ctx, "a"); err != nil || !ok || string(v) != "1" {
+		t.Fatalf("读取缓存结果错误：%s,%t,%v", v, ok, err)
+	}
+
+	srv.FastForward(time.Second)
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Fatal("缓存过期后不应被读取")
+	}
+
+	store.Delete(ctx, "b")
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Fatal("删除后不应被读取")
+	}
+
+	// 共享存储时，其它实例的失效对当前实例可见
+	c1, c2 := New(store, time.Minute), New(NewRedisStore(client), time.Minute)
+	var items []string
+	c1.Load(ctx, NSMenu, "k", &items, func() error { items = []string{"old"}; return nil })
+	c2.Invalidate(ctx, NSMenu)
+	items = nil
+	c1.Load(ctx, NSMenu, "k", &items, func() error { items = []string{"new"}; return nil })
+	if len(items) != 1 || items[0] != "new" {
+		t.Fatalf("失效后应重新加载：%v", items)
+	}
+}
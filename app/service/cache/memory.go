@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+var now = time.Now
+
+// NewMemoryStore 创建进程内的LRU缓存存储(仅适用于单实例部署)，size为最大缓存条数
+func NewMemoryStore(size int) Store {
+	if size <= 0 {
+		size = 10000
+	}
+
+	return &memoryStore{
+		size:  size,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+type memoryItem struct {
+	key     string
+	value   []byte
+	expired time.Time // 为零值时不过期
+}
+
+type memoryStore struct {
+	sync.Mutex
+	size  int
+	items map[string]*list.Element
+	lru   *list.List // 最近使用的在前
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	item := e.Value.(*memoryItem)
+	if !item.expired.IsZero() && !now().Before(item.expired) {
+		s.remove(e)
+		return nil, false, nil
+	}
+
+	s.lru.MoveToFront(e)
+	return item.value, true, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	item := &memoryItem{key: key, value: value}
+	if ttl > 0 {
+		item.expired = now().Add(ttl)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if e, ok := s.items[key]; ok {
+		e.Value = item
+		s.lru.MoveToFront(e)
+		return nil
+	}
+
+	s.items[key] = s.lru.PushFront(item)
+	for s.lru.Len() > s.size {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+func (s *memoryStore) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.items, e.Value.(*memoryItem).key)
+}
+
+func (s *memoryStore) Delete(_ context.Context, keys ...string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, key := range keys {
+		if e, ok := s.items[key]; ok {
+			s.remove(e)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
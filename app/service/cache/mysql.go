@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"moddns/app/service/mysql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cacheItem 缓存存储项
+type cacheItem struct {
+	ID       int64  `db:"id,primarykey,autoincrement"` // 唯一标识(自增ID)
+	CacheKey string `db:"cache_key,size:191"`          // 缓存键
+	Value    []byte `db:"value"`                       // 缓存数据
+	Expired  int64  `db:"expired"`                     // 过期时间(毫秒，0表示不过期)
+}
+
+// NewMySQLStore 创建基于数据库(MySQL、PostgreSQL)的缓存存储(多实例共享)
+func NewMySQLStore(db *mysql.DB, tableName string, gcInterval time.Duration) Store {
+	if gcInterval <= 0 {
+		gcInterval = time.Minute
+	}
+
+	db.CreateTableIfNotExists(cacheItem{}, tableName)
+	db.CreateTableIndex(tableName, "idx_cache_key", true, "cache_key")
+	db.CreateTableIndex(tableName, "idx_expired", false, "expired")
+
+	s := &mysqlStore{
+		db:     db.Primary(), // 读取使用主库(避免副本延迟读取到过期的数据)
+		table:  tableName,
+		ticker: time.NewTicker(gcInterval),
+	}
+	go s.gc()
+
+	return s
+}
+
+type mysqlStore struct {
+	db     *mysql.DB
+	table  string
+	ticker *time.Ticker
+}
+
+func (s *mysqlStore) gc() {
+	for range s.ticker.C {
+		query := fmt.Sprintf("DELETE FROM %s WHERE expired>0 AND expired<?", s.table)
+		s.db.Exec(query, toMillis(now()))
+	}
+}
+
+func (s *mysqlStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var items []*cacheItem
+	query := fmt.Sprintf("SELECT id,cache_key,value,expired FROM %s WHERE cache_key=?", s.table)
+	_, err := s.db.WithContext(ctx).Select(&items, query, key)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "读取缓存发生错误")
+	} else if len(items) == 0 {
+		return nil, false, nil
+	}
+
+	item := items[0]
+	if item.Expired > 0 && item.Expired <= toMillis(now()) {
+		return nil, false, nil
+	}
+	return item.Value, true, nil
+}
+
+func (s *mysqlStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	var expired int64
+	if ttl > 0 {
+		expired = toMillis(now().Add(ttl))
+	}
+
+	query := s.db.Dialect().UpsertSQL(s.table, []string{"cache_key"},
+		[]string{"cache_key", "value", "expired"}, []string{"value", "expired"})
+	_, err := s.db.WithContext(ctx).Exec(query, key, value, expired)
+	if err != nil {
+		return errors.Wrap(err, "写入缓存发生错误")
+	}
+	return nil
+}
+
+func (s *mysqlStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	db := s.db.WithContext(ctx)
+	query, args, err := db.In(fmt.Sprintf("DELETE FROM %s WHERE cache_key IN(?)", s.table), keys)
+	if err != nil {
+		return errors.Wrap(err, "删除缓存发生错误")
+	}
+
+	_, err = db.Exec(query, args...)
+	if err != nil {
+		return errors.Wrap(err, "删除缓存发生错误")
+	}
+	return nil
+}
+
+func (s *mysqlStore) Close() error {
+	s.ticker.Stop()
+	return nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"moddns/app/service/redis"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewRedisStore 创建基于Redis的缓存存储(多实例共享，过期由Redis处理)，客户端由调用方关闭
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+type redisStore struct {
+	client *redis.Client
+}
+
+func (s *redisStore) key(key string) string {
+	return s.client.Key("cache:" + key)
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := redis.Bytes(s.client.Do(ctx, "GET", s.key(key)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, false, nil
+		}
+		return nil, false, errors.Wrap(err, "读取缓存发生错误")
+	}
+	return value, true, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{"SET", s.key(key), value}
+	if ms := int64(ttl / time.Millisecond); ms > 0 {
+		args = append(args, "PX", ms)
+	}
+
+	_, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return errors.Wrap(err, "写入缓存发生错误")
+	}
+	return nil
+}
+
+func (s *redisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, key := range keys {
+		args = append(args, s.key(key))
+	}
+
+	_, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return errors.Wrap(err, "删除缓存发生错误")
+	}
+	return nil
+}
+
+func (s *redisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,283 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type (
+	// Logger 定义日志输出
+	Logger interface {
+		Printf(format string, args ...interface{})
+	}
+
+	// Option 配置项
+	Option func(*options)
+
+	options struct {
+		certFile     string // 证书文件
+		keyFile      string // 私钥文件
+		clientCAFile string // 客户端CA证书文件
+		watch        bool   // 监听文件变化
+		logger       Logger // 日志
+	}
+)
+
+// SetCertFile 设定证书文件
+func SetCertFile(certFile string) Option {
+	return func(o *options) {
+		o.certFile = certFile
+	}
+}
+
+// SetKeyFile 设定私钥文件
+func SetKeyFile(keyFile string) Option {
+	return func(o *options) {
+		o.keyFile = keyFile
+	}
+}
+
+// SetClientCAFile 设定客户端CA证书文件
+func SetClientCAFile(clientCAFile string) Option {
+	return func(o *options) {
+		o.clientCAFile = clientCAFile
+	}
+}
+
+// SetWatch 设定是否监听文件变化
+func SetWatch(watch bool) Option {
+	return func(o *options) {
+		o.watch = watch
+	}
+}
+
+// SetLogger 设定日志
+func SetLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// NewReloader 创建证书加载器，在文件变化或收到SIGHUP信号时重新加载证书，
+// 新证书仅作用于新的握手，不影响已建立的连接
+func NewReloader(opts ...Option) (*Reloader, error) {
+	o := &options{
+		watch:  true,
+		logger: log.New(os.Stderr, "", log.LstdFlags),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	r := &Reloader{
+		opts:   o,
+		signal: make(chan os.Signal, 1),
+		done:   make(chan struct{}),
+	}
+
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.watch {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+
+		dirs := make(map[string]struct{})
+		for _, name := range []string{o.certFile, o.keyFile, o.clientCAFile} {
+			if name == "" {
+				continue
+			}
+			// 监听目录以兼容通过符号链接替换文件的部署方式
+			dirs[filepath.Dir(name)] = struct{}{}
+		}
+		for dir := range dirs {
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return nil, err
+			}
+		}
+		r.watcher = watcher
+	}
+
+	signal.Notify(r.signal, syscall.SIGHUP)
+	go r.run()
+
+	return r, nil
+}
+
+// Reloader 证书加载器
+type Reloader struct {
+	sync.RWMutex
+	opts      *options
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	watcher   *fsnotify.Watcher
+	signal    chan os.Signal
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Reload 重新加载证书
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.opts.certFile, r.opts.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书发生错误：%s", err.Error())
+	}
+
+	var pool *x509.CertPool
+	if r.opts.clientCAFile != "" {
+		buf, err := ioutil.ReadFile(r.opts.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("加载客户端CA证书发生错误：%s", err.Error())
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("客户端CA证书[%s]中没有有效的证书", r.opts.clientCAFile)
+		}
+	}
+
+	r.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.Unlock()
+
+	return nil
+}
+
+// GetCertificate 获取当前证书(用于tls.Config.GetCertificate)
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert, nil
+}
+
+// ClientCAs 获取当前客户端CA证书池
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.clientCAs
+}
+
+// TLSConfig 基于base配置生成每次握手使用当前证书的TLS配置
+func (r *Reloader) TLSConfig(base *tls.Config) *tls.Config {
+	if base == nil {
+		base = new(tls.Config)
+	}
+
+	cfg := base.Clone()
+	cfg.GetCertificate = r.GetCertificate
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.GetCertificate = r.GetCertificate
+		c.ClientCAs = r.ClientCAs()
+		return c, nil
+	}
+	cfg.ClientCAs = r.ClientCAs()
+
+	return cfg
+}
+
+func (r *Reloader) run() {
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	if r.watcher != nil {
+		events = r.watcher.Events
+		errs = r.watcher.Errors
+	}
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.signal:
+			r.reload("SIGHUP")
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if r.isWatched(ev.Name) {
+				r.reload(ev.String())
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			r.opts.logger.Printf("监听证书文件发生错误：%s", err.Error())
+		}
+	}
+}
+
+func (r *Reloader) isWatched(name string) bool {
+	dir := filepath.Dir(name)
+	for _, f := range []string{r.opts.certFile, r.opts.keyFile, r.opts.clientCAFile} {
+		if f == "" {
+			continue
+		}
+		// 符号链接替换时变化的是同目录下的其它文件(如..data)
+		if filepath.Dir(f) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) reload(reason string) {
+	if err := r.Reload(); err != nil {
+		r.opts.logger.Printf("重新加载证书(%s)失败，继续使用原证书：%s", reason, err.Error())
+		return
+	}
+	r.opts.logger.Printf("重新加载证书(%s)完成", reason)
+}
+
+// Close 停止监听
+func (r *Reloader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		signal.Stop(r.signal)
+		close(r.done)
+		if r.watcher != nil {
+			err = r.watcher.Close()
+		}
+	})
+	return err
+}
+
+// Identity 获取客户端证书的身份标识(cn:通用名称 email:邮箱 dns:域名)
+func Identity(cert *x509.Certificate, field string) string {
+	if cert == nil {
+		return ""
+	}
+
+	switch field {
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
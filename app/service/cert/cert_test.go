@@ -0,0 +1,168 @@
+package cert_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"moddns/app/service/cert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Printf(format string, args ...interface{}) {
+	l.t.Logf(format, args...)
+}
+
+// writeCert 生成自签名证书并写入文件
+func writeCert(t *testing.T, certFile, keyFile, cn string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{cn + ".example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 先写入临时文件再重命名，避免加载到写入一半的文件
+	write := func(name, typ string, buf []byte) {
+		tmp := name + ".tmp"
+		if err := ioutil.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: buf}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(keyFile, "EC PRIVATE KEY", keyDER)
+	write(certFile, "CERTIFICATE", der)
+}
+
+func commonName(t *testing.T, r *cert.Reloader) string {
+	c, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCert(t, certFile, keyFile, "v1")
+
+	r, err := cert.NewReloader(
+		cert.SetCertFile(certFile),
+		cert.SetKeyFile(keyFile),
+		cert.SetClientCAFile(certFile),
+		cert.SetLogger(testLogger{t}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if cn := commonName(t, r); cn != "v1" {
+		t.Fatalf("证书错误：%s", cn)
+	}
+	if r.ClientCAs() == nil {
+		t.Fatal("应加载客户端CA证书")
+	}
+
+	cfg := r.TLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})
+	if cfg.GetCertificate == nil || cfg.GetConfigForClient == nil {
+		t.Fatal("TLS配置应使用当前证书")
+	}
+
+	// 文件变化后自动重新加载
+	writeCert(t, certFile, keyFile, "v2")
+	deadline := time.Now().Add(5 * time.Second)
+	for commonName(t, r) != "v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("文件变化后应重新加载证书")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	c, err := cfg.GetConfigForClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.GetCertificate(nil); got == nil {
+		t.Fatal("握手时应获取到当前证书")
+	}
+
+	// 新证书无效时继续使用原证书
+	if err := ioutil.WriteFile(certFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("无效的证书应加载失败")
+	}
+	if cn := commonName(t, r); cn != "v2" {
+		t.Fatalf("加载失败时应保留原证书：%s", cn)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	c := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice"},
+		EmailAddresses: []string{"alice@example.com", "a@example.com"},
+		DNSNames:       []string{"alice.example.com"},
+	}
+
+	cases := []struct {
+		field    string
+		expected string
+	}{
+		{"", "alice"},
+		{"cn", "alice"},
+		{"email", "alice@example.com"},
+		{"dns", "alice.example.com"},
+	}
+	for _, item := range cases {
+		if v := cert.Identity(c, item.field); v != item.expected {
+			t.Fatalf("字段[%s]的身份标识错误：%s", item.field, v)
+		}
+	}
+
+	if v := cert.Identity(&x509.Certificate{}, "email"); v != "" {
+		t.Fatalf("缺少字段时应返回空：%s", v)
+	}
+	if v := cert.Identity(nil, "cn"); v != "" {
+		t.Fatalf("证书为空时应返回空：%s", v)
+	}
+}
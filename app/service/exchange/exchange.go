@@ -0,0 +1,286 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// 数据交换格式
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+// ParseFormat 解析数据交换格式(为空时默认为csv，兼容json及文件扩展名)
+func ParseFormat(s string) (string, error) {
+	s = strings.ToLower(strings.TrimPrefix(filepath.Ext("."+s), "."))
+	switch s {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatJSONL, "json", "ndjson":
+		return FormatJSONL, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("不支持的数据格式：%s", s)
+}
+
+// ContentType 数据交换格式对应的响应类型
+func ContentType(format string) string {
+	switch format {
+	case FormatJSONL:
+		return "application/x-ndjson; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Writer 数据导出
+type Writer interface {
+	// 写入一行数据(与导出列一一对应)
+	Write(values []string) error
+	// 完成导出
+	Close() error
+}
+
+// NewWriter 创建数据导出，columns为导出列(写入表头或作为JSON的键)
+func NewWriter(w io.Writer, format string, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w), columns: columns}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	}
+	return nil, fmt.Errorf("不支持的数据格式：%s", format)
+}
+
+// Row 导入的一行数据
+type Row struct {
+	Line   int               // 行号(从1开始，csv及xlsx包含表头行)
+	Values map[string]string // 列名与值
+}
+
+// Get 获取列的值(去除首尾空白)
+func (r *Row) Get(column string) string {
+	return strings.TrimSpace(r.Values[column])
+}
+
+// ReadAll 读取导入的全部数据，csv及xlsx以首行作为列名
+func ReadAll(r io.Reader, format string) ([]*Row, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取导入数据发生错误")
+	}
+
+	switch format {
+	case FormatCSV:
+		return readCSV(buf)
+	case FormatJSONL:
+		return readJSONL(buf)
+	case FormatXLSX:
+		return readXLSX(buf)
+	}
+	return nil, fmt.Errorf("不支持的数据格式：%s", format)
+}
+
+// SplitList 拆分以|分隔的多个值(忽略空值)
+func SplitList(s string) []string {
+	var items []string
+	for _, v := range strings.Split(s, "|") {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// JoinList 以|连接多个值
+func JoinList(items []string) string {
+	return strings.Join(items, "|")
+}
+
+// formulaPrefixes 电子表格软件视为公式的首字符
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula 以'开头的值或可能被电子表格软件作为公式执行的值前面添加'(防止公式注入)，导入时由unescapeFormula还原
+func escapeFormula(v string) string {
+	if v != "" && strings.ContainsRune(formulaPrefixes+"'", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// unescapeFormula 还原escapeFormula添加的'
+func unescapeFormula(v string) string {
+	if len(v) > 1 && v[0] == '\'' && strings.ContainsRune(formulaPrefixes+"'", rune(v[1])) {
+		return v[1:]
+	}
+	return v
+}
+
+// escapeFormulas 对一行数据防止公式注入
+func escapeFormulas(values []string) []string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = escapeFormula(v)
+	}
+	return items
+}
+
+// 以UTF-8 BOM开头，便于Excel正确识别中文
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []string) (Writer, error) {
+	if _, err := w.Write(utf8BOM); err != nil {
+		return nil, errors.Wrap(err, "写入导出数据发生错误")
+	}
+
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (a *csvWriter) Write(values []string) error {
+	if err := a.w.Write(escapeFormulas(values)); err != nil {
+		return errors.Wrap(err, "写入导出数据发生错误")
+	}
+	return nil
+}
+
+func (a *csvWriter) Close() error {
+	a.w.Flush()
+	if err := a.w.Error(); err != nil {
+		return errors.Wrap(err, "写入导出数据发生错误")
+	}
+	return nil
+}
+
+func readCSV(buf []byte) ([]*Row, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(buf, utf8BOM)))
+	r.FieldsPerRecord = -1
+
+	var (
+		records [][]string
+		lines   []int
+	)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "解析CSV数据发生错误")
+		}
+
+		line, _ := r.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	return tableRows(records, lines), nil
+}
+
+type jsonlWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func (a *jsonlWriter) Write(values []string) error {
+	obj := make(map[string]string, len(a.columns))
+	for i, col := range a.columns {
+		if i < len(values) {
+			obj[col] = values[i]
+		}
+	}
+
+	if err := a.enc.Encode(obj); err != nil {
+		return errors.Wrap(err, "写入导出数据发生错误")
+	}
+	return nil
+}
+
+func (a *jsonlWriter) Close() error {
+	return nil
+}
+
+func readJSONL(buf []byte) ([]*Row, error) {
+	var rows []*Row
+	for i, line := range bytes.Split(buf, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal(line, &obj); err != nil {
+			return nil, errors.Wrapf(err, "解析第%d行JSON数据发生错误", i+1)
+		}
+
+		values := make(map[string]string, len(obj))
+		for k, v := range obj {
+			switch vv := v.(type) {
+			case nil:
+			case string:
+				values[k] = vv
+			case []interface{}:
+				items := make([]string, len(vv))
+				for j, item := range vv {
+					items[j] = fmt.Sprint(item)
+				}
+				values[k] = JoinList(items)
+			default:
+				values[k] = fmt.Sprint(vv)
+			}
+		}
+		rows = append(rows, &Row{Line: i + 1, Values: values})
+	}
+	return rows, nil
+}
+
+// tableRows 将首行作为列名转换表格数据(忽略空行并还原导出时防止公式注入添加的')，lines为每行数据的行号
+func tableRows(records [][]string, lines []int) []*Row {
+	if len(records) == 0 {
+		return nil
+	}
+
+	header := make([]string, len(records[0]))
+	for i, col := range records[0] {
+		header[i] = strings.TrimSpace(col)
+	}
+
+	var rows []*Row
+	for i, record := range records[1:] {
+		values := make(map[string]string, len(header))
+		empty := true
+		for j, v := range record {
+			if j >= len(header) || header[j] == "" {
+				continue
+			}
+			values[header[j]] = unescapeFormula(v)
+			if strings.TrimSpace(v) != "" {
+				empty = false
+			}
+		}
+
+		if !empty {
+			rows = append(rows, &Row{Line: lines[i+1], Values: values})
+		}
+	}
+	return rows
+}
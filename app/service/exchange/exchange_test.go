@@ -0,0 +1,183 @@
+package exchange
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	columns := []string{"user_name", "real_name", "roles"}
+	data := [][]string{
+		{"zhangsan", "张三", "管理员|审计员"},
+		{"lisi", "李四, \"小李\"", ""},
+		{"wangwu", "<王五> & co", "管理员"},
+		{"zhaoliu", "=HYPERLINK(\"http://x\")", "'+1"},
+		{"qianqi", "@SUM(A1)", "''-1"},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSONL, FormatXLSX} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format, columns)
+		if err != nil {
+			t.Fatalf("%s：%v", format, err)
+		}
+		for _, values := range data {
+			if err := w.Write(values); err != nil {
+				t.Fatalf("%s：%v", format, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s：%v", format, err)
+		}
+
+		rows, err := ReadAll(&buf, format)
+		if err != nil {
+			t.Fatalf("%s：%v", format, err)
+		} else if len(rows) != len(data) {
+			t.Fatalf("%s的数据行数错误：%d", format, len(rows))
+		}
+
+		for i, row := range rows {
+			for j, col := range columns {
+				if v := row.Values[col]; v != data[i][j] {
+					t.Errorf("%s第%d行%s的值错误：%q", format, row.Line, col, v)
+				}
+			}
+		}
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	cases := map[string]string{
+		"":        "",
+		"张三":      "张三",
+		"=1+1":    "'=1+1",
+		"+1":      "'+1",
+		"-1":      "'-1",
+		"@SUM(1)": "'@SUM(1)",
+		"\tx":     "'\tx",
+		"'x":      "''x",
+		"a=1":     "a=1",
+	}
+	for v, expected := range cases {
+		if s := escapeFormula(v); s != expected {
+			t.Errorf("%q应转换为%q，实际为%q", v, expected, s)
+		} else if s := unescapeFormula(s); s != v {
+			t.Errorf("%q未还原：%q", v, s)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatCSV, []string{"real_name"})
+	w.Write([]string{"=1+1"})
+	w.Close()
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n'=1+1\n")) {
+		t.Errorf("导出的CSV未防止公式注入：%q", buf.String())
+	}
+}
+
+func TestReadCSVLines(t *testing.T) {
+	src := "\xEF\xBB\xBFname,memo\n\nfoo,\"a\nb\"\n,\nbar,x\n"
+	rows, err := ReadAll(bytes.NewBufferString(src), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []int
+	for _, row := range rows {
+		lines = append(lines, row.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{3, 6}) {
+		t.Errorf("行号错误：%v", lines)
+	}
+}
+
+func TestReadXLSXSharedStrings(t *testing.T) {
+	rows, err := readXLSX(testXLSX(t,
+		`<sst><si><t>name</t></si><si><r><t>张</t></r><r><t>三</t></r></si></sst>`,
+		`<worksheet><sheetData><row r="2"><c r="B2" t="s"><v>0</v></c></row><row r="4"><c r="B4" t="s"><v>1</v></c><c r="C4"><v>12</v></c></row></sheetData></worksheet>`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rows) != 1 {
+		t.Fatalf("数据行数错误：%d", len(rows))
+	}
+
+	if rows[0].Line != 4 || rows[0].Get("name") != "张三" {
+		t.Errorf("数据错误：%d %v", rows[0].Line, rows[0].Values)
+	}
+}
+
+func TestReadXLSXLimits(t *testing.T) {
+	_, err := readXLSX(testXLSX(t, `<sst></sst>`,
+		`<worksheet><sheetData><row r="1"><c r="ZZZZZZZ1"><v>1</v></c></row></sheetData></worksheet>`,
+	))
+	if err == nil {
+		t.Error("超出最大列数时未返回错误")
+	}
+
+	// 压缩后很小，解压后超过限制
+	sheet := `<worksheet><sheetData><row r="1"><c r="A1"><v>` + strings.Repeat("0", maxXLSXPartSize) + `</v></c></row></sheetData></worksheet>`
+	buf := testXLSX(t, `<sst></sst>`, sheet)
+	if len(buf) > 1<<20 {
+		t.Fatalf("压缩后的大小错误：%d", len(buf))
+	}
+	if _, err := readXLSX(buf); err == nil {
+		t.Error("解压后超过限制时未返回错误")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	cases := map[string]string{
+		"":           FormatCSV,
+		"CSV":        FormatCSV,
+		"json":       FormatJSONL,
+		"users.xlsx": FormatXLSX,
+	}
+	for s, expected := range cases {
+		if format, err := ParseFormat(s); err != nil || format != expected {
+			t.Errorf("解析%q错误：%s %v", s, format, err)
+		}
+	}
+
+	if _, err := ParseFormat("xls"); err == nil {
+		t.Error("未返回不支持的格式错误")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA", maxXLSXColumns - 1: "XFD"} {
+		if v := columnName(i); v != name {
+			t.Errorf("列名错误：%d %s", i, v)
+		}
+		if v := columnIndex(name + "12"); v != i {
+			t.Errorf("列序号错误：%s %d", name, v)
+		}
+	}
+
+	if v := columnIndex("ZZZZZZZZZZZZZZZZ1"); v != maxXLSXColumns {
+		t.Errorf("超出最大列数的列序号错误：%d", v)
+	}
+}
+
+func testXLSX(t *testing.T, sst, sheet string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"xl/sharedStrings.xml": sst,
+		xlsxSheet:              sheet,
+	} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,260 @@
+package exchange
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// xlsx文件的固定部分(单个工作表，单元格使用内联字符串)
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+const xlsxSheet = "xl/worksheets/sheet1.xml"
+
+// xlsx导入的限制
+const (
+	maxXLSXColumns  = 16384    // 最大列数(列名XFD)
+	maxXLSXPartSize = 64 << 20 // 压缩包中单个文件解压后的最大字节数
+)
+
+// xlsxWriter 流式写入xlsx，工作表为压缩包的最后一个文件，逐行写入
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+func newXLSXWriter(w io.Writer, columns []string) (Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, p := range xlsxParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "写入导出数据发生错误")
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			return nil, errors.Wrap(err, "写入导出数据发生错误")
+		}
+	}
+
+	sheet, err := zw.Create(xlsxSheet)
+	if err != nil {
+		return nil, errors.Wrap(err, "写入导出数据发生错误")
+	}
+
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, errors.Wrap(err, "写入导出数据发生错误")
+	}
+
+	xw := &xlsxWriter{zw: zw, sheet: sheet}
+	if err := xw.Write(columns); err != nil {
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (a *xlsxWriter) Write(values []string) error {
+	a.row++
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<row r="%d">`, a.row)
+	for i, v := range escapeFormulas(values) {
+		fmt.Fprintf(&buf, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(i), a.row)
+		xml.EscapeText(&buf, []byte(v))
+		buf.WriteString(`</t></is></c>`)
+	}
+	buf.WriteString(`</row>`)
+
+	if _, err := a.sheet.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "写入导出数据发生错误")
+	}
+	return nil
+}
+
+func (a *xlsxWriter) Close() error {
+	if _, err := io.WriteString(a.sheet, `</sheetData></worksheet>`); err != nil {
+		return errors.Wrap(err, "写入导出数据发生错误")
+	}
+	if err := a.zw.Close(); err != nil {
+		return errors.Wrap(err, "写入导出数据发生错误")
+	}
+	return nil
+}
+
+// columnName 列序号(从0开始)转换为列名(A、B...Z、AA...)
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// columnIndex 单元格引用(如B3)转换为列序号(从0开始)，无效时返回-1，超出最大列数时返回maxXLSXColumns
+func columnIndex(ref string) int {
+	index := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		index = index*26 + int(c-'A') + 1
+		if index > maxXLSXColumns {
+			return maxXLSXColumns
+		}
+	}
+	return index - 1
+}
+
+type xlsxText struct {
+	T string     `xml:"t"`
+	R []xlsxText `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+
+	var s strings.Builder
+	for _, r := range t.R {
+		s.WriteString(r.T)
+	}
+	return s.String()
+}
+
+type xlsxCell struct {
+	Ref   string    `xml:"r,attr"`
+	Type  string    `xml:"t,attr"`
+	Value string    `xml:"v"`
+	IS    *xlsxText `xml:"is"`
+}
+
+type xlsxRow struct {
+	Num   int        `xml:"r,attr"`
+	Cells []xlsxCell `xml:"c"`
+}
+
+// readXLSX 读取xlsx第一个工作表的数据(支持共享字符串及内联字符串)
+func readXLSX(buf []byte) ([]*Row, error) {
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return nil, errors.Wrap(err, "解析XLSX数据发生错误")
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(f, &sst); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[xlsxSheet]
+	if !ok {
+		return nil, errors.New("XLSX文件中未找到工作表")
+	}
+
+	var sheet struct {
+		Rows []xlsxRow `xml:"sheetData>row"`
+	}
+	if err := decodeZipXML(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	var (
+		records [][]string
+		lines   []int
+	)
+	for i, row := range sheet.Rows {
+		line := row.Num
+		if line == 0 {
+			line = i + 1
+		}
+
+		var record []string
+		for j, c := range row.Cells {
+			index := j
+			if c.Ref != "" {
+				index = columnIndex(c.Ref)
+			}
+			if index < 0 {
+				continue
+			} else if index >= maxXLSXColumns {
+				return nil, fmt.Errorf("第%d行的单元格[%s]超出最大列数%d", line, c.Ref, maxXLSXColumns)
+			}
+			for len(record) <= index {
+				record = append(record, "")
+			}
+
+			switch c.Type {
+			case "s":
+				n, _ := strconv.Atoi(c.Value)
+				if n >= 0 && n < len(sst.Items) {
+					record[index] = sst.Items[n].String()
+				}
+			case "inlineStr":
+				if c.IS != nil {
+					record[index] = c.IS.String()
+				}
+			default:
+				record[index] = c.Value
+			}
+		}
+
+		// 跳过表头之前的空行
+		if len(records) == 0 && len(record) == 0 {
+			continue
+		}
+
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	return tableRows(records, lines), nil
+}
+
+func decodeZipXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return errors.Wrap(err, "解析XLSX数据发生错误")
+	}
+	defer rc.Close()
+
+	// 限制解压后的大小(压缩率极高的文件解压后可能耗尽内存)
+	buf, err := ioutil.ReadAll(io.LimitReader(rc, maxXLSXPartSize+1))
+	if err != nil {
+		return errors.Wrap(err, "解析XLSX数据发生错误")
+	} else if len(buf) > maxXLSXPartSize {
+		return fmt.Errorf("XLSX文件[%s]解压后超过%dMB", f.Name, maxXLSXPartSize>>20)
+	}
+
+	if err := xml.Unmarshal(buf, v); err != nil {
+		return errors.Wrapf(err, "解析XLSX文件[%s]发生错误", f.Name)
+	}
+	return nil
+}
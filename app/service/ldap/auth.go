@@ -0,0 +1,284 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUserNotFound 目录中不存在该用户
+	ErrUserNotFound = errors.New("ldap: 用户不存在")
+	// ErrInvalidCredentials 用户的密码错误
+	ErrInvalidCredentials = errors.New("ldap: 无效的凭据")
+)
+
+type (
+	// Option 认证的配置项
+	Option func(*options)
+
+	options struct {
+		url           string        // 服务端地址
+		bindDN        string        // 搜索使用的服务账户DN(为空时匿名搜索)
+		bindPassword  string        // 服务账户的密码
+		baseDN        string        // 搜索用户的基准DN
+		userFilter    string        // 搜索用户的过滤器(%s替换为转义后的用户名)
+		nameAttribute string        // 真实姓名的属性
+		groupBaseDN   string        // 搜索组的基准DN(为空时使用baseDN)
+		groupFilter   string        // 搜索组的过滤器(%s替换为转义后的用户DN，为空时不搜索)
+		groupAttr     string        // 组名称的属性
+		memberOfAttr  string        // 用户条目中记录所属组DN的属性(如Active Directory的memberOf)
+		startTLS      bool          // 是否使用StartTLS
+		tlsConfig     *tls.Config   // TLS配置(ldaps或StartTLS)
+		timeout       time.Duration // 连接及操作的超时时间
+	}
+)
+
+// SetURL 设置服务端地址(格式：ldap://host:389或ldaps://host:636)
+func SetURL(url string) Option {
+	return func(o *options) {
+		o.url = url
+	}
+}
+
+// SetBind 设置搜索使用的服务账户
+func SetBind(dn, password string) Option {
+	return func(o *options) {
+		o.bindDN = dn
+		o.bindPassword = password
+	}
+}
+
+// SetBaseDN 设置搜索用户的基准DN
+func SetBaseDN(dn string) Option {
+	return func(o *options) {
+		o.baseDN = dn
+	}
+}
+
+// SetUserFilter 设置搜索用户的过滤器(%s替换为转义后的用户名)
+func SetUserFilter(filter string) Option {
+	return func(o *options) {
+		o.userFilter = filter
+	}
+}
+
+// SetNameAttribute 设置真实姓名的属性
+func SetNameAttribute(attr string) Option {
+	return func(o *options) {
+		o.nameAttribute = attr
+	}
+}
+
+// SetGroupSearch 设置搜索用户所属组的基准DN、过滤器(%s替换为转义后的用户DN)及组名称的属性
+func SetGroupSearch(baseDN, filter, attr string) Option {
+	return func(o *options) {
+		o.groupBaseDN = baseDN
+		o.groupFilter = filter
+		if attr != "" {
+			o.groupAttr = attr
+		}
+	}
+}
+
+// SetMemberOfAttribute 设置用户条目中记录所属组DN的属性
+func SetMemberOfAttribute(attr string) Option {
+	return func(o *options) {
+		o.memberOfAttr = attr
+	}
+}
+
+// SetStartTLS 设置是否使用StartTLS
+func SetStartTLS(startTLS bool) Option {
+	return func(o *options) {
+		o.startTLS = startTLS
+	}
+}
+
+// SetTLSConfig 设置TLS配置
+func SetTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// SetTimeout 设置连接及操作的超时时间
+func SetTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// NewAuthenticator 创建LDAP认证
+func NewAuthenticator(opts ...Option) *Authenticator {
+	o := &options{
+		url:           "ldap://127.0.0.1:389",
+		userFilter:    "(uid=%s)",
+		nameAttribute: "cn",
+		groupAttr:     "cn",
+		timeout:       defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Authenticator{opts: o}
+}
+
+// Authenticator LDAP认证：使用服务账户搜索用户，再以用户的DN及密码绑定校验
+type Authenticator struct {
+	opts *options
+}
+
+// UserInfo 通过认证的用户信息
+type UserInfo struct {
+	DN       string   // 用户的DN
+	UserName string   // 用户名
+	RealName string   // 真实姓名
+	Groups   []string // 所属组(包含组的DN及名称)
+}
+
+// Authenticate 认证用户，用户不存在时返回ErrUserNotFound，密码错误时返回ErrInvalidCredentials
+func (a *Authenticator) Authenticate(ctx context.Context, userName, password string) (*UserInfo, error) {
+	// 空密码的绑定会被服务端视为匿名绑定而成功
+	if userName == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := a.bindService(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	attrs := []string{a.opts.nameAttribute}
+	if a.opts.memberOfAttr != "" {
+		attrs = append(attrs, a.opts.memberOfAttr)
+	}
+	entries, err := conn.Search(ctx, &SearchRequest{
+		BaseDN:     a.opts.baseDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     strings.Replace(a.opts.userFilter, "%s", EscapeFilter(userName), -1),
+		Attributes: attrs,
+		SizeLimit:  2,
+	})
+	if err != nil && !IsErrorCode(err, ResultSizeLimitExceeded) {
+		return nil, err
+	} else if len(entries) == 0 {
+		return nil, ErrUserNotFound
+	} else if len(entries) > 1 {
+		return nil, fmt.Errorf("ldap: 用户名[%s]匹配到多个条目", userName)
+	}
+	entry := entries[0]
+
+	if err := conn.Bind(ctx, entry.DN, password); err != nil {
+		if IsErrorCode(err, ResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	info := &UserInfo{
+		DN:       entry.DN,
+		UserName: userName,
+		RealName: entry.GetFirst(a.opts.nameAttribute),
+	}
+	for _, dn := range entry.Get(a.opts.memberOfAttr) {
+		info.Groups = append(info.Groups, dn)
+		if name := firstRDNValue(dn); name != "" {
+			info.Groups = append(info.Groups, name)
+		}
+	}
+
+	if a.opts.groupFilter != "" {
+		// 用户不一定具有搜索组的权限，使用服务账户重新绑定
+		if err := a.bindService(ctx, conn); err != nil {
+			return nil, err
+		}
+
+		groups, err := a.searchGroups(ctx, conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		info.Groups = append(info.Groups, groups...)
+	}
+
+	return info, nil
+}
+
+// dial 连接服务端(按配置升级为TLS连接)
+func (a *Authenticator) dial(ctx context.Context) (*Conn, error) {
+	conn, err := Dial(ctx, a.opts.url, a.opts.tlsConfig, a.opts.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.opts.startTLS {
+		if err := conn.StartTLS(ctx, a.opts.tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindService 使用服务账户绑定(未配置时保持匿名)
+func (a *Authenticator) bindService(ctx context.Context, conn *Conn) error {
+	if a.opts.bindDN == "" {
+		return conn.Bind(ctx, "", "")
+	}
+
+	if err := conn.Bind(ctx, a.opts.bindDN, a.opts.bindPassword); err != nil {
+		return fmt.Errorf("ldap: 服务账户绑定失败：%s", err.Error())
+	}
+	return nil
+}
+
+// searchGroups 搜索用户所属的组，返回组的DN及名称
+func (a *Authenticator) searchGroups(ctx context.Context, conn *Conn, userDN string) ([]string, error) {
+	baseDN := a.opts.groupBaseDN
+	if baseDN == "" {
+		baseDN = a.opts.baseDN
+	}
+
+	entries, err := conn.Search(ctx, &SearchRequest{
+		BaseDN:     baseDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     strings.Replace(a.opts.groupFilter, "%s", EscapeFilter(userDN), -1),
+		Attributes: []string{a.opts.groupAttr},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []string
+	for _, entry := range entries {
+		groups = append(groups, entry.DN)
+		groups = append(groups, entry.Get(a.opts.groupAttr)...)
+	}
+	return groups, nil
+}
+
+// firstRDNValue 获取DN中第一个RDN的值(如cn=admins,ou=groups,dc=example,dc=com返回admins)
+func firstRDNValue(dn string) string {
+	rdn := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+		} else if dn[i] == ',' {
+			rdn = dn[:i]
+			break
+		}
+	}
+
+	if i := strings.IndexByte(rdn, '='); i >= 0 {
+		return strings.TrimSpace(strings.Replace(rdn[i+1:], "\\", "", -1))
+	}
+	return ""
+}
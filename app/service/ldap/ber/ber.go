@@ -0,0 +1,223 @@
+// Package ber 实现LDAP协议使用的BER编码子集(仅支持单字节标识及确定长度)
+package ber
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 标识的类别及构造位
+const (
+	ClassUniversal   byte = 0x00 // 通用类
+	ClassApplication byte = 0x40 // 应用类
+	ClassContext     byte = 0x80 // 上下文类
+	TypeConstructed  byte = 0x20 // 构造类型
+)
+
+// 通用类标签
+const (
+	TagBoolean     byte = 0x01
+	TagInteger     byte = 0x02
+	TagOctetString byte = 0x04
+	TagNull        byte = 0x05
+	TagEnumerated  byte = 0x0a
+	TagSequence    byte = 0x30 // SEQUENCE(含构造位)
+	TagSet         byte = 0x31 // SET(含构造位)
+)
+
+// MaxPacketSize 读取的数据包的最大长度
+const MaxPacketSize = 16 << 20
+
+// ErrMalformed 数据包格式错误
+var ErrMalformed = errors.New("ber: 数据包格式错误")
+
+// Packet 数据包(构造类型的内容由子数据包组成)
+type Packet struct {
+	Tag      byte      // 标识(类别|构造位|标签号)
+	Value    []byte    // 基本类型的内容
+	Children []*Packet // 构造类型的子数据包
+}
+
+// NewConstructed 创建构造类型的数据包(标识自动添加构造位)
+func NewConstructed(tag byte, children ...*Packet) *Packet {
+	return &Packet{Tag: tag | TypeConstructed, Children: children}
+}
+
+// NewString 创建字符串类型的数据包
+func NewString(tag byte, s string) *Packet {
+	return &Packet{Tag: tag, Value: []byte(s)}
+}
+
+// NewInteger 创建整数类型的数据包(二进制补码，大端序)
+func NewInteger(tag byte, n int64) *Packet {
+	var buf []byte
+	for {
+		buf = append([]byte{byte(n)}, buf...)
+		n >>= 8
+		if (n == 0 && buf[0]&0x80 == 0) || (n == -1 && buf[0]&0x80 != 0) {
+			break
+		}
+	}
+	return &Packet{Tag: tag, Value: buf}
+}
+
+// NewBoolean 创建布尔类型的数据包
+func NewBoolean(tag byte, b bool) *Packet {
+	if b {
+		return &Packet{Tag: tag, Value: []byte{0xff}}
+	}
+	return &Packet{Tag: tag, Value: []byte{0x00}}
+}
+
+// Constructed 是否为构造类型
+func (p *Packet) Constructed() bool {
+	return p.Tag&TypeConstructed != 0
+}
+
+// Append 添加子数据包
+func (p *Packet) Append(children ...*Packet) *Packet {
+	p.Children = append(p.Children, children...)
+	return p
+}
+
+// String 获取字符串内容
+func (p *Packet) String() string {
+	return string(p.Value)
+}
+
+// Int 获取整数内容
+func (p *Packet) Int() (int64, error) {
+	if len(p.Value) == 0 || len(p.Value) > 8 {
+		return 0, ErrMalformed
+	}
+
+	n := int64(int8(p.Value[0]))
+	for _, b := range p.Value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// Bool 获取布尔内容
+func (p *Packet) Bool() bool {
+	return len(p.Value) > 0 && p.Value[0] != 0
+}
+
+// Bytes 编码数据包
+func (p *Packet) Bytes() []byte {
+	content := p.Value
+	if p.Constructed() {
+		content = nil
+		for _, c := range p.Children {
+			content = append(content, c.Bytes()...)
+		}
+	}
+
+	buf := append([]byte{p.Tag}, encodeLength(len(content))...)
+	return append(buf, content...)
+}
+
+// encodeLength 编码长度(超过127时使用长格式)
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+
+	var buf []byte
+	for ; n > 0; n >>= 8 {
+		buf = append([]byte{byte(n)}, buf...)
+	}
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
+
+// Read 从r中读取一个数据包
+func Read(r *bufio.Reader) (*Packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, fmt.Errorf("ber: 不支持多字节标识")
+	}
+
+	n, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, n)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parse(tag, content)
+}
+
+// readLength 读取长度(不支持不确定长度)
+func readLength(r *bufio.Reader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	} else if b < 0x80 {
+		return int(b), nil
+	}
+
+	size := int(b & 0x7f)
+	if size == 0 || size > 4 {
+		return 0, ErrMalformed
+	}
+
+	var n int
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | int(b)
+	}
+	if n > MaxPacketSize {
+		return 0, fmt.Errorf("ber: 数据包长度超出限制：%d", n)
+	}
+	return n, nil
+}
+
+// parse 解析数据包的内容(构造类型递归解析子数据包)
+func parse(tag byte, content []byte) (*Packet, error) {
+	p := &Packet{Tag: tag}
+	if !p.Constructed() {
+		p.Value = content
+		return p, nil
+	}
+
+	for len(content) > 0 {
+		if len(content) < 2 || content[0]&0x1f == 0x1f {
+			return nil, ErrMalformed
+		}
+		childTag := content[0]
+
+		n, size := int(content[1]), 2
+		if n >= 0x80 {
+			l := n & 0x7f
+			if l == 0 || l > 4 || len(content) < 2+l {
+				return nil, ErrMalformed
+			}
+			n = 0
+			for _, b := range content[2 : 2+l] {
+				n = n<<8 | int(b)
+			}
+			size += l
+		}
+		if n < 0 || len(content)-size < n {
+			return nil, ErrMalformed
+		}
+
+		child, err := parse(childTag, content[size:size+n])
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, child)
+		content = content[size+n:]
+	}
+	return p, nil
+}
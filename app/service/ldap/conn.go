@@ -0,0 +1,390 @@
+// Package ldap 实现LDAP v3客户端的子集(简单绑定、搜索及StartTLS)，用于目录服务认证
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"moddns/app/service/ldap/ber"
+)
+
+// 协议操作的标签(RFC 4511 4.2)
+const (
+	AppBindRequest      byte = 0x60
+	AppBindResponse     byte = 0x61
+	AppUnbindRequest    byte = 0x42
+	AppSearchRequest    byte = 0x63
+	AppSearchEntry      byte = 0x64
+	AppSearchDone       byte = 0x65
+	AppSearchReference  byte = 0x73
+	AppExtendedRequest  byte = 0x77
+	AppExtendedResponse byte = 0x78
+)
+
+// 结果码
+const (
+	ResultSuccess            = 0
+	ResultOperationsError    = 1
+	ResultProtocolError      = 2
+	ResultSizeLimitExceeded  = 4
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+	ResultInsufficientAccess = 50
+	ResultUnwillingToPerform = 53
+	ResultOther              = 80
+)
+
+const (
+	oidStartTLS         = "1.3.6.1.4.1.1466.20037" // StartTLS扩展操作
+	tagSimpleAuth  byte = 0x80                     // 绑定请求的简单认证(密码)
+	tagRequestName byte = 0x80                     // 扩展请求的名称
+	defaultTimeout      = time.Second * 10
+)
+
+// 搜索范围
+const (
+	ScopeBaseObject   = 0 // 仅基准对象
+	ScopeSingleLevel  = 1 // 基准对象的直接下级
+	ScopeWholeSubtree = 2 // 基准对象及全部下级
+)
+
+// ErrMalformed 响应格式错误
+var ErrMalformed = errors.New("ldap: 响应格式错误")
+
+// Error 服务端返回的错误结果
+type Error struct {
+	ResultCode int    // 结果码
+	Message    string // 诊断信息
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: 结果码%d", e.ResultCode)
+	}
+	return fmt.Sprintf("ldap: 结果码%d(%s)", e.ResultCode, e.Message)
+}
+
+// IsErrorCode 检查错误是否为指定结果码的服务端错误
+func IsErrorCode(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.ResultCode == code
+}
+
+// Entry 搜索结果的条目
+type Entry struct {
+	DN         string              // 条目的DN
+	Attributes map[string][]string // 属性值(属性名为小写)
+}
+
+// Get 获取属性的全部值(属性名不区分大小写)
+func (e *Entry) Get(name string) []string {
+	return e.Attributes[strings.ToLower(name)]
+}
+
+// GetFirst 获取属性的第一个值
+func (e *Entry) GetFirst(name string) string {
+	if vs := e.Get(name); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// SearchRequest 搜索请求
+type SearchRequest struct {
+	BaseDN     string   // 搜索的基准DN
+	Scope      int      // 搜索范围
+	Filter     string   // 过滤器(RFC 4515)
+	Attributes []string // 返回的属性(为空时返回全部用户属性)
+	SizeLimit  int      // 返回的最大条目数(0表示不限制)
+}
+
+// Conn LDAP连接(非并发安全，每次认证使用独立的连接)
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	msgID   int64
+	timeout time.Duration
+}
+
+// Dial 连接服务端，地址格式为ldap://host:389或ldaps://host:636，
+// tlsConfig用于ldaps及StartTLS(为nil时使用默认配置)
+func Dial(ctx context.Context, rawurl string, tlsConfig *tls.Config, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: 无效的地址[%s]：%s", rawurl, err.Error())
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "ldap":
+			host = net.JoinHostPort(u.Hostname(), "389")
+		case "ldaps":
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	case "ldaps":
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			break
+		}
+
+		tlsConn := tls.Client(conn, clientTLSConfig(tlsConfig, u.Hostname()))
+		conn.SetDeadline(time.Now().Add(timeout))
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			break
+		}
+		conn = tlsConn
+	default:
+		return nil, fmt.Errorf("ldap: 不支持的协议：%s", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap: 连接[%s]发生错误：%s", host, err.Error())
+	}
+
+	return &Conn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// clientTLSConfig 复制TLS配置并设置服务端名称
+func clientTLSConfig(cfg *tls.Config, serverName string) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = serverName
+	}
+	return cfg
+}
+
+// StartTLS 将明文连接升级为TLS连接
+func (c *Conn) StartTLS(ctx context.Context, tlsConfig *tls.Config) error {
+	req := ber.NewConstructed(AppExtendedRequest,
+		ber.NewString(tagRequestName, oidStartTLS),
+	)
+
+	resp, err := c.request(ctx, req, AppExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err := resultError(resp); err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	tlsConn := tls.Client(c.conn, clientTLSConfig(tlsConfig, host))
+	c.setDeadline(ctx)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("ldap: TLS握手发生错误：%s", err.Error())
+	}
+
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind 简单绑定(密码为空时服务端将视为匿名绑定，调用方应自行拒绝空密码)
+func (c *Conn) Bind(ctx context.Context, dn, password string) error {
+	req := ber.NewConstructed(AppBindRequest,
+		ber.NewInteger(ber.TagInteger, 3),
+		ber.NewString(ber.TagOctetString, dn),
+		ber.NewString(tagSimpleAuth, password),
+	)
+
+	resp, err := c.request(ctx, req, AppBindResponse)
+	if err != nil {
+		return err
+	}
+	return resultError(resp)
+}
+
+// Search 搜索条目(忽略搜索引用)
+func (c *Conn) Search(ctx context.Context, sr *SearchRequest) ([]*Entry, error) {
+	filter, err := CompileFilter(sr.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := ber.NewConstructed(ber.TagSequence)
+	for _, attr := range sr.Attributes {
+		attrs.Append(ber.NewString(ber.TagOctetString, attr))
+	}
+
+	req := ber.NewConstructed(AppSearchRequest,
+		ber.NewString(ber.TagOctetString, sr.BaseDN),
+		ber.NewInteger(ber.TagEnumerated, int64(sr.Scope)),
+		ber.NewInteger(ber.TagEnumerated, 0), // 不解引用别名
+		ber.NewInteger(ber.TagInteger, int64(sr.SizeLimit)),
+		ber.NewInteger(ber.TagInteger, int64(c.timeout/time.Second)),
+		ber.NewBoolean(ber.TagBoolean, false), // 返回属性值
+		filter,
+		attrs,
+	)
+
+	msgID, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for {
+		op, err := c.receive(msgID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.Tag {
+		case AppSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case AppSearchReference:
+		case AppSearchDone:
+			if err := resultError(op); err != nil {
+				return entries, err
+			}
+			return entries, nil
+		default:
+			return nil, ErrMalformed
+		}
+	}
+}
+
+// parseEntry 解析搜索结果的条目
+func parseEntry(op *ber.Packet) (*Entry, error) {
+	if len(op.Children) < 2 {
+		return nil, ErrMalformed
+	}
+
+	entry := &Entry{
+		DN:         op.Children[0].String(),
+		Attributes: make(map[string][]string),
+	}
+	for _, attr := range op.Children[1].Children {
+		if len(attr.Children) < 2 {
+			return nil, ErrMalformed
+		}
+
+		name := strings.ToLower(attr.Children[0].String())
+		for _, v := range attr.Children[1].Children {
+			entry.Attributes[name] = append(entry.Attributes[name], v.String())
+		}
+	}
+	return entry, nil
+}
+
+// resultError 解析操作结果(LDAPResult)，非成功时返回*Error
+func resultError(op *ber.Packet) error {
+	if len(op.Children) < 3 {
+		return ErrMalformed
+	}
+
+	code, err := op.Children[0].Int()
+	if err != nil {
+		return ErrMalformed
+	} else if code == ResultSuccess {
+		return nil
+	}
+	return &Error{ResultCode: int(code), Message: op.Children[2].String()}
+}
+
+// request 发送请求并读取单个响应
+func (c *Conn) request(ctx context.Context, req *ber.Packet, respTag byte) (*ber.Packet, error) {
+	msgID, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := c.receive(msgID)
+	if err != nil {
+		return nil, err
+	} else if op.Tag != respTag {
+		return nil, ErrMalformed
+	}
+	return op, nil
+}
+
+// setDeadline 设置读写的截止时间(上下文的截止时间优先)
+func (c *Conn) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+}
+
+// send 发送请求消息，返回消息ID
+func (c *Conn) send(ctx context.Context, op *ber.Packet) (int64, error) {
+	c.msgID++
+	msg := ber.NewConstructed(ber.TagSequence,
+		ber.NewInteger(ber.TagInteger, c.msgID),
+		op,
+	)
+
+	c.setDeadline(ctx)
+	if _, err := c.conn.Write(msg.Bytes()); err != nil {
+		return 0, fmt.Errorf("ldap: 发送请求发生错误：%s", err.Error())
+	}
+	return c.msgID, nil
+}
+
+// receive 读取响应消息，返回协议操作
+func (c *Conn) receive(msgID int64) (*ber.Packet, error) {
+	msg, err := ber.Read(c.r)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: 读取响应发生错误：%s", err.Error())
+	} else if msg.Tag != ber.TagSequence || len(msg.Children) < 2 {
+		return nil, ErrMalformed
+	}
+
+	id, err := msg.Children[0].Int()
+	if err != nil {
+		return nil, ErrMalformed
+	} else if id != msgID {
+		// 消息ID为0的为服务端的主动通知(如断开连接)
+		if id == 0 && msg.Children[1].Tag == AppExtendedResponse {
+			if err := resultError(msg.Children[1]); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrMalformed
+	}
+	return msg.Children[1], nil
+}
+
+// Close 发送解除绑定请求并关闭连接
+func (c *Conn) Close() error {
+	c.msgID++
+	msg := ber.NewConstructed(ber.TagSequence,
+		ber.NewInteger(ber.TagInteger, c.msgID),
+		&ber.Packet{Tag: AppUnbindRequest},
+	)
+
+	c.conn.SetDeadline(time.Now().Add(time.Second))
+	c.conn.Write(msg.Bytes())
+	return c.conn.Close()
+}
@@ -0,0 +1,224 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"moddns/app/service/ldap/ber"
+)
+
+// 过滤器的标签(RFC 4511 4.5.1)
+const (
+	FilterAnd            byte = 0xa0
+	FilterOr             byte = 0xa1
+	FilterNot            byte = 0xa2
+	FilterEqualityMatch  byte = 0xa3
+	FilterSubstrings     byte = 0xa4
+	FilterGreaterOrEqual byte = 0xa5
+	FilterLessOrEqual    byte = 0xa6
+	FilterPresent        byte = 0x87
+	FilterApproxMatch    byte = 0xa8
+)
+
+// 子串过滤器的标签
+const (
+	SubstringInitial byte = 0x80
+	SubstringAny     byte = 0x81
+	SubstringFinal   byte = 0x82
+)
+
+// EscapeFilter 转义过滤器中的值(RFC 4515)，拼接用户输入时必须使用
+func EscapeFilter(value string) string {
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&buf, "\\%02x", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// CompileFilter 编译字符串形式的过滤器(RFC 4515，不支持扩展匹配)
+func CompileFilter(filter string) (*ber.Packet, error) {
+	p := &filterParser{s: filter}
+	packet, err := p.parse()
+	if err != nil {
+		return nil, err
+	} else if p.pos != len(p.s) {
+		return nil, p.errorf("过滤器结尾存在多余的内容")
+	}
+	return packet, nil
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("无效的过滤器[%s]：%s", p.s, fmt.Sprintf(format, args...))
+}
+
+// parse 解析括号包围的过滤器
+func (p *filterParser) parse() (*ber.Packet, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return nil, p.errorf("位置%d缺少左括号", p.pos)
+	}
+	p.pos++
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("过滤器不完整")
+	}
+
+	var (
+		packet *ber.Packet
+		err    error
+	)
+	switch p.s[p.pos] {
+	case '&':
+		p.pos++
+		packet, err = p.parseSet(FilterAnd)
+	case '|':
+		p.pos++
+		packet, err = p.parseSet(FilterOr)
+	case '!':
+		p.pos++
+		var child *ber.Packet
+		child, err = p.parse()
+		if err == nil {
+			packet = ber.NewConstructed(FilterNot, child)
+		}
+	default:
+		packet, err = p.parseItem()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		return nil, p.errorf("位置%d缺少右括号", p.pos)
+	}
+	p.pos++
+	return packet, nil
+}
+
+// parseSet 解析与、或过滤器的子过滤器(至少一个)
+func (p *filterParser) parseSet(tag byte) (*ber.Packet, error) {
+	packet := ber.NewConstructed(tag)
+	for p.pos < len(p.s) && p.s[p.pos] == '(' {
+		child, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		packet.Append(child)
+	}
+
+	if len(packet.Children) == 0 {
+		return nil, p.errorf("位置%d缺少子过滤器", p.pos)
+	}
+	return packet, nil
+}
+
+// parseItem 解析属性比较过滤器
+func (p *filterParser) parseItem() (*ber.Packet, error) {
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return nil, p.errorf("过滤器不完整")
+	}
+	item := p.s[p.pos : p.pos+end]
+	p.pos += end
+
+	i := strings.IndexByte(item, '=')
+	if i <= 0 {
+		return nil, p.errorf("无效的比较项：%s", item)
+	}
+	attr, value, tag := item[:i], item[i+1:], FilterEqualityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		attr, tag = attr[:len(attr)-1], FilterGreaterOrEqual
+	case '<':
+		attr, tag = attr[:len(attr)-1], FilterLessOrEqual
+	case '~':
+		attr, tag = attr[:len(attr)-1], FilterApproxMatch
+	case ':':
+		return nil, p.errorf("不支持扩展匹配：%s", item)
+	}
+	if attr == "" || strings.ContainsAny(attr, "()*\\ ") {
+		return nil, p.errorf("无效的属性名：%s", item)
+	}
+
+	if tag == FilterEqualityMatch && value == "*" {
+		return ber.NewString(FilterPresent, attr), nil
+	}
+
+	if tag == FilterEqualityMatch && strings.Contains(value, "*") {
+		return p.parseSubstrings(attr, value)
+	}
+
+	v, err := unescapeFilter(value)
+	if err != nil {
+		return nil, p.errorf("%s", err.Error())
+	}
+	return ber.NewConstructed(tag,
+		ber.NewString(ber.TagOctetString, attr),
+		ber.NewString(ber.TagOctetString, v),
+	), nil
+}
+
+// parseSubstrings 解析子串过滤器(如cn=ab*cd*ef)
+func (p *filterParser) parseSubstrings(attr, value string) (*ber.Packet, error) {
+	parts := strings.Split(value, "*")
+	subs := ber.NewConstructed(ber.TagSequence)
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+
+		v, err := unescapeFilter(part)
+		if err != nil {
+			return nil, p.errorf("%s", err.Error())
+		}
+
+		tag := SubstringAny
+		if i == 0 {
+			tag = SubstringInitial
+		} else if i == len(parts)-1 {
+			tag = SubstringFinal
+		}
+		subs.Append(ber.NewString(tag, v))
+	}
+
+	return ber.NewConstructed(FilterSubstrings,
+		ber.NewString(ber.TagOctetString, attr),
+		subs,
+	), nil
+}
+
+// unescapeFilter 还原过滤器值中的转义(\XX)
+func unescapeFilter(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+
+	var buf []byte
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			buf = append(buf, value[i])
+			continue
+		}
+
+		if i+3 > len(value) {
+			return "", fmt.Errorf("无效的转义：%s", value)
+		}
+		b, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("无效的转义：%s", value)
+		}
+		buf = append(buf, b[0])
+		i += 2
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,157 @@
+package ldap_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"moddns/app/service/ldap"
+	"moddns/app/service/ldap/ber"
+	"moddns/app/service/ldap/ldaptest"
+	"sort"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	if v := ldap.EscapeFilter("a*(b)\\"); v != "a\\2a\\28b\\29\\5c" {
+		t.Fatalf("转义结果错误：%s", v)
+	}
+
+	f, err := ldap.CompileFilter("(&(objectClass=person)(|(uid=" + ldap.EscapeFilter("ad*min") + ")(cn=Ad*n))(!(mail=*)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Tag != ldap.FilterAnd || len(f.Children) != 3 {
+		t.Fatalf("过滤器结构错误：%#v", f)
+	}
+
+	or := f.Children[1]
+	if eq := or.Children[0]; eq.Tag != ldap.FilterEqualityMatch || eq.Children[1].String() != "ad*min" {
+		t.Fatalf("转义的值应还原为等值匹配：%#v", eq)
+	}
+	if sub := or.Children[1]; sub.Tag != ldap.FilterSubstrings || len(sub.Children[1].Children) != 2 {
+		t.Fatalf("子串过滤器错误：%#v", sub)
+	}
+	if not := f.Children[2]; not.Tag != ldap.FilterNot || not.Children[0].Tag != ldap.FilterPresent {
+		t.Fatalf("非过滤器错误：%#v", not)
+	}
+
+	// 编码后应能还原
+	p, err := ber.Read(bufio.NewReader(bytes.NewReader(f.Bytes())))
+	if err != nil || !bytes.Equal(p.Bytes(), f.Bytes()) {
+		t.Fatalf("编码还原错误：%v", err)
+	}
+
+	for _, s := range []string{"", "uid=a", "(uid=a", "(&)", "(uid=a)(cn=b)", "(uid=\\2)", "(cn:dn:=a)"} {
+		if _, err := ldap.CompileFilter(s); err == nil {
+			t.Fatalf("无效的过滤器应返回错误：%s", s)
+		}
+	}
+}
+
+func newServer(t *testing.T) *ldaptest.Server {
+	srv, err := ldaptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.AddEntry("cn=reader,dc=example,dc=com", map[string][]string{
+		"objectClass":  {"person"},
+		"userPassword": {"readerpw"},
+	})
+	srv.AddEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+		"objectClass":  {"person"},
+		"uid":          {"alice"},
+		"cn":           {"Alice Liddell"},
+		"memberOf":     {"cn=auditors,ou=groups,dc=example,dc=com"},
+		"userPassword": {"alicepw"},
+	})
+	srv.AddEntry("uid=bob,ou=people,dc=example,dc=com", map[string][]string{
+		"objectClass":  {"person"},
+		"uid":          {"bob"},
+		"cn":           {"Bob"},
+		"userPassword": {"bobpw"},
+	})
+	srv.AddEntry("cn=admins,ou=groups,dc=example,dc=com", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"admins"},
+		"member":      {"uid=alice, ou=people, dc=example, dc=com"},
+	})
+	srv.AddEntry("cn=users,ou=groups,dc=example,dc=com", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"users"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=com", "uid=bob,ou=people,dc=example,dc=com"},
+	})
+	return srv
+}
+
+func TestAuthenticate(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+
+	auth := ldap.NewAuthenticator(
+		ldap.SetURL(srv.URL()),
+		ldap.SetBind("cn=reader,dc=example,dc=com", "readerpw"),
+		ldap.SetBaseDN("ou=people,dc=example,dc=com"),
+		ldap.SetUserFilter("(&(objectClass=person)(uid=%s))"),
+		ldap.SetGroupSearch("ou=groups,dc=example,dc=com", "(&(objectClass=groupOfNames)(member=%s))", "cn"),
+		ldap.SetMemberOfAttribute("memberOf"),
+	)
+
+	ctx := context.Background()
+	info, err := auth.Authenticate(ctx, "alice", "alicepw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DN != "uid=alice,ou=people,dc=example,dc=com" || info.RealName != "Alice Liddell" {
+		t.Fatalf("用户信息错误：%#v", info)
+	}
+
+	sort.Strings(info.Groups)
+	expected := []string{
+		"admins", "auditors",
+		"cn=admins,ou=groups,dc=example,dc=com",
+		"cn=auditors,ou=groups,dc=example,dc=com",
+		"cn=users,ou=groups,dc=example,dc=com",
+		"users",
+	}
+	if len(info.Groups) != len(expected) {
+		t.Fatalf("所属组错误：%v", info.Groups)
+	}
+	for i, g := range expected {
+		if info.Groups[i] != g {
+			t.Fatalf("所属组错误：%v", info.Groups)
+		}
+	}
+
+	if _, err := auth.Authenticate(ctx, "alice", "wrong"); err != ldap.ErrInvalidCredentials {
+		t.Fatalf("密码错误时应返回ErrInvalidCredentials：%v", err)
+	}
+	if _, err := auth.Authenticate(ctx, "alice", ""); err != ldap.ErrInvalidCredentials {
+		t.Fatalf("空密码应被拒绝：%v", err)
+	}
+	if _, err := auth.Authenticate(ctx, "carol", "pw"); err != ldap.ErrUserNotFound {
+		t.Fatalf("用户不存在时应返回ErrUserNotFound：%v", err)
+	}
+
+	// 用户名中的过滤器字符应被转义，不能匹配到其它用户
+	if _, err := auth.Authenticate(ctx, "*", "bobpw"); err != ldap.ErrUserNotFound {
+		t.Fatalf("通配符不应匹配用户：%v", err)
+	}
+
+	// 服务账户的密码错误
+	bad := ldap.NewAuthenticator(
+		ldap.SetURL(srv.URL()),
+		ldap.SetBind("cn=reader,dc=example,dc=com", "wrong"),
+		ldap.SetBaseDN("dc=example,dc=com"),
+	)
+	if _, err := bad.Authenticate(ctx, "bob", "bobpw"); err == nil || err == ldap.ErrInvalidCredentials {
+		t.Fatalf("服务账户绑定失败应返回其它错误：%v", err)
+	}
+
+	// 匿名搜索
+	srv.SetAllowAnonymous(true)
+	anon := ldap.NewAuthenticator(ldap.SetURL(srv.URL()), ldap.SetBaseDN("dc=example,dc=com"))
+	if info, err := anon.Authenticate(ctx, "bob", "bobpw"); err != nil || info.RealName != "Bob" || len(info.Groups) != 0 {
+		t.Fatalf("匿名搜索认证错误：%#v,%v", info, err)
+	}
+}
@@ -0,0 +1,356 @@
+// Package ldaptest 进程内的LDAP服务(目录服务替身)，实现认证使用的操作子集(简单绑定、搜索)，测试无需依赖外部服务
+package ldaptest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	"moddns/app/service/ldap"
+	"moddns/app/service/ldap/ber"
+)
+
+type entry struct {
+	dn    string
+	attrs map[string][]string // 属性名为小写
+}
+
+// Server 进程内的LDAP服务
+type Server struct {
+	ln             net.Listener
+	mu             sync.Mutex
+	entries        []*entry
+	allowAnonymous bool // 是否允许匿名搜索
+	wg             sync.WaitGroup
+}
+
+// NewServer 启动进程内的LDAP服务(监听本地随机端口)
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{ln: ln}
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// URL 服务地址
+func (s *Server) URL() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+// SetAllowAnonymous 设置是否允许匿名搜索(默认需要绑定)
+func (s *Server) SetAllowAnonymous(allow bool) {
+	s.mu.Lock()
+	s.allowAnonymous = allow
+	s.mu.Unlock()
+}
+
+// AddEntry 添加条目，userPassword属性为简单绑定的明文密码
+func (s *Server) AddEntry(dn string, attrs map[string][]string) {
+	e := &entry{dn: dn, attrs: make(map[string][]string)}
+	for k, v := range attrs {
+		e.attrs[strings.ToLower(k)] = v
+	}
+
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+}
+
+// Close 关闭服务
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	var boundDN string
+	for {
+		msg, err := ber.Read(r)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+
+		id, _ := msg.Children[0].Int()
+		op := msg.Children[1]
+
+		var resps []*ber.Packet
+		switch op.Tag {
+		case ldap.AppBindRequest:
+			var code int
+			code, boundDN = s.bind(op)
+			resps = append(resps, result(ldap.AppBindResponse, code, ""))
+		case ldap.AppSearchRequest:
+			resps = s.search(op, boundDN)
+		case ldap.AppUnbindRequest:
+			return
+		case ldap.AppExtendedRequest:
+			resps = append(resps, result(ldap.AppExtendedResponse, ldap.ResultProtocolError, "不支持扩展操作"))
+		default:
+			return
+		}
+
+		for _, resp := range resps {
+			out := ber.NewConstructed(ber.TagSequence, ber.NewInteger(ber.TagInteger, id), resp)
+			if _, err := c.Write(out.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// result 构造操作结果(LDAPResult)
+func result(tag byte, code int, message string) *ber.Packet {
+	return ber.NewConstructed(tag,
+		ber.NewInteger(ber.TagEnumerated, int64(code)),
+		ber.NewString(ber.TagOctetString, ""),
+		ber.NewString(ber.TagOctetString, message),
+	)
+}
+
+// bind 简单绑定，返回结果码及绑定的DN(匿名时为空)
+func (s *Server) bind(op *ber.Packet) (int, string) {
+	if len(op.Children) < 3 {
+		return ldap.ResultProtocolError, ""
+	}
+
+	dn, password := op.Children[1].String(), op.Children[2].String()
+	if dn == "" && password == "" {
+		return ldap.ResultSuccess, ""
+	} else if password == "" {
+		return ldap.ResultUnwillingToPerform, ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.lookup(dn)
+	if e == nil {
+		return ldap.ResultInvalidCredentials, ""
+	}
+	for _, v := range e.attrs["userpassword"] {
+		if v == password {
+			return ldap.ResultSuccess, e.dn
+		}
+	}
+	return ldap.ResultInvalidCredentials, ""
+}
+
+// search 搜索条目，返回条目及搜索结果
+func (s *Server) search(op *ber.Packet, boundDN string) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{result(ldap.AppSearchDone, ldap.ResultProtocolError, "")}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if boundDN == "" && !s.allowAnonymous {
+		return []*ber.Packet{result(ldap.AppSearchDone, ldap.ResultInsufficientAccess, "需要绑定")}
+	}
+
+	baseDN := normalizeDN(op.Children[0].String())
+	scope, _ := op.Children[1].Int()
+	sizeLimit, _ := op.Children[3].Int()
+	filter := op.Children[6]
+
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, strings.ToLower(a.String()))
+	}
+
+	var resps []*ber.Packet
+	for _, e := range s.entries {
+		if !inScope(normalizeDN(e.dn), baseDN, int(scope)) || !match(e, filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(resps)) >= sizeLimit {
+			return append(resps, result(ldap.AppSearchDone, ldap.ResultSizeLimitExceeded, ""))
+		}
+		resps = append(resps, searchEntry(e, attrs))
+	}
+	return append(resps, result(ldap.AppSearchDone, ldap.ResultSuccess, ""))
+}
+
+// searchEntry 构造搜索结果的条目(不返回密码)
+func searchEntry(e *entry, attrs []string) *ber.Packet {
+	list := ber.NewConstructed(ber.TagSequence)
+	for name, values := range e.attrs {
+		if name == "userpassword" || (len(attrs) > 0 && !contains(attrs, name)) {
+			continue
+		}
+
+		vals := ber.NewConstructed(ber.TagSet)
+		for _, v := range values {
+			vals.Append(ber.NewString(ber.TagOctetString, v))
+		}
+		list.Append(ber.NewConstructed(ber.TagSequence, ber.NewString(ber.TagOctetString, name), vals))
+	}
+
+	return ber.NewConstructed(ldap.AppSearchEntry,
+		ber.NewString(ber.TagOctetString, e.dn),
+		list,
+	)
+}
+
+// lookup 根据DN查询条目(调用方持有锁)
+func (s *Server) lookup(dn string) *entry {
+	dn = normalizeDN(dn)
+	for _, e := range s.entries {
+		if normalizeDN(e.dn) == dn {
+			return e
+		}
+	}
+	return nil
+}
+
+// normalizeDN 规范化DN(小写，去除RDN之间的空格)
+func normalizeDN(dn string) string {
+	parts := strings.Split(strings.ToLower(dn), ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ",")
+}
+
+// inScope 检查条目是否在搜索范围内
+func inScope(dn, baseDN string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == baseDN
+	case ldap.ScopeSingleLevel:
+		i := strings.IndexByte(dn, ',')
+		return i >= 0 && dn[i+1:] == baseDN
+	default:
+		return baseDN == "" || dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+// match 检查条目是否匹配过滤器(比较不区分大小写)
+func match(e *entry, f *ber.Packet) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !match(e, c) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if match(e, c) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !match(e, f.Children[0])
+	case ldap.FilterPresent:
+		return len(e.attrs[strings.ToLower(f.String())]) > 0
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		if len(f.Children) < 2 {
+			return false
+		}
+		want := strings.ToLower(f.Children[1].String())
+		for _, v := range values(e, f.Children[0].String()) {
+			switch v = strings.ToLower(v); f.Tag {
+			case ldap.FilterGreaterOrEqual:
+				if v >= want {
+					return true
+				}
+			case ldap.FilterLessOrEqual:
+				if v <= want {
+					return true
+				}
+			default:
+				if v == want || (isDNAttr(f.Children[0].String()) && normalizeDN(v) == normalizeDN(want)) {
+					return true
+				}
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		if len(f.Children) < 2 {
+			return false
+		}
+		for _, v := range values(e, f.Children[0].String()) {
+			if matchSubstrings(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// values 获取条目的属性值(dn作为伪属性)
+func values(e *entry, name string) []string {
+	if name = strings.ToLower(name); name == "dn" {
+		return []string{e.dn}
+	}
+	return e.attrs[name]
+}
+
+// isDNAttr 是否为值为DN的属性(比较时规范化)
+func isDNAttr(name string) bool {
+	switch strings.ToLower(name) {
+	case "member", "uniquemember", "memberof", "dn":
+		return true
+	}
+	return false
+}
+
+// matchSubstrings 检查值是否匹配子串过滤器
+func matchSubstrings(v string, subs []*ber.Packet) bool {
+	for _, sub := range subs {
+		s := strings.ToLower(sub.String())
+		switch sub.Tag {
+		case ldap.SubstringInitial:
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case ldap.SubstringAny:
+			i := strings.Index(v, s)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(s):]
+		case ldap.SubstringFinal:
+			if !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
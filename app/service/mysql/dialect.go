@@ -0,0 +1,217 @@
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/gorp.v2"
+)
+
+// 支持的数据库类型
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+)
+
+// Dialect 数据库方言，隔离不同数据库之间的SQL差异；
+// 业务代码统一使用?作为占位符，由方言转换为数据库支持的形式
+type Dialect interface {
+	// Name 方言名称(mysql、postgres)
+	Name() string
+	// Rebind 将?占位符转换为数据库支持的占位符
+	Rebind(query string) string
+	// Concat 字符串拼接表达式
+	Concat(args ...string) string
+	// Like 模糊查询(不区分大小写)的运算符
+	Like() string
+	// InsertIgnoreSQL 插入数据(唯一键冲突时忽略)的SQL
+	InsertIgnoreSQL(table string, columns ...string) string
+	// UpsertSQL 插入数据(唯一键keys冲突时更新updates)的SQL
+	UpsertSQL(table string, keys, columns, updates []string) string
+	// ColumnSizeSQL 查询字段长度的SQL(参数为表名、字段名)
+	ColumnSizeSQL() string
+	// ModifyColumnSQL 修改字段类型的SQL
+	ModifyColumnSQL(table, column, definition string) string
+
+	driver() string
+	gorpDialect(o *options) gorp.Dialect
+	createIndexSQL(table, idx string, unique bool, columns []string) string
+	createColumnSQL(table, column, definition string) string
+	ignoreError(err error) bool
+}
+
+// newDialect 根据名称获取数据库方言(未知名称时使用MySQL)
+func newDialect(name string) Dialect {
+	if name == DialectPostgres {
+		return postgresDialect{}
+	}
+	return mysqlDialect{}
+}
+
+func valuesSQL(table string, columns []string) string {
+	return fmt.Sprintf("%s(%s) VALUES(%s)", table, strings.Join(columns, ","), strings.Repeat(",?", len(columns))[1:])
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return DialectMySQL
+}
+
+func (mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) Concat(args ...string) string {
+	return fmt.Sprintf("concat(%s)", strings.Join(args, ","))
+}
+
+func (mysqlDialect) Like() string {
+	return "LIKE"
+}
+
+func (mysqlDialect) InsertIgnoreSQL(table string, columns ...string) string {
+	return "INSERT IGNORE INTO " + valuesSQL(table, columns)
+}
+
+func (mysqlDialect) UpsertSQL(table string, keys, columns, updates []string) string {
+	sets := make([]string, len(updates))
+	for i, c := range updates {
+		sets[i] = fmt.Sprintf("%s=VALUES(%s)", c, c)
+	}
+	return fmt.Sprintf("INSERT INTO %s ON DUPLICATE KEY UPDATE %s", valuesSQL(table, columns), strings.Join(sets, ","))
+}
+
+func (mysqlDialect) ColumnSizeSQL() string {
+	return "SELECT IFNULL(MAX(character_maximum_length),0) FROM information_schema.columns WHERE table_schema=DATABASE() AND table_name=? AND column_name=?"
+}
+
+func (mysqlDialect) ModifyColumnSQL(table, column, definition string) string {
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition)
+}
+
+func (mysqlDialect) driver() string {
+	return "mysql"
+}
+
+func (mysqlDialect) gorpDialect(o *options) gorp.Dialect {
+	return gorp.MySQLDialect{
+		Encoding: o.encoding,
+		Engine:   o.engine,
+	}
+}
+
+func (mysqlDialect) createIndexSQL(table, idx string, unique bool, columns []string) string {
+	s := bytes.Buffer{}
+	s.WriteString("CREATE ")
+	if unique {
+		s.WriteString("UNIQUE ")
+	}
+	s.WriteString(fmt.Sprintf("INDEX %s ON %s (%s);", idx, table, strings.Join(columns, ",")))
+	return s.String()
+}
+
+func (mysqlDialect) createColumnSQL(table, column, definition string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition)
+}
+
+// ignoreError 忽略索引已存在(1061)及字段已存在(1060)的错误
+func (mysqlDialect) ignoreError(err error) bool {
+	s := err.Error()
+	return strings.HasPrefix(s, "Error 1061:") || strings.HasPrefix(s, "Error 1060:")
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return DialectPostgres
+}
+
+// Rebind 将?转换为$1、$2...(忽略引号内的?)
+func (postgresDialect) Rebind(query string) string {
+	if strings.IndexByte(query, '?') == -1 {
+		return query
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(query)+8))
+	var (
+		n     int
+		quote byte
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			buf.WriteByte('$')
+			buf.WriteString(strconv.Itoa(n))
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+func (postgresDialect) Concat(args ...string) string {
+	return strings.Join(args, "||")
+}
+
+func (postgresDialect) Like() string {
+	return "ILIKE"
+}
+
+func (postgresDialect) InsertIgnoreSQL(table string, columns ...string) string {
+	return fmt.Sprintf("INSERT INTO %s ON CONFLICT DO NOTHING", valuesSQL(table, columns))
+}
+
+func (postgresDialect) UpsertSQL(table string, keys, columns, updates []string) string {
+	sets := make([]string, len(updates))
+	for i, c := range updates {
+		sets[i] = fmt.Sprintf("%s=EXCLUDED.%s", c, c)
+	}
+	return fmt.Sprintf("INSERT INTO %s ON CONFLICT (%s) DO UPDATE SET %s",
+		valuesSQL(table, columns), strings.Join(keys, ","), strings.Join(sets, ","))
+}
+
+func (postgresDialect) ColumnSizeSQL() string {
+	return "SELECT COALESCE(MAX(character_maximum_length),0) FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=? AND column_name=?"
+}
+
+func (postgresDialect) ModifyColumnSQL(table, column, definition string) string {
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", table, column, definition)
+}
+
+func (postgresDialect) driver() string {
+	return "postgres"
+}
+
+func (postgresDialect) gorpDialect(o *options) gorp.Dialect {
+	return gorp.PostgresDialect{}
+}
+
+// createIndexSQL PostgreSQL的索引名在模式内唯一，使用表名作为索引名的前缀
+func (postgresDialect) createIndexSQL(table, idx string, unique bool, columns []string) string {
+	s := bytes.Buffer{}
+	s.WriteString("CREATE ")
+	if unique {
+		s.WriteString("UNIQUE ")
+	}
+	s.WriteString(fmt.Sprintf("INDEX IF NOT EXISTS %s_%s ON %s (%s);", table, idx, table, strings.Join(columns, ",")))
+	return s.String()
+}
+
+func (postgresDialect) createColumnSQL(table, column, definition string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;", table, column, definition)
+}
+
+func (postgresDialect) ignoreError(err error) bool {
+	return false
+}
@@ -0,0 +1,38 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestDialectRebind(t *testing.T) {
+	pg := newDialect(DialectPostgres)
+	query := pg.Rebind("SELECT * FROM t WHERE a=? AND b LIKE '?%' AND c IN(?,?)")
+	if query != "SELECT * FROM t WHERE a=$1 AND b LIKE '?%' AND c IN($2,$3)" {
+		t.Errorf("占位符转换错误：%s", query)
+	}
+
+	my := newDialect(DialectMySQL)
+	if query := my.Rebind("SELECT * FROM t WHERE a=?"); query != "SELECT * FROM t WHERE a=?" {
+		t.Errorf("MySQL不应转换占位符：%s", query)
+	}
+}
+
+func TestDialectUpsert(t *testing.T) {
+	cols := []string{"k", "v", "e"}
+	updates := []string{"v", "e"}
+
+	query := newDialect(DialectMySQL).UpsertSQL("t", []string{"k"}, cols, updates)
+	if query != "INSERT INTO t(k,v,e) VALUES(?,?,?) ON DUPLICATE KEY UPDATE v=VALUES(v),e=VALUES(e)" {
+		t.Errorf("MySQL的插入更新语句错误：%s", query)
+	}
+
+	query = newDialect(DialectPostgres).UpsertSQL("t", []string{"k"}, cols, updates)
+	if query != "INSERT INTO t(k,v,e) VALUES(?,?,?) ON CONFLICT (k) DO UPDATE SET v=EXCLUDED.v,e=EXCLUDED.e" {
+		t.Errorf("PostgreSQL的插入更新语句错误：%s", query)
+	}
+
+	query = newDialect(DialectPostgres).InsertIgnoreSQL("t", "k")
+	if query != "INSERT INTO t(k) VALUES(?) ON CONFLICT DO NOTHING" {
+		t.Errorf("PostgreSQL的插入忽略语句错误：%s", query)
+	}
+}
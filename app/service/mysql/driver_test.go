@@ -0,0 +1,183 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/gorp.v2"
+)
+
+// testDriver 记录执行的语句、参数及连接(连接串)的测试驱动：
+// 执行语句返回affected条受影响的行，计数查询返回count，其它查询返回rows中的数据(列为columns)；
+// 连接串为broken时查询返回连接错误，SLEEP语句等待到上下文结束(最长50毫秒)
+type testDriver struct {
+	sync.Mutex
+	calls    []testCall
+	affected int64
+	count    int64
+	columns  []string
+	rows     [][]driver.Value
+}
+
+// testCall 执行的语句
+type testCall struct {
+	dsn   string
+	query string
+	args  []driver.Value
+}
+
+func (d *testDriver) Open(dsn string) (driver.Conn, error) {
+	return &testConn{d: d, dsn: dsn}, nil
+}
+
+func (d *testDriver) record(dsn, query string, args []driver.NamedValue) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	d.Lock()
+	d.calls = append(d.calls, testCall{dsn: dsn, query: query, args: values})
+	d.Unlock()
+}
+
+// reset 清空记录并设置后续的执行结果
+func (d *testDriver) reset(affected, count int64, columns []string, rows ...[]driver.Value) {
+	d.Lock()
+	d.calls = nil
+	d.affected, d.count, d.columns, d.rows = affected, count, columns, rows
+	d.Unlock()
+}
+
+// last 最后执行的语句
+func (d *testDriver) last() testCall {
+	d.Lock()
+	defer d.Unlock()
+	if len(d.calls) == 0 {
+		return testCall{}
+	}
+	return d.calls[len(d.calls)-1]
+}
+
+type testConn struct {
+	d   *testDriver
+	dsn string
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return &testStmt{c, query}, nil
+}
+
+func (c *testConn) Close() error              { return nil }
+func (c *testConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *testConn) Commit() error             { return nil }
+func (c *testConn) Rollback() error           { return nil }
+
+func (c *testConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.HasPrefix(query, "SELECT SLEEP") {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	c.d.record(c.dsn, query, args)
+
+	c.d.Lock()
+	defer c.d.Unlock()
+	return testResult(c.d.affected), nil
+}
+
+func (c *testConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.dsn == "broken" {
+		return nil, driver.ErrBadConn
+	}
+	c.d.record(c.dsn, query, args)
+
+	c.d.Lock()
+	defer c.d.Unlock()
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		return &testRows{columns: []string{"n"}, rows: [][]driver.Value{{c.d.count}}}, nil
+	}
+	return &testRows{columns: c.d.columns, rows: c.d.rows}, nil
+}
+
+type testStmt struct {
+	c     *testConn
+	query string
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// testResult 执行结果(自增ID固定为1)
+type testResult int64
+
+func (r testResult) LastInsertId() (int64, error) { return 1, nil }
+func (r testResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+type testRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.columns }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var testSQLDriver = &testDriver{}
+
+func init() {
+	sql.Register("mysqltest", testSQLDriver)
+}
+
+// newTestDB 创建使用测试驱动的数据库(主库的连接串为primary，replicas为只读副本的连接串)
+func newTestDB(t *testing.T, replicas ...string) *DB {
+	open := func(dsn string) *gorp.DbMap {
+		db, err := sql.Open("mysqltest", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &gorp.DbMap{Db: db, Dialect: gorp.MySQLDialect{}}
+	}
+
+	db := &DB{DbMap: open("primary"), opts: &options{}}
+	if len(replicas) > 0 {
+		s := &replicaSet{name: DialectMySQL}
+		for i, dsn := range replicas {
+			s.items = append(s.items, &replica{index: i + 1, dbMap: open(dsn), healthy: 1})
+		}
+		db.replicas = s
+	}
+	return db
+}
@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -10,7 +11,9 @@ import (
 	"reflect"
 	"strings"
 	"time"
+
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"gopkg.in/gorp.v2"
 )
 
@@ -23,11 +26,21 @@ type (
 		Printf(format string, args ...interface{})
 	}
 
+	// Executor SQL执行器(*DB、*Trans)
+	Executor interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	}
+
+	// SlowQueryHandler 慢查询处理函数
+	SlowQueryHandler func(ctx context.Context, query string, elapsed time.Duration)
+
 	// Option 配置项
 	Option func(*options)
 
 	options struct {
+		dialect      string        // 数据库类型(mysql、postgres)
 		dsn          string        // 连接串
+		tablePrefix  string        // 表名前缀
 		trace        bool          // 追踪调试
 		maxLifetime  time.Duration // 设置连接可以被重新使用的最大时间量
 		maxOpenConns int           // 设置打开连接到数据库的最大数量
@@ -35,9 +48,28 @@ type (
 		logger       Logger        // 日志
 		engine       string        // 数据库表的存储引擎
 		encoding     string        // 数据库表的编码格式
+		queryTimeout time.Duration // 语句的默认执行超时时间
+		slowQuery    time.Duration // 慢查询的阈值
+		slowHandler  SlowQueryHandler
+		replicas     []string      // 只读副本的连接串
+		replicaCheck time.Duration // 只读副本健康检查的间隔
 	}
 )
 
+// SetDialect 设置数据库类型(DialectMySQL、DialectPostgres)
+func SetDialect(dialect string) Option {
+	return func(o *options) {
+		o.dialect = dialect
+	}
+}
+
+// SetTablePrefix 设置表名前缀
+func SetTablePrefix(prefix string) Option {
+	return func(o *options) {
+		o.tablePrefix = prefix
+	}
+}
+
 // SetDSN 设置连接串
 func SetDSN(dsn string) Option {
 	return func(o *options) {
@@ -45,6 +77,20 @@ func SetDSN(dsn string) Option {
 	}
 }
 
+// SetReplicas 设置只读副本的连接串(事务外的查询路由到健康的副本，写入及事务使用主库)
+func SetReplicas(dsns ...string) Option {
+	return func(o *options) {
+		o.replicas = dsns
+	}
+}
+
+// SetReplicaCheckInterval 设置只读副本健康检查的间隔
+func SetReplicaCheckInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.replicaCheck = interval
+	}
+}
+
 // SetTrace 设置追踪调试
 func SetTrace(t bool) Option {
 	return func(o *options) {
@@ -94,9 +140,25 @@ func SetEncoding(encoding string) Option {
 	}
 }
 
-// NewDB 创建MySQL数据库实例
+// SetQueryTimeout 设定语句的默认执行超时时间(上下文未设置截止时间时生效)
+func SetQueryTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.queryTimeout = timeout
+	}
+}
+
+// SetSlowQuery 设定慢查询的阈值及处理函数
+func SetSlowQuery(threshold time.Duration, handler SlowQueryHandler) Option {
+	return func(o *options) {
+		o.slowQuery = threshold
+		o.slowHandler = handler
+	}
+}
+
+// NewDB 创建数据库实例(默认为MySQL)
 func NewDB(opts ...Option) (*DB, error) {
 	o := &options{
+		dialect:      DialectMySQL,
 		maxLifetime:  time.Hour * 2,
 		maxOpenConns: 150,
 		maxIdleConns: 50,
@@ -108,7 +170,8 @@ func NewDB(opts ...Option) (*DB, error) {
 		opt(o)
 	}
 
-	db, err := sql.Open("mysql", o.dsn)
+	dialect := newDialect(o.dialect)
+	db, err := sql.Open(dialect.driver(), o.dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -119,29 +182,35 @@ func NewDB(opts ...Option) (*DB, error) {
 	err = util.DoFunc(10, func() error {
 		err := db.Ping()
 		if err != nil {
-			fmt.Printf("[mysql]发送ping值发生错误：%v\n", err)
+			fmt.Printf("[%s]发送ping值发生错误：%v\n", dialect.Name(), err)
 		}
 		return err
 	}, func(i int) time.Duration {
-		fmt.Printf("[mysql]正在尝试发送第[%d]次ping...\n", i)
+		fmt.Printf("[%s]正在尝试发送第[%d]次ping...\n", dialect.Name(), i)
 		return time.Second * 2 * time.Duration(i)
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	replicas, err := newReplicaSet(o, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	dbMap := &DB{
-		logger: o.logger,
+		opts:     o,
+		logger:   o.logger,
+		dialect:  dialect,
+		replicas: replicas,
 		DbMap: &gorp.DbMap{
-			Db: db,
-			Dialect: gorp.MySQLDialect{
-				Encoding: o.encoding,
-				Engine:   o.engine,
-			},
+			Db:      db,
+			Dialect: dialect.gorpDialect(o),
 		},
 	}
 	if o.trace && o.logger != nil {
-		dbMap.TraceOn("[mysql]", o.logger)
+		dbMap.TraceOn(fmt.Sprintf("[%s]", dialect.Name()), o.logger)
 	}
 
 	return dbMap, nil
@@ -150,14 +219,309 @@ func NewDB(opts ...Option) (*DB, error) {
 // DB 数据库管理
 type DB struct {
 	*gorp.DbMap
-	logger Logger
+	ctx      context.Context
+	tran     *gorp.Transaction
+	opts     *options
+	logger   Logger
+	dialect  Dialect
+	replicas *replicaSet
+	primary  bool
+}
+
+// WithContext 创建绑定上下文的数据库实例(开启追踪调试时，日志中输出上下文中的跟踪ID)；
+// 上下文中存在工作单元时，查询及执行语句加入工作单元的事务
+func (d *DB) WithContext(ctx context.Context) *DB {
+	dbMap, ok := d.DbMap.WithContext(ctx).(*gorp.DbMap)
+	if !ok {
+		return d
+	}
+
+	if d.options().trace && d.logger != nil {
+		prefix := fmt.Sprintf("[%s]", d.Dialect().Name())
+		if traceID := util.FromTraceIDContext(ctx); traceID != "" {
+			prefix = fmt.Sprintf("%s [%s]", prefix, traceID)
+		}
+		dbMap.TraceOn(prefix, d.logger)
+	}
+
+	db := &DB{
+		DbMap:    dbMap,
+		ctx:      ctx,
+		opts:     d.opts,
+		logger:   d.logger,
+		dialect:  d.dialect,
+		replicas: d.replicas,
+		primary:  d.primary,
+	}
+	if uow := fromTransContext(ctx); uow != nil {
+		db.tran = uow.tran
+	}
+	return db
+}
+
+// Primary 创建只使用主库的数据库实例(查询不路由到只读副本，用于不能容忍副本延迟的读取)
+func (d *DB) Primary() *DB {
+	db := *d
+	db.primary = true
+	return &db
+}
+
+// replica 选择执行查询的只读副本(事务中、强制主库、请求中已写入数据或副本均不可用时返回nil)
+func (d *DB) replica(ctx context.Context) *replica {
+	if d.replicas == nil || d.primary || d.tran != nil {
+		return nil
+	}
+	if pin := fromReadPinContext(ctx); pin != nil && pin.Written() {
+		return nil
+	}
+	return d.replicas.pick()
+}
+
+// Dialect 数据库方言
+func (d *DB) Dialect() Dialect {
+	if d.dialect == nil {
+		return mysqlDialect{}
+	}
+	return d.dialect
+}
+
+// TablePrefix 表名前缀(非空时以_结尾)
+func (d *DB) TablePrefix() string {
+	prefix := d.options().tablePrefix
+	if prefix != "" && prefix[len(prefix)-1] != '_' {
+		prefix += "_"
+	}
+	return prefix
+}
+
+func (d *DB) options() *options {
+	if d.opts == nil {
+		return &options{}
+	}
+	return d.opts
+}
+
+// run 使用绑定的上下文执行语句(附加默认的超时时间)，并记录慢查询；
+// read为true时事务外的查询路由到只读副本(副本连接错误时切换到主库重试)，写入时标记请求使用主库读取
+func (d *DB) run(query string, read bool, fn func(gorp.SqlExecutor) error) error {
+	ctx := d.context()
+	o := d.options()
+	if o.queryTimeout > 0 {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.queryTimeout)
+			defer cancel()
+		}
+	}
+
+	var r *replica
+	if read {
+		r = d.replica(ctx)
+	} else if pin := fromReadPinContext(ctx); pin != nil {
+		pin.markWritten()
+	}
+
+	start := time.Now()
+	err := fn(d.executor(ctx, r))
+	if err != nil && r != nil && isConnError(err) {
+		d.replicas.markDown(r, err)
+		err = fn(d.DbMap.WithContext(ctx))
+	}
+	d.slow(ctx, query, start)
+	return err
+}
+
+func (d *DB) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// executor 执行语句的执行器(事务中使用事务，r不为nil时使用只读副本)
+func (d *DB) executor(ctx context.Context, r *replica) gorp.SqlExecutor {
+	switch {
+	case d.tran != nil:
+		return d.tran.WithContext(ctx)
+	case r != nil:
+		return r.dbMap.WithContext(ctx)
+	default:
+		return d.DbMap.WithContext(ctx)
+	}
+}
+
+// slow 记录超过阈值的慢查询
+func (d *DB) slow(ctx context.Context, query string, start time.Time) {
+	if o, elapsed := d.options(), time.Since(start); o.slowHandler != nil &&
+		o.slowQuery > 0 && elapsed >= o.slowQuery {
+		o.slowHandler(ctx, query, elapsed)
+	}
+}
+
+// Select 查询数据列表
+func (d *DB) Select(i interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	query = d.Dialect().Rebind(query)
+	var list []interface{}
+	err := d.run(query, true, func(exec gorp.SqlExecutor) (err error) {
+		list, err = exec.Select(i, query, args...)
+		return
+	})
+	return list, err
+}
+
+// SelectOne 查询单条数据
+func (d *DB) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	query = d.Dialect().Rebind(query)
+	return d.run(query, true, func(exec gorp.SqlExecutor) error {
+		return exec.SelectOne(holder, query, args...)
+	})
+}
+
+// SelectInt 查询整型值
+func (d *DB) SelectInt(query string, args ...interface{}) (int64, error) {
+	query = d.Dialect().Rebind(query)
+	var n int64
+	err := d.run(query, true, func(exec gorp.SqlExecutor) (err error) {
+		n, err = exec.SelectInt(query, args...)
+		return
+	})
+	return n, err
+}
+
+// Insert 插入数据
+func (d *DB) Insert(list ...interface{}) error {
+	return d.run("INSERT", false, func(exec gorp.SqlExecutor) error {
+		return exec.Insert(list...)
+	})
+}
+
+// Exec 执行SQL
+func (d *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	query = d.Dialect().Rebind(query)
+	var result sql.Result
+	err := d.run(query, false, func(exec gorp.SqlExecutor) (err error) {
+		result, err = exec.Exec(query, args...)
+		return
+	})
+	return result, err
+}
+
+// Get 按主键查询数据
+func (d *DB) Get(i interface{}, keys ...interface{}) (interface{}, error) {
+	var item interface{}
+	err := d.run("GET", true, func(exec gorp.SqlExecutor) (err error) {
+		item, err = exec.Get(i, keys...)
+		return
+	})
+	return item, err
+}
+
+// Update 按主键更新数据
+func (d *DB) Update(list ...interface{}) (int64, error) {
+	var n int64
+	err := d.run("UPDATE", false, func(exec gorp.SqlExecutor) (err error) {
+		n, err = exec.Update(list...)
+		return
+	})
+	return n, err
+}
+
+// Delete 按主键删除数据
+func (d *DB) Delete(list ...interface{}) (int64, error) {
+	var n int64
+	err := d.run("DELETE", false, func(exec gorp.SqlExecutor) (err error) {
+		n, err = exec.Delete(list...)
+		return
+	})
+	return n, err
+}
+
+// SelectNullInt 查询可为空的整型值
+func (d *DB) SelectNullInt(query string, args ...interface{}) (sql.NullInt64, error) {
+	query = d.Dialect().Rebind(query)
+	var n sql.NullInt64
+	err := d.run(query, true, func(exec gorp.SqlExecutor) (err error) {
+		n, err = exec.SelectNullInt(query, args...)
+		return
+	})
+	return n, err
+}
+
+// SelectFloat 查询浮点值
+func (d *DB) SelectFloat(query string, args ...interface{}) (float64, error) {
+	query = d.Dialect().Rebind(query)
+	var f float64
+	err := d.run(query, true, func(exec gorp.SqlExecutor) (err error) {
+		f, err = exec.SelectFloat(query, args...)
+		return
+	})
+	return f, err
+}
+
+// SelectNullFloat 查询可为空的浮点值
+func (d *DB) SelectNullFloat(query string, args ...interface{}) (sql.NullFloat64, error) {
+	query = d.Dialect().Rebind(query)
+	var f sql.NullFloat64
+	err := d.run(query, true, func(exec gorp.SqlExecutor) (err error) {
+		f, err = exec.SelectNullFloat(query, args...)
+		return
+	})
+	return f, err
 }
 
-// Close 关闭数据库连接
+// SelectStr 查询字符串值
+func (d *DB) SelectStr(query string, args ...interface{}) (string, error) {
+	query = d.Dialect().Rebind(query)
+	var str string
+	err := d.run(query, true, func(exec gorp.SqlExecutor) (err error) {
+		str, err = exec.SelectStr(query, args...)
+		return
+	})
+	return str, err
+}
+
+// SelectNullStr 查询可为空的字符串值
+func (d *DB) SelectNullStr(query string, args ...interface{}) (sql.NullString, error) {
+	query = d.Dialect().Rebind(query)
+	var str sql.NullString
+	err := d.run(query, true, func(exec gorp.SqlExecutor) (err error) {
+		str, err = exec.SelectNullStr(query, args...)
+		return
+	})
+	return str, err
+}
+
+// Query 查询数据行(结果在返回后读取，不附加默认的超时时间)
+func (d *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	query = d.Dialect().Rebind(query)
+	ctx := d.context()
+	r := d.replica(ctx)
+
+	start := time.Now()
+	rows, err := d.executor(ctx, r).Query(query, args...)
+	if err != nil && r != nil && isConnError(err) {
+		d.replicas.markDown(r, err)
+		rows, err = d.DbMap.WithContext(ctx).Query(query, args...)
+	}
+	d.slow(ctx, query, start)
+	return rows, err
+}
+
+// QueryRow 查询单行数据(结果在返回后读取，不附加默认的超时时间)
+func (d *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	query = d.Dialect().Rebind(query)
+	ctx := d.context()
+	return d.executor(ctx, d.replica(ctx)).QueryRow(query, args...)
+}
+
+// Close 关闭数据库连接(包括只读副本)
 func (d *DB) Close() error {
 	if d.DbMap == nil {
 		return nil
 	}
+	if d.replicas != nil {
+		d.replicas.close()
+	}
 	return d.Db.Close()
 }
 
@@ -171,37 +535,40 @@ func (d *DB) CreateTableIfNotExists(i interface{}, name string) {
 	}
 }
 
-// CreateTableIndex 创建索引
+// CreateTableIndex 创建索引(索引已存在时忽略)
 func (d *DB) CreateTableIndex(table, idx string, unique bool, columns ...string) {
-	s := bytes.Buffer{}
-	s.WriteString("CREATE")
-	s.WriteByte(' ')
-	if unique {
-		s.WriteString("UNIQUE")
-		s.WriteByte(' ')
-	}
-	s.WriteString("INDEX")
-	s.WriteByte(' ')
-	s.WriteString(idx)
-	s.WriteByte(' ')
-	s.WriteString("ON")
-	s.WriteByte(' ')
-	s.WriteString(table)
-	s.WriteByte(' ')
-	s.WriteByte('(')
-	s.WriteString(strings.Join(columns, ","))
-	s.WriteByte(')')
-	s.WriteByte(';')
-
-	_, err := d.Exec(s.String())
+	query := d.Dialect().createIndexSQL(table, idx, unique, columns)
+
+	_, err := d.Exec(query)
+	if err != nil && !d.Dialect().ignoreError(err) {
+		d.logger.Printf("创建索引[%s]发生错误:%s", query, err.Error())
+	}
+}
+
+// CreateTableColumn 创建表字段(字段已存在时忽略)
+func (d *DB) CreateTableColumn(table, column, definition string) {
+	query := d.Dialect().createColumnSQL(table, column, definition)
+
+	_, err := d.Exec(query)
+	if err != nil && !d.Dialect().ignoreError(err) {
+		d.logger.Printf("创建字段[%s]发生错误:%s", query, err.Error())
+	}
+}
+
+// BackfillVersion 将版本号为0的历史数据(增加版本号字段之前创建)的版本号设为1，
+// 使其ETag可以用于If-Match请求头
+func (d *DB) BackfillVersion(table string) {
+	_, err := d.Exec(fmt.Sprintf("UPDATE %s SET version=1 WHERE version=0", table))
 	if err != nil {
-		errString := err.Error()
-		if !strings.HasPrefix(errString, "Error 1061:") {
-			d.logger.Printf("创建索引[%s]发生错误:%s", s.String(), errString)
-		}
+		d.logger.Printf("初始化表[%s]的版本号发生错误:%s", table, err.Error())
 	}
 }
 
+// ColumnSize 查询字符类型字段的长度(字段不存在时为0)
+func (d *DB) ColumnSize(table, column string) (int64, error) {
+	return d.SelectInt(d.Dialect().ColumnSizeSQL(), table, column)
+}
+
 // InsertSQL 获取插入SQL
 func (d *DB) InsertSQL(table string, info M) (string, []interface{}) {
 	q := fmt.Sprintf("INSERT INTO %s", table)
@@ -233,9 +600,9 @@ func (d *DB) InsertM(table string, info M) (int64, error) {
 }
 
 // InsertMWithTran 基于事物插入数据
-func (d *DB) InsertMWithTran(tran *gorp.Transaction, table string, info M) (int64, error) {
+func (d *DB) InsertMWithTran(tran gorp.SqlExecutor, table string, info M) (int64, error) {
 	q, vals := d.InsertSQL(table, info)
-	result, err := tran.Exec(q, vals...)
+	result, err := tran.Exec(d.Dialect().Rebind(q), vals...)
 	if err != nil {
 		return 0, err
 	}
@@ -287,9 +654,59 @@ func (d *DB) UpdateByPK(table string, pk, info M) (int64, error) {
 }
 
 // UpdateByPKWithTran 基于事物更新数据
-func (d *DB) UpdateByPKWithTran(tran *gorp.Transaction, table string, pk, info M) (int64, error) {
+func (d *DB) UpdateByPKWithTran(tran gorp.SqlExecutor, table string, pk, info M) (int64, error) {
 	q, vals := d.UpdateSQL(table, pk, info)
-	result, err := tran.Exec(q, vals...)
+	result, err := tran.Exec(d.Dialect().Rebind(q), vals...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// UpdateWithVersionSQL 获取基于版本号更新的SQL(版本号自增，version大于0时作为更新条件)
+func (d *DB) UpdateWithVersionSQL(table string, pk M, version int64, info M) (string, []interface{}) {
+	q := fmt.Sprintf("UPDATE %s SET", table)
+
+	var (
+		cols = []string{"version=version+1"}
+		vals []interface{}
+	)
+
+	for k, v := range info {
+		if k == "version" {
+			continue
+		}
+		cols = append(cols, fmt.Sprintf("%s=?", k))
+		vals = append(vals, v)
+	}
+
+	q = fmt.Sprintf("%s %s", q, strings.Join(cols, ","))
+	cols = nil
+
+	for k, v := range pk {
+		cols = append(cols, fmt.Sprintf("%s=?", k))
+		vals = append(vals, v)
+	}
+
+	if version > 0 {
+		cols = append(cols, "version=?")
+		vals = append(vals, version)
+	}
+
+	q = fmt.Sprintf("%s WHERE %s", q, strings.Join(cols, " and "))
+	return q, vals
+}
+
+// UpdateByPKWithVersion 基于版本号更新数据(乐观锁)，返回受影响的行数(版本号不匹配时为0)
+func (d *DB) UpdateByPKWithVersion(exec Executor, table string, pk M, version int64, info M) (int64, error) {
+	q, vals := d.UpdateWithVersionSQL(table, pk, version, info)
+	result, err := exec.Exec(d.Dialect().Rebind(q), vals...)
 	if err != nil {
 		return 0, err
 	}
@@ -337,9 +754,9 @@ func (d *DB) DeleteByPK(table string, pk M) (int64, error) {
 }
 
 // DeleteByPKWithTran 基于事物删除表数据
-func (d *DB) DeleteByPKWithTran(tran *gorp.Transaction, table string, pk M) (int64, error) {
+func (d *DB) DeleteByPKWithTran(tran gorp.SqlExecutor, table string, pk M) (int64, error) {
 	q, vals := d.DeleteSQL(table, pk)
-	result, err := tran.Exec(q, vals...)
+	result, err := tran.Exec(d.Dialect().Rebind(q), vals...)
 	if err != nil {
 		return 0, err
 	}
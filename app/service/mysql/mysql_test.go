@@ -1,8 +1,10 @@
 package mysql
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -52,3 +54,45 @@ func TestDB(t *testing.T) {
 		return
 	}
 }
+
+func TestQueryTimeout(t *testing.T) {
+	var slow []string
+	db := newTestDB(t)
+	db.opts = &options{
+		queryTimeout: 20 * time.Millisecond,
+		slowQuery:    10 * time.Millisecond,
+		slowHandler: func(ctx context.Context, query string, elapsed time.Duration) {
+			slow = append(slow, query)
+		},
+	}
+	defer db.Close()
+
+	// 上下文未设置截止时间时使用默认的超时时间
+	start := time.Now()
+	if _, err := db.WithContext(context.Background()).Exec("SELECT SLEEP(1)"); err != context.DeadlineExceeded {
+		t.Fatalf("超过默认的超时时间应取消执行：%v", err)
+	} else if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Fatalf("超时时间未生效：%s", elapsed)
+	}
+	if len(slow) != 1 || slow[0] != "SELECT SLEEP(1)" {
+		t.Fatalf("应记录慢查询：%v", slow)
+	}
+
+	// 上下文已设置截止时间时不覆盖
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := db.WithContext(ctx).Exec("SELECT SLEEP(1)"); err != nil {
+		t.Fatalf("应使用上下文的截止时间：%v", err)
+	}
+	if len(slow) != 2 {
+		t.Fatalf("应记录慢查询：%v", slow)
+	}
+
+	// 未超过阈值的语句不记录
+	if _, err := db.Exec("UPDATE t SET n=1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(slow) != 2 {
+		t.Fatalf("未超过阈值的语句不应记录：%v", slow)
+	}
+}
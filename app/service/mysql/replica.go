@@ -0,0 +1,181 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"gopkg.in/gorp.v2"
+)
+
+type readPinKey struct{}
+
+// ReadPin 请求范围内的主库读取标记，同一请求中写入数据后的查询使用主库(避免读取到副本延迟的数据)
+type ReadPin struct {
+	written int32
+}
+
+// Written 是否已写入数据
+func (p *ReadPin) Written() bool {
+	return atomic.LoadInt32(&p.written) == 1
+}
+
+func (p *ReadPin) markWritten() {
+	atomic.StoreInt32(&p.written, 1)
+}
+
+// NewReadPinContext 创建带有主库读取标记的上下文
+func NewReadPinContext(ctx context.Context, pin *ReadPin) context.Context {
+	return context.WithValue(ctx, readPinKey{}, pin)
+}
+
+func fromReadPinContext(ctx context.Context) *ReadPin {
+	if v := ctx.Value(readPinKey{}); v != nil {
+		if pin, ok := v.(*ReadPin); ok {
+			return pin
+		}
+	}
+	return nil
+}
+
+// replica 只读副本
+type replica struct {
+	index   int
+	dbMap   *gorp.DbMap
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// replicaSet 只读副本集合，定期检查副本的健康状态，查询轮询健康的副本
+type replicaSet struct {
+	name   string
+	items  []*replica
+	next   uint32
+	ticker *time.Ticker
+	done   chan struct{} // 关闭时停止健康检查
+	once   sync.Once
+	logger Logger
+}
+
+// newReplicaSet 连接只读副本(连接失败的副本标记为不可用，由健康检查恢复)
+func newReplicaSet(o *options, dialect Dialect) (*replicaSet, error) {
+	if len(o.replicas) == 0 {
+		return nil, nil
+	}
+
+	s := &replicaSet{
+		name:   dialect.Name(),
+		done:   make(chan struct{}),
+		logger: o.logger,
+	}
+	for i, dsn := range o.replicas {
+		db, err := sql.Open(dialect.driver(), dsn)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("连接只读副本[%d]发生错误：%s", i+1, err.Error())
+		}
+		db.SetMaxOpenConns(o.maxOpenConns)
+		db.SetMaxIdleConns(o.maxIdleConns)
+		db.SetConnMaxLifetime(o.maxLifetime)
+
+		dbMap := &gorp.DbMap{Db: db, Dialect: dialect.gorpDialect(o)}
+		if o.trace && o.logger != nil {
+			dbMap.TraceOn(fmt.Sprintf("[%s] [replica%d]", dialect.Name(), i+1), o.logger)
+		}
+		s.items = append(s.items, &replica{index: i + 1, dbMap: dbMap})
+	}
+
+	s.check()
+
+	interval := o.replicaCheck
+	if interval <= 0 {
+		interval = time.Second * 10
+	}
+	s.ticker = time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-s.ticker.C:
+			}
+
+			s.check()
+		}
+	}()
+
+	return s, nil
+}
+
+// check 检查所有副本的健康状态，状态变化时输出日志
+func (s *replicaSet) check() {
+	for _, r := range s.items {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		err := r.dbMap.Db.PingContext(ctx)
+		cancel()
+
+		if err != nil {
+			s.markDown(r, err)
+		} else if atomic.SwapInt32(&r.healthy, 1) == 0 && s.logger != nil {
+			s.logger.Printf("[%s]只读副本[%d]可用", s.name, r.index)
+		}
+	}
+}
+
+// markDown 标记副本不可用
+func (s *replicaSet) markDown(r *replica, err error) {
+	if atomic.SwapInt32(&r.healthy, 0) == 1 && s.logger != nil {
+		s.logger.Printf("[%s]只读副本[%d]不可用，查询切换到其它副本或主库：%s", s.name, r.index, err.Error())
+	}
+}
+
+// pick 轮询选择健康的副本(全部不可用时返回nil)
+func (s *replicaSet) pick() *replica {
+	n := len(s.items)
+	start := atomic.AddUint32(&s.next, 1)
+	for i := 0; i < n; i++ {
+		if r := s.items[(int(start)+i)%n]; r.isHealthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *replicaSet) close() error {
+	s.once.Do(func() {
+		if s.ticker != nil {
+			s.ticker.Stop()
+			close(s.done)
+		}
+	})
+
+	var result error
+	for _, r := range s.items {
+		if err := r.dbMap.Db.Close(); err != nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// isConnError 是否是连接错误(连接错误时查询切换到主库重试)
+func isConnError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, gomysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
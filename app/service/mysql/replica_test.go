@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	db := newTestDB(t, "replica")
+	defer db.Close()
+
+	ctx := NewReadPinContext(context.Background(), new(ReadPin))
+	db.WithContext(ctx).SelectInt("SELECT COUNT(*) FROM t")
+	if v := testSQLDriver.last().dsn; v != "replica" {
+		t.Errorf("查询应路由到只读副本：%s", v)
+	}
+
+	db.Primary().WithContext(ctx).SelectInt("SELECT COUNT(*) FROM t")
+	if v := testSQLDriver.last().dsn; v != "primary" {
+		t.Errorf("强制主库的查询应使用主库：%s", v)
+	}
+
+	db.WithContext(ctx).Exec("UPDATE t SET n=1")
+	if v := testSQLDriver.last().dsn; v != "primary" {
+		t.Errorf("写入应使用主库：%s", v)
+	}
+
+	db.WithContext(ctx).SelectInt("SELECT COUNT(*) FROM t")
+	if v := testSQLDriver.last().dsn; v != "primary" {
+		t.Errorf("同一请求中写入后的查询应使用主库：%s", v)
+	}
+
+	db.WithContext(context.Background()).SelectInt("SELECT COUNT(*) FROM t")
+	if v := testSQLDriver.last().dsn; v != "replica" {
+		t.Errorf("其它请求的查询应路由到只读副本：%s", v)
+	}
+}
+
+func TestReplicaFallback(t *testing.T) {
+	db := newTestDB(t, "broken", "replica")
+	defer db.Close()
+
+	db.replicas.items[1].healthy = 0
+	_, err := db.SelectInt("SELECT COUNT(*) FROM t")
+	if err != nil {
+		t.Fatal(err)
+	} else if v := testSQLDriver.last().dsn; v != "primary" {
+		t.Errorf("副本连接错误时应切换到主库重试：%s", v)
+	}
+
+	if db.replicas.items[0].isHealthy() {
+		t.Error("连接错误的副本应标记为不可用")
+	} else if db.replicas.pick() != nil {
+		t.Error("副本均不可用时不应选择副本")
+	}
+
+	db.replicas.check()
+	if r := db.replicas.pick(); r == nil {
+		t.Error("健康检查后副本应恢复可用")
+	}
+}
+
+func TestReplicaRepositoryPrimary(t *testing.T) {
+	db := newTestDB(t, "replica")
+	defer db.Close()
+
+	repo := NewRepository(db, "t")
+	repo.Exists(context.Background(), NewFilter())
+	if v := testSQLDriver.last().dsn; v != "replica" {
+		t.Errorf("查询应路由到只读副本：%s", v)
+	}
+
+	repo.Primary().Exists(context.Background(), NewFilter())
+	if v := testSQLDriver.last().dsn; v != "primary" {
+		t.Errorf("写入前的检查应使用主库：%s", v)
+	}
+}
+
+func TestReplicaGorpMethods(t *testing.T) {
+	db := newTestDB(t, "replica")
+	defer db.Close()
+	db.AddTableWithName(testEntity{}, "t_item").SetKeys(true, "ID")
+
+	ctx := NewReadPinContext(context.Background(), new(ReadPin))
+	db.WithContext(ctx).SelectStr("SELECT name FROM t_item")
+	if v := testSQLDriver.last().dsn; v != "replica" {
+		t.Errorf("查询应路由到只读副本：%s", v)
+	}
+
+	testSQLDriver.reset(1, 0, nil)
+	if _, err := db.WithContext(ctx).Delete(&testEntity{testBase: testBase{ID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if v := testSQLDriver.last().dsn; v != "primary" {
+		t.Errorf("删除应使用主库：%s", v)
+	}
+
+	db.WithContext(ctx).QueryRow("SELECT name FROM t_item").Scan(new(string))
+	if v := testSQLDriver.last().dsn; v != "primary" {
+		t.Errorf("同一请求中写入后的查询应使用主库：%s", v)
+	}
+}
@@ -0,0 +1,367 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"moddns/app/util"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var columnsCache sync.Map
+
+// Columns 根据结构体的db标签获取列名(忽略db:"-"及未设置db标签的字段)，
+// v可以为结构体、结构体指针或结构体(指针)切片的指针
+func Columns(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	if cols, ok := columnsCache.Load(t); ok {
+		return cols.([]string)
+	}
+
+	cols := structColumns(t)
+	columnsCache.Store(t, cols)
+	return cols
+}
+
+func structColumns(t reflect.Type) []string {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var cols []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			cols = append(cols, structColumns(f.Type)...)
+			continue
+		}
+
+		tag := f.Tag.Get("db")
+		if i := strings.IndexByte(tag, ','); i != -1 {
+			tag = tag[:i]
+		}
+		if tag == "" || tag == "-" {
+			continue
+		}
+		cols = append(cols, tag)
+	}
+	return cols
+}
+
+// Filter 查询条件
+type Filter struct {
+	conds []string
+	args  []interface{}
+}
+
+// NewFilter 创建查询条件
+func NewFilter() *Filter {
+	return &Filter{}
+}
+
+// Where 添加查询条件(参数为切片时展开为IN查询的参数)
+func (f *Filter) Where(cond string, args ...interface{}) *Filter {
+	f.conds = append(f.conds, cond)
+	f.args = append(f.args, args...)
+	return f
+}
+
+// Equal 添加等值查询条件(值为零值时忽略)
+func (f *Filter) Equal(column string, value interface{}) *Filter {
+	if value == nil || reflect.ValueOf(value).IsZero() {
+		return f
+	}
+	return f.Where(fmt.Sprintf("%s=?", column), value)
+}
+
+// Like 添加模糊查询条件(值为空时忽略)
+func (f *Filter) Like(column, value string) *Filter {
+	if value == "" {
+		return f
+	}
+	return f.Where(fmt.Sprintf("%s LIKE ?", column), "%"+value+"%")
+}
+
+// In 添加IN查询条件(切片为空时忽略)
+func (f *Filter) In(column string, values interface{}) *Filter {
+	if v := reflect.ValueOf(values); !v.IsValid() || v.Len() == 0 {
+		return f
+	}
+	return f.Where(fmt.Sprintf("%s IN(?)", column), values)
+}
+
+// build 组织WHERE子句，deleted为软删除条件
+func (f *Filter) build(deleted string) (string, []interface{}) {
+	conds := []string{deleted}
+	var args []interface{}
+	if f != nil {
+		conds = append(conds, f.conds...)
+		args = f.args
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Repository 通用数据仓库，根据实体的db标签生成查询列，
+// 统一处理软删除(deleted)、记录内码(record_id)查询、时间戳及分页
+type Repository struct {
+	db    *DB
+	table string
+}
+
+// NewRepository 创建通用数据仓库
+func NewRepository(db *DB, table string) *Repository {
+	return &Repository{db: db, table: table}
+}
+
+// Primary 创建只使用主库查询的数据仓库(写入前的检查不能容忍副本延迟)
+func (r *Repository) Primary() *Repository {
+	return &Repository{db: r.db.Primary(), table: r.table}
+}
+
+// TableName 表名
+func (r *Repository) TableName() string {
+	return r.table
+}
+
+// where 组织查询条件(展开IN查询的参数，模糊查询使用方言的不区分大小写运算符)
+func (r *Repository) where(filter *Filter, deleted string) (string, []interface{}, error) {
+	where, args := filter.build(deleted)
+	if like := r.db.Dialect().Like(); like != "LIKE" {
+		where = strings.Replace(where, " LIKE ?", " "+like+" ?", -1)
+	}
+	return r.db.In(where, args...)
+}
+
+func (r *Repository) page(ctx context.Context, filter *Filter, deleted, fields, order string, pageIndex, pageSize uint, items interface{}) (int64, error) {
+	where, args, err := r.where(filter, deleted)
+	if err != nil {
+		return 0, err
+	}
+
+	db := r.db.WithContext(ctx)
+	count, err := db.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s %s", r.table, where), args...)
+	if err != nil {
+		return 0, err
+	} else if count == 0 {
+		return 0, nil
+	}
+
+	if order != "" {
+		where = fmt.Sprintf("%s ORDER BY %s", where, order)
+	}
+	_, err = db.Select(items, fmt.Sprintf("SELECT %s FROM %s %s LIMIT %d OFFSET %d", fields, r.table, where, pageSize, (pageIndex-1)*pageSize), args...)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// QueryPage 查询分页数据，查询列由items(结构体切片的指针)的db标签确定
+func (r *Repository) QueryPage(ctx context.Context, filter *Filter, order string, pageIndex, pageSize uint, items interface{}) (int64, error) {
+	fields := strings.Join(Columns(items), ",")
+	count, err := r.page(ctx, filter, "deleted=0", fields, order, pageIndex, pageSize, items)
+	if err != nil {
+		return 0, errors.Wrap(err, "查询分页数据发生错误")
+	}
+	return count, nil
+}
+
+// Query 查询数据列表，查询列由items(结构体切片的指针)的db标签确定
+func (r *Repository) Query(ctx context.Context, filter *Filter, order string, items interface{}) error {
+	where, args, err := r.where(filter, "deleted=0")
+	if err != nil {
+		return errors.Wrap(err, "查询数据发生错误")
+	}
+
+	if order != "" {
+		where = fmt.Sprintf("%s ORDER BY %s", where, order)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(Columns(items), ","), r.table, where)
+	_, err = r.db.WithContext(ctx).Select(items, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "查询数据发生错误")
+	}
+	return nil
+}
+
+func (r *Repository) getOne(ctx context.Context, filter *Filter, deleted string, item interface{}) (bool, error) {
+	where, args, err := r.where(filter, deleted)
+	if err != nil {
+		return false, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(Columns(item), ","), r.table, where)
+	err = r.db.WithContext(ctx).SelectOne(item, query, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Get 查询指定数据，返回数据是否存在
+func (r *Repository) Get(ctx context.Context, recordID string, item interface{}) (bool, error) {
+	ok, err := r.getOne(ctx, NewFilter().Where("record_id=?", recordID), "deleted=0", item)
+	if err != nil {
+		return false, errors.Wrap(err, "查询指定数据发生错误")
+	}
+	return ok, nil
+}
+
+// GetBy 根据查询条件查询单条数据，返回数据是否存在
+func (r *Repository) GetBy(ctx context.Context, filter *Filter, item interface{}) (bool, error) {
+	ok, err := r.getOne(ctx, filter, "deleted=0", item)
+	if err != nil {
+		return false, errors.Wrap(err, "查询指定数据发生错误")
+	}
+	return ok, nil
+}
+
+// Exists 检查满足查询条件的数据是否存在
+func (r *Repository) Exists(ctx context.Context, filter *Filter) (bool, error) {
+	where, args, err := r.where(filter, "deleted=0")
+	if err != nil {
+		return false, errors.Wrap(err, "检查数据是否存在发生错误")
+	}
+
+	n, err := r.db.WithContext(ctx).SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s %s", r.table, where), args...)
+	if err != nil {
+		return false, errors.Wrap(err, "检查数据是否存在发生错误")
+	}
+	return n > 0, nil
+}
+
+// Check 检查数据是否存在
+func (r *Repository) Check(ctx context.Context, recordID string) (bool, error) {
+	return r.Exists(ctx, NewFilter().Where("record_id=?", recordID))
+}
+
+// Create 创建数据(未设置创建时间时使用当前时间)
+func (r *Repository) Create(ctx context.Context, item interface{}) error {
+	setTimestamp(item, "created", time.Now().Unix())
+
+	err := r.db.WithContext(ctx).Insert(item)
+	if err != nil {
+		return errors.Wrap(err, "创建数据发生错误")
+	}
+	return nil
+}
+
+// Update 更新未删除的数据(未指定更新时间时使用当前时间，version大于0时校验版本号)
+func (r *Repository) Update(ctx context.Context, recordID string, info M, version int64) error {
+	if _, ok := info["updated"]; !ok {
+		info["updated"] = time.Now().Unix()
+	}
+
+	db := r.db.WithContext(ctx)
+	affected, err := db.UpdateByPKWithVersion(db, r.table, M{"record_id": recordID, "deleted": 0}, version, info)
+	if err != nil {
+		return errors.Wrap(err, "更新数据发生错误")
+	} else if affected == 0 {
+		return util.ErrConflict
+	}
+	return nil
+}
+
+// Delete 删除未删除的数据(软删除)，返回使用的删除时间戳
+func (r *Repository) Delete(ctx context.Context, recordID string) (int64, error) {
+	deleted := time.Now().Unix()
+	_, err := r.db.WithContext(ctx).UpdateByPK(r.table,
+		M{"record_id": recordID, "deleted": 0},
+		M{"deleted": deleted})
+	if err != nil {
+		return 0, errors.Wrap(err, "删除数据发生错误")
+	}
+	return deleted, nil
+}
+
+// QueryDeletedPage 查询已删除的分页数据(回收站)，fields为查询列
+func (r *Repository) QueryDeletedPage(ctx context.Context, fields string, pageIndex, pageSize uint, items interface{}) (int64, error) {
+	count, err := r.page(ctx, nil, "deleted<>0", fields, "deleted DESC,id DESC", pageIndex, pageSize, items)
+	if err != nil {
+		return 0, errors.Wrap(err, "查询已删除的分页数据发生错误")
+	}
+	return count, nil
+}
+
+// GetDeleted 查询指定的已删除数据，返回数据是否存在
+func (r *Repository) GetDeleted(ctx context.Context, recordID string, item interface{}) (bool, error) {
+	ok, err := r.getOne(ctx, NewFilter().Where("record_id=?", recordID), "deleted<>0", item)
+	if err != nil {
+		return false, errors.Wrap(err, "查询指定的已删除数据发生错误")
+	}
+	return ok, nil
+}
+
+// Restore 恢复已删除的数据，info为同时更新的字段(可为空)
+func (r *Repository) Restore(ctx context.Context, recordID string, deleted int64, info M) error {
+	values := M{"deleted": 0, "updated": time.Now().Unix()}
+	for k, v := range info {
+		values[k] = v
+	}
+
+	_, err := r.db.WithContext(ctx).UpdateByPK(r.table,
+		M{"record_id": recordID, "deleted": deleted},
+		values)
+	if err != nil {
+		return errors.Wrap(err, "恢复数据发生错误")
+	}
+	return nil
+}
+
+// Purge 彻底删除已删除的数据
+func (r *Repository) Purge(ctx context.Context, recordID string) error {
+	_, err := r.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted<>0 AND record_id=?", r.table), recordID)
+	if err != nil {
+		return errors.Wrap(err, "彻底删除数据发生错误")
+	}
+	return nil
+}
+
+// PurgeExpired 彻底删除指定时间之前删除的数据，返回删除的数据条数
+func (r *Repository) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	result, err := r.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted<>0 AND deleted<?", r.table), before)
+	if err != nil {
+		return 0, errors.Wrap(err, "清理已删除数据发生错误")
+	}
+
+	n, _ := result.RowsAffected()
+	return n, nil
+}
+
+// setTimestamp 为db标签为column且未设置值的int64字段设置时间戳
+func setTimestamp(item interface{}, column string, ts int64) {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("db")
+		if i := strings.IndexByte(tag, ','); i != -1 {
+			tag = tag[:i]
+		}
+		if tag != column {
+			continue
+		}
+
+		if f := v.Field(i); f.Kind() == reflect.Int64 && f.Int() == 0 && f.CanSet() {
+			f.SetInt(ts)
+		}
+		return
+	}
+}
@@ -0,0 +1,218 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"moddns/app/util"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	return NewRepository(newTestDB(t), "t_item")
+}
+
+// checkQuery 检查最后执行的语句及参数(参数为nil时不检查)
+func checkQuery(t *testing.T, query string, args ...driver.Value) {
+	c := testSQLDriver.last()
+	if c.query != query {
+		t.Fatalf("执行的语句错误：%s", c.query)
+	}
+	if args != nil && !reflect.DeepEqual(c.args, args) {
+		t.Fatalf("执行的参数错误：%v", c.args)
+	}
+}
+
+type testBase struct {
+	ID       int64  `db:"id,primarykey,autoincrement"`
+	RecordID string `db:"record_id,size:36"`
+}
+
+type testEntity struct {
+	testBase
+	Name    string   `db:"name,size:50"`
+	Created int64    `db:"created"`
+	RoleIDs []string `db:"-"`
+	Memo    string
+}
+
+func TestColumns(t *testing.T) {
+	expected := []string{"id", "record_id", "name", "created"}
+
+	var items []*testEntity
+	for _, v := range []interface{}{testEntity{}, &testEntity{}, &items} {
+		if cols := Columns(v); !reflect.DeepEqual(cols, expected) {
+			t.Errorf("%T的列名错误：%v", v, cols)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	filter := NewFilter().
+		Like("name", "foo").
+		Like("code", "").
+		Equal("status", 1).
+		Equal("type", 0).
+		In("record_id", []string{"a", "b"}).
+		In("parent_id", []string{})
+
+	where, args := filter.build("deleted=0")
+	if where != "WHERE deleted=0 AND name LIKE ? AND status=? AND record_id IN(?)" {
+		t.Errorf("查询条件错误：%s", where)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"%foo%", 1, []string{"a", "b"}}) {
+		t.Errorf("查询参数错误：%v", args)
+	}
+
+	var nilFilter *Filter
+	if where, _ := nilFilter.build("deleted<>0"); where != "WHERE deleted<>0" {
+		t.Errorf("空查询条件错误：%s", where)
+	}
+}
+
+func TestSetTimestamp(t *testing.T) {
+	item := &testEntity{}
+	setTimestamp(item, "created", 100)
+	if item.Created != 100 {
+		t.Errorf("未设置创建时间：%d", item.Created)
+	}
+
+	setTimestamp(item, "created", 200)
+	if item.Created != 100 {
+		t.Errorf("不应覆盖已设置的创建时间：%d", item.Created)
+	}
+}
+
+// whereArgs 解析UPDATE语句的更新条件及对应的参数(更新条件的顺序不固定)
+func whereArgs(t *testing.T, query string, args []driver.Value) map[string]driver.Value {
+	i := strings.Index(query, " WHERE ")
+	if i < 0 {
+		t.Fatalf("缺少更新条件：%s", query)
+	}
+	conds := strings.Split(query[i+len(" WHERE "):], " and ")
+	args = args[strings.Count(query[:i], "?"):]
+	if len(conds) != len(args) {
+		t.Fatalf("更新条件与参数不匹配：%s %v", query, args)
+	}
+
+	m := make(map[string]driver.Value, len(conds))
+	for j, cond := range conds {
+		m[cond] = args[j]
+	}
+	return m
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	defer repo.db.Close()
+	repo.db.AddTableWithName(testEntity{}, "t_item")
+
+	testSQLDriver.reset(1, 0, nil)
+	item := &testEntity{Name: "foo"}
+	item.RecordID = "r1"
+	if err := repo.Create(ctx, item); err != nil {
+		t.Fatal(err)
+	} else if item.ID != 1 || item.Created == 0 {
+		t.Fatalf("创建数据错误：%+v", item)
+	}
+	if q := testSQLDriver.last().query; !strings.HasPrefix(q, "insert into `t_item`") {
+		t.Fatalf("创建数据的语句错误：%s", q)
+	}
+
+	testSQLDriver.reset(0, 0, []string{"id", "record_id", "name", "created"},
+		[]driver.Value{int64(1), "r1", "foo", int64(100)})
+	var got testEntity
+	if ok, err := repo.Get(ctx, "r1", &got); err != nil || !ok || got.Name != "foo" {
+		t.Fatalf("查询数据错误：%v,%v,%+v", ok, err, got)
+	}
+	checkQuery(t, "SELECT id,record_id,name,created FROM t_item WHERE deleted=0 AND record_id=?", "r1")
+
+	testSQLDriver.reset(0, 0, []string{"id", "record_id", "name", "created"})
+	if ok, err := repo.Get(ctx, "r2", &got); err != nil || ok {
+		t.Fatalf("数据不存在时应返回false：%v,%v", ok, err)
+	}
+
+	testSQLDriver.reset(0, 2, nil)
+	if ok, err := repo.Check(ctx, "r1"); err != nil || !ok {
+		t.Fatalf("检查数据错误：%v,%v", ok, err)
+	}
+	checkQuery(t, "SELECT COUNT(*) FROM t_item WHERE deleted=0 AND record_id=?", "r1")
+
+	// 仅更新未删除且版本号一致的数据
+	testSQLDriver.reset(1, 0, nil)
+	if err := repo.Update(ctx, "r1", M{"name": "bar"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	c := testSQLDriver.last()
+	q, args := c.query, c.args
+	if !strings.HasPrefix(q, "UPDATE t_item SET version=version+1,") {
+		t.Fatalf("更新数据的语句错误：%s", q)
+	}
+	if w := whereArgs(t, q, args); !reflect.DeepEqual(w, map[string]driver.Value{
+		"record_id=?": "r1", "deleted=?": int64(0), "version=?": int64(3)}) {
+		t.Fatalf("更新条件错误：%s %v", q, args)
+	}
+
+	testSQLDriver.reset(0, 0, nil)
+	if err := repo.Update(ctx, "r1", M{"name": "bar"}, 2); err != util.ErrConflict {
+		t.Fatalf("未更新数据时应返回冲突：%v", err)
+	}
+
+	// 已删除的数据不能再次删除(保留原删除时间戳)
+	testSQLDriver.reset(1, 0, nil)
+	deleted, err := repo.Delete(ctx, "r1")
+	if err != nil || deleted == 0 {
+		t.Fatalf("删除数据错误：%d,%v", deleted, err)
+	}
+	c = testSQLDriver.last()
+	q, args = c.query, c.args
+	if !strings.HasPrefix(q, "UPDATE t_item SET deleted=? WHERE ") || args[0] != deleted {
+		t.Fatalf("删除数据的语句错误：%s %v", q, args)
+	}
+	if w := whereArgs(t, q, args); !reflect.DeepEqual(w, map[string]driver.Value{
+		"record_id=?": "r1", "deleted=?": int64(0)}) {
+		t.Fatalf("删除条件错误：%s %v", q, args)
+	}
+
+	testSQLDriver.reset(0, 11, []string{"id", "record_id", "name", "created"},
+		[]driver.Value{int64(1), "r1", "foo", int64(100)})
+	var items []*testEntity
+	if n, err := repo.QueryPage(ctx, NewFilter().Like("name", "f"), "id DESC", 2, 10, &items); err != nil || n != 11 || len(items) != 1 {
+		t.Fatalf("查询分页数据错误：%d,%v,%v", n, err, items)
+	}
+	checkQuery(t, "SELECT id,record_id,name,created FROM t_item WHERE deleted=0 AND name LIKE ? ORDER BY id DESC LIMIT 10 OFFSET 10", "%f%")
+}
+
+func TestRepositoryRecycle(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	defer repo.db.Close()
+
+	testSQLDriver.reset(3, 0, nil)
+	n, err := repo.PurgeExpired(ctx, 100)
+	if err != nil || n != 3 {
+		t.Fatalf("清理结果错误：%d,%v", n, err)
+	}
+	// 仅清理已删除且删除时间在保留期限之前的数据
+	checkQuery(t, "DELETE FROM t_item WHERE deleted<>0 AND deleted<?", int64(100))
+
+	if err := repo.Purge(ctx, "r1"); err != nil {
+		t.Fatal(err)
+	}
+	checkQuery(t, "DELETE FROM t_item WHERE deleted<>0 AND record_id=?", "r1")
+
+	if err := repo.Restore(ctx, "r1", 100, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 仅恢复删除时间戳一致的数据
+	c := testSQLDriver.last()
+	q, args := c.query, c.args
+	where := q[strings.Index(q, " WHERE "):]
+	if !strings.Contains(where, "record_id=?") || !strings.Contains(where, "deleted=?") ||
+		!reflect.DeepEqual(args[2:], []driver.Value{"r1", int64(100)}) && !reflect.DeepEqual(args[2:], []driver.Value{int64(100), "r1"}) {
+		t.Fatalf("恢复的条件错误：%s %v", q, args)
+	}
+}
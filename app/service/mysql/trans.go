@@ -0,0 +1,154 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"gopkg.in/gorp.v2"
+)
+
+// ErrTransRollback 工作单元中的事务已被标记回滚
+var ErrTransRollback = errors.New("事务已回滚")
+
+type transContextKey struct{}
+
+// unitOfWork 工作单元
+type unitOfWork struct {
+	tran     *gorp.Transaction
+	done     bool     // 事务是否已结束
+	rollback bool     // 是否已被加入的事务标记回滚
+	hooks    []func() // 提交后执行的函数
+}
+
+// fromTransContext 从上下文中获取进行中的工作单元
+func fromTransContext(ctx context.Context) *unitOfWork {
+	if ctx == nil {
+		return nil
+	}
+	if uow, ok := ctx.Value(transContextKey{}).(*unitOfWork); ok && !uow.done {
+		return uow
+	}
+	return nil
+}
+
+// InTrans 检查上下文中是否存在进行中的工作单元
+func InTrans(ctx context.Context) bool {
+	return fromTransContext(ctx) != nil
+}
+
+// AfterCommit 注册工作单元提交后执行的函数(上下文中不存在工作单元时立即执行)
+func AfterCommit(ctx context.Context, fn func()) {
+	if uow := fromTransContext(ctx); uow != nil {
+		uow.hooks = append(uow.hooks, fn)
+		return
+	}
+	fn()
+}
+
+// ExecTrans 在工作单元(事务)中执行，上下文中已存在工作单元时直接加入；
+// fn返回错误或者事务被标记回滚时整体回滚，提交成功后依次执行通过AfterCommit注册的函数
+func (d *DB) ExecTrans(ctx context.Context, fn func(context.Context) error) error {
+	if fromTransContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	tran, err := d.WithContext(ctx).Begin()
+	if err != nil {
+		return err
+	}
+
+	uow := &unitOfWork{tran: tran}
+	defer func() {
+		if r := recover(); r != nil {
+			uow.done = true
+			tran.Rollback()
+			panic(r)
+		}
+	}()
+
+	err = fn(context.WithValue(ctx, transContextKey{}, uow))
+	if err == nil && uow.rollback {
+		err = ErrTransRollback
+	}
+	uow.done = true
+
+	if err != nil {
+		tran.Rollback()
+		return err
+	}
+
+	err = tran.Commit()
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range uow.hooks {
+		hook()
+	}
+	return nil
+}
+
+// Trans 事务，加入工作单元时提交与回滚由工作单元统一处理
+type Trans struct {
+	*gorp.Transaction
+	uow *unitOfWork
+	db  *DB
+}
+
+// Select 查询数据列表
+func (t *Trans) Select(i interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	return t.db.Select(i, query, args...)
+}
+
+// SelectOne 查询单条数据
+func (t *Trans) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	return t.db.SelectOne(holder, query, args...)
+}
+
+// SelectInt 查询整型值
+func (t *Trans) SelectInt(query string, args ...interface{}) (int64, error) {
+	return t.db.SelectInt(query, args...)
+}
+
+// Insert 插入数据
+func (t *Trans) Insert(list ...interface{}) error {
+	return t.db.Insert(list...)
+}
+
+// Exec 执行SQL
+func (t *Trans) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.db.Exec(query, args...)
+}
+
+// Commit 提交事务
+func (t *Trans) Commit() error {
+	if t.uow != nil {
+		return nil
+	}
+	return t.Transaction.Commit()
+}
+
+// Rollback 回滚事务(加入工作单元时标记整个工作单元回滚)
+func (t *Trans) Rollback() error {
+	if t.uow != nil {
+		t.uow.rollback = true
+		return nil
+	}
+	return t.Transaction.Rollback()
+}
+
+// BeginTrans 开启事务，上下文中存在工作单元时加入该工作单元
+func (d *DB) BeginTrans(ctx context.Context) (*Trans, error) {
+	db := d.WithContext(ctx)
+	if uow := fromTransContext(ctx); uow != nil {
+		return &Trans{Transaction: uow.tran, uow: uow, db: db}, nil
+	}
+
+	tran, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	db.tran = tran
+	return &Trans{Transaction: tran, db: db}, nil
+}
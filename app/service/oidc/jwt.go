@@ -0,0 +1,225 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // 注册SHA-256
+	_ "crypto/sha512" // 注册SHA-384及SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 支持的签名算法(不接受none及HMAC算法，防止算法混淆)
+var signingAlgs = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// jwtHeader JWS的头部
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwt 解析后的紧凑格式JWS
+type jwt struct {
+	header    jwtHeader
+	signed    string // 签名的内容(头部.载荷)
+	payload   []byte
+	signature []byte
+}
+
+// parseJWT 解析紧凑格式的JWS(不校验签名)
+func parseJWT(raw string) (*jwt, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	t := &jwt{
+		signed:    parts[0] + "." + parts[1],
+		payload:   payload,
+		signature: signature,
+	}
+	if err := json.Unmarshal(header, &t.header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := signingAlgs[t.header.Alg]; !ok {
+		return nil, fmt.Errorf("%s: 不支持的签名算法[%s]", ErrInvalidToken.Error(), t.header.Alg)
+	}
+	return t, nil
+}
+
+// verify 使用公钥校验签名(密钥类型需要与签名算法一致)
+func (t *jwt) verify(key crypto.PublicKey) error {
+	hash := signingAlgs[t.header.Alg]
+	h := hash.New()
+	h.Write([]byte(t.signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if t.header.Alg[:2] == "RS" && rsa.VerifyPKCS1v15(k, hash, digest, t.signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		// 签名为定长的r||s(RFC 7518 3.4)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if t.header.Alg[:2] == "ES" && len(t.signature) == 2*size {
+			r := new(big.Int).SetBytes(t.signature[:size])
+			s := new(big.Int).SetBytes(t.signature[size:])
+			if ecdsa.Verify(k, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s: 签名校验失败", ErrInvalidToken.Error())
+}
+
+// jwk JSON Web Key(仅使用的字段)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey 转换为公钥(不支持的密钥类型返回nil)
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		buf, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(buf) == 0 {
+			return nil, fmt.Errorf("oidc: 无效的JWK[%s]", k.Kid)
+		}
+		return new(big.Int).SetBytes(buf), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		} else if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("oidc: 无效的JWK[%s]", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("oidc: 无效的JWK[%s]", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, nil
+}
+
+// keySet 缓存的JWKS，遇到未知的密钥时重新获取(支持身份提供方轮换密钥)
+type keySet struct {
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// get 获取kid对应的公钥(kid为空时仅在只有一个密钥时使用该密钥)
+func (s *keySet) get(ctx context.Context, p *Provider, uri, kid string, interval time.Duration) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key := s.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	if s.keys != nil && time.Since(s.fetchedAt) < interval {
+		return nil, fmt.Errorf("%s: 未知的密钥[%s]", ErrInvalidToken.Error(), kid)
+	}
+
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, uri, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, err
+		} else if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	s.keys = keys
+	s.fetchedAt = time.Now()
+
+	if key := s.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: 未知的密钥[%s]", ErrInvalidToken.Error(), kid)
+}
+
+// lookup 查找缓存的公钥(调用方持有锁)
+func (s *keySet) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return s.keys[kid]
+}
@@ -0,0 +1,423 @@
+// Package oidc 实现OpenID Connect依赖方的授权码流程(PKCE)，并使用身份提供方的JWKS校验ID令牌
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = time.Second * 10
+	maxBodySize    = 1 << 20
+)
+
+var (
+	// ErrInvalidToken 无效的ID令牌(签名、签发方、受众、有效期或随机数校验失败)
+	ErrInvalidToken = errors.New("oidc: 无效的ID令牌")
+)
+
+type (
+	// Option 依赖方的配置项
+	Option func(*options)
+
+	options struct {
+		issuer       string        // 签发方(身份提供方的地址)
+		clientID     string        // 客户端ID
+		clientSecret string        // 客户端密钥(为空时为公共客户端)
+		redirectURL  string        // 回调地址
+		scopes       []string      // 授权范围
+		httpClient   *http.Client  // 请求身份提供方使用的客户端
+		leeway       time.Duration // 校验有效期时允许的时钟偏差
+		jwksInterval time.Duration // 遇到未知密钥时重新获取JWKS的最小间隔
+	}
+)
+
+// SetIssuer 设置签发方(身份提供方的地址，需要与发现文档及ID令牌中的iss一致)
+func SetIssuer(issuer string) Option {
+	return func(o *options) {
+		o.issuer = strings.TrimRight(issuer, "/")
+	}
+}
+
+// SetClient 设置客户端ID及密钥(密钥为空时为公共客户端，仅依赖PKCE)
+func SetClient(id, secret string) Option {
+	return func(o *options) {
+		o.clientID = id
+		o.clientSecret = secret
+	}
+}
+
+// SetRedirectURL 设置回调地址
+func SetRedirectURL(redirectURL string) Option {
+	return func(o *options) {
+		o.redirectURL = redirectURL
+	}
+}
+
+// SetScopes 设置授权范围(总是包含openid)
+func SetScopes(scopes ...string) Option {
+	return func(o *options) {
+		o.scopes = []string{"openid"}
+		for _, s := range scopes {
+			if s != "" && s != "openid" {
+				o.scopes = append(o.scopes, s)
+			}
+		}
+	}
+}
+
+// SetHTTPClient 设置请求身份提供方使用的客户端
+func SetHTTPClient(cli *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = cli
+	}
+}
+
+// SetLeeway 设置校验有效期时允许的时钟偏差
+func SetLeeway(leeway time.Duration) Option {
+	return func(o *options) {
+		o.leeway = leeway
+	}
+}
+
+// SetJWKSRefreshInterval 设置遇到未知密钥时重新获取JWKS的最小间隔(防止伪造的kid频繁触发请求)
+func SetJWKSRefreshInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.jwksInterval = interval
+	}
+}
+
+// NewProvider 创建身份提供方的客户端(首次使用时获取发现文档)
+func NewProvider(opts ...Option) *Provider {
+	o := &options{
+		scopes:       []string{"openid", "profile", "email"},
+		httpClient:   &http.Client{Timeout: defaultTimeout},
+		leeway:       time.Minute,
+		jwksInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Provider{opts: o}
+}
+
+// Provider 身份提供方的客户端
+type Provider struct {
+	opts *options
+	mu   sync.Mutex
+	meta *metadata
+	keys keySet
+}
+
+// metadata 发现文档(仅使用的字段)
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Token 令牌端点的响应
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// tokenError 令牌端点的错误响应
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// discover 获取发现文档(成功后缓存，失败时下次重新获取)
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	err := p.getJSON(ctx, p.opts.issuer+"/.well-known/openid-configuration", &meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Issuer != p.opts.issuer {
+		return nil, fmt.Errorf("oidc: 发现文档的签发方[%s]与配置[%s]不一致", meta.Issuer, p.opts.issuer)
+	} else if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: 发现文档缺少授权、令牌或JWKS端点")
+	}
+
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// getJSON 发送GET请求并解析JSON响应
+func (p *Provider) getJSON(ctx context.Context, rawurl string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.opts.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("oidc: 请求[%s]发生错误：%s", rawurl, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: 请求[%s]返回状态码%d", rawurl, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(v); err != nil {
+		return fmt.Errorf("oidc: 解析[%s]的响应发生错误：%s", rawurl, err.Error())
+	}
+	return nil
+}
+
+// AuthCodeURL 生成授权地址，state防止跨站请求伪造，nonce绑定ID令牌，verifier为PKCE的验证码
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: 无效的授权端点：%s", err.Error())
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.opts.clientID)
+	q.Set("redirect_uri", p.opts.redirectURL)
+	q.Set("scope", strings.Join(p.opts.scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", ChallengeS256(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange 使用授权码及PKCE的验证码换取令牌
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.opts.redirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.opts.clientSecret == "" {
+		form.Set("client_id", p.opts.clientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.opts.clientSecret != "" {
+		// client_secret_basic(RFC 6749 2.3.1，凭据需要先进行表单编码)
+		req.SetBasicAuth(url.QueryEscape(p.opts.clientID), url.QueryEscape(p.opts.clientSecret))
+	}
+
+	resp, err := p.opts.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: 请求令牌端点发生错误：%s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: 读取令牌端点的响应发生错误：%s", err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e tokenError
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("oidc: 换取令牌失败：%s(%s)", e.Error, e.Description)
+		}
+		return nil, fmt.Errorf("oidc: 令牌端点返回状态码%d", resp.StatusCode)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("oidc: 解析令牌端点的响应发生错误：%s", err.Error())
+	} else if token.IDToken == "" {
+		return nil, errors.New("oidc: 令牌端点未返回ID令牌")
+	}
+	return &token, nil
+}
+
+// VerifyIDToken 校验ID令牌的签名(JWKS)、签发方、受众、有效期及随机数，返回令牌的声明
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := parseJWT(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.SigningAlgs) > 0 && !containsString(meta.SigningAlgs, token.header.Alg) {
+		return nil, fmt.Errorf("%s: 身份提供方不支持签名算法%s", ErrInvalidToken.Error(), token.header.Alg)
+	}
+
+	key, err := p.keys.get(ctx, p, meta.JWKSURI, token.header.Kid, p.opts.jwksInterval)
+	if err != nil {
+		return nil, err
+	}
+	if err := token.verify(key); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(token.payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := p.validateClaims(claims, nonce); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validateClaims 校验ID令牌的声明(OpenID Connect Core 3.1.3.7)
+func (p *Provider) validateClaims(claims Claims, nonce string) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s: %s", ErrInvalidToken.Error(), fmt.Sprintf(format, args...))
+	}
+
+	if iss := claims.String("iss"); iss != p.opts.issuer {
+		return invalid("签发方[%s]不匹配", iss)
+	}
+	if claims.String("sub") == "" {
+		return invalid("缺少主体标识")
+	}
+
+	aud := claims.Strings("aud")
+	if !containsString(aud, p.opts.clientID) {
+		return invalid("受众不包含当前客户端")
+	}
+	if azp := claims.String("azp"); (len(aud) > 1 || azp != "") && azp != p.opts.clientID {
+		return invalid("授权方[%s]不是当前客户端", azp)
+	}
+
+	now := time.Now()
+	exp, ok := claims.Time("exp")
+	if !ok {
+		return invalid("缺少过期时间")
+	} else if !now.Before(exp.Add(p.opts.leeway)) {
+		return invalid("令牌已过期")
+	}
+	if iat, ok := claims.Time("iat"); ok && iat.After(now.Add(p.opts.leeway)) {
+		return invalid("签发时间晚于当前时间")
+	}
+	if nbf, ok := claims.Time("nbf"); ok && nbf.After(now.Add(p.opts.leeway)) {
+		return invalid("令牌尚未生效")
+	}
+
+	if nonce != "" && claims.String("nonce") != nonce {
+		return invalid("随机数不匹配")
+	}
+	return nil
+}
+
+// Claims ID令牌的声明
+type Claims map[string]interface{}
+
+// String 获取字符串声明(不存在或非字符串时返回空)
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings 获取字符串或字符串数组的声明
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	case []string:
+		return v
+	}
+	return nil
+}
+
+// Bool 获取布尔声明，ok表示声明是否存在
+func (c Claims) Bool(name string) (value bool, ok bool) {
+	switch v := c[name].(type) {
+	case bool:
+		return v, true
+	case string:
+		// 部分身份提供方以字符串返回布尔值
+		return v == "true", true
+	}
+	return false, false
+}
+
+// Time 获取时间声明(自1970年起的秒数)
+func (c Claims) Time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// RandomString 生成随机字符串(n字节的base64url编码)，用于state、nonce及PKCE的验证码
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// ChallengeS256 计算PKCE的验证码对应的挑战(RFC 7636 4.2)
+func ChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
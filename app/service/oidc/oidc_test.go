@@ -0,0 +1,247 @@
+package oidc_test
+
+import (
+	"context"
+	"moddns/app/service/oidc"
+	"moddns/app/service/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const redirectURL = "http://127.0.0.1/api/v1/login/oidc/callback"
+
+func newProvider(srv *oidctest.Server, secret string) *oidc.Provider {
+	return oidc.NewProvider(
+		oidc.SetIssuer(srv.Issuer()),
+		oidc.SetClient("moddns", secret),
+		oidc.SetRedirectURL(redirectURL),
+		oidc.SetScopes("profile", "groups"),
+		oidc.SetJWKSRefreshInterval(0),
+	)
+}
+
+// authorize 访问授权地址，返回回调地址中的授权码
+func authorize(t *testing.T, p *oidc.Provider, state, nonce, verifier string) string {
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := cli.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(loc.String(), redirectURL) {
+		t.Fatalf("授权端点应重定向到回调地址：%s", resp.Header.Get("Location"))
+	}
+	if loc.Query().Get("state") != state || loc.Query().Get("code") == "" {
+		t.Fatalf("回调参数错误：%s", loc.RawQuery)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestLogin(t *testing.T) {
+	srv, err := oidctest.NewServer("moddns", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.SetClaims(map[string]interface{}{
+		"sub":                "u-1",
+		"preferred_username": "alice",
+		"groups":             []string{"admins", "users"},
+	})
+
+	ctx := context.Background()
+	p := newProvider(srv, "s3cret")
+	verifier, _ := oidc.RandomString(32)
+
+	code := authorize(t, p, "state1", "nonce1", verifier)
+	token, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := p.VerifyIDToken(ctx, token.IDToken, "nonce1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.String("preferred_username") != "alice" || len(claims.Strings("groups")) != 2 {
+		t.Fatalf("声明错误：%v", claims)
+	}
+
+	// 随机数不匹配
+	if _, err := p.VerifyIDToken(ctx, token.IDToken, "nonce2"); err == nil {
+		t.Fatal("随机数不匹配时应校验失败")
+	}
+
+	// 授权码只能使用一次
+	if _, err := p.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("重复使用授权码应失败")
+	}
+
+	// PKCE的验证码错误
+	code = authorize(t, p, "state2", "nonce2", verifier)
+	if _, err := p.Exchange(ctx, code, verifier+"x"); err == nil {
+		t.Fatal("PKCE验证码错误时应换取失败")
+	}
+
+	// 客户端密钥错误
+	bad := newProvider(srv, "wrong")
+	code = authorize(t, bad, "state3", "nonce3", verifier)
+	if _, err := bad.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("客户端密钥错误时应换取失败")
+	}
+
+	// 轮换密钥后重新获取JWKS
+	if err := srv.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	code = authorize(t, p, "state4", "nonce4", verifier)
+	token, err = p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(ctx, token.IDToken, "nonce4"); err != nil {
+		t.Fatalf("轮换密钥后应能校验：%v", err)
+	}
+}
+
+func TestPublicClient(t *testing.T) {
+	srv, err := oidctest.NewServer("moddns", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	ctx := context.Background()
+	p := newProvider(srv, "")
+	verifier, _ := oidc.RandomString(32)
+
+	code := authorize(t, p, "state", "nonce", verifier)
+	token, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := p.VerifyIDToken(ctx, token.IDToken, "nonce"); err != nil || claims.String("sub") != "user1" {
+		t.Fatalf("公共客户端登录错误：%v,%v", claims, err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	srv, err := oidctest.NewServer("moddns", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	ctx := context.Background()
+	p := newProvider(srv, "s3cret")
+	now := time.Now().Unix()
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   srv.Issuer(),
+			"sub":   "u-1",
+			"aud":   "moddns",
+			"iat":   now,
+			"exp":   now + 60,
+			"nonce": "n",
+		}
+	}
+
+	token, err := srv.Sign(valid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(ctx, token, "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func(map[string]interface{}){
+		"签发方错误":    func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"受众错误":     func(c map[string]interface{}) { c["aud"] = "other" },
+		"授权方错误":    func(c map[string]interface{}) { c["aud"] = []string{"moddns", "other"}; c["azp"] = "other" },
+		"已过期":      func(c map[string]interface{}) { c["exp"] = now - 3600 },
+		"缺少过期时间":   func(c map[string]interface{}) { delete(c, "exp") },
+		"签发时间未来":   func(c map[string]interface{}) { c["iat"] = now + 3600 },
+		"缺少主体标识":   func(c map[string]interface{}) { delete(c, "sub") },
+		"缺少随机数":    func(c map[string]interface{}) { delete(c, "nonce") },
+		"随机数不匹配":   func(c map[string]interface{}) { c["nonce"] = "m" },
+		"尚未生效":     func(c map[string]interface{}) { c["nbf"] = now + 3600 },
+		"多受众缺少授权方": func(c map[string]interface{}) { c["aud"] = []string{"moddns", "other"} },
+	}
+	for name, fn := range cases {
+		claims := valid()
+		fn(claims)
+		token, err := srv.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.VerifyIDToken(ctx, token, "n"); err == nil {
+			t.Fatalf("%s时应校验失败", name)
+		}
+	}
+
+	// 篡改载荷
+	parts := strings.Split(token, ".")
+	tampered, _ := srv.Sign(map[string]interface{}{"sub": "admin"})
+	parts[1] = strings.Split(tampered, ".")[1]
+	if _, err := p.VerifyIDToken(ctx, strings.Join(parts, "."), ""); err == nil {
+		t.Fatal("篡改的令牌应校验失败")
+	}
+
+	// 不接受none算法
+	none := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+	if _, err := p.VerifyIDToken(ctx, none, ""); err == nil {
+		t.Fatal("none算法的令牌应校验失败")
+	}
+
+	// 签名密钥不在JWKS中
+	other, err := oidctest.NewServer("moddns", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	claims := valid()
+	forged, _ := other.Sign(claims)
+	if _, err := p.VerifyIDToken(ctx, forged, "n"); err == nil {
+		t.Fatal("其它密钥签名的令牌应校验失败")
+	}
+}
+
+func TestSealer(t *testing.T) {
+	s := oidc.NewSealer("secret")
+
+	type state struct {
+		Nonce string `json:"nonce"`
+	}
+	sealed, err := s.Seal(&state{Nonce: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v state
+	if err := s.Open(sealed, &v); err != nil || v.Nonce != "n" {
+		t.Fatalf("解密错误：%v,%v", v, err)
+	}
+
+	buf := []byte(sealed)
+	buf[len(buf)-2] ^= 1
+	if err := s.Open(string(buf), &v); err != oidc.ErrInvalidSealed {
+		t.Fatalf("篡改的密文应解密失败：%v", err)
+	}
+	if err := oidc.NewSealer("other").Open(sealed, &v); err != oidc.ErrInvalidSealed {
+		t.Fatalf("密钥不匹配时应解密失败：%v", err)
+	}
+}
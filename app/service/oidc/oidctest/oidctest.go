@@ -0,0 +1,282 @@
+// Package oidctest 进程内的OpenID Connect身份提供方(身份提供方替身)，
+// 实现发现文档、授权(PKCE)、令牌及JWKS端点，测试无需依赖外部服务
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// grant 已签发的授权码
+type grant struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      map[string]interface{}
+}
+
+// Server 进程内的身份提供方(授权端点不需要登录，直接为SetClaims设置的用户签发授权码)
+type Server struct {
+	srv          *httptest.Server
+	clientID     string
+	clientSecret string
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	kid    string
+	keyNum int
+	claims map[string]interface{}
+	codes  map[string]*grant
+}
+
+// NewServer 启动身份提供方，clientSecret为空时为公共客户端(令牌请求在表单中传递client_id)
+func NewServer(clientID, clientSecret string) (*Server, error) {
+	s := &Server{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		claims:       map[string]interface{}{"sub": "user1"},
+		codes:        make(map[string]*grant),
+	}
+	if err := s.RotateKey(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.srv = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// Issuer 签发方(服务地址)
+func (s *Server) Issuer() string {
+	return s.srv.URL
+}
+
+// SetClaims 设置后续签发的ID令牌中的用户声明(sub等，签发方相关的声明自动设置)
+func (s *Server) SetClaims(claims map[string]interface{}) {
+	s.mu.Lock()
+	s.claims = claims
+	s.mu.Unlock()
+}
+
+// RotateKey 生成新的签名密钥(JWKS中仅包含新密钥)
+func (s *Server) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keyNum++
+	s.key = key
+	s.kid = fmt.Sprintf("key%d", s.keyNum)
+	s.mu.Unlock()
+	return nil
+}
+
+// Sign 使用当前密钥签名声明(RS256)，用于构造自定义的ID令牌
+func (s *Server) Sign(claims map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+
+	return sign(key, kid, claims)
+}
+
+// Close 关闭服务
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func sign(key *rsa.PrivateKey, kid string, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer(),
+		"authorization_endpoint":                s.Issuer() + "/authorize",
+		"token_endpoint":                        s.Issuer() + "/token",
+		"jwks_uri":                              s.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize 授权端点：校验请求后重定向到回调地址并携带授权码
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("client_id") != s.clientID || redirectURI == "" {
+		http.Error(w, "invalid client", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	rq := u.Query()
+	rq.Set("state", q.Get("state"))
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		rq.Set("error", "invalid_request")
+	} else {
+		code := randomString()
+		s.mu.Lock()
+		s.codes[code] = &grant{
+			clientID:    s.clientID,
+			redirectURI: redirectURI,
+			nonce:       q.Get("nonce"),
+			challenge:   q.Get("code_challenge"),
+			claims:      s.claims,
+		}
+		s.mu.Unlock()
+		rq.Set("code", code)
+	}
+	u.RawQuery = rq.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// token 令牌端点：校验客户端凭据、授权码(一次性)及PKCE的验证码后签发ID令牌
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if id, secret, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if secret != s.clientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		clientID = id
+	} else if s.clientSecret != "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if clientID != s.clientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g := s.codes[code]
+	delete(s.codes, code)
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+
+	if g == nil || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now().Unix()
+	claims := map[string]interface{}{
+		"iss": s.Issuer(),
+		"aud": g.clientID,
+		"iat": now,
+		"exp": now + 300,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+
+	idToken, err := sign(key, kid, claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// jwks JWKS端点：返回当前的签名公钥
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
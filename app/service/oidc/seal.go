@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidSealed 无效的密文(被篡改或密钥不匹配)
+var ErrInvalidSealed = errors.New("oidc: 无效的密文")
+
+// Sealer 使用AES-GCM加密登录流程的状态(如流程cookie及登录票据)，防止客户端读取或篡改
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer 创建加密器，密钥由secret派生(不同用途应使用不同的secret)
+func NewSealer(secret string) *Sealer {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &Sealer{aead: aead}
+}
+
+// Seal 将数据序列化为JSON并加密，返回base64url编码的密文
+func (s *Sealer) Seal(v interface{}) (string, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, buf, nil)), nil
+}
+
+// Open 解密Seal的密文并反序列化
+func (s *Sealer) Open(sealed string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(buf) < s.aead.NonceSize() {
+		return ErrInvalidSealed
+	}
+
+	n := s.aead.NonceSize()
+	plain, err := s.aead.Open(nil, buf[:n], buf[n:], nil)
+	if err != nil {
+		return ErrInvalidSealed
+	}
+	return json.Unmarshal(plain, v)
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var now = time.Now
+
+// NewMemoryStore 创建基于内存的令牌桶存储(仅适用于单实例部署)
+func NewMemoryStore(gcInterval time.Duration) Store {
+	if gcInterval <= 0 {
+		gcInterval = time.Minute
+	}
+
+	s := &memoryStore{
+		buckets: make(map[string]*bucket),
+		ticker:  time.NewTicker(gcInterval),
+		done:    make(chan struct{}),
+	}
+	go s.gc()
+
+	return s
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+type memoryStore struct {
+	sync.Mutex
+	buckets map[string]*bucket
+	ticker  *time.Ticker
+	done    chan struct{} // 关闭时停止清理
+	once    sync.Once
+}
+
+func (s *memoryStore) gc() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ticker.C:
+		}
+
+		t := now()
+
+		s.Lock()
+		for k, b := range s.buckets {
+			// 已填满的令牌桶与新建的令牌桶等价，可以直接移除
+			if b.full.Before(t) {
+				delete(s.buckets, k)
+			}
+		}
+		s.Unlock()
+	}
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, rate float64, burst int) (*Result, error) {
+	t := now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: t}
+		s.buckets[key] = b
+	}
+
+	tokens, result := take(b.tokens, b.last, t, rate, burst)
+	b.tokens = tokens
+	b.last = t
+	b.full = t.Add(result.ResetAfter)
+
+	return result, nil
+}
+
+func (s *memoryStore) Close() error {
+	s.once.Do(func() {
+		s.ticker.Stop()
+		close(s.done)
+	})
+	return nil
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"moddns/app/service/mysql"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// bucketItem 令牌桶存储项
+type bucketItem struct {
+	ID        int64   `db:"id,primarykey,autoincrement"` // 唯一标识(自增ID)
+	BucketKey string  `db:"bucket_key,size:191"`         // 令牌桶键
+	Tokens    float64 `db:"tokens"`                      // 剩余令牌数
+	Updated   int64   `db:"updated"`                     // 更新时间(毫秒)
+	Expired   int64   `db:"expired"`                     // 令牌桶填满的时间(毫秒)
+}
+
+// NewMySQLStore 创建基于数据库(MySQL、PostgreSQL)的令牌桶存储(多实例共享)
+func NewMySQLStore(db *mysql.DB, tableName string, gcInterval time.Duration) Store {
+	if gcInterval <= 0 {
+		gcInterval = time.Minute
+	}
+
+	db.CreateTableIfNotExists(bucketItem{}, tableName)
+	db.CreateTableIndex(tableName, "idx_bucket_key", true, "bucket_key")
+	db.CreateTableIndex(tableName, "idx_expired", false, "expired")
+
+	s := &mysqlStore{
+		db:     db,
+		table:  tableName,
+		ticker: time.NewTicker(gcInterval),
+		done:   make(chan struct{}),
+	}
+	go s.gc()
+
+	return s
+}
+
+type mysqlStore struct {
+	db     *mysql.DB
+	table  string
+	ticker *time.Ticker
+	done   chan struct{} // 关闭时停止清理
+	once   sync.Once
+}
+
+func (s *mysqlStore) gc() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ticker.C:
+		}
+
+		query := fmt.Sprintf("DELETE FROM %s WHERE expired<?", s.table)
+		s.db.Exec(query, toMillis(now()))
+	}
+}
+
+func (s *mysqlStore) Take(ctx context.Context, key string, rate float64, burst int) (*Result, error) {
+	t := now()
+
+	tran, err := s.db.BeginTrans(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "获取令牌发生错误")
+	}
+
+	query := s.db.Dialect().InsertIgnoreSQL(s.table, "bucket_key", "tokens", "updated", "expired")
+	_, err = tran.Exec(query, key, burst, toMillis(t), toMillis(t))
+	if err != nil {
+		tran.Rollback()
+		return nil, errors.Wrap(err, "获取令牌发生错误")
+	}
+
+	var item bucketItem
+	query = fmt.Sprintf("SELECT id,bucket_key,tokens,updated,expired FROM %s WHERE bucket_key=? FOR UPDATE", s.table)
+	err = tran.SelectOne(&item, query, key)
+	if err != nil {
+		tran.Rollback()
+		return nil, errors.Wrap(err, "获取令牌发生错误")
+	}
+
+	tokens, result := take(item.Tokens, fromMillis(item.Updated), t, rate, burst)
+
+	query = fmt.Sprintf("UPDATE %s SET tokens=?,updated=?,expired=? WHERE id=?", s.table)
+	_, err = tran.Exec(query, tokens, toMillis(t), toMillis(t.Add(result.ResetAfter)), item.ID)
+	if err != nil {
+		tran.Rollback()
+		return nil, errors.Wrap(err, "获取令牌发生错误")
+	}
+
+	err = tran.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "获取令牌提交事物发生错误")
+	}
+
+	return result, nil
+}
+
+func (s *mysqlStore) Close() error {
+	s.once.Do(func() {
+		s.ticker.Stop()
+		close(s.done)
+	})
+	return nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+)
+
+// Store 令牌桶存储
+type Store interface {
+	// Take 从指定的令牌桶中获取一个令牌
+	Take(ctx context.Context, key string, rate float64, burst int) (*Result, error)
+	// Close 关闭存储
+	Close() error
+}
+
+// Result 获取令牌的结果
+type Result struct {
+	Allowed    bool          // 是否允许
+	Limit      int           // 令牌桶容量
+	Remaining  int           // 剩余令牌数
+	RetryAfter time.Duration // 距下一个可用令牌的时长
+	ResetAfter time.Duration // 距令牌桶填满的时长
+}
+
+// Rule 限流规则
+type Rule struct {
+	Name   string  // 规则名称
+	Prefix string  // 匹配的路由前缀(路由组)
+	Memo   string  // 匹配的路由说明(WrapContext memo)
+	Rate   float64 // 每秒生成的令牌数
+	Burst  int     // 令牌桶容量
+}
+
+// NewLimiter 创建限流器
+func NewLimiter(store Store, defaultRule *Rule, rules ...*Rule) *Limiter {
+	return &Limiter{
+		store:       store,
+		defaultRule: defaultRule,
+		rules:       rules,
+	}
+}
+
+// Limiter 限流器
+type Limiter struct {
+	store       Store
+	defaultRule *Rule
+	rules       []*Rule
+}
+
+// Match 匹配限流规则(优先匹配memo，其次匹配最长的路由前缀，最后使用默认规则)
+func (a *Limiter) Match(path, memo string) *Rule {
+	if memo != "" {
+		for _, r := range a.rules {
+			if r.Memo != "" && r.Memo == memo {
+				return r
+			}
+		}
+	}
+
+	var matched *Rule
+	for _, r := range a.rules {
+		if r.Prefix == "" || !strings.HasPrefix(path, r.Prefix) {
+			continue
+		}
+		if matched == nil || len(r.Prefix) > len(matched.Prefix) {
+			matched = r
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+
+	return a.defaultRule
+}
+
+// Take 按规则获取令牌，identity为限流主体(用户或IP)
+func (a *Limiter) Take(ctx context.Context, rule *Rule, identity string) (*Result, error) {
+	return a.store.Take(ctx, rule.Name+"|"+identity, rule.Rate, rule.Burst)
+}
+
+// Close 关闭限流器
+func (a *Limiter) Close() error {
+	return a.store.Close()
+}
+
+// take 根据上次的令牌数及时间计算本次获取令牌的结果
+func take(tokens float64, last, now time.Time, rate float64, burst int) (float64, *Result) {
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(burst), tokens+elapsed*rate)
+	}
+
+	result := &Result{Limit: burst}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else if rate > 0 {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	} else {
+		result.RetryAfter = time.Hour
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	if rate > 0 {
+		result.ResetAfter = time.Duration((float64(burst) - tokens) / rate * float64(time.Second))
+	}
+
+	return tokens, result
+}
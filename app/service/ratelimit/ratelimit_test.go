@@ -0,0 +1,205 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"moddns/app/service/redis"
+	"moddns/app/service/redis/redistest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	cur := time.Now()
+	now = func() time.Time { return cur }
+	defer func() { now = time.Now }()
+
+	store := NewMemoryStore(0)
+	defer store.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		result, err := store.Take(ctx, "foo", 1, 3)
+		if err != nil {
+			t.Fatal(err)
+		} else if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("第%d次获取令牌结果错误：%+v", i+1, result)
+		}
+	}
+
+	result, _ := store.Take(ctx, "foo", 1, 3)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("令牌耗尽后应被拒绝：%+v", result)
+	}
+
+	// 其它令牌桶不受影响
+	result, _ = store.Take(ctx, "bar", 1, 3)
+	if !result.Allowed {
+		t.Fatalf("令牌桶之间应互不影响：%+v", result)
+	}
+
+	cur = cur.Add(time.Second)
+	result, _ = store.Take(ctx, "foo", 1, 3)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("令牌应按速率恢复：%+v", result)
+	}
+}
+
+func TestLimiterMatch(t *testing.T) {
+	defaultRule := &Rule{Name: "default", Rate: 10, Burst: 10}
+	login := &Rule{Name: "login", Memo: "用户登录", Rate: 1, Burst: 1}
+	v1 := &Rule{Name: "v1", Prefix: "/api/v1/", Rate: 5, Burst: 5}
+	users := &Rule{Name: "users", Prefix: "/api/v1/users", Rate: 2, Burst: 2}
+
+	limiter := NewLimiter(NewMemoryStore(0), defaultRule, login, v1, users)
+	defer limiter.Close()
+
+	cases := []struct {
+		path, memo string
+		rule       *Rule
+	}{
+		{"/api/v1/login", "用户登录", login},
+		{"/api/v1/users/1", "查询指定用户数据", users},
+		{"/api/v1/roles", "查询角色数据", v1},
+		{"/api/v2/roles", "", defaultRule},
+	}
+
+	for _, c := range cases {
+		if r := limiter.Match(c.path, c.memo); r != c.rule {
+			t.Errorf("路由[%s]匹配的规则错误：%s", c.path, r.Name)
+		}
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.RegisterScript(takeSource, takeScriptFunc)
+
+	client := redis.NewClient(redis.SetAddr(srv.Addr()))
+	defer client.Close()
+
+	cur := time.Now().Truncate(time.Millisecond) // 令牌桶的更新时间精确到毫秒
+	now = func() time.Time { return cur }
+	defer func() { now = time.Now }()
+
+	// 多个实例共享同一令牌桶
+	stores := []Store{NewRedisStore(client), NewRedisStore(client)}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		result, err := stores[i%2].Take(ctx, "foo", 1, 3)
+		if err != nil {
+			t.Fatal(err)
+		} else if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("第%d次获取令牌结果错误：%+v", i+1, result)
+		}
+	}
+
+	result, _ := stores[1].Take(ctx, "foo", 1, 3)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("令牌耗尽后应被拒绝：%+v", result)
+	}
+
+	cur = cur.Add(time.Second)
+	result, _ = stores[0].Take(ctx, "foo", 1, 3)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("令牌应按速率恢复：%+v", result)
+	}
+
+	// 并发获取令牌时不会超发
+	var (
+		wg      sync.WaitGroup
+		allowed int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := stores[i%2].Take(ctx, "bar", 0.001, 5)
+			if err != nil {
+				t.Error(err)
+			} else if result.Allowed {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Fatalf("并发获取的令牌数错误：%d", allowed)
+	}
+}
+
+// takeScriptFunc 获取令牌脚本的Go实现(redistest不能执行Lua)
+func takeScriptFunc(call func(args ...string) interface{}, keys, args []string) interface{} {
+	ms, _ := strconv.ParseInt(args[0], 10, 64)
+	rate, _ := strconv.ParseFloat(args[1], 64)
+	burst, _ := strconv.Atoi(args[2])
+
+	t := fromMillis(ms)
+	tokens, last := float64(burst), t
+	if value, ok := call("GET", keys[0]).([]byte); ok {
+		tokens, last = parseBucket(string(value), tokens, last)
+	}
+	if t.After(last) {
+		tokens = math.Min(float64(burst), tokens+float64(ms-toMillis(last))/1000*rate)
+	}
+
+	rest, result := take(tokens, t, t, rate, burst)
+	ttl := result.ResetAfter
+	if result.RetryAfter > ttl {
+		ttl = result.RetryAfter
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	call("SET", keys[0], fmt.Sprintf("%g %d", rest, ms), "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	return []byte(strconv.FormatFloat(tokens, 'g', 17, 64))
+}
+
+// parseBucket 解析令牌桶的值(格式错误时使用默认值)
+func parseBucket(value string, tokens float64, last time.Time) (float64, time.Time) {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return tokens, last
+	}
+
+	v, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return tokens, last
+	}
+
+	ms, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return tokens, last
+	}
+	return v, fromMillis(ms)
+}
+
+func TestStoreClose(t *testing.T) {
+	base := runtime.NumGoroutine()
+
+	store := NewMemoryStore(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 重复关闭不应panic
+	store.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatal("关闭后应停止定期清理")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"moddns/app/service/redis"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// takeSource 获取令牌的Lua脚本：令牌桶的值为"剩余令牌数 更新时间(毫秒)"，参数为当前时间(毫秒)、速率及容量，
+// 返回按速率补充后(获取令牌前)的令牌数；令牌桶填满(或不再生成令牌时下一个令牌可用)后过期，过期等同于满桶
+const takeSource = `
+local now, rate, burst = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local tokens, last = burst, now
+local value = redis.call('GET', KEYS[1])
+if value then
+	local t, l = string.match(value, '^(%S+) (%S+)$')
+	if tonumber(t) and tonumber(l) then
+		tokens, last = tonumber(t), tonumber(l)
+	end
+end
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) / 1000 * rate)
+end
+
+local rest, ttl = tokens, 0
+if tokens >= 1 then
+	rest = tokens - 1
+elseif rate > 0 then
+	ttl = (1 - tokens) / rate * 1000
+else
+	ttl = 3600000
+end
+if rate > 0 then
+	ttl = math.max(ttl, (burst - rest) / rate * 1000)
+end
+
+redis.call('SET', KEYS[1], string.format('%.17g %d', rest, now), 'PX', math.max(math.floor(ttl), 1000))
+return string.format('%.17g', tokens)
+`
+
+var takeScript = redis.NewScript(takeSource)
+
+// NewRedisStore 创建基于Redis的令牌桶存储(多实例共享，令牌桶填满后由Redis过期删除)，客户端由调用方关闭
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+type redisStore struct {
+	client *redis.Client
+}
+
+// Take 使用Lua脚本原子地更新令牌桶(并发获取时无需重试)
+func (s *redisStore) Take(ctx context.Context, key string, rate float64, burst int) (*Result, error) {
+	t := now()
+
+	value, err := redis.String(takeScript.Run(ctx, s.client, []string{s.client.Key("ratelimit:" + key)}, toMillis(t), rate, burst))
+	if err != nil {
+		return nil, errors.Wrap(err, "获取令牌发生错误")
+	}
+
+	tokens, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "获取令牌发生错误")
+	}
+
+	// 脚本已按当前时间补充令牌，据此计算的结果与脚本中的判断一致
+	_, result := take(tokens, t, t, rate, burst)
+	return result, nil
+}
+
+func (s *redisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,438 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNil 键不存在(空回复)
+	ErrNil = errors.New("redis: nil")
+	// ErrTxFailed 监视的键被修改，乐观事务未执行
+	ErrTxFailed = errors.New("redis: 事务冲突")
+	// ErrClosed 客户端已关闭
+	ErrClosed = errors.New("redis: 客户端已关闭")
+)
+
+type (
+	// Option 配置项
+	Option func(*options)
+
+	options struct {
+		addr        string        // 连接地址
+		password    string        // 密码
+		db          int           // 数据库
+		poolSize    int           // 连接池中保持的最大空闲连接数
+		dialTimeout time.Duration // 连接超时时间
+		ioTimeout   time.Duration // 读写超时时间(上下文未设置截止时间时生效)
+		keyPrefix   string        // 键名前缀
+	}
+)
+
+// SetAddr 设置连接地址(格式：127.0.0.1:6379)
+func SetAddr(addr string) Option {
+	return func(o *options) {
+		o.addr = addr
+	}
+}
+
+// SetPassword 设置密码
+func SetPassword(password string) Option {
+	return func(o *options) {
+		o.password = password
+	}
+}
+
+// SetDB 设置数据库
+func SetDB(db int) Option {
+	return func(o *options) {
+		o.db = db
+	}
+}
+
+// SetPoolSize 设置连接池中保持的最大空闲连接数
+func SetPoolSize(size int) Option {
+	return func(o *options) {
+		o.poolSize = size
+	}
+}
+
+// SetDialTimeout 设置连接超时时间
+func SetDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// SetIOTimeout 设置读写超时时间
+func SetIOTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.ioTimeout = timeout
+	}
+}
+
+// SetKeyPrefix 设置键名前缀(多个应用共享同一Redis时区分键名)
+func SetKeyPrefix(prefix string) Option {
+	return func(o *options) {
+		o.keyPrefix = prefix
+	}
+}
+
+// NewClient 创建Redis客户端(RESP协议，兼容Redis及支持该协议的服务)
+func NewClient(opts ...Option) *Client {
+	o := &options{
+		addr:        "127.0.0.1:6379",
+		poolSize:    20,
+		dialTimeout: time.Second * 5,
+		ioTimeout:   time.Second * 3,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return &Client{
+		opts: o,
+		idle: make(chan *conn, o.poolSize),
+	}
+}
+
+// Client Redis客户端
+type Client struct {
+	opts   *options
+	idle   chan *conn
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Key 获取附加前缀的键名
+func (c *Client) Key(key string) string {
+	return c.opts.keyPrefix + key
+}
+
+// Do 执行命令，返回值见ReadReply；错误回复作为error返回
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(ctx, c.opts.ioTimeout, args...)
+	c.put(cn, err)
+	return reply, replyError(reply, err)
+}
+
+// Ping 检查连接
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Tx 乐观事务中的连接
+type Tx struct {
+	ctx context.Context
+	cn  *conn
+	c   *Client
+}
+
+// Do 在事务的连接上执行命令(用于读取被监视的键)
+func (tx *Tx) Do(args ...interface{}) (interface{}, error) {
+	reply, err := tx.cn.do(tx.ctx, tx.c.opts.ioTimeout, args...)
+	return reply, replyError(reply, err)
+}
+
+// Watch 执行乐观事务：监视keys后调用fn读取数据，fn返回的命令在MULTI/EXEC中执行；
+// 监视的键在此期间被修改时返回ErrTxFailed(调用方可重试)
+func (c *Client) Watch(ctx context.Context, fn func(tx *Tx) ([][]interface{}, error), keys ...string) error {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = c.watch(ctx, cn, fn, keys)
+	if err != nil && cn.err == nil {
+		// 放回连接池前取消监视，避免影响后续的事务
+		_, uerr := cn.do(ctx, c.opts.ioTimeout, "UNWATCH")
+		c.put(cn, uerr)
+	} else {
+		c.put(cn, nil)
+	}
+	return err
+}
+
+func (c *Client) watch(ctx context.Context, cn *conn, fn func(tx *Tx) ([][]interface{}, error), keys []string) error {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "WATCH")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	tx := &Tx{ctx: ctx, cn: cn, c: c}
+	if _, err := tx.Do(args...); err != nil {
+		return err
+	}
+
+	cmds, err := fn(tx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Do("MULTI"); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if _, err := tx.Do(cmd...); err != nil {
+			tx.Do("DISCARD")
+			return err
+		}
+	}
+
+	reply, err := tx.Do("EXEC")
+	if err != nil {
+		return err
+	} else if reply == nil {
+		return ErrTxFailed
+	}
+	return nil
+}
+
+// Script Lua脚本(服务端原子地执行)
+type Script struct {
+	src  string
+	hash string
+}
+
+// NewScript 创建Lua脚本
+func NewScript(src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{src: src, hash: hex.EncodeToString(h[:])}
+}
+
+// Run 执行脚本，返回值见ReadReply；优先使用EVALSHA，服务端未缓存脚本时使用EVAL
+func (s *Script) Run(ctx context.Context, c *Client, keys []string, args ...interface{}) (interface{}, error) {
+	cmd := make([]interface{}, 0, len(keys)+len(args)+3)
+	cmd = append(cmd, "EVALSHA", s.hash, len(keys))
+	for _, key := range keys {
+		cmd = append(cmd, key)
+	}
+	cmd = append(cmd, args...)
+
+	reply, err := c.Do(ctx, cmd...)
+	if e, ok := err.(Error); ok && strings.HasPrefix(string(e), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", s.src
+		reply, err = c.Do(ctx, cmd...)
+	}
+	return reply, err
+}
+
+// Close 关闭客户端及连接池中的连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.idle)
+	for cn := range c.idle {
+		cn.Close()
+	}
+	return nil
+}
+
+// get 获取空闲连接(不存在时创建新连接)
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	select {
+	case cn := <-c.idle:
+		if cn != nil {
+			return cn, nil
+		}
+	default:
+	}
+	return c.dial(ctx)
+}
+
+// put 放回连接(发生网络错误或连接池已满时关闭连接)
+func (c *Client) put(cn *conn, err error) {
+	if err != nil {
+		if _, ok := err.(Error); !ok && err != ErrNil {
+			cn.Close()
+			return
+		}
+	}
+	if cn.err != nil {
+		cn.Close()
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		cn.Close()
+		return
+	}
+
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.opts.dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.opts.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{
+		Conn: nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+	}
+
+	if c.opts.password != "" {
+		reply, err := cn.do(ctx, c.opts.ioTimeout, "AUTH", c.opts.password)
+		if err = replyError(reply, err); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: 认证失败：%s", err.Error())
+		}
+	}
+
+	if c.opts.db > 0 {
+		reply, err := cn.do(ctx, c.opts.ioTimeout, "SELECT", c.opts.db)
+		if err = replyError(reply, err); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: 选择数据库失败：%s", err.Error())
+		}
+	}
+
+	return cn, nil
+}
+
+type conn struct {
+	net.Conn
+	r   *bufio.Reader
+	w   *bufio.Writer
+	err error // 网络错误(连接不可再使用)
+}
+
+func (cn *conn) do(ctx context.Context, timeout time.Duration, args ...interface{}) (interface{}, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok && timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	cn.SetDeadline(deadline)
+
+	if err := WriteCommand(cn.w, args...); err != nil {
+		cn.err = err
+		return nil, err
+	}
+
+	reply, err := ReadReply(cn.r)
+	if err != nil {
+		cn.err = err
+		return nil, err
+	}
+	return reply, nil
+}
+
+// replyError 将错误回复转换为error
+func replyError(reply interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+	if e, ok := reply.(Error); ok {
+		return e
+	}
+	return nil
+}
+
+// Bytes 将回复转换为字节切片(空回复时返回ErrNil)
+func Bytes(reply interface{}, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := reply.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case nil:
+		return nil, ErrNil
+	}
+	return nil, fmt.Errorf("redis: 无法将%T转换为[]byte", reply)
+}
+
+// String 将回复转换为字符串(空回复时返回ErrNil)
+func String(reply interface{}, err error) (string, error) {
+	b, err := Bytes(reply, err)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Int64 将回复转换为整数(空回复时返回ErrNil)
+func Int64(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case nil:
+		return 0, ErrNil
+	}
+	return 0, fmt.Errorf("redis: 无法将%T转换为int64", reply)
+}
+
+// Strings 将多条批量回复转换为字符串切片
+func Strings(reply interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok {
+		if reply == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("redis: 无法将%T转换为[]string", reply)
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		s, err := String(item, nil)
+		if err != nil && err != ErrNil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
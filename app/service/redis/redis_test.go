@@ -0,0 +1,116 @@
+package redis_test
+
+import (
+	"context"
+	"moddns/app/service/redis"
+	"moddns/app/service/redis/redistest"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetPassword("secret")
+	defer srv.Close()
+
+	ctx := context.Background()
+	bad := redis.NewClient(redis.SetAddr(srv.Addr()), redis.SetPassword("wrong"))
+	defer bad.Close()
+	if err := bad.Ping(ctx); err == nil {
+		t.Fatal("密码错误时应认证失败")
+	}
+
+	c := redis.NewClient(redis.SetAddr(srv.Addr()), redis.SetPassword("secret"), redis.SetKeyPrefix("test:"))
+	defer c.Close()
+
+	key := c.Key("foo")
+	if _, err := c.Do(ctx, "SET", key, "bar", "PX", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := redis.String(c.Do(ctx, "GET", key)); err != nil || v != "bar" {
+		t.Fatalf("读取结果错误：%s,%v", v, err)
+	}
+
+	srv.FastForward(time.Second)
+	if _, err := redis.String(c.Do(ctx, "GET", key)); err != redis.ErrNil {
+		t.Fatalf("过期的键应返回ErrNil：%v", err)
+	}
+
+	if _, err := c.Do(ctx, "NOSUCHCMD"); err == nil {
+		t.Fatal("错误回复应作为error返回")
+	} else if _, ok := err.(redis.Error); !ok {
+		t.Fatalf("错误回复的类型错误：%T", err)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	c := redis.NewClient(redis.SetAddr(srv.Addr()))
+	defer c.Close()
+
+	ctx := context.Background()
+	incr := func(modify bool) error {
+		return c.Watch(ctx, func(tx *redis.Tx) ([][]interface{}, error) {
+			n, err := redis.Int64(tx.Do("GET", "n"))
+			if err != nil && err != redis.ErrNil {
+				return nil, err
+			}
+			if modify {
+				// 模拟其它客户端并发修改
+				if _, err := c.Do(ctx, "SET", "n", 100); err != nil {
+					return nil, err
+				}
+			}
+			return [][]interface{}{{"SET", "n", n + 1}}, nil
+		}, "n")
+	}
+
+	if err := incr(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := incr(true); err != redis.ErrTxFailed {
+		t.Fatalf("监视的键被修改时应返回ErrTxFailed：%v", err)
+	}
+	if n, _ := redis.Int64(c.Do(ctx, "GET", "n")); n != 100 {
+		t.Fatalf("事务冲突时不应执行命令：%d", n)
+	}
+	if err := incr(false); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := redis.Int64(c.Do(ctx, "GET", "n")); n != 101 {
+		t.Fatalf("事务执行结果错误：%d", n)
+	}
+}
+
+func TestClientScript(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	src := "return redis.call('INCR', KEYS[1])"
+	srv.RegisterScript(src, func(call func(args ...string) interface{}, keys, args []string) interface{} {
+		return call("INCR", keys[0])
+	})
+
+	c := redis.NewClient(redis.SetAddr(srv.Addr()))
+	defer c.Close()
+
+	// 首次执行时服务端未缓存脚本，使用EVAL执行；之后使用EVALSHA执行
+	ctx := context.Background()
+	script := redis.NewScript(src)
+	for i := int64(1); i <= 2; i++ {
+		if n, err := redis.Int64(script.Run(ctx, c, []string{"n"})); err != nil || n != i {
+			t.Fatalf("第%d次执行脚本的结果错误：%d,%v", i, n, err)
+		}
+	}
+}
@@ -0,0 +1,727 @@
+// Package redistest 进程内的RESP服务(Redis替身)，实现测试使用的命令子集，测试无需依赖外部服务
+package redistest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"moddns/app/service/redis"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type item struct {
+	value   []byte
+	set     map[string]bool
+	expired time.Time // 过期时间(零值表示不过期)
+}
+
+// Server 进程内的RESP服务
+type Server struct {
+	ln       net.Listener
+	password string // 设置后需要AUTH认证
+	mu       sync.Mutex
+	data     map[string]*item
+	versions map[string]uint64 // 键的修改版本(WATCH使用)
+	scripts  map[string]ScriptFunc
+	loaded   map[string]bool // 已通过EVAL缓存的脚本
+	offset   time.Duration   // 快进的时长
+	wg       sync.WaitGroup
+}
+
+// NewServer 启动进程内的RESP服务(监听本地随机端口)
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ln:       ln,
+		data:     make(map[string]*item),
+		versions: make(map[string]uint64),
+		scripts:  make(map[string]ScriptFunc),
+		loaded:   make(map[string]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// SetPassword 设置密码(之后建立的连接需要AUTH认证)
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	s.password = password
+	s.mu.Unlock()
+}
+
+// ScriptFunc 脚本的Go实现(不能执行Lua)，call在脚本中执行命令(同redis.call)
+type ScriptFunc func(call func(args ...string) interface{}, keys, args []string) interface{}
+
+// RegisterScript 注册脚本的Go实现，EVAL及EVALSHA执行该脚本时调用fn(执行期间不执行其它命令)
+func (s *Server) RegisterScript(src string, fn ScriptFunc) {
+	s.mu.Lock()
+	s.scripts[scriptHash(src)] = fn
+	s.mu.Unlock()
+}
+
+func scriptHash(src string) string {
+	h := sha1.Sum([]byte(src))
+	return hex.EncodeToString(h[:])
+}
+
+// Addr 监听地址
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// FastForward 快进时间(用于测试键的过期)
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+}
+
+// Keys 获取未过期的键(已排序)
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for k := range s.data {
+		if s.lookup(k) != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Close 关闭服务
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+// session 连接状态
+type session struct {
+	authed  bool
+	multi   bool
+	queued  [][]string
+	watched map[string]uint64
+	dirty   bool // 事务中的命令排队失败
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	s.mu.Lock()
+	password := s.password
+	s.mu.Unlock()
+
+	sess := &session{authed: password == ""}
+	for {
+		req, err := redis.ReadReply(r)
+		if err != nil {
+			return
+		}
+
+		items, ok := req.([]interface{})
+		if !ok || len(items) == 0 {
+			writeReply(w, redis.Error("ERR 无效的命令"))
+			continue
+		}
+
+		args := make([]string, len(items))
+		for i, v := range items {
+			b, _ := v.([]byte)
+			args[i] = string(b)
+		}
+		writeReply(w, s.exec(sess, password, args))
+	}
+}
+
+func (s *Server) exec(sess *session, password string, args []string) interface{} {
+	cmd := strings.ToUpper(args[0])
+	if !sess.authed && cmd != "AUTH" {
+		return redis.Error("NOAUTH Authentication required.")
+	}
+
+	switch cmd {
+	case "AUTH":
+		if len(args) != 2 || args[1] != password {
+			return redis.Error("ERR invalid password")
+		}
+		sess.authed = true
+		return "OK"
+	case "MULTI":
+		sess.multi = true
+		sess.queued = nil
+		return "OK"
+	case "DISCARD":
+		sess.multi, sess.queued, sess.watched, sess.dirty = false, nil, nil, false
+		return "OK"
+	case "EXEC":
+		return s.execMulti(sess)
+	case "WATCH":
+		s.mu.Lock()
+		if sess.watched == nil {
+			sess.watched = make(map[string]uint64)
+		}
+		for _, key := range args[1:] {
+			s.lookup(key)
+			sess.watched[key] = s.versions[key]
+		}
+		s.mu.Unlock()
+		return "OK"
+	case "UNWATCH":
+		sess.watched = nil
+		return "OK"
+	}
+
+	if sess.multi {
+		if _, ok := commands[cmd]; !ok {
+			sess.dirty = true
+			return redis.Error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		}
+		sess.queued = append(sess.queued, args)
+		return "QUEUED"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.call(cmd, args[1:])
+}
+
+func (s *Server) execMulti(sess *session) interface{} {
+	if !sess.multi {
+		return redis.Error("ERR EXEC without MULTI")
+	}
+
+	queued, watched, dirty := sess.queued, sess.watched, sess.dirty
+	sess.multi, sess.queued, sess.watched, sess.dirty = false, nil, nil, false
+	if dirty {
+		return redis.Error("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, version := range watched {
+		s.lookup(key)
+		if s.versions[key] != version {
+			return nil
+		}
+	}
+
+	replies := make([]interface{}, len(queued))
+	for i, args := range queued {
+		replies[i] = s.call(strings.ToUpper(args[0]), args[1:])
+	}
+	return replies
+}
+
+func (s *Server) call(cmd string, args []string) interface{} {
+	fn, ok := commands[cmd]
+	if !ok {
+		return redis.Error(fmt.Sprintf("ERR unknown command '%s'", cmd))
+	}
+	return fn(s, args)
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// lookup 获取未过期的数据项(过期时删除并视为修改)
+func (s *Server) lookup(key string) *item {
+	it, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !it.expired.IsZero() && !s.now().Before(it.expired) {
+		s.remove(key)
+		return nil
+	}
+	return it
+}
+
+func (s *Server) store(key string, it *item) {
+	s.data[key] = it
+	s.versions[key]++
+}
+
+func (s *Server) remove(key string) bool {
+	if _, ok := s.data[key]; !ok {
+		return false
+	}
+	delete(s.data, key)
+	s.versions[key]++
+	return true
+}
+
+var errSyntax = redis.Error("ERR syntax error")
+var errWrongType = redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+var commands map[string]func(s *Server, args []string) interface{}
+
+func init() {
+	commands = map[string]func(s *Server, args []string) interface{}{
+		"PING":      cmdPing,
+		"SELECT":    cmdSelect,
+		"GET":       cmdGet,
+		"SET":       cmdSet,
+		"DEL":       cmdDel,
+		"EXISTS":    cmdExists,
+		"EXPIRE":    cmdExpire,
+		"PEXPIRE":   cmdPExpire,
+		"TTL":       cmdTTL,
+		"PTTL":      cmdPTTL,
+		"INCR":      cmdIncr,
+		"SADD":      cmdSAdd,
+		"SREM":      cmdSRem,
+		"SMEMBERS":  cmdSMembers,
+		"FLUSHDB":   cmdFlush,
+		"FLUSHALL":  cmdFlush,
+		"DBSIZE":    cmdDBSize,
+		"KEYS":      cmdKeys,
+		"SCARD":     cmdSCard,
+		"SISMEMBER": cmdSIsMember,
+		"EVAL":      cmdEval,
+		"EVALSHA":   cmdEvalSha,
+	}
+}
+
+func cmdEval(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	hash := scriptHash(args[0])
+	if _, ok := s.scripts[hash]; !ok {
+		return redis.Error("ERR 未注册的脚本")
+	}
+	s.loaded[hash] = true
+	return evalScript(s, hash, args[1:])
+}
+
+func cmdEvalSha(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	hash := strings.ToLower(args[0])
+	if !s.loaded[hash] {
+		return redis.Error("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return evalScript(s, hash, args[1:])
+}
+
+// evalScript 执行脚本，args为键的数量、键及参数
+func evalScript(s *Server, hash string, args []string) interface{} {
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || n > len(args)-1 {
+		return redis.Error("ERR Number of keys can't be greater than number of args")
+	}
+
+	call := func(args ...string) interface{} {
+		return s.call(strings.ToUpper(args[0]), args[1:])
+	}
+	return s.scripts[hash](call, args[1:n+1], args[n+1:])
+}
+
+func cmdPing(s *Server, args []string) interface{} {
+	if len(args) > 0 {
+		return []byte(args[0])
+	}
+	return "PONG"
+}
+
+func cmdSelect(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errSyntax
+	}
+	return "OK"
+}
+
+func cmdGet(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	it := s.lookup(args[0])
+	if it == nil {
+		return nil
+	} else if it.set != nil {
+		return errWrongType
+	}
+	return it.value
+}
+
+// cmdSet SET key value [EX seconds|PX milliseconds] [NX|XX]
+func cmdSet(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	var (
+		expired time.Time
+		nx, xx  bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return redis.Error("ERR invalid expire time in set")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expired = s.now().Add(time.Duration(n) * unit)
+			i++
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return errSyntax
+		}
+	}
+
+	exists := s.lookup(args[0]) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+
+	s.store(args[0], &item{value: []byte(args[1]), expired: expired})
+	return "OK"
+}
+
+func cmdDel(s *Server, args []string) interface{} {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil && s.remove(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(s *Server, args []string) interface{} {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExpire(s *Server, args []string) interface{} {
+	return expire(s, args, time.Second)
+}
+
+func cmdPExpire(s *Server, args []string) interface{} {
+	return expire(s, args, time.Millisecond)
+}
+
+func expire(s *Server, args []string, unit time.Duration) interface{} {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return redis.Error("ERR value is not an integer or out of range")
+	}
+
+	it := s.lookup(args[0])
+	if it == nil {
+		return int64(0)
+	} else if n <= 0 {
+		s.remove(args[0])
+		return int64(1)
+	}
+
+	it.expired = s.now().Add(time.Duration(n) * unit)
+	s.versions[args[0]]++
+	return int64(1)
+}
+
+func cmdTTL(s *Server, args []string) interface{} {
+	return ttl(s, args, time.Second)
+}
+
+func cmdPTTL(s *Server, args []string) interface{} {
+	return ttl(s, args, time.Millisecond)
+}
+
+func ttl(s *Server, args []string, unit time.Duration) interface{} {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	it := s.lookup(args[0])
+	if it == nil {
+		return int64(-2)
+	} else if it.expired.IsZero() {
+		return int64(-1)
+	}
+	return int64((it.expired.Sub(s.now()) + unit - 1) / unit)
+}
+
+func cmdIncr(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	var n int64
+	it := s.lookup(args[0])
+	if it != nil {
+		if it.set != nil {
+			return errWrongType
+		}
+		v, err := strconv.ParseInt(string(it.value), 10, 64)
+		if err != nil {
+			return redis.Error("ERR value is not an integer or out of range")
+		}
+		n = v
+	} else {
+		it = &item{}
+	}
+
+	n++
+	it.value = []byte(strconv.FormatInt(n, 10))
+	s.store(args[0], it)
+	return n
+}
+
+// setItem 获取集合类型的数据项(create为true时不存在则创建)
+func setItem(s *Server, key string, create bool) (*item, interface{}) {
+	it := s.lookup(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		it = &item{set: make(map[string]bool)}
+		s.data[key] = it
+	} else if it.set == nil {
+		return nil, errWrongType
+	}
+	return it, nil
+}
+
+func cmdSAdd(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	it, errReply := setItem(s, args[0], true)
+	if errReply != nil {
+		return errReply
+	}
+
+	var n int64
+	for _, member := range args[1:] {
+		if !it.set[member] {
+			it.set[member] = true
+			n++
+		}
+	}
+	s.versions[args[0]]++
+	return n
+}
+
+func cmdSRem(s *Server, args []string) interface{} {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	it, errReply := setItem(s, args[0], false)
+	if errReply != nil || it == nil {
+		if errReply != nil {
+			return errReply
+		}
+		return int64(0)
+	}
+
+	var n int64
+	for _, member := range args[1:] {
+		if it.set[member] {
+			delete(it.set, member)
+			n++
+		}
+	}
+	if len(it.set) == 0 {
+		s.remove(args[0])
+	} else {
+		s.versions[args[0]]++
+	}
+	return n
+}
+
+func cmdSMembers(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	it, errReply := setItem(s, args[0], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	members := []interface{}{}
+	if it != nil {
+		var keys []string
+		for member := range it.set {
+			keys = append(keys, member)
+		}
+		sort.Strings(keys)
+		for _, member := range keys {
+			members = append(members, []byte(member))
+		}
+	}
+	return members
+}
+
+func cmdSCard(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	it, errReply := setItem(s, args[0], false)
+	if errReply != nil {
+		return errReply
+	} else if it == nil {
+		return int64(0)
+	}
+	return int64(len(it.set))
+}
+
+func cmdSIsMember(s *Server, args []string) interface{} {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	it, errReply := setItem(s, args[0], false)
+	if errReply != nil {
+		return errReply
+	} else if it == nil || !it.set[args[1]] {
+		return int64(0)
+	}
+	return int64(1)
+}
+
+func cmdFlush(s *Server, args []string) interface{} {
+	for key := range s.data {
+		s.remove(key)
+	}
+	return "OK"
+}
+
+func cmdDBSize(s *Server, args []string) interface{} {
+	var n int64
+	for key := range s.data {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// cmdKeys KEYS pattern(仅支持*通配符)
+func cmdKeys(s *Server, args []string) interface{} {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	var keys []string
+	for key := range s.data {
+		if s.lookup(key) != nil && match(args[0], key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		result[i] = []byte(key)
+	}
+	return result
+}
+
+func match(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 {
+			return strings.HasSuffix(s, part)
+		}
+		j := strings.Index(s, part)
+		if j == -1 {
+			return false
+		}
+		s = s[j+len(part):]
+	}
+	return true
+}
+
+// writeReply 按RESP协议写入回复
+func writeReply(w *bufio.Writer, reply interface{}) {
+	writeValue(w, reply)
+	w.Flush()
+}
+
+func writeValue(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		w.WriteString("+" + v + "\r\n")
+	case redis.Error:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case []byte:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n")
+		w.Write(v)
+		w.WriteString("\r\n")
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeValue(w, item)
+		}
+	}
+}
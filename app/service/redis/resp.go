@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error Redis返回的错误回复
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// WriteCommand 按RESP协议写入命令(参数为字符串、字节切片、整数及浮点数，其它类型使用fmt格式化)
+func WriteCommand(w *bufio.Writer, args ...interface{}) error {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(len(args)))
+	w.WriteString("\r\n")
+
+	for _, arg := range args {
+		var b []byte
+		switch v := arg.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		case int:
+			b = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		case float64:
+			b = strconv.AppendFloat(nil, v, 'f', -1, 64)
+		default:
+			b = []byte(fmt.Sprint(v))
+		}
+
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(b)))
+		w.WriteString("\r\n")
+		w.Write(b)
+		w.WriteString("\r\n")
+	}
+	return w.Flush()
+}
+
+// ReadReply 按RESP协议读取回复：状态回复为string，错误回复为Error，整数回复为int64，
+// 批量回复为[]byte，多条批量回复为[]interface{}，空回复为nil
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	} else if len(line) == 0 {
+		return nil, errors.New("redis: 无效的回复")
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		} else if n < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		} else if n < 0 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := ReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: 无效的回复类型[%c]", line[0])
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(line) - 2
+	if n < 0 || line[n] != '\r' {
+		return nil, errors.New("redis: 无效的回复行")
+	}
+	return line[:n], nil
+}
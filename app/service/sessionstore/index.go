@@ -0,0 +1,223 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"moddns/app/service/mysql"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	_ Index = &memoryIndex{}
+	_ Index = &dbIndex{}
+)
+
+// NewMemoryIndex 创建基于内存的会话索引(与内存会话存储配合使用，仅适用于单实例部署)
+func NewMemoryIndex(gcInterval time.Duration) Index {
+	if gcInterval <= 0 {
+		gcInterval = time.Minute * 10
+	}
+
+	s := &memoryIndex{
+		items:  make(map[string]*Record),
+		ticker: time.NewTicker(gcInterval),
+		done:   make(chan struct{}),
+	}
+	go s.gc()
+
+	return s
+}
+
+type memoryIndex struct {
+	lock   sync.RWMutex
+	items  map[string]*Record
+	ticker *time.Ticker
+	done   chan struct{} // 关闭时停止清理
+	once   sync.Once
+}
+
+func (s *memoryIndex) gc() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ticker.C:
+		}
+
+		now := time.Now().Unix()
+		s.lock.Lock()
+		for sid, item := range s.items {
+			if item.ExpiredAt <= now {
+				delete(s.items, sid)
+			}
+		}
+		s.lock.Unlock()
+	}
+}
+
+func (s *memoryIndex) Save(ctx context.Context, item *Record) error {
+	v := *item
+	s.lock.Lock()
+	s.items[item.SessionID] = &v
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *memoryIndex) Get(ctx context.Context, sid string) (*Record, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	item, ok := s.items[sid]
+	if !ok || item.ExpiredAt <= time.Now().Unix() {
+		return nil, nil
+	}
+	v := *item
+	return &v, nil
+}
+
+func (s *memoryIndex) List(ctx context.Context, userID string) ([]*Record, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	now := time.Now().Unix()
+	var list []*Record
+	for _, item := range s.items {
+		if item.UserID == userID && item.ExpiredAt > now {
+			v := *item
+			list = append(list, &v)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryIndex) Delete(ctx context.Context, items ...*Record) error {
+	s.lock.Lock()
+	for _, item := range items {
+		delete(s.items, item.SessionID)
+	}
+	s.lock.Unlock()
+	return nil
+}
+
+// Close 停止清理过期的会话记录
+func (s *memoryIndex) Close() error {
+	s.once.Do(func() {
+		s.ticker.Stop()
+		close(s.done)
+	})
+	return nil
+}
+
+// recordColumns 会话记录表的列
+const recordColumns = "session_id,record_id,user_id,ip,user_agent,login_at,last_active,expired_at"
+
+// NewIndex 创建基于数据库(MySQL、PostgreSQL)的会话索引，方言差异由db处理
+func NewIndex(db *mysql.DB, tableName string, gcInterval time.Duration) Index {
+	if gcInterval <= 0 {
+		gcInterval = time.Minute * 10
+	}
+
+	db.CreateTableIfNotExists(Record{}, tableName)
+	db.CreateTableIndex(tableName, "idx_user_id", false, "user_id")
+	db.CreateTableIndex(tableName, "idx_expired_at", false, "expired_at")
+
+	s := &dbIndex{
+		db:     db.Primary(), // 读取使用主库(撤销会话后不应再读取到旧的记录)
+		table:  tableName,
+		ticker: time.NewTicker(gcInterval),
+		done:   make(chan struct{}),
+	}
+	go s.gc()
+
+	return s
+}
+
+type dbIndex struct {
+	db     *mysql.DB
+	table  string
+	ticker *time.Ticker
+	done   chan struct{} // 关闭时停止清理
+	once   sync.Once
+}
+
+func (s *dbIndex) gc() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ticker.C:
+		}
+
+		s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expired_at<=?", s.table), time.Now().Unix())
+	}
+}
+
+func (s *dbIndex) Save(ctx context.Context, item *Record) error {
+	query := s.db.Dialect().UpsertSQL(s.table, []string{"session_id"},
+		[]string{"session_id", "record_id", "user_id", "ip", "user_agent", "login_at", "last_active", "expired_at"},
+		[]string{"record_id", "user_id", "ip", "user_agent", "login_at", "last_active", "expired_at"})
+	_, err := s.db.WithContext(ctx).Exec(query, item.SessionID, item.RecordID, item.UserID,
+		item.IP, item.UserAgent, item.LoginAt, item.LastActive, item.ExpiredAt)
+	if err != nil {
+		return errors.Wrap(err, "保存会话记录发生错误")
+	}
+	return nil
+}
+
+func (s *dbIndex) Get(ctx context.Context, sid string) (*Record, error) {
+	var item Record
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE session_id=? AND expired_at>?", recordColumns, s.table)
+	err := s.db.WithContext(ctx).SelectOne(&item, query, sid, time.Now().Unix())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "查询会话记录发生错误")
+	}
+	return &item, nil
+}
+
+func (s *dbIndex) List(ctx context.Context, userID string) ([]*Record, error) {
+	var items []*Record
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id=? AND expired_at>?", recordColumns, s.table)
+	_, err := s.db.WithContext(ctx).Select(&items, query, userID, time.Now().Unix())
+	if err != nil {
+		return nil, errors.Wrap(err, "查询会话记录发生错误")
+	}
+	return items, nil
+}
+
+func (s *dbIndex) Delete(ctx context.Context, items ...*Record) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	sids := make([]string, len(items))
+	for i, item := range items {
+		sids[i] = item.SessionID
+	}
+
+	query, args, err := s.db.In(fmt.Sprintf("DELETE FROM %s WHERE session_id IN (?)", s.table), sids)
+	if err != nil {
+		return errors.Wrap(err, "删除会话记录发生错误")
+	}
+
+	_, err = s.db.WithContext(ctx).Exec(query, args...)
+	if err != nil {
+		return errors.Wrap(err, "删除会话记录发生错误")
+	}
+	return nil
+}
+
+// Close 停止清理过期的会话记录(数据库连接由调用方关闭)
+func (s *dbIndex) Close() error {
+	s.once.Do(func() {
+		s.ticker.Stop()
+		close(s.done)
+	})
+	return nil
+}
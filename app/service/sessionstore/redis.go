@@ -0,0 +1,313 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"moddns/app/service/redis"
+	"sync"
+	"time"
+
+	"github.com/go-session/session"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ session.ManagerStore = &redisManagerStore{}
+	_ session.Store        = &redisStore{}
+)
+
+// NewRedisStore 创建基于Redis的会话存储(会话过期由Redis处理)，客户端由调用方关闭
+func NewRedisStore(client *redis.Client) session.ManagerStore {
+	return &redisManagerStore{client: client}
+}
+
+type redisManagerStore struct {
+	client *redis.Client
+}
+
+func (s *redisManagerStore) key(sid string) string {
+	return s.client.Key("session:" + sid)
+}
+
+// getValue 获取会话数据(不存在时为空)
+func (s *redisManagerStore) getValue(ctx context.Context, sid string) (string, error) {
+	value, err := redis.String(s.client.Do(ctx, "GET", s.key(sid)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "查询会话发生错误")
+	}
+	return value, nil
+}
+
+func (s *redisManagerStore) Check(ctx context.Context, sid string) (bool, error) {
+	n, err := redis.Int64(s.client.Do(ctx, "EXISTS", s.key(sid)))
+	if err != nil {
+		return false, errors.Wrap(err, "查询会话发生错误")
+	}
+	return n > 0, nil
+}
+
+func (s *redisManagerStore) Create(ctx context.Context, sid string, expired int64) (session.Store, error) {
+	return s.newStore(ctx, sid, expired, nil), nil
+}
+
+func (s *redisManagerStore) Update(ctx context.Context, sid string, expired int64) (session.Store, error) {
+	value, err := s.getValue(ctx, sid)
+	if err != nil {
+		return nil, err
+	} else if value == "" {
+		return s.newStore(ctx, sid, expired, nil), nil
+	}
+
+	if expired > 0 {
+		_, err = s.client.Do(ctx, "EXPIRE", s.key(sid), expired)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "更新会话发生错误")
+	}
+
+	values, err := parseValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return s.newStore(ctx, sid, expired, values), nil
+}
+
+func (s *redisManagerStore) Delete(ctx context.Context, sid string) error {
+	_, err := s.client.Do(ctx, "DEL", s.key(sid))
+	if err != nil {
+		return errors.Wrap(err, "删除会话发生错误")
+	}
+	return nil
+}
+
+func (s *redisManagerStore) Refresh(ctx context.Context, oldsid, sid string, expired int64) (session.Store, error) {
+	value, err := s.getValue(ctx, oldsid)
+	if err != nil {
+		return nil, err
+	} else if value == "" {
+		return s.newStore(ctx, sid, expired, nil), nil
+	}
+
+	_, err = s.client.Do(ctx, setArgs(s.key(sid), value, expired)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "刷新会话发生错误")
+	}
+
+	err = s.Delete(ctx, oldsid)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return s.newStore(ctx, sid, expired, values), nil
+}
+
+// Close 客户端由调用方关闭
+func (s *redisManagerStore) Close() error {
+	return nil
+}
+
+func (s *redisManagerStore) newStore(ctx context.Context, sid string, expired int64, values map[string]interface{}) *redisStore {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+
+	return &redisStore{
+		manager: s,
+		ctx:     ctx,
+		sid:     sid,
+		expired: expired,
+		values:  values,
+	}
+}
+
+type redisStore struct {
+	sync.RWMutex
+	manager *redisManagerStore
+	ctx     context.Context
+	sid     string
+	expired int64
+	values  map[string]interface{}
+}
+
+func (s *redisStore) Context() context.Context {
+	return s.ctx
+}
+
+func (s *redisStore) SessionID() string {
+	return s.sid
+}
+
+func (s *redisStore) Set(key string, value interface{}) {
+	s.Lock()
+	s.values[key] = value
+	s.Unlock()
+}
+
+func (s *redisStore) Get(key string) (interface{}, bool) {
+	s.RLock()
+	val, ok := s.values[key]
+	s.RUnlock()
+	return val, ok
+}
+
+func (s *redisStore) Delete(key string) interface{} {
+	s.Lock()
+	v, ok := s.values[key]
+	if ok {
+		delete(s.values, key)
+	}
+	s.Unlock()
+	return v
+}
+
+func (s *redisStore) Flush() error {
+	s.Lock()
+	s.values = make(map[string]interface{})
+	s.Unlock()
+	return s.Save()
+}
+
+// Save 保存会话数据并重置有效期
+func (s *redisStore) Save() error {
+	s.RLock()
+	buf, err := json.Marshal(s.values)
+	s.RUnlock()
+	if err != nil {
+		return errors.Wrap(err, "保存会话发生错误")
+	}
+
+	_, err = s.manager.client.Do(s.ctx, setArgs(s.manager.key(s.sid), buf, s.expired)...)
+	if err != nil {
+		return errors.Wrap(err, "保存会话发生错误")
+	}
+	return nil
+}
+
+// setArgs 写入会话的命令参数(有效期不大于0时不过期)
+func setArgs(key string, value interface{}, expired int64) []interface{} {
+	args := []interface{}{"SET", key, value}
+	if expired > 0 {
+		args = append(args, "EX", expired)
+	}
+	return args
+}
+
+var _ Index = &redisIndex{}
+
+// NewRedisIndex 创建基于Redis的会话索引(记录过期由Redis处理)，客户端由调用方关闭
+func NewRedisIndex(client *redis.Client) Index {
+	return &redisIndex{client: client}
+}
+
+type redisIndex struct {
+	client *redis.Client
+}
+
+func (s *redisIndex) recordKey(sid string) string {
+	return s.client.Key("session_record:" + sid)
+}
+
+func (s *redisIndex) userKey(userID string) string {
+	return s.client.Key("user_sessions:" + userID)
+}
+
+// Save 保存会话记录，并延长用户会话集合的有效期
+func (s *redisIndex) Save(ctx context.Context, item *Record) error {
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrap(err, "保存会话记录发生错误")
+	}
+
+	ttl := item.ExpiredAt - time.Now().Unix()
+	if ttl <= 0 {
+		return nil
+	}
+
+	_, err = s.client.Do(ctx, "SET", s.recordKey(item.SessionID), buf, "EX", ttl)
+	if err == nil {
+		_, err = s.client.Do(ctx, "SADD", s.userKey(item.UserID), item.SessionID)
+	}
+	if err == nil {
+		_, err = s.client.Do(ctx, "EXPIRE", s.userKey(item.UserID), ttl)
+	}
+	if err != nil {
+		return errors.Wrap(err, "保存会话记录发生错误")
+	}
+	return nil
+}
+
+func (s *redisIndex) Get(ctx context.Context, sid string) (*Record, error) {
+	buf, err := redis.Bytes(s.client.Do(ctx, "GET", s.recordKey(sid)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "查询会话记录发生错误")
+	}
+
+	var item Record
+	if err := json.Unmarshal(buf, &item); err != nil {
+		return nil, errors.Wrap(err, "解析会话记录发生错误")
+	}
+	return &item, nil
+}
+
+// List 查询用户的会话记录，已过期的会话ID从集合中移除
+func (s *redisIndex) List(ctx context.Context, userID string) ([]*Record, error) {
+	sids, err := redis.Strings(s.client.Do(ctx, "SMEMBERS", s.userKey(userID)))
+	if err != nil {
+		return nil, errors.Wrap(err, "查询会话记录发生错误")
+	}
+
+	var list []*Record
+	for _, sid := range sids {
+		item, err := s.Get(ctx, sid)
+		if err != nil {
+			return nil, err
+		} else if item == nil || item.UserID != userID {
+			if _, err := s.client.Do(ctx, "SREM", s.userKey(userID), sid); err != nil {
+				return nil, errors.Wrap(err, "删除会话记录发生错误")
+			}
+			continue
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// Delete 删除会话记录(未指定用户ID时先查询记录)
+func (s *redisIndex) Delete(ctx context.Context, items ...*Record) error {
+	for _, item := range items {
+		userID := item.UserID
+		if userID == "" {
+			old, err := s.Get(ctx, item.SessionID)
+			if err != nil {
+				return err
+			} else if old == nil {
+				continue
+			}
+			userID = old.UserID
+		}
+
+		_, err := s.client.Do(ctx, "DEL", s.recordKey(item.SessionID))
+		if err == nil {
+			_, err = s.client.Do(ctx, "SREM", s.userKey(userID), item.SessionID)
+		}
+		if err != nil {
+			return errors.Wrap(err, "删除会话记录发生错误")
+		}
+	}
+	return nil
+}
+
+// Close 客户端由调用方关闭
+func (s *redisIndex) Close() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package sessionstore
+
+import (
+	"context"
+	"moddns/app/service/redis"
+	"moddns/app/service/redis/redistest"
+	"testing"
+	"time"
+)
+
+func TestRedisStore(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client := redis.NewClient(redis.SetAddr(srv.Addr()), redis.SetKeyPrefix("app:"))
+	defer client.Close()
+
+	ctx := context.Background()
+	manager := NewRedisStore(client)
+	store, _ := manager.Create(ctx, "sid1", 60)
+	store.Set("user_id", "u1")
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := manager.Check(ctx, "sid1"); err != nil || !ok {
+		t.Fatalf("保存后会话应存在：%t,%v", ok, err)
+	}
+
+	store, err = manager.Update(ctx, "sid1", 60)
+	if err != nil {
+		t.Fatal(err)
+	} else if v, _ := store.Get("user_id"); v != "u1" {
+		t.Fatalf("会话数据错误：%v", v)
+	}
+
+	store, err = manager.Refresh(ctx, "sid1", "sid2", 60)
+	if err != nil {
+		t.Fatal(err)
+	} else if v, _ := store.Get("user_id"); v != "u1" {
+		t.Fatalf("刷新后的会话数据错误：%v", v)
+	}
+	if ok, _ := manager.Check(ctx, "sid1"); ok {
+		t.Fatal("刷新后原会话不应存在")
+	}
+
+	srv.FastForward(time.Minute)
+	if ok, _ := manager.Check(ctx, "sid2"); ok {
+		t.Fatal("会话过期后不应存在")
+	}
+}
+
+func TestRedisRegistry(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client := redis.NewClient(redis.SetAddr(srv.Addr()))
+	defer client.Close()
+
+	testRegistry(t, NewRedisStore(client), NewRedisIndex(client))
+
+	srv.FastForward(time.Hour)
+	if keys := srv.Keys(); len(keys) > 0 {
+		t.Fatalf("会话过期后记录应被删除：%v", keys)
+	}
+}
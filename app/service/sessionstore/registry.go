@@ -0,0 +1,294 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/go-session/session"
+	"github.com/google/uuid"
+)
+
+// 超出同时在线会话数时的处理方式
+const (
+	PolicyKickOldest = "kick_oldest" // 撤销最早登录的会话
+	PolicyReject     = "reject"      // 拒绝新的登录
+)
+
+var (
+	// ErrSessionLimit 同时在线的会话数已达上限
+	ErrSessionLimit = errors.New("同时在线的会话数已达上限")
+	// ErrSessionRevoked 会话未登记(已被撤销或登记失败)
+	ErrSessionRevoked = errors.New("会话已失效")
+)
+
+// Record 会话记录(按用户ID索引，会话ID不对外暴露，通过记录ID撤销会话)
+type Record struct {
+	SessionID  string `json:"session_id" db:"session_id,primarykey,size:255"` // 会话ID
+	RecordID   string `json:"record_id" db:"record_id,size:36"`               // 记录ID
+	UserID     string `json:"user_id" db:"user_id,size:36"`                   // 用户ID
+	IP         string `json:"ip" db:"ip,size:64"`                             // 客户端IP
+	UserAgent  string `json:"user_agent" db:"user_agent,size:255"`            // 客户端标识
+	LoginAt    int64  `json:"login_at" db:"login_at"`                         // 登录时间
+	LastActive int64  `json:"last_active" db:"last_active"`                   // 最后活动时间
+	ExpiredAt  int64  `json:"expired_at" db:"expired_at"`                     // 过期时间
+}
+
+// Index 会话索引
+type Index interface {
+	// Save 保存会话记录(不存在时插入，存在时更新)
+	Save(ctx context.Context, item *Record) error
+	// Get 查询未过期的会话记录(不存在时返回nil)
+	Get(ctx context.Context, sid string) (*Record, error)
+	// List 查询用户未过期的会话记录
+	List(ctx context.Context, userID string) ([]*Record, error)
+	// Delete 删除会话记录
+	Delete(ctx context.Context, items ...*Record) error
+	// Close 关闭索引
+	Close() error
+}
+
+type (
+	// RegistryOption 会话登记的配置项
+	RegistryOption func(*registryOptions)
+
+	registryOptions struct {
+		expired       int64         // 会话有效期(秒)
+		maxSessions   int           // 每个用户同时在线的最大会话数(0表示不限制)
+		policy        string        // 超出最大会话数时的处理方式
+		touchInterval time.Duration // 更新最后活动时间的最小间隔
+	}
+)
+
+// SetExpired 设置会话有效期(单位秒，与会话管理的配置一致)
+func SetExpired(expired int64) RegistryOption {
+	return func(o *registryOptions) {
+		o.expired = expired
+	}
+}
+
+// SetMaxSessions 设置每个用户同时在线的最大会话数及超出时的处理方式(PolicyKickOldest/PolicyReject)
+func SetMaxSessions(n int, policy string) RegistryOption {
+	return func(o *registryOptions) {
+		o.maxSessions = n
+		o.policy = policy
+	}
+}
+
+// SetTouchInterval 设置更新最后活动时间的最小间隔(避免每个请求都写入索引)
+func SetTouchInterval(interval time.Duration) RegistryOption {
+	return func(o *registryOptions) {
+		o.touchInterval = interval
+	}
+}
+
+// NewRegistry 创建会话登记，store为会话管理使用的存储，撤销会话时从中删除
+func NewRegistry(store session.ManagerStore, index Index, opts ...RegistryOption) *Registry {
+	o := &registryOptions{
+		expired:       7200,
+		policy:        PolicyKickOldest,
+		touchInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return &Registry{
+		opts:  o,
+		store: store,
+		index: index,
+	}
+}
+
+// Registry 会话登记：记录用户的在线会话，提供查询、撤销及同时在线会话数的限制
+type Registry struct {
+	opts  *registryOptions
+	store session.ManagerStore
+	index Index
+}
+
+// expiredAt 会话记录的过期时间(在会话有效期的基础上延长一个更新间隔，避免早于会话过期)
+func (r *Registry) expiredAt(now time.Time) int64 {
+	return now.Add(time.Duration(r.opts.expired)*time.Second + r.opts.touchInterval).Unix()
+}
+
+// List 查询用户在线的会话记录(按登录时间倒序)，会话已不存在的记录将被清理
+func (r *Registry) List(ctx context.Context, userID string) ([]*Record, error) {
+	items, err := r.index.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		list  []*Record
+		stale []*Record
+	)
+	for _, item := range items {
+		exists, err := r.store.Check(ctx, item.SessionID)
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			stale = append(stale, item)
+			continue
+		}
+		list = append(list, item)
+	}
+
+	if len(stale) > 0 {
+		if err := r.index.Delete(ctx, stale...); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LoginAt > list[j].LoginAt
+	})
+	return list, nil
+}
+
+// Allow 检查用户是否允许建立新的会话(仅拒绝策略下校验)，sid为登录前的会话ID(登录后被替换，不计入)
+func (r *Registry) Allow(ctx context.Context, userID, sid string) error {
+	if r.opts.maxSessions <= 0 || r.opts.policy != PolicyReject {
+		return nil
+	}
+
+	items, err := r.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	for _, item := range items {
+		if item.SessionID != sid {
+			n++
+		}
+	}
+	if n >= r.opts.maxSessions {
+		return ErrSessionLimit
+	}
+	return nil
+}
+
+// Add 登记登录后的会话(登录时间为空时使用当前时间)，oldSID为登录前的会话ID；撤销策略下超出最大会话数时撤销最早登录的会话
+func (r *Registry) Add(ctx context.Context, oldSID string, item *Record) error {
+	if oldSID != "" && oldSID != item.SessionID {
+		if err := r.index.Delete(ctx, &Record{SessionID: oldSID}); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	item.UserAgent = truncate(item.UserAgent, 255)
+	if item.RecordID == "" {
+		item.RecordID = uuid.New().String()
+	}
+	if item.LoginAt == 0 {
+		item.LoginAt = now.Unix()
+	}
+	item.LastActive = now.Unix()
+	item.ExpiredAt = r.expiredAt(now)
+	if err := r.index.Save(ctx, item); err != nil {
+		return err
+	}
+
+	if r.opts.maxSessions <= 0 || r.opts.policy != PolicyKickOldest {
+		return nil
+	}
+
+	items, err := r.List(ctx, item.UserID)
+	if err != nil {
+		return err
+	}
+
+	var kicks []*Record
+	for i := len(items) - 1; i >= 0 && len(items)-len(kicks) > r.opts.maxSessions; i-- {
+		if items[i].SessionID != item.SessionID {
+			kicks = append(kicks, items[i])
+		}
+	}
+	return r.revoke(ctx, kicks)
+}
+
+// Touch 更新会话的最后活动时间；会话未登记(或登记的用户不一致)时返回ErrSessionRevoked，
+// 撤销只能删除已登记的会话，未登记的会话不能再使用
+func (r *Registry) Touch(ctx context.Context, item *Record) error {
+	old, err := r.index.Get(ctx, item.SessionID)
+	if err != nil {
+		return err
+	} else if old == nil || old.UserID != item.UserID {
+		return ErrSessionRevoked
+	}
+
+	now := time.Now()
+	if now.Sub(time.Unix(old.LastActive, 0)) < r.opts.touchInterval {
+		return nil
+	}
+
+	item.RecordID = old.RecordID
+	item.LoginAt = old.LoginAt
+	item.UserAgent = truncate(item.UserAgent, 255)
+	item.LastActive = now.Unix()
+	item.ExpiredAt = r.expiredAt(now)
+	return r.index.Save(ctx, item)
+}
+
+// Remove 移除会话记录(用户登出时，会话由调用方清空)
+func (r *Registry) Remove(ctx context.Context, sid string) error {
+	return r.index.Delete(ctx, &Record{SessionID: sid})
+}
+
+// Revoke 撤销用户的会话(recordIDs为空时撤销全部会话)，返回撤销的会话数
+func (r *Registry) Revoke(ctx context.Context, userID string, recordIDs ...string) (int, error) {
+	items, err := r.index.List(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(recordIDs) > 0 {
+		ids := make(map[string]bool, len(recordIDs))
+		for _, id := range recordIDs {
+			ids[id] = true
+		}
+
+		var list []*Record
+		for _, item := range items {
+			if ids[item.RecordID] {
+				list = append(list, item)
+			}
+		}
+		items = list
+	}
+
+	if err := r.revoke(ctx, items); err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+// revoke 删除会话及会话记录
+func (r *Registry) revoke(ctx context.Context, items []*Record) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	for _, item := range items {
+		if err := r.store.Delete(ctx, item.SessionID); err != nil {
+			return err
+		}
+	}
+	return r.index.Delete(ctx, items...)
+}
+
+// truncate 截取字符串的前n个字符
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// Close 关闭会话索引
+func (r *Registry) Close() error {
+	return r.index.Close()
+}
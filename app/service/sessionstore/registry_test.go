@@ -0,0 +1,111 @@
+package sessionstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-session/session"
+)
+
+// login 创建会话并登记
+func login(t *testing.T, r *Registry, store session.ManagerStore, sid, userID string, loginAt int64) *Record {
+	ctx := context.Background()
+	s, _ := store.Create(ctx, sid, 60)
+	s.Set("user_id", userID)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	item := &Record{SessionID: sid, UserID: userID, IP: "127.0.0.1", LoginAt: loginAt}
+	if err := r.Add(ctx, "", item); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func checkSessions(t *testing.T, r *Registry, userID string, sids ...string) {
+	items, err := r.List(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(items) != len(sids) {
+		t.Fatalf("会话数错误：%d", len(items))
+	}
+	for i, item := range items {
+		if item.SessionID != sids[i] {
+			t.Fatalf("会话[%d]错误：%s", i, item.SessionID)
+		}
+	}
+}
+
+// testRegistry 验证会话登记的查询、撤销及同时在线会话数的限制
+func testRegistry(t *testing.T, store session.ManagerStore, index Index) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	r := NewRegistry(store, index, SetExpired(60), SetMaxSessions(2, PolicyKickOldest))
+	login(t, r, store, "s1", "u1", now-20)
+	login(t, r, store, "s2", "u1", now-10)
+	login(t, r, store, "s3", "u2", now-10)
+	checkSessions(t, r, "u1", "s2", "s1")
+
+	login(t, r, store, "s4", "u1", now)
+	checkSessions(t, r, "u1", "s4", "s2")
+	if ok, _ := store.Check(ctx, "s1"); ok {
+		t.Fatal("超出最大会话数时应撤销最早登录的会话")
+	}
+
+	reject := NewRegistry(store, index, SetExpired(60), SetMaxSessions(2, PolicyReject))
+	if err := reject.Allow(ctx, "u1", ""); err != ErrSessionLimit {
+		t.Fatalf("拒绝策略下超出最大会话数时应拒绝登录：%v", err)
+	} else if err := reject.Allow(ctx, "u1", "s2"); err != nil {
+		t.Fatalf("替换当前会话的登录不应被拒绝：%v", err)
+	}
+
+	items, _ := r.List(ctx, "u1")
+	if n, err := r.Revoke(ctx, "u1", items[0].RecordID); err != nil || n != 1 {
+		t.Fatalf("撤销指定会话发生错误：%d,%v", n, err)
+	}
+	checkSessions(t, r, "u1", "s2")
+
+	if n, err := r.Revoke(ctx, "u1"); err != nil || n != 1 {
+		t.Fatalf("撤销全部会话发生错误：%d,%v", n, err)
+	}
+	checkSessions(t, r, "u1")
+	if ok, _ := store.Check(ctx, "s2"); ok {
+		t.Fatal("撤销后会话不应存在")
+	}
+	checkSessions(t, r, "u2", "s3")
+
+	// 未登记的会话(撤销时无法删除)不能再使用
+	s, _ := store.Create(ctx, "s5", 60)
+	s.Set("user_id", "u1")
+	s.Save()
+	if err := r.Touch(ctx, &Record{SessionID: "s5", UserID: "u1"}); err != ErrSessionRevoked {
+		t.Fatalf("未登记的会话应已失效：%v", err)
+	}
+	checkSessions(t, r, "u1")
+
+	if err := r.Touch(ctx, &Record{SessionID: "s3", UserID: "u1"}); err != ErrSessionRevoked {
+		t.Fatalf("登记的用户不一致的会话应已失效：%v", err)
+	} else if err := r.Touch(ctx, &Record{SessionID: "s3", UserID: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 会话已被删除(如登出后过期)的记录在查询时清理
+	store.Delete(ctx, "s3")
+	checkSessions(t, r, "u2")
+	if item, _ := index.Get(ctx, "s3"); item != nil {
+		t.Fatal("会话不存在的记录应被清理")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	store := session.NewMemoryStore()
+	defer store.Close()
+
+	index := NewMemoryIndex(0)
+	defer index.Close()
+
+	testRegistry(t, store, index)
+}
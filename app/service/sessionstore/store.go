@@ -0,0 +1,268 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"moddns/app/service/mysql"
+	"sync"
+	"time"
+
+	"github.com/go-session/session"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ session.ManagerStore = &managerStore{}
+	_ session.Store        = &store{}
+)
+
+// sessionItem 会话存储项(与go-session/mysql的表结构兼容)
+type sessionItem struct {
+	ID        string `db:"id,primarykey,size:255"` // 会话ID
+	Value     string `db:"value,size:2048"`        // 会话数据(JSON)
+	ExpiredAt int64  `db:"expired_at"`             // 过期时间(秒)
+}
+
+// NewStore 创建基于数据库(MySQL、PostgreSQL)的会话存储，方言差异由db处理
+func NewStore(db *mysql.DB, tableName string, gcInterval time.Duration) session.ManagerStore {
+	if gcInterval <= 0 {
+		gcInterval = time.Minute * 10
+	}
+
+	db.CreateTableIfNotExists(sessionItem{}, tableName)
+	db.CreateTableIndex(tableName, "idx_expired_at", false, "expired_at")
+
+	s := &managerStore{
+		db:     db.Primary(), // 读取使用主库(避免副本延迟读取到过期的数据)
+		table:  tableName,
+		ticker: time.NewTicker(gcInterval),
+		done:   make(chan struct{}),
+	}
+	go s.gc()
+
+	return s
+}
+
+type managerStore struct {
+	db     *mysql.DB
+	table  string
+	ticker *time.Ticker
+	done   chan struct{} // 关闭时停止清理
+	once   sync.Once
+}
+
+func (s *managerStore) gc() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ticker.C:
+		}
+
+		s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expired_at<=?", s.table), time.Now().Unix())
+	}
+}
+
+// getValue 获取未过期的会话数据(不存在时为空)
+func (s *managerStore) getValue(ctx context.Context, sid string) (string, error) {
+	var item sessionItem
+	query := fmt.Sprintf("SELECT id,value,expired_at FROM %s WHERE id=?", s.table)
+	err := s.db.WithContext(ctx).SelectOne(&item, query, sid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "查询会话发生错误")
+	} else if time.Now().Unix() >= item.ExpiredAt {
+		return "", nil
+	}
+	return item.Value, nil
+}
+
+func (s *managerStore) Check(ctx context.Context, sid string) (bool, error) {
+	value, err := s.getValue(ctx, sid)
+	if err != nil {
+		return false, err
+	}
+	return value != "", nil
+}
+
+func (s *managerStore) Create(ctx context.Context, sid string, expired int64) (session.Store, error) {
+	return s.newStore(ctx, sid, expired, nil), nil
+}
+
+func (s *managerStore) Update(ctx context.Context, sid string, expired int64) (session.Store, error) {
+	value, err := s.getValue(ctx, sid)
+	if err != nil {
+		return nil, err
+	} else if value == "" {
+		return s.newStore(ctx, sid, expired, nil), nil
+	}
+
+	_, err = s.db.WithContext(ctx).Exec(fmt.Sprintf("UPDATE %s SET expired_at=? WHERE id=?", s.table),
+		expiredAt(expired), sid)
+	if err != nil {
+		return nil, errors.Wrap(err, "更新会话发生错误")
+	}
+
+	values, err := parseValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return s.newStore(ctx, sid, expired, values), nil
+}
+
+func (s *managerStore) Delete(ctx context.Context, sid string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	_, err := s.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE id=?", s.table), sid)
+	if err != nil {
+		return errors.Wrap(err, "删除会话发生错误")
+	}
+	return nil
+}
+
+func (s *managerStore) Refresh(ctx context.Context, oldsid, sid string, expired int64) (session.Store, error) {
+	value, err := s.getValue(ctx, oldsid)
+	if err != nil {
+		return nil, err
+	} else if value == "" {
+		return s.newStore(ctx, sid, expired, nil), nil
+	}
+
+	_, err = s.db.WithContext(ctx).Exec(fmt.Sprintf("INSERT INTO %s(id,value,expired_at) VALUES(?,?,?)", s.table),
+		sid, value, expiredAt(expired))
+	if err != nil {
+		return nil, errors.Wrap(err, "刷新会话发生错误")
+	}
+
+	err = s.Delete(ctx, oldsid)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return s.newStore(ctx, sid, expired, values), nil
+}
+
+// Close 停止清理过期会话(数据库连接由调用方关闭)
+func (s *managerStore) Close() error {
+	s.once.Do(func() {
+		s.ticker.Stop()
+		close(s.done)
+	})
+	return nil
+}
+
+func (s *managerStore) newStore(ctx context.Context, sid string, expired int64, values map[string]interface{}) *store {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+
+	return &store{
+		manager: s,
+		ctx:     ctx,
+		sid:     sid,
+		expired: expired,
+		values:  values,
+	}
+}
+
+type store struct {
+	sync.RWMutex
+	manager *managerStore
+	ctx     context.Context
+	sid     string
+	expired int64
+	values  map[string]interface{}
+}
+
+func (s *store) Context() context.Context {
+	return s.ctx
+}
+
+func (s *store) SessionID() string {
+	return s.sid
+}
+
+func (s *store) Set(key string, value interface{}) {
+	s.Lock()
+	s.values[key] = value
+	s.Unlock()
+}
+
+func (s *store) Get(key string) (interface{}, bool) {
+	s.RLock()
+	val, ok := s.values[key]
+	s.RUnlock()
+	return val, ok
+}
+
+func (s *store) Delete(key string) interface{} {
+	s.Lock()
+	v, ok := s.values[key]
+	if ok {
+		delete(s.values, key)
+	}
+	s.Unlock()
+	return v
+}
+
+func (s *store) Flush() error {
+	s.Lock()
+	s.values = make(map[string]interface{})
+	s.Unlock()
+	return s.Save()
+}
+
+// Save 保存会话数据(不存在时插入，存在时更新)
+func (s *store) Save() error {
+	var value string
+
+	s.RLock()
+	if len(s.values) > 0 {
+		buf, err := json.Marshal(s.values)
+		if err != nil {
+			s.RUnlock()
+			return errors.Wrap(err, "保存会话发生错误")
+		}
+		value = string(buf)
+	}
+	s.RUnlock()
+
+	db := s.manager.db
+	if s.ctx != nil {
+		db = db.WithContext(s.ctx)
+	}
+
+	query := db.Dialect().UpsertSQL(s.manager.table, []string{"id"},
+		[]string{"id", "value", "expired_at"}, []string{"value", "expired_at"})
+	_, err := db.Exec(query, s.sid, value, expiredAt(s.expired))
+	if err != nil {
+		return errors.Wrap(err, "保存会话发生错误")
+	}
+	return nil
+}
+
+func parseValue(value string) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	if len(value) > 0 {
+		err := json.Unmarshal([]byte(value), &values)
+		if err != nil {
+			return nil, errors.Wrap(err, "解析会话数据发生错误")
+		}
+	}
+	return values, nil
+}
+
+// expiredAt 根据有效期(秒)计算过期时间
+func expiredAt(expired int64) int64 {
+	return time.Now().Add(time.Duration(expired) * time.Second).Unix()
+}
@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// RFC 6238附录B的SHA1测试向量(8位验证码)
+func TestCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		if c := code(key, Step(time.Unix(v.unix, 0)), 8); c != v.code {
+			t.Errorf("时间[%d]的验证码错误：%s，期望：%s", v.unix, c, v.code)
+		}
+	}
+
+	secret := base32.StdEncoding.EncodeToString(key)
+	if c, err := Code(secret, 1); err != nil || c != "287082" {
+		t.Errorf("6位验证码错误：%s,%v", c, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	prev, _ := Code(secret, Step(now)-1)
+	if step, err := Validate(secret, prev, now, 1); err != nil || step != Step(now)-1 {
+		t.Fatalf("允许偏差内的验证码应通过：%d,%v", step, err)
+	}
+
+	old, _ := Code(secret, Step(now)-2)
+	if _, err := Validate(secret, old, now, 1); err != ErrInvalidCode {
+		t.Fatalf("超出偏差的验证码不应通过：%v", err)
+	}
+
+	if _, err := Validate(secret, "12345", now, 1); err != ErrInvalidCode {
+		t.Fatalf("位数错误的验证码不应通过：%v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("moddns", "admin@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/moddns:admin@example.com" {
+		t.Fatalf("URI错误：%s", u.String())
+	}
+
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "moddns" || q.Get("digits") != "6" {
+		t.Fatalf("URI参数错误：%s", u.RawQuery)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists := make(map[string]bool)
+	for _, c := range codes {
+		if len(c) != 14 || exists[c] {
+			t.Fatalf("恢复码错误：%s", c)
+		}
+		exists[c] = true
+	}
+
+	if NormalizeRecoveryCode(" AB12-cd34 ") != "ab12cd34" {
+		t.Fatal("恢复码规范化错误")
+	}
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"moddns/app/bll"
+	"moddns/app/schema"
+	"moddns/app/service/mysql"
+	"moddns/app/util"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const snapshotUsage = `用法：
+  snapshot export -c <配置文件> [-o <输出文件>] [--format yaml|json] [--users]
+  snapshot apply -c <配置文件> -f <快照文件> [--dry-run] [--prune]`
+
+// RunSnapshot 执行配置快照命令，args为snapshot之后的命令行参数
+func RunSnapshot(args []string, out io.Writer) error {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "apply") {
+		return errors.New(snapshotUsage)
+	}
+
+	fs := flag.NewFlagSet("snapshot "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	var (
+		configFile = fs.String("c", "", "配置文件(.json,.yaml,.toml)")
+		output     = fs.String("o", "", "导出的快照文件(默认输出到标准输出)")
+		format     = fs.String("format", "", "快照格式(yaml或json，默认根据文件扩展名确定)")
+		users      = fs.Bool("users", false, "导出时包含用户(不包含密码)")
+		file       = fs.String("f", "", "应用的快照文件")
+		dryRun     = fs.Bool("dry-run", false, "仅输出变更计划")
+		prune      = fs.Bool("prune", false, "删除快照中不存在的数据")
+	)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	} else if *configFile == "" {
+		return errors.New(snapshotUsage)
+	}
+
+	viper.SetConfigFile(*configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		return errors.Wrap(err, "加载配置文件发生错误")
+	}
+
+	InitSecrets()
+	db := InitDB()
+	defer db.Close()
+
+	// 共享缓存存储时，导入快照后使运行中服务的缓存失效
+	redisCli := InitRedis()
+	if redisCli != nil {
+		defer redisCli.Close()
+	}
+	queryCache := InitCache(db, redisCli)
+	defer queryCache.Close()
+
+	// 共享会话存储时，导入快照中停用或修改的用户的会话将被撤销
+	sessionStore, sessions := InitSession(db, redisCli)
+	defer sessionStore.Close()
+	defer sessions.Close()
+
+	_, _, ctlCommon := InitInject(db, queryCache, sessions)
+	snapshotBll := ctlCommon.SnapshotAPI.SnapshotBll
+	ctx := util.NewTraceIDContext(context.Background(), "snapshot")
+	ctx = mysql.NewReadPinContext(ctx, new(mysql.ReadPin))
+
+	if args[0] == "export" {
+		name := *format
+		if name == "" {
+			name = *output
+		}
+		f, err := bll.ParseSnapshotFormat(name)
+		if err != nil {
+			return err
+		}
+
+		snap, err := snapshotBll.Export(ctx, *users)
+		if err != nil {
+			return err
+		}
+
+		buf, err := bll.MarshalSnapshot(snap, f)
+		if err != nil {
+			return err
+		}
+
+		if *output == "" {
+			_, err = out.Write(buf)
+			return err
+		}
+		return ioutil.WriteFile(*output, buf, 0644)
+	}
+
+	if *file == "" {
+		return errors.New(snapshotUsage)
+	}
+
+	name := *format
+	if name == "" {
+		name = *file
+	}
+	f, err := bll.ParseSnapshotFormat(name)
+	if err != nil {
+		return err
+	}
+
+	buf, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return errors.Wrap(err, "读取快照文件发生错误")
+	}
+
+	snap, err := bll.UnmarshalSnapshot(buf, f)
+	if err != nil {
+		return err
+	}
+
+	plan, err := snapshotBll.Apply(ctx, snap, schema.SnapshotApplyParam{DryRun: *dryRun, Prune: *prune})
+	if err != nil {
+		return err
+	}
+
+	printSnapshotPlan(out, plan)
+	return nil
+}
+
+func printSnapshotPlan(out io.Writer, plan *schema.SnapshotPlan) {
+	if len(plan.Changes) == 0 {
+		fmt.Fprintln(out, "配置已经一致，无需变更")
+		return
+	}
+
+	signs := map[string]string{"create": "+", "update": "~", "delete": "-"}
+	kinds := map[string]string{"menu": "菜单", "role": "角色", "user": "用户"}
+	for _, c := range plan.Changes {
+		fmt.Fprintf(out, "%s %s %s", signs[c.Action], kinds[c.Kind], c.Key)
+		if len(c.Fields) > 0 {
+			fmt.Fprintf(out, " %v", c.Fields)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if plan.DryRun {
+		fmt.Fprintf(out, "共%d项变更(仅输出计划，未执行)\n", len(plan.Changes))
+	} else {
+		fmt.Fprintf(out, "已完成%d项变更\n", len(plan.Changes))
+	}
+}
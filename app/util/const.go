@@ -9,10 +9,16 @@ const (
 	ReleaseMode = "release"
 	// SessionKeyUserID 存储在session中的键(用户ID)
 	SessionKeyUserID = "user_id"
+	// SessionKeyTOTPChallenge 存储在session中的键(登录的两步验证挑战)
+	SessionKeyTOTPChallenge = "totp_challenge"
 	// ContextKeyUserID 存储上下文中的键(用户ID)
 	ContextKeyUserID = "user_id"
 	// ContextKeyURLMemo 存储上下文中的键(请求URL说明)
 	ContextKeyURLMemo = "url_memo"
 	// ContextKeyTraceID 存储上下文中的键(跟踪ID)
 	ContextKeyTraceID = "trace_id"
+	// ContextKeyRequestCache 存储上下文中的键(请求范围内的缓存)
+	ContextKeyRequestCache = "request_cache"
+	// ContextKeyReadPin 存储上下文中的键(请求范围内的主库读取标记)
+	ContextKeyReadPin = "read_pin"
 )
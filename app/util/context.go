@@ -2,11 +2,13 @@ package util
 
 import (
 	"context"
+	"sync"
 )
 
 type (
-	traceIDContextKey struct{}
-	userIDContextKey  struct{}
+	traceIDContextKey      struct{}
+	userIDContextKey       struct{}
+	requestCacheContextKey struct{}
 )
 
 // NewTraceIDContext 创建跟踪ID上下文
@@ -40,3 +42,24 @@ func FromUserIDContext(ctx context.Context) string {
 	}
 	return ""
 }
+
+// RequestCache 请求范围内的缓存(同一请求中的多次查询共享结果)
+type RequestCache struct {
+	sync.Map
+}
+
+// NewRequestCacheContext 创建请求缓存上下文
+func NewRequestCacheContext(ctx context.Context, cache *RequestCache) context.Context {
+	return context.WithValue(ctx, requestCacheContextKey{}, cache)
+}
+
+// FromRequestCacheContext 从上下文中获取请求缓存(不存在时返回nil)
+func FromRequestCacheContext(ctx context.Context) *RequestCache {
+	v := ctx.Value(requestCacheContextKey{})
+	if v != nil {
+		if c, ok := v.(*RequestCache); ok {
+			return c
+		}
+	}
+	return nil
+}
@@ -6,5 +6,22 @@ import (
 
 // 定义错误
 var (
-	ErrNotFound = errors.New("未找到资源")
+	ErrNotFound      = errors.New("未找到资源")
+	ErrBatchFailed   = errors.New("批量操作存在处理失败的数据，已全部回滚")
+	ErrConflict      = errors.New("数据已被修改，请刷新后重试")
+	ErrImportInvalid = errors.New("导入数据校验未通过")
 )
+
+// ConflictError 与已存在的数据冲突(如名称重复)，响应409
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// NewConflictError 创建数据冲突错误
+func NewConflictError(message string) error {
+	return &ConflictError{Message: message}
+}
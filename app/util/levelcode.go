@@ -0,0 +1,97 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+)
+
+// levelCodeWidth 分级码每级的位数，每级使用36进制(0-9a-z)编码
+var levelCodeWidth = 2
+
+// SetLevelCodeWidth 设置分级码每级的位数(默认为2位，每级最多1295个)，
+// 两位十进制的分级码与两位36进制的分级码兼容
+func SetLevelCodeWidth(width int) {
+	if width > 0 {
+		levelCodeWidth = width
+	}
+}
+
+// LevelCodeWidth 获取分级码每级的位数
+func LevelCodeWidth() int {
+	return levelCodeWidth
+}
+
+// encodeLevelSegment 将序号编码为指定位数的一级分级码，超出位数时返回空
+func encodeLevelSegment(n int64, width int) string {
+	s := strconv.FormatInt(n, 36)
+	if len(s) > width {
+		return ""
+	}
+	return strings.Repeat("0", width-len(s)) + s
+}
+
+// GetLevelCode 获取上级分级码(顶级为空)下未被占用的最小分级码，siblings为已存在的同级分级码，
+// 同级数量已达到上限时返回空
+func GetLevelCode(parentCode string, siblings []string) string {
+	used := make(map[int64]bool, len(siblings))
+	for _, code := range siblings {
+		if len(code) != len(parentCode)+levelCodeWidth || !strings.HasPrefix(code, parentCode) {
+			continue
+		}
+		if n, err := strconv.ParseInt(code[len(parentCode):], 36, 64); err == nil {
+			used[n] = true
+		}
+	}
+
+	for n := int64(1); ; n++ {
+		if used[n] {
+			continue
+		}
+		segment := encodeLevelSegment(n, levelCodeWidth)
+		if segment == "" {
+			return ""
+		}
+		return parentCode + segment
+	}
+}
+
+// ConvertLevelCode 将每级fromWidth位的分级码转换为当前位数，分级码无效或序号超出当前位数时返回false
+func ConvertLevelCode(levelCode string, fromWidth int) (string, bool) {
+	if fromWidth <= 0 || len(levelCode)%fromWidth != 0 {
+		return "", false
+	}
+
+	var s strings.Builder
+	for i := 0; i < len(levelCode); i += fromWidth {
+		// 序号从1开始，不允许符号
+		n, err := strconv.ParseUint(levelCode[i:i+fromWidth], 36, 63)
+		if err != nil || n == 0 {
+			return "", false
+		}
+
+		segment := encodeLevelSegment(int64(n), levelCodeWidth)
+		if segment == "" {
+			return "", false
+		}
+		s.WriteString(segment)
+	}
+	return s.String(), true
+}
+
+// ParseLevelCodes 解析分级码，返回分级码及其全部上级的分级码（去重）
+func ParseLevelCodes(levelCodes ...string) []string {
+	var allCodes []string
+	exists := make(map[string]bool)
+
+	for _, levelCode := range levelCodes {
+		for i := levelCodeWidth; i <= len(levelCode); i += levelCodeWidth {
+			code := levelCode[:i]
+			if !exists[code] {
+				exists[code] = true
+				allCodes = append(allCodes, code)
+			}
+		}
+	}
+
+	return allCodes
+}
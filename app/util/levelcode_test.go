@@ -0,0 +1,106 @@
+package util_test
+
+import (
+	"moddns/app/util"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// setLevelCodeWidth 设置分级码位数，返回恢复原位数的函数
+func setLevelCodeWidth(width int) func() {
+	old := util.LevelCodeWidth()
+	util.SetLevelCodeWidth(width)
+	return func() { util.SetLevelCodeWidth(old) }
+}
+
+// levelCodes 生成上级分级码下序号1至n的分级码
+func levelCodes(parentCode string, n int) []string {
+	codes := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		s := strconv.FormatInt(int64(i), 36)
+		if len(s) < util.LevelCodeWidth() {
+			s = "0" + s
+		}
+		codes = append(codes, parentCode+s)
+	}
+	return codes
+}
+
+func TestGetLevelCode(t *testing.T) {
+	defer setLevelCodeWidth(2)()
+
+	cases := []struct {
+		name       string
+		parentCode string
+		siblings   []string
+		expected   string
+	}{
+		{"顶级第一个", "", nil, "01"},
+		{"顶级追加", "", []string{"01", "02"}, "03"},
+		{"补齐空缺", "", []string{"01", "03"}, "02"},
+		{"下级", "01", []string{"01", "0101", "0102", "02"}, "0103"},
+		{"忽略其它上级及其它层级", "01", []string{"0201", "010101"}, "0101"},
+		{"忽略无效分级码", "", []string{"0!", "01"}, "02"},
+		{"十进制之后使用字母", "", levelCodes("", 9), "0a"},
+		{"最后一个", "01", levelCodes("01", 1294), "01zz"},
+		{"已达上限", "01", levelCodes("01", 1295), ""},
+	}
+
+	for _, c := range cases {
+		if code := util.GetLevelCode(c.parentCode, c.siblings); code != c.expected {
+			t.Errorf("%s：分级码应为[%s]，实际为[%s]", c.name, c.expected, code)
+		}
+	}
+}
+
+func TestConvertLevelCode(t *testing.T) {
+	cases := []struct {
+		name      string
+		width     int
+		levelCode string
+		fromWidth int
+		expected  string
+		ok        bool
+	}{
+		{"2位转换为3位", 3, "0102", 2, "001002", true},
+		{"2位的最后一个转换为3位", 3, "zz01zz", 2, "0zz0010zz", true},
+		{"3位转换为2位", 2, "00100a", 3, "010a", true},
+		{"超出当前位数", 2, "001zzz", 3, "", false},
+		{"长度无效", 3, "012", 2, "", false},
+		{"字符无效", 3, "01-2", 2, "", false},
+		{"序号为0", 3, "0100", 2, "", false},
+		{"原位数无效", 3, "0102", 0, "", false},
+	}
+
+	for _, c := range cases {
+		restore := setLevelCodeWidth(c.width)
+		code, ok := util.ConvertLevelCode(c.levelCode, c.fromWidth)
+		restore()
+		if code != c.expected || ok != c.ok {
+			t.Errorf("%s：应为[%s,%v]，实际为[%s,%v]", c.name, c.expected, c.ok, code, ok)
+		}
+	}
+}
+
+func TestParseLevelCodes(t *testing.T) {
+	cases := []struct {
+		name       string
+		width      int
+		levelCodes []string
+		expected   []string
+	}{
+		{"无分级码", 2, nil, nil},
+		{"去重并包含上级", 2, []string{"010203", "0102", "02"}, []string{"01", "0102", "010203", "02"}},
+		{"3位分级码", 3, []string{"001002", "002"}, []string{"001", "001002", "002"}},
+	}
+
+	for _, c := range cases {
+		restore := setLevelCodeWidth(c.width)
+		codes := util.ParseLevelCodes(c.levelCodes...)
+		restore()
+		if !reflect.DeepEqual(codes, c.expected) {
+			t.Errorf("%s：应为%v，实际为%v", c.name, c.expected, codes)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// 定义密钥引用前缀
+const (
+	SecretPrefixFile = "file:"
+	SecretPrefixEnv  = "env:"
+)
+
+// IsSecretRef 检查是否是密钥引用(file:/env:)
+func IsSecretRef(v string) bool {
+	return strings.HasPrefix(v, SecretPrefixFile) ||
+		strings.HasPrefix(v, SecretPrefixEnv)
+}
+
+// ResolveSecret 解析密钥引用，非引用的值原样返回
+// file:/run/secrets/mysql 读取文件内容(去除末尾换行)
+// env:MYSQL_PASSWORD 读取环境变量
+func ResolveSecret(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, SecretPrefixFile):
+		name := strings.TrimPrefix(v, SecretPrefixFile)
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("读取密钥文件[%s]发生错误：%s", name, err.Error())
+		}
+		return strings.TrimRight(string(buf), "\r\n"), nil
+	case strings.HasPrefix(v, SecretPrefixEnv):
+		name := strings.TrimPrefix(v, SecretPrefixEnv)
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("环境变量[%s]未设置", name)
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+// ResolveSecrets 递归解析配置值中的密钥引用，返回解析后的值及所有被解析的密钥
+func ResolveSecrets(v interface{}) (interface{}, []string, error) {
+	switch vv := v.(type) {
+	case string:
+		if !IsSecretRef(vv) {
+			return vv, nil, nil
+		}
+		s, err := ResolveSecret(vv)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, []string{s}, nil
+	case []string:
+		var secrets []string
+		result := make([]string, len(vv))
+		for i, item := range vv {
+			s, ss, err := ResolveSecrets(item)
+			if err != nil {
+				return nil, nil, err
+			}
+			result[i] = s.(string)
+			secrets = append(secrets, ss...)
+		}
+		return result, secrets, nil
+	case []interface{}:
+		var secrets []string
+		result := make([]interface{}, len(vv))
+		for i, item := range vv {
+			s, ss, err := ResolveSecrets(item)
+			if err != nil {
+				return nil, nil, err
+			}
+			result[i] = s
+			secrets = append(secrets, ss...)
+		}
+		return result, secrets, nil
+	case map[string]interface{}:
+		var secrets []string
+		result := make(map[string]interface{}, len(vv))
+		for k, item := range vv {
+			s, ss, err := ResolveSecrets(item)
+			if err != nil {
+				return nil, nil, err
+			}
+			result[k] = s
+			secrets = append(secrets, ss...)
+		}
+		return result, secrets, nil
+	}
+	return v, nil, nil
+}
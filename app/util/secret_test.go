@@ -0,0 +1,51 @@
+package util_test
+
+import (
+	"io/ioutil"
+	"moddns/app/util"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "mysql")
+	if err := ioutil.WriteFile(name, []byte("filepw\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("MODDNS_TEST_SECRET", "envpw")
+	defer os.Unsetenv("MODDNS_TEST_SECRET")
+
+	v, secrets, err := util.ResolveSecrets(map[string]interface{}{
+		"password": util.SecretPrefixFile + name,
+		"users":    []interface{}{"root", util.SecretPrefixEnv + "MODDNS_TEST_SECRET"},
+		"host":     "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := v.(map[string]interface{})
+	if m["password"] != "filepw" || m["host"] != "127.0.0.1" {
+		t.Fatalf("解析结果错误：%v", m)
+	}
+	if users := m["users"].([]interface{}); users[0] != "root" || users[1] != "envpw" {
+		t.Fatalf("解析结果错误：%v", users)
+	}
+	if len(secrets) != 2 {
+		t.Fatalf("解析的密钥错误：%v", secrets)
+	}
+
+	if _, _, err := util.ResolveSecrets(util.SecretPrefixFile + filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("密钥文件不存在时应返回错误")
+	}
+	if _, _, err := util.ResolveSecrets(util.SecretPrefixEnv + "MODDNS_TEST_MISSING"); err == nil {
+		t.Fatal("环境变量未设置时应返回错误")
+	}
+}
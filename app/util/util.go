@@ -1,8 +1,6 @@
 package util
 
 import (
-	"bytes"
-	"fmt"
 	"github.com/fatih/structs"
 	"reflect"
 	"strings"
@@ -29,88 +27,36 @@ func StructsToMapSlice(v interface{}) []map[string]interface{} {
 	return result
 }
 
-// GetLevelCode 获取分级码
-func GetLevelCode(orderLevelCodes []string) string {
-	l := len(orderLevelCodes)
-
-	if l == 0 {
-		return "01"
-	} else if l == 1 {
-		return orderLevelCodes[0] + "01"
-	}
-
-	root := orderLevelCodes[0]
-	toValue := func(i int) string {
-		if i < 10 {
-			return fmt.Sprintf("%s0%d", root, i)
-		}
-		return fmt.Sprintf("%s%d", root, i)
-	}
-
-	for i := 1; i < 100; i++ {
-		code := toValue(i)
-		if i < l &&
-			orderLevelCodes[i] == code {
-			continue
+// CheckPrefix 检查是否存在前缀
+func CheckPrefix(s string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
 		}
-		return code
 	}
-
-	return ""
+	return false
 }
 
-// ParseLevelCodes 解析分级码（去重）
-func ParseLevelCodes(levelCodes ...string) []string {
-	var allCodes []string
-
-	for _, levelCode := range levelCodes {
-		codes := parseLevelCode(levelCode)
-
-		for _, code := range codes {
-			var exists bool
-			for _, c := range allCodes {
-				if code == c {
-					exists = true
-					break
-				}
-			}
-
-			if !exists {
-				allCodes = append(allCodes, code)
-			}
-		}
+// DiffStrings 比较新旧字符串列表，返回新增及移除的元素
+func DiffStrings(oldItems, newItems []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(oldItems))
+	for _, s := range oldItems {
+		oldSet[s] = true
 	}
 
-	return allCodes
-}
-
-func parseLevelCode(levelCode string) []string {
-	if len(levelCode) < 2 {
-		return nil
+	newSet := make(map[string]bool, len(newItems))
+	for _, s := range newItems {
+		if !newSet[s] && !oldSet[s] {
+			added = append(added, s)
+		}
+		newSet[s] = true
 	}
-	var (
-		codes []string
-		root  bytes.Buffer
-	)
 
-	for i := range levelCode {
-		idx := i + 1
-		if idx%2 == 0 {
-			root.WriteString(levelCode[idx-2 : idx])
-			codes = append(codes, root.String())
+	for _, s := range oldItems {
+		if !newSet[s] {
+			removed = append(removed, s)
 		}
 	}
 
-	root.Reset()
-	return codes
+	return
 }
-
-// CheckPrefix 检查是否存在前缀
-func CheckPrefix(s string, prefixes ...string) bool {
-	for _, p := range prefixes {
-		if strings.HasPrefix(s, p) {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
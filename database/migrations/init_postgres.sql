@@ -0,0 +1,36 @@
+-- 创建数据库
+CREATE DATABASE ginadmin ENCODING 'UTF8';
+
+-- 创建g_menu表(PostgreSQL的索引名在模式内唯一，以表名作为前缀)
+CREATE TABLE IF NOT EXISTS g_menu (
+  id bigserial PRIMARY KEY,
+  record_id varchar(36),
+  code varchar(50),
+  name varchar(50),
+  type integer,
+  sequence integer,
+  icon varchar(200),
+  path varchar(200),
+  method varchar(50),
+  level_code varchar(100),
+  parent_id varchar(36),
+  is_hide integer,
+  status integer,
+  creator varchar(36),
+  created bigint,
+  updated bigint,
+  deleted bigint,
+  version bigint NOT NULL DEFAULT 1
+);
+CREATE UNIQUE INDEX IF NOT EXISTS g_menu_idx_record_id ON g_menu (record_id);
+CREATE INDEX IF NOT EXISTS g_menu_idx_code ON g_menu (code);
+CREATE INDEX IF NOT EXISTS g_menu_idx_name ON g_menu (name);
+CREATE INDEX IF NOT EXISTS g_menu_idx_type ON g_menu (type);
+CREATE INDEX IF NOT EXISTS g_menu_idx_parent_id ON g_menu (parent_id);
+CREATE INDEX IF NOT EXISTS g_menu_idx_status ON g_menu (status);
+CREATE INDEX IF NOT EXISTS g_menu_idx_deleted ON g_menu (deleted);
+CREATE INDEX IF NOT EXISTS g_menu_idx_is_hide ON g_menu (is_hide);
+CREATE UNIQUE INDEX IF NOT EXISTS g_menu_idx_level_code ON g_menu (level_code, deleted);
+
+-- 其它表在服务启动时自动创建，菜单等初始数据由配置快照导入(见database/snapshot.yaml)：
+-- ./moddns snapshot apply -c config/config.toml -f database/snapshot.yaml
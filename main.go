@@ -2,16 +2,16 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/spf13/viper"
 	"moddns/app"
+	"moddns/app/gen"
 	"moddns/app/logger"
-	"net/http"
 	"os"
 	"os/signal"
 	"sync/atomic"
 	"syscall"
-	"time"
 )
 
 var VERSION = "0.0.1"
@@ -27,6 +27,24 @@ func init() {
 }
 
 func main() {
+	// 代码生成：gen module <name> --fields ...
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		if err := gen.Run(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 配置快照：snapshot export|apply -c <配置文件> ...
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		if err := app.RunSnapshot(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
 	if configFile == "" {
 		panic("Please use -c or -config local config")
@@ -43,17 +61,16 @@ func main() {
 	signal.Notify(sc, syscall.SIGTERM, syscall.SIGQUIT)
 
 	httpHandler, closeHandle := app.Init(VERSION, traceID)
+	httpServer, closeServerHandle := app.InitHTTPServer(httpHandler, traceID)
 
 	go func() {
-		logger.System(traceID).Infof("HTTP Server Starting , Port:[%s]", viper.GetString("http_port"))
-
-		httpServer := &http.Server{
-			Addr:           viper.GetString("http_addr"),
-			Handler:        httpHandler,
-			ReadTimeout:    10 * time.Second,
-			WriteTimeout:   10 * time.Second,
-			MaxHeaderBytes: 1 << 20,
+		if httpServer.TLSConfig != nil {
+			logger.System(traceID).Infof("HTTPS Server Starting , Addr:[%s]", httpServer.Addr)
+			ac <- httpServer.ListenAndServeTLS("", "")
+			return
 		}
+
+		logger.System(traceID).Infof("HTTP Server Starting , Addr:[%s]", httpServer.Addr)
 		ac <- httpServer.ListenAndServe()
 	}()
 
@@ -67,6 +84,9 @@ func main() {
 		logger.System(traceID).Infof("Get the exit signal[%s]", sig.String())
 
 	}
+	if closeServerHandle != nil {
+		closeServerHandle()
+	}
 	if closeHandle != nil {
 		closeHandle()
 	}
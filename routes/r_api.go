@@ -4,17 +4,25 @@ import (
 	"github.com/casbin/casbin"
 	"github.com/gin-gonic/gin"
 	"moddns/app/http/ctl"
+	"moddns/app/service/ratelimit"
 )
 
 // APIV1Handler /api/v1路由
-func APIV1Handler(r *gin.Engine, enforcer *casbin.Enforcer, c *ctl.Common) {
-	v1 := r.Group("/api/v1/",
+func APIV1Handler(r *gin.Engine, enforcer *casbin.Enforcer, c *ctl.Common, limiter *ratelimit.Limiter) {
+	handlers := []gin.HandlerFunc{
+		ClientCertMiddleware(c.LoginAPI.LoginBll, c.LoginAPI.TOTPBll),
 		VerifySessionMiddleware(
+			c.LoginAPI.LoginBll,
 			"/api/v1/login",
 			"/api/v1/logout",
 		),
-		CasbinMiddleware(enforcer),
-	)
+	}
+	if limiter != nil {
+		handlers = append(handlers, RateLimitMiddleware(limiter))
+	}
+	handlers = append(handlers, CasbinMiddleware(enforcer))
+
+	v1 := r.Group("/api/v1/", handlers...)
 
 	// 注册路由
 	APILoginRouter(v1, c.LoginAPI)
@@ -22,4 +30,6 @@ func APIV1Handler(r *gin.Engine, enforcer *casbin.Enforcer, c *ctl.Common) {
 	APIDemoRouter(v1, c.DemoAPI)
 	APIMenuRouter(v1, c.MenuAPI)
 	APIUserRouter(v1, c.UserAPI)
+	APISnapshotRouter(v1, c.SnapshotAPI)
+	APICacheRouter(v1, c.CacheAPI)
 }
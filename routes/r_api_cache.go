@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"moddns/app/http/context"
+	"moddns/app/http/ctl"
+)
+
+// APICacheRouter 注册/cache路由
+func APICacheRouter(g *gin.RouterGroup, c *ctl.Cache) {
+	g.GET("/cache/stats", context.WrapContext(c.Stats, "查询缓存统计"))
+}
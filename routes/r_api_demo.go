@@ -14,4 +14,7 @@ func APIDemoRouter(g *gin.RouterGroup, demo *ctl.Demo) {
 	g.PUT("/demos/:id", context.WrapContext(demo.Update, "更新示例数据"))
 	g.DELETE("/demos/:id", context.WrapContext(demo.Delete, "删除示例数据"))
 	g.DELETE("/demos", context.WrapContext(demo.DeleteMany, "删除多条示例数据"))
+	g.GET("/recycle/demos", context.WrapContext(demo.QueryDeleted, "查询已删除示例数据"))
+	g.PATCH("/recycle/demos/:id/restore", context.WrapContext(demo.Restore, "恢复已删除示例数据"))
+	g.DELETE("/recycle/demos/:id", context.WrapContext(demo.Purge, "彻底删除示例数据"))
 }
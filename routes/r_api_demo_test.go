@@ -0,0 +1,59 @@
+package routes_test
+
+import (
+	"moddns/app/bll"
+	"moddns/app/http/ctl"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDemoIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	model := &modeltest.Demo{Items: []*schema.Demo{{RecordID: "d1", Code: "c1", Name: "n1", Version: 1}}}
+	app := gin.New()
+	routes.APIDemoRouter(app.Group("/api/v1"), &ctl.Demo{DemoBll: &bll.Demo{DemoModel: model}})
+
+	do := func(method, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/demos/d1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("查询响应错误：%d %s", w.Code, etag)
+	}
+
+	body := `{"code":"c1","name":"n2"}`
+	if w := do(http.MethodPut, etag, body); w.Code != http.StatusOK {
+		t.Fatalf("版本号一致时应更新成功：%d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "", ""); w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("更新后版本号应递增：%s", w.Header().Get("ETag"))
+	}
+
+	// 使用过期的ETag更新
+	if w := do(http.MethodPut, etag, body); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("版本号过期时应返回412：%d", w.Code)
+	}
+	if w := do(http.MethodPut, `"0"`, body); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("无效的If-Match应返回412：%d", w.Code)
+	}
+	if model.Items[0].Name != "n2" || model.Items[0].Version != 2 {
+		t.Fatalf("前置条件失败时不应更新：%+v", model.Items[0])
+	}
+}
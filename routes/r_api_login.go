@@ -9,7 +9,17 @@ import (
 // APILoginRouter 注册登录相关路由
 func APILoginRouter(g *gin.RouterGroup, login *ctl.Login) {
 	g.POST("/login", context.WrapContext(login.Login, "用户登录"))
+	g.POST("/login/2fa", context.WrapContext(login.LoginTOTP, "用户登录两步验证"))
+	g.GET("/login/oidc", context.WrapContext(login.LoginOIDC, "OIDC登录"))
+	g.GET("/login/oidc/callback", context.WrapContext(login.LoginOIDCCallback, "OIDC登录回调"))
+	g.POST("/login/oidc/token", context.WrapContext(login.LoginOIDCToken, "OIDC登录换取会话"))
 	g.POST("/logout", context.WrapContext(login.Logout, "用户登出"))
 	g.GET("/current/user", context.WrapContext(login.GetCurrentUserInfo, "获取当前用户信息"))
 	g.GET("/current/menus", context.WrapContext(login.QueryCurrentUserMenus, "查询当前用户菜单"))
+	g.GET("/current/sessions", context.WrapContext(login.QueryCurrentUserSessions, "查询当前用户会话"))
+	g.GET("/current/2fa", context.WrapContext(login.GetCurrentUserTOTP, "查询当前用户两步验证状态"))
+	g.POST("/current/2fa", context.WrapContext(login.BeginCurrentUserTOTP, "生成当前用户两步验证密钥"))
+	g.PUT("/current/2fa", context.WrapContext(login.EnableCurrentUserTOTP, "启用当前用户两步验证"))
+	g.DELETE("/current/2fa", context.WrapContext(login.DisableCurrentUserTOTP, "停用当前用户两步验证"))
+	g.POST("/current/2fa/recovery_codes", context.WrapContext(login.RegenerateCurrentUserRecoveryCodes, "重新生成当前用户恢复码"))
 }
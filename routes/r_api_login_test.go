@@ -0,0 +1,113 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"moddns/app/bll"
+	"moddns/app/http/ctl"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/app/service/sessionstore"
+	"moddns/app/service/totp"
+	"moddns/app/util"
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-session/session"
+	"github.com/spf13/viper"
+)
+
+// TestLoginTOTP 登录的两步验证：挑战超出最大尝试次数或过期后失效，验证码不能重复使用
+func TestLoginTOTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("session", map[string]interface{}{"header_name": "access-token", "sign": "test", "expired": 7200})
+	viper.Set("system_root_user", []string{"root", "123"})
+	defer viper.Set("session", nil)
+	defer viper.Set("system_root_user", nil)
+	defer viper.Set("totp", nil)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	totpModel := &modeltest.TOTP{Items: []*schema.UserTOTP{{UserID: "root", Secret: secret, Status: 1}}}
+
+	store := session.NewMemoryStore()
+	login := &bll.Login{Sessions: sessionstore.NewRegistry(store, sessionstore.NewMemoryIndex(0))}
+	totpBll := &bll.TOTP{TOTPModel: totpModel, UserModel: new(modeltest.User), RoleModel: new(modeltest.Role), LoginBll: login}
+
+	app := gin.New()
+	app.Use(routes.SessionMiddleware(store, "/api/v1/"))
+	routes.APILoginRouter(app.Group("/api/v1"), &ctl.Login{LoginBll: login, TOTPBll: totpBll})
+
+	do := func(path, sid string, body interface{}) (string, map[string]interface{}) {
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(buf)))
+		req.Header.Set("Content-Type", "application/json")
+		if sid != "" {
+			req.Header.Set("access-token", sid)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		var result map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("响应错误：%d %s", w.Code, w.Body.String())
+		}
+		return w.Header().Get("access-token"), result
+	}
+	begin := func() (string, string) {
+		sid, result := do("/api/v1/login", "", gin.H{"user_name": "root", "password": util.MD5HashString("123")})
+		if result["status"] != "2fa_required" {
+			t.Fatalf("已启用两步验证时应要求验证：%v", result)
+		}
+		return sid, result["challenge"].(string)
+	}
+	verify := func(sid, challenge, code string) interface{} {
+		_, result := do("/api/v1/login/2fa", sid, gin.H{"challenge": challenge, "code": code})
+		return result["status"]
+	}
+	code := func() string {
+		v, _ := totp.Code(secret, totp.Step(time.Now()))
+		return v
+	}
+
+	// 超出最大尝试次数后挑战失效，正确的验证码也需要重新登录
+	viper.Set("totp", map[string]interface{}{"max_attempts": 2})
+	sid, challenge := begin()
+	for i := 0; i < 2; i++ {
+		if status := verify(sid, challenge, "invalid"); status != "fail" {
+			t.Fatalf("第%d次验证应失败：%v", i+1, status)
+		}
+	}
+	if status := verify(sid, challenge, code()); status != "expired" {
+		t.Fatalf("超出最大尝试次数后挑战应失效：%v", status)
+	}
+
+	used := code()
+	sid, challenge = begin()
+	if status := verify(sid, challenge, "invalid"); status != "fail" {
+		t.Fatalf("验证应失败：%v", status)
+	} else if status := verify(sid, challenge, used); status != "OK" {
+		t.Fatalf("验证码正确时应完成登录：%v", status)
+	}
+
+	// 已使用的验证码不能用于再次登录
+	sid, challenge = begin()
+	if status := verify(sid, challenge, used); status != "fail" {
+		t.Fatalf("重复使用验证码应失败：%v", status)
+	}
+
+	// 挑战过期
+	viper.Set("totp", map[string]interface{}{"challenge_expired": 1})
+	totpModel.Items[0].LastStep = 0
+	sid, challenge = begin()
+	time.Sleep(time.Millisecond * 1100)
+	if status := verify(sid, challenge, code()); status != "expired" {
+		t.Fatalf("挑战过期后应重新登录：%v", status)
+	}
+}
@@ -14,6 +14,15 @@ func APIMenuRouter(g *gin.RouterGroup, menu *ctl.Menu) {
 	g.PUT("/menus/:id", context.WrapContext(menu.Update, "更新菜单数据"))
 	g.DELETE("/menus/:id", context.WrapContext(menu.Delete, "删除菜单数据"))
 	g.DELETE("/menus", context.WrapContext(menu.DeleteMany, "删除多条菜单数据"))
+	g.PATCH("/menus", context.WrapContext(menu.UpdateStatusMany, "更新多条菜单数据状态"))
 	g.PATCH("/menus/:id/enable", context.WrapContext(menu.Enable, "启用菜单数据"))
 	g.PATCH("/menus/:id/disable", context.WrapContext(menu.Disable, "禁用菜单数据"))
+	g.PATCH("/menus/:id/move", context.WrapContext(menu.Move, "移动菜单数据"))
+	g.POST("/menus/:id/copy", context.WrapContext(menu.Copy, "复制菜单数据"))
+	g.PATCH("/reorder/menus", context.WrapContext(menu.Reorder, "排序菜单数据"))
+	g.GET("/export/menus", context.WrapContext(menu.Export, "导出菜单数据"))
+	g.POST("/import/menus", context.WrapContext(menu.Import, "导入菜单数据"))
+	g.GET("/recycle/menus", context.WrapContext(menu.QueryDeleted, "查询已删除菜单数据"))
+	g.PATCH("/recycle/menus/:id/restore", context.WrapContext(menu.Restore, "恢复已删除菜单数据"))
+	g.DELETE("/recycle/menus/:id", context.WrapContext(menu.Purge, "彻底删除菜单数据"))
 }
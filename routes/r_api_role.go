@@ -14,6 +14,12 @@ func APIRoleRouter(g *gin.RouterGroup, role *ctl.Role) {
 	g.PUT("/roles/:id", context.WrapContext(role.Update, "更新角色数据"))
 	g.DELETE("/roles/:id", context.WrapContext(role.Delete, "删除角色数据"))
 	g.DELETE("/roles", context.WrapContext(role.DeleteMany, "删除多条角色数据"))
+	g.PATCH("/roles", context.WrapContext(role.UpdateStatusMany, "更新多条角色数据状态"))
 	g.PATCH("/roles/:id/enable", context.WrapContext(role.Enable, "启用角色数据"))
 	g.PATCH("/roles/:id/disable", context.WrapContext(role.Disable, "禁用角色数据"))
+	g.GET("/export/roles", context.WrapContext(role.Export, "导出角色数据"))
+	g.POST("/import/roles", context.WrapContext(role.Import, "导入角色数据"))
+	g.GET("/recycle/roles", context.WrapContext(role.QueryDeleted, "查询已删除角色数据"))
+	g.PATCH("/recycle/roles/:id/restore", context.WrapContext(role.Restore, "恢复已删除角色数据"))
+	g.DELETE("/recycle/roles/:id", context.WrapContext(role.Purge, "彻底删除角色数据"))
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"moddns/app/http/context"
+	"moddns/app/http/ctl"
+)
+
+// APISnapshotRouter 注册/snapshot路由
+func APISnapshotRouter(g *gin.RouterGroup, snapshot *ctl.Snapshot) {
+	g.GET("/snapshot", context.WrapContext(snapshot.Export, "导出配置快照"))
+	g.POST("/snapshot", context.WrapContext(snapshot.Apply, "应用配置快照"))
+}
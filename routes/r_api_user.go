@@ -14,6 +14,15 @@ func APIUserRouter(g *gin.RouterGroup, user *ctl.User) {
 	g.PUT("/users/:id", context.WrapContext(user.Update, "更新用户数据"))
 	g.DELETE("/users/:id", context.WrapContext(user.Delete, "删除用户数据"))
 	g.DELETE("/users", context.WrapContext(user.DeleteMany, "删除多条用户数据"))
+	g.PATCH("/users", context.WrapContext(user.UpdateStatusMany, "更新多条用户数据状态"))
 	g.PATCH("/users/:id/enable", context.WrapContext(user.Enable, "启用用户数据"))
 	g.PATCH("/users/:id/disable", context.WrapContext(user.Disable, "禁用用户数据"))
+	g.GET("/users/:id/sessions", context.WrapContext(user.QuerySessions, "查询用户会话"))
+	g.DELETE("/users/:id/sessions", context.WrapContext(user.RevokeSessions, "撤销用户会话"))
+	g.DELETE("/users/:id/2fa", context.WrapContext(user.ResetTOTP, "重置用户两步验证"))
+	g.GET("/export/users", context.WrapContext(user.Export, "导出用户数据"))
+	g.POST("/import/users", context.WrapContext(user.Import, "导入用户数据"))
+	g.GET("/recycle/users", context.WrapContext(user.QueryDeleted, "查询已删除用户数据"))
+	g.PATCH("/recycle/users/:id/restore", context.WrapContext(user.Restore, "恢复已删除用户数据"))
+	g.DELETE("/recycle/users/:id", context.WrapContext(user.Purge, "彻底删除用户数据"))
 }
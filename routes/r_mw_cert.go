@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"fmt"
+	"moddns/app/bll"
+	"moddns/app/http/context"
+	"moddns/app/service/cert"
+	"moddns/app/util"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// ClientCertMiddleware 客户端证书认证中间件(将已验证的客户端证书映射为用户身份)；
+// 客户端证书未配置为第二因素时，启用或被要求两步验证的用户不能仅通过客户端证书认证
+func ClientCertMiddleware(login *bll.Login, totp *bll.TOTP) gin.HandlerFunc {
+	config := viper.GetStringMap("http-tls")
+	field := util.T(config["client_user_field"]).String()
+	secondFactor := util.T(config["client_cert_second_factor"]).Bool()
+
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 ||
+			len(c.Request.TLS.VerifiedChains[0]) == 0 {
+			c.Next()
+			return
+		}
+
+		ctx := context.NewContext(c)
+		userName := cert.Identity(c.Request.TLS.VerifiedChains[0][0], field)
+		if userName == "" {
+			ctx.ResError(fmt.Errorf("无效的客户端证书"), http.StatusUnauthorized, 9999)
+			return
+		}
+
+		user, err := login.VerifyIdentity(ctx.NewContext(), userName)
+		if err != nil {
+			ctx.ResError(err, http.StatusUnauthorized, 9999)
+			return
+		}
+
+		if !secondFactor {
+			status, err := totp.Status(ctx.NewContext(), user.RecordID)
+			if err != nil {
+				ctx.ResError(errors.Wrap(err, "查询两步验证状态发生错误"), http.StatusInternalServerError)
+				return
+			} else if status.Enabled || status.Required {
+				ctx.ResError(fmt.Errorf("该用户需要两步验证，不能仅通过客户端证书认证"), http.StatusUnauthorized, 9999)
+				return
+			}
+		}
+
+		c.Set(util.ContextKeyUserID, user.RecordID)
+		c.Next()
+	}
+}
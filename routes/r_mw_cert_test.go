@@ -0,0 +1,82 @@
+package routes_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"moddns/app/bll"
+	"moddns/app/models/modeltest"
+	"moddns/app/schema"
+	"moddns/app/util"
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// TestClientCertMiddleware 客户端证书映射为用户身份；证书未配置为第二因素时，需要两步验证的用户不能仅通过证书认证
+func TestClientCertMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer viper.Set("http-tls", nil)
+
+	userModel := &modeltest.User{Items: []*schema.User{
+		{RecordID: "u1", UserName: "plain", Status: 1},
+		{RecordID: "u2", UserName: "enabled", Status: 1},
+		{RecordID: "u3", UserName: "required", Status: 1, RoleIDs: []string{"r1"}},
+		{RecordID: "u4", UserName: "disabled", Status: 2},
+	}}
+	login := &bll.Login{UserModel: userModel}
+	totp := &bll.TOTP{
+		TOTPModel: &modeltest.TOTP{Items: []*schema.UserTOTP{{UserID: "u2", Status: 1}}},
+		UserModel: userModel,
+		RoleModel: &modeltest.Role{Items: []*schema.Role{{RecordID: "r1", Status: 1, Require2FA: 1}}},
+		LoginBll:  login,
+	}
+
+	cases := []struct {
+		name         string
+		secondFactor bool
+		userName     string
+		status       int
+		userID       string
+	}{
+		{"未提供证书", false, "", http.StatusOK, ""},
+		{"无需两步验证", false, "plain", http.StatusOK, "u1"},
+		{"已启用两步验证", false, "enabled", http.StatusUnauthorized, ""},
+		{"角色要求两步验证", false, "required", http.StatusUnauthorized, ""},
+		{"证书作为第二因素时已启用两步验证", true, "enabled", http.StatusOK, "u2"},
+		{"证书作为第二因素时角色要求两步验证", true, "required", http.StatusOK, "u3"},
+		{"用户已停用", true, "disabled", http.StatusUnauthorized, ""},
+		{"用户不存在", false, "unknown", http.StatusUnauthorized, ""},
+	}
+
+	for _, c := range cases {
+		viper.Set("http-tls", map[string]interface{}{
+			"client_user_field":         "cn",
+			"client_cert_second_factor": c.secondFactor,
+		})
+
+		app := gin.New()
+		app.Use(routes.ClientCertMiddleware(login, totp))
+		app.GET("/user", func(ctx *gin.Context) {
+			ctx.String(http.StatusOK, ctx.GetString(util.ContextKeyUserID))
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		if c.userName != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: c.userName}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%s：状态码应为%d，实际为%d(%s)", c.name, c.status, w.Code, w.Body.String())
+		} else if c.status == http.StatusOK && w.Body.String() != c.userID {
+			t.Errorf("%s：用户应为[%s]，实际为[%s]", c.name, c.userID, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"moddns/app/util"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// CORSMiddleware 跨域请求中间件(允许携带凭证时必须明确配置允许的来源)
+func CORSMiddleware(allowPrefixes ...string) gin.HandlerFunc {
+	corsConfig := viper.GetStringMap("cors")
+
+	allowOrigins := viper.GetStringSlice("cors.allow_origins")
+	allowMethods := viper.GetStringSlice("cors.allow_methods")
+	if len(allowMethods) == 0 {
+		allowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+	}
+
+	allowHeaders := viper.GetStringSlice("cors.allow_headers")
+	if len(allowHeaders) == 0 {
+		allowHeaders = []string{"Content-Type", "X-Request-Id", "If-Match", "If-None-Match"}
+	}
+	// 会话标识存储在请求头中，必须允许跨域携带
+	if v := util.T(viper.GetStringMap("session")["header_name"]).String(); v != "" {
+		allowHeaders = append(allowHeaders, v)
+	}
+
+	exposeHeaders := viper.GetStringSlice("cors.expose_headers")
+	allowCredentials := util.T(corsConfig["allow_credentials"]).Bool()
+	maxAge := util.T(corsConfig["max_age"]).Int()
+
+	allowAll := false
+	for _, o := range allowOrigins {
+		if o == "*" {
+			allowAll = true
+			break
+		}
+	}
+	// 通配符与携带凭证同时配置时会向任意来源开放带凭证的请求
+	if allowAll && allowCredentials {
+		panic("跨域配置错误：允许携带凭证时不能使用通配符来源(*)，请明确配置允许的来源")
+	}
+
+	checkOrigin := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		for _, o := range allowOrigins {
+			if strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !util.CheckPrefix(c.Request.URL.Path, allowPrefixes...) {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if !checkOrigin(origin) {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if allowAll {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if allowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		// 预检请求
+		if c.Request.Method == http.MethodOptions &&
+			c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			c.Header("Access-Control-Allow-Methods", strings.Join(allowMethods, ","))
+			c.Header("Access-Control-Allow-Headers", strings.Join(allowHeaders, ","))
+			if maxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(maxAge))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if len(exposeHeaders) > 0 {
+			c.Header("Access-Control-Expose-Headers", strings.Join(exposeHeaders, ","))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package routes_test
+
+import (
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer viper.Reset()
+
+	viper.Set("cors", map[string]interface{}{"allow_credentials": true})
+	viper.Set("cors.allow_origins", []string{"*"})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("通配符来源与携带凭证同时配置时应拒绝启动")
+			}
+		}()
+		routes.CORSMiddleware("/api/")
+	}()
+
+	viper.Set("cors.allow_origins", []string{"http://a.example.com"})
+	app := gin.New()
+	app.Use(routes.CORSMiddleware("/api/"))
+	app.GET("/api/v1/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(origin string) http.Header {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/ping", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	if h := do("http://a.example.com"); h.Get("Access-Control-Allow-Origin") != "http://a.example.com" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("允许的来源响应头错误：%v", h)
+	}
+	if h := do("http://evil.example.com"); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("不允许的来源不应返回跨域响应头：%v", h)
+	}
+}
@@ -8,14 +8,31 @@ import (
 	"moddns/app/logger"
 	"moddns/app/util"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
+// 请求体中需要脱敏的字段
+var sensitiveBodyRegexp = regexp.MustCompile(`("(?i:password|old_password|new_password|ticket|code)"\s*:\s*)"[^"]*"`)
+
+// 请求URL中需要脱敏的查询参数(按路径)
+var sensitiveQueryParams = map[string][]string{
+	"/api/v1/login/oidc/callback": {"code", "state"}, // OIDC授权码及防止跨站请求伪造的state
+}
+
 // LoggerMiddleware GIN的日志中间件
 func LoggerMiddleware(allowPrefixes []string, skipPrefixes ...string) gin.HandlerFunc {
+	sensitiveHeaders := []string{"Authorization", "Cookie"}
+	if v := util.T(viper.GetStringMap("session")["header_name"]).String(); v != "" {
+		sensitiveHeaders = append(sensitiveHeaders, v)
+	}
+
 	return func(c *gin.Context) {
 		p := c.Request.URL.Path
 		if !util.CheckPrefix(p, allowPrefixes...) ||
@@ -28,9 +45,9 @@ func LoggerMiddleware(allowPrefixes []string, skipPrefixes ...string) gin.Handle
 		fields := logrus.Fields{}
 		fields["ip"] = c.ClientIP()
 		fields["method"] = c.Request.Method
-		fields["url"] = c.Request.URL.String()
+		fields["url"] = redactURL(c.Request.URL)
 		fields["proto"] = c.Request.Proto
-		fields["header"] = c.Request.Header
+		fields["header"] = redactHeader(c.Request.Header, sensitiveHeaders...)
 		fields["user_agent"] = c.GetHeader("User-Agent")
 
 		if m := c.Request.Method; m == http.MethodPost ||
@@ -43,7 +60,7 @@ func LoggerMiddleware(allowPrefixes []string, skipPrefixes ...string) gin.Handle
 					buf := bytes.NewBuffer(body)
 					c.Request.Body = ioutil.NopCloser(buf)
 					fields["content_length"] = c.Request.ContentLength
-					fields["body"] = string(body)
+					fields["body"] = sensitiveBodyRegexp.ReplaceAllString(string(body), `$1"`+logger.RedactedText+`"`)
 				}
 			}
 		}
@@ -69,3 +86,38 @@ func LoggerMiddleware(allowPrefixes []string, skipPrefixes ...string) gin.Handle
 		)
 	}
 }
+
+// redactURL 对请求URL中的敏感查询参数脱敏
+func redactURL(u *url.URL) string {
+	keys := sensitiveQueryParams[u.Path]
+	if len(keys) == 0 || u.RawQuery == "" {
+		return u.String()
+	}
+
+	query := u.Query()
+	for _, k := range keys {
+		if _, ok := query[k]; ok {
+			query.Set(k, logger.RedactedText)
+		}
+	}
+
+	v := *u
+	v.RawQuery = query.Encode()
+	return v.String()
+}
+
+// redactHeader 复制请求头并对敏感项脱敏
+func redactHeader(header http.Header, keys ...string) http.Header {
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		h[k] = v
+	}
+
+	for _, k := range keys {
+		k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+		if _, ok := h[k]; ok {
+			h[k] = []string{logger.RedactedText}
+		}
+	}
+	return h
+}
@@ -0,0 +1,82 @@
+package routes_test
+
+import (
+	"bytes"
+	"moddns/app/logger"
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoggerMiddlewareRedact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	l := logger.Default()
+	out := l.Out
+	l.Out = &buf
+	defer func() { l.Out = out }()
+
+	app := gin.New()
+	app.Use(routes.LoggerMiddleware([]string{"/api/"}))
+	app.POST("/api/v1/login", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	body := `{"user_name":"root","Password":"p1","old_password" : "p2","new_password":"p3","ticket":"t1","code":"654321"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", "oidc_flow=c1")
+	req.Header.Set("Authorization", "Basic a1")
+	app.ServeHTTP(httptest.NewRecorder(), req)
+
+	s := buf.String()
+	for _, v := range []string{"p1", "p2", "p3", "t1", "654321", "c1", "a1"} {
+		if strings.Contains(s, v) {
+			t.Fatalf("日志中的敏感内容[%s]应脱敏：%s", v, s)
+		}
+	}
+	if !strings.Contains(s, "root") {
+		t.Fatalf("非敏感字段不应脱敏：%s", s)
+	}
+}
+
+func TestLoggerMiddlewareRedactQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	l := logger.Default()
+	out := l.Out
+	l.Out = &buf
+	defer func() { l.Out = out }()
+
+	app := gin.New()
+	app.Use(routes.LoggerMiddleware([]string{"/api/"}))
+	app.GET("/api/v1/login/oidc/callback", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	app.GET("/api/v1/menus", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, u := range []string{"/api/v1/login/oidc/callback?code=c1&state=s1&session_state=x1", "/api/v1/menus?code=m1"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u, nil))
+	}
+
+	s := buf.String()
+	for _, v := range []string{"c1", "s1"} {
+		if strings.Contains(s, v) {
+			t.Fatalf("回调地址中的敏感参数[%s]应脱敏：%s", v, s)
+		}
+	}
+	// 其它参数及其它路径的同名参数不脱敏
+	for _, v := range []string{"session_state=x1", "code=m1"} {
+		if !strings.Contains(s, v) {
+			t.Fatalf("参数[%s]不应脱敏：%s", v, s)
+		}
+	}
+}
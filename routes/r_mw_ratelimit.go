@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"moddns/app/http/context"
+	"moddns/app/logger"
+	"moddns/app/service/ratelimit"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware 限流中间件(令牌桶)，在权限校验之前获取令牌，被拒绝的请求同样计入
+// 规则按路由说明(WrapContext memo)或路由前缀匹配，优先以用户ID作为限流主体，未登录时使用客户端IP
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := limiter.Match(c.Request.URL.Path, context.ResolveMemo(c))
+		if rule == nil {
+			c.Next()
+			return
+		}
+
+		ctx := context.NewContext(c)
+		identity := "ip:" + c.ClientIP()
+		if userID := ctx.GetUserID(); userID != "" {
+			identity = "user:" + userID
+		}
+
+		result, err := limiter.Take(ctx.NewContext(), rule, identity)
+		if err != nil {
+			// 限流存储不可用时放行请求，避免影响正常业务
+			logger.SystemWithContext(ctx.NewContext()).Errorf("限流检查发生错误：%s", err.Error())
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(result.ResetAfter).Unix(), 10))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			ctx.ResError(fmt.Errorf("请求过于频繁，请稍后再试"), http.StatusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
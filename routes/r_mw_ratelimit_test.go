@@ -0,0 +1,70 @@
+package routes_test
+
+import (
+	"moddns/app/http/context"
+	"moddns/app/service/ratelimit"
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(0), nil,
+		&ratelimit.Rule{Name: "login", Memo: "用户登录", Rate: 0.001, Burst: 2},
+		&ratelimit.Rule{Name: "raw", Prefix: "/api/v1/raw", Rate: 0.001, Burst: 1},
+	)
+	defer limiter.Close()
+
+	var handled int
+	app := gin.New()
+	app.Use(routes.RateLimitMiddleware(limiter))
+	app.Use(func(c *gin.Context) {
+		// 模拟权限校验拒绝请求
+		if c.Request.URL.Path == "/api/v1/denied" {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	})
+	app.POST("/api/v1/login", context.WrapContext(func(ctx *context.Context) {
+		handled++
+		ctx.ResOK()
+	}, "用户登录"))
+	app.POST("/api/v1/denied", context.WrapContext(func(ctx *context.Context) {
+		ctx.ResOK()
+	}, "用户登录"))
+	app.GET("/api/v1/raw", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(method, path string) int {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	// 被权限校验拒绝的请求同样消耗令牌
+	if code := do(http.MethodPost, "/api/v1/denied"); code != http.StatusForbidden {
+		t.Fatalf("响应状态错误：%d", code)
+	}
+	if code := do(http.MethodPost, "/api/v1/login"); code != http.StatusOK {
+		t.Fatalf("响应状态错误：%d", code)
+	}
+	if code := do(http.MethodPost, "/api/v1/login"); code != http.StatusTooManyRequests {
+		t.Fatalf("令牌耗尽后应被限流：%d", code)
+	}
+	if handled != 1 {
+		t.Fatalf("仅解析路由说明时不应处理请求：%d", handled)
+	}
+
+	// 非WrapContext的处理函数按路由前缀限流
+	if code := do(http.MethodGet, "/api/v1/raw"); code != http.StatusOK {
+		t.Fatalf("响应状态错误：%d", code)
+	}
+	if code := do(http.MethodGet, "/api/v1/raw"); code != http.StatusTooManyRequests {
+		t.Fatalf("令牌耗尽后应被限流：%d", code)
+	}
+}
@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"fmt"
+	"moddns/app/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// SecureHeadersMiddleware 安全响应头中间件
+func SecureHeadersMiddleware() gin.HandlerFunc {
+	secureConfig := viper.GetStringMap("secure-headers")
+
+	headers := make(map[string]string)
+	headers["X-Content-Type-Options"] = "nosniff"
+	headers["X-Frame-Options"] = "DENY"
+	headers["Content-Security-Policy"] = "default-src 'none'; frame-ancestors 'none'"
+	headers["Referrer-Policy"] = "no-referrer"
+
+	if v := util.T(secureConfig["frame_options"]).String(); v != "" {
+		headers["X-Frame-Options"] = v
+	}
+	if v := util.T(secureConfig["content_security_policy"]).String(); v != "" {
+		headers["Content-Security-Policy"] = v
+	}
+	if v := util.T(secureConfig["referrer_policy"]).String(); v != "" {
+		headers["Referrer-Policy"] = v
+	}
+
+	var hsts string
+	if v := util.T(secureConfig["hsts_max_age"]).Int(); v > 0 {
+		hsts = fmt.Sprintf("max-age=%d", v)
+		if util.T(secureConfig["hsts_include_subdomains"]).Bool() {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(c *gin.Context) {
+		for k, v := range headers {
+			c.Header(k, v)
+		}
+
+		// HSTS仅在HTTPS连接(或经由HTTPS代理)下有效
+		if hsts != "" && (c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https") {
+			c.Header("Strict-Transport-Security", hsts)
+		}
+		c.Next()
+	}
+}
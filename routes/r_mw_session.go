@@ -2,20 +2,21 @@ package routes
 
 import (
 	"fmt"
+	"moddns/app/bll"
 	"moddns/app/http/context"
-	"moddns/app/service/mysql"
+	"moddns/app/logger"
+	"moddns/app/service/sessionstore"
 	"moddns/app/util"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-session/gin-session"
-	mysession "github.com/go-session/mysql"
 	"github.com/go-session/session"
 	"github.com/spf13/viper"
 )
 
 // SessionMiddleware session中间件
-func SessionMiddleware(db *mysql.DB, allowPrefixes ...string) gin.HandlerFunc {
+func SessionMiddleware(store session.ManagerStore, allowPrefixes ...string) gin.HandlerFunc {
 	sessionConfig := viper.GetStringMap("session")
 
 	var opts []session.Option
@@ -26,11 +27,8 @@ func SessionMiddleware(db *mysql.DB, allowPrefixes ...string) gin.HandlerFunc {
 	opts = append(opts, session.SetSign(util.T(sessionConfig["sign"]).Bytes()))
 	opts = append(opts, session.SetExpired(util.T(sessionConfig["expired"]).Int64()))
 
-	if util.T(sessionConfig["store"]).String() == "mysql" {
-		tableName := fmt.Sprintf("%s_%s",
-			util.T(viper.GetStringMap("mysql")["table_prefix"]).String(),
-			util.T(sessionConfig["table"]).String())
-		opts = append(opts, session.SetStore(mysession.NewStoreWithDB(db.Db, tableName, 0)))
+	if store != nil {
+		opts = append(opts, session.SetStore(store))
 	}
 
 	ginConfig := ginsession.DefaultConfig
@@ -45,15 +43,25 @@ func SessionMiddleware(db *mysql.DB, allowPrefixes ...string) gin.HandlerFunc {
 	return ginsession.NewWithConfig(ginConfig, opts...)
 }
 
-// VerifySessionMiddleware 验证session中间件
-func VerifySessionMiddleware(skipPrefixes ...string) gin.HandlerFunc {
+// VerifySessionMiddleware 验证session中间件(同时更新会话的最后活动时间，已失效的会话视为未登录)
+func VerifySessionMiddleware(login *bll.Login, skipPrefixes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 已通过其它方式(如客户端证书)认证
+		if c.GetString(util.ContextKeyUserID) != "" {
+			c.Next()
+			return
+		}
+
 		ctx := context.NewContext(c)
 		store := ginsession.FromContext(c)
 		userID, ok := store.Get(util.SessionKeyUserID)
+		loggedIn := ok && userID != nil
+		if loggedIn {
+			loggedIn = touchSession(ctx, login, store, fmt.Sprint(userID))
+		}
 
 		if viper.GetString("run_mode") == util.DebugMode {
-			if !ok || userID == nil {
+			if !loggedIn {
 				if rootUser := viper.GetStringSlice("system_root_user"); len(rootUser) > 0 {
 					userID = rootUser[0]
 				}
@@ -63,7 +71,7 @@ func VerifySessionMiddleware(skipPrefixes ...string) gin.HandlerFunc {
 			return
 		}
 
-		if !ok || userID == nil {
+		if !loggedIn {
 			if util.CheckPrefix(c.Request.URL.Path, skipPrefixes...) {
 				c.Next()
 				return
@@ -75,3 +83,23 @@ func VerifySessionMiddleware(skipPrefixes ...string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// touchSession 更新会话的最后活动时间，会话已失效时清空会话并返回false(其它错误仅记录日志)
+func touchSession(ctx *context.Context, login *bll.Login, store session.Store, userID string) bool {
+	nctx := ctx.NewContext()
+	err := login.TouchSession(nctx, &sessionstore.Record{
+		SessionID: store.SessionID(),
+		UserID:    userID,
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
+	if err == sessionstore.ErrSessionRevoked {
+		if err := store.Flush(); err != nil {
+			logger.SystemWithContext(nctx).Warnf("清空已失效的会话发生错误：%s", err.Error())
+		}
+		return false
+	} else if err != nil {
+		logger.SystemWithContext(nctx).Warnf("更新会话活动时间发生错误：%s", err.Error())
+	}
+	return true
+}
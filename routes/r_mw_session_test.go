@@ -0,0 +1,70 @@
+package routes_test
+
+import (
+	"context"
+	"moddns/app/bll"
+	"moddns/app/service/sessionstore"
+	"moddns/app/util"
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-session/gin-session"
+	"github.com/go-session/session"
+	"github.com/spf13/viper"
+)
+
+// TestVerifySessionRevoked 撤销的会话及未登记的会话不能再使用
+func TestVerifySessionRevoked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("session", map[string]interface{}{"header_name": "access-token", "sign": "test", "expired": 7200})
+	defer viper.Set("session", nil)
+
+	store := session.NewMemoryStore()
+	sessions := sessionstore.NewRegistry(store, sessionstore.NewMemoryIndex(0))
+	login := &bll.Login{Sessions: sessions}
+
+	app := gin.New()
+	app.Use(routes.SessionMiddleware(store, "/api/v1/"))
+	app.GET("/api/v1/login", func(c *gin.Context) {
+		s, _ := ginsession.Refresh(c)
+		s.Set(util.SessionKeyUserID, "u1")
+		s.Save()
+		if c.Query("register") == "1" {
+			login.AddSession(context.Background(), "", &sessionstore.Record{SessionID: s.SessionID(), UserID: "u1"})
+		}
+	})
+	app.GET("/api/v1/current", routes.VerifySessionMiddleware(login), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(util.ContextKeyUserID))
+	})
+
+	do := func(path, sid string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if sid != "" {
+			req.Header.Set("access-token", sid)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		return w
+	}
+
+	sid := do("/api/v1/login?register=1", "").Header().Get("access-token")
+	if w := do("/api/v1/current", sid); w.Code != http.StatusOK || w.Body.String() != "u1" {
+		t.Fatalf("已登记的会话应通过验证：%d %s", w.Code, w.Body.String())
+	}
+
+	// 登记失败(未登记)的会话撤销时无法删除，不能使用
+	unregistered := do("/api/v1/login", "").Header().Get("access-token")
+	if w := do("/api/v1/current", unregistered); w.Code != http.StatusUnauthorized {
+		t.Fatalf("未登记的会话应视为未登录：%d", w.Code)
+	}
+
+	if n, err := sessions.Revoke(context.Background(), "u1"); err != nil || n != 1 {
+		t.Fatalf("撤销会话发生错误：%d,%v", n, err)
+	}
+	if w := do("/api/v1/current", sid); w.Code != http.StatusUnauthorized {
+		t.Fatalf("撤销的会话应视为未登录：%d", w.Code)
+	}
+}
@@ -4,9 +4,20 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"moddns/app/util"
+	"regexp"
+	"strings"
+)
+
+// 跟踪ID的最大长度
+const maxTraceIDLength = 64
+
+var (
+	traceIDRegexp     = regexp.MustCompile(`^[A-Za-z0-9\-_.:]+$`)
+	traceparentRegexp = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
 )
 
 // TraceMiddleware 跟踪ID中间件
+// 优先使用请求头X-Request-Id，其次使用W3C traceparent中的trace-id，都无效时生成新的跟踪ID
 func TraceMiddleware(allowPrefixes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if !util.CheckPrefix(c.Request.URL.Path, allowPrefixes...) {
@@ -14,11 +25,31 @@ func TraceMiddleware(allowPrefixes ...string) gin.HandlerFunc {
 			return
 		}
 
-		traceID := c.Query("X-Request-Id")
+		traceID := c.GetHeader("X-Request-Id")
+		if !validTraceID(traceID) {
+			traceID = parseTraceparent(c.GetHeader("traceparent"))
+		}
 		if traceID == "" {
 			traceID = uuid.New().String()
 		}
+
 		c.Set(util.ContextKeyTraceID, traceID)
+		c.Header("X-Request-Id", traceID)
 		c.Next()
 	}
 }
+
+func validTraceID(traceID string) bool {
+	return traceID != "" &&
+		len(traceID) <= maxTraceIDLength &&
+		traceIDRegexp.MatchString(traceID)
+}
+
+// parseTraceparent 解析W3C traceparent中的trace-id
+func parseTraceparent(traceparent string) string {
+	m := traceparentRegexp.FindStringSubmatch(strings.TrimSpace(traceparent))
+	if len(m) != 2 || strings.Trim(m[1], "0") == "" {
+		return ""
+	}
+	return m[1]
+}
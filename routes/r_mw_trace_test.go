@@ -0,0 +1,62 @@
+package routes_test
+
+import (
+	"moddns/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestTraceMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	app := gin.New()
+	app.Use(routes.TraceMiddleware("/api/"))
+	app.GET("/api/v1/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	valid := "00-" + traceID + "-00f067aa0ba902b7-01"
+
+	cases := []struct {
+		name        string
+		requestID   string
+		traceparent string
+		expected    string // 为空时应生成新的跟踪ID
+	}{
+		{"请求ID", "req-1:a_b.c", "", "req-1:a_b.c"},
+		{"请求ID优先", "req-1", valid, "req-1"},
+		{"traceparent", "", valid, traceID},
+		{"traceparent首尾空格", "", " " + valid + " ", traceID},
+		{"请求ID无效时使用traceparent", "bad id", valid, traceID},
+		{"请求ID过长", strings.Repeat("a", 65), "", ""},
+		{"请求ID包含换行", "a\nb", "", ""},
+		{"traceparent大写", "", strings.ToUpper(valid), ""},
+		{"trace-id全为0", "", "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01", ""},
+		{"traceparent格式错误", "", "00-" + traceID + "-01", ""},
+		{"都未提供", "", "", ""},
+	}
+	for _, item := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/ping", nil)
+		if item.requestID != "" {
+			req.Header.Set("X-Request-Id", item.requestID)
+		}
+		if item.traceparent != "" {
+			req.Header.Set("traceparent", item.traceparent)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		v := w.Header().Get("X-Request-Id")
+		if item.expected != "" {
+			if v != item.expected {
+				t.Fatalf("%s：跟踪ID错误：%s", item.name, v)
+			}
+		} else if _, err := uuid.Parse(v); err != nil {
+			t.Fatalf("%s：应生成新的跟踪ID：%s", item.name, v)
+		}
+	}
+}